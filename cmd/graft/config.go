@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/voxelbrain/goptions"
+	"github.com/wayneeseguin/graft/internal/config"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+type configOpts struct {
+	JSON bool               `goptions:"--json, description='Output settings as JSON'"`
+	Help bool               `goptions:"--help, -h"`
+	Args goptions.Remainder `goptions:"description='show: print the effective settings and where each came from; validate: check them'"`
+}
+
+// settings is the configuration graft is running with, from .graft.yml
+// files, the environment and flags. It is resolved at the start of main, for
+// the commands in usesSettings, and is nil for the others.
+var settings *config.Effective
+
+// usesSettings are the commands that read settings. The others run the same
+// whatever .graft.yml files there are, even invalid ones.
+var usesSettings = map[goptions.Verbs]bool{
+	"merge":     true,
+	"fan":       true,
+	"explain":   true,
+	"deps":      true,
+	"diff":      true,
+	"vaultinfo": true,
+	"refsinfo":  true,
+	"secrets":   true,
+	"config":    true,
+	"targets":   true,
+	"lint":      true,
+}
+
+// appliedSettings are the settings, and the sections of settings, that graft
+// acts on. config show and validate leave out the rest of what the files may
+// hold, like logging and parser settings, since no command reads them.
+var appliedSettings = []string{
+	"engine.vault",
+	"engine.aws",
+	"engine.secrets",
+	"engine.dataflow_order",
+	"engine.color_output",
+	"performance.enable_caching",
+	"performance.cache.expression_cache_size",
+	"performance.concurrency.max_workers",
+	"targets",
+	"merge",
+}
+
+// appliedSetting reports whether graft acts on the setting key
+func appliedSetting(key string) bool {
+	for _, applied := range appliedSettings {
+		if key == applied || strings.HasPrefix(key, applied+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSettings resolves the configuration for a run started in the working
+// directory
+func loadSettings() (*config.Effective, error) {
+	s, err := config.Resolve(".")
+	if err != nil {
+		return nil, ansi.Errorf("@R{Invalid configuration}: %s", err.Error())
+	}
+	return s, nil
+}
+
+// cmdConfig runs `graft config show` or `graft config validate`, returning
+// what to print and the exit code
+func cmdConfig(options configOpts, s *config.Effective, loadErr error) (string, int) {
+	action := "show"
+	if len(options.Args) > 0 {
+		action = options.Args[0]
+	}
+
+	switch action {
+	case "show":
+		if loadErr != nil {
+			return loadErr.Error(), 2
+		}
+		out, err := formatSettings(s, options.JSON)
+		if err != nil {
+			return err.Error(), 2
+		}
+		return out, 0
+
+	case "validate":
+		if loadErr != nil {
+			return loadErr.Error(), 2
+		}
+		err := config.Validate(s.Config)
+		if err == nil {
+			return ansi.Sprintf("@G{configuration is valid}") + loadedFiles(s), 0
+		}
+
+		var problems config.ValidationErrors
+		if !errors.As(err, &problems) {
+			return err.Error(), 2
+		}
+		var out []string
+		for _, p := range problems {
+			if !appliedSetting(p.Field) {
+				continue
+			}
+			out = append(out, ansi.Sprintf("@R{%s}: %s (%s)", p.Field, p.Message, s.Origin(p.Field)))
+		}
+		if len(out) == 0 {
+			return ansi.Sprintf("@G{configuration is valid}") + loadedFiles(s), 0
+		}
+		out = append(out, fmt.Sprintf("%d problem(s) found", len(out)))
+		return strings.Join(out, "\n"), 2
+	}
+
+	return ansi.Sprintf("@R{Unknown config action} @c{%s}@R{. Must be 'show' or 'validate'.}", action), 2
+}
+
+// formatSettings lists every applied setting with its value and origin.
+// Secrets are never printed, only whether they are set.
+func formatSettings(s *config.Effective, asJSON bool) (string, error) {
+	var list []config.Setting
+	for _, setting := range s.Settings() {
+		if !appliedSetting(setting.Key) {
+			continue
+		}
+		if setting.Secret && setting.Value != "" {
+			setting.Value = "<redacted>"
+		}
+		list = append(list, setting)
+	}
+
+	if asJSON {
+		out, err := json.MarshalIndent(struct {
+			UserFile    string           `json:"user_file,omitempty"`
+			ProjectFile string           `json:"project_file,omitempty"`
+			Settings    []config.Setting `json:"settings"`
+		}{s.UserFile, s.ProjectFile, list}, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+
+	width := 0
+	for _, setting := range list {
+		if len(setting.Key) > width {
+			width = len(setting.Key)
+		}
+	}
+
+	var out strings.Builder
+	for _, setting := range list {
+		value := fmt.Sprintf("%v", setting.Value)
+		if value == "" {
+			value = `""`
+		}
+		line := fmt.Sprintf("%-*s  %s", width, setting.Key, value)
+		if setting.Origin.Layer == config.LayerDefault {
+			out.WriteString(line + "\n")
+		} else {
+			out.WriteString(ansi.Sprintf("%s  @c{(%s)}\n", line, setting.Origin))
+		}
+	}
+	return strings.TrimSuffix(out.String(), "\n") + loadedFiles(s), nil
+}
+
+func loadedFiles(s *config.Effective) string {
+	var out string
+	if s.UserFile != "" {
+		out += fmt.Sprintf("\nuser file: %s", s.UserFile)
+	}
+	if s.ProjectFile != "" {
+		out += fmt.Sprintf("\nproject file: %s", s.ProjectFile)
+	}
+	return out
+}
+
+// engineOptions are the options graft engines are created with. The
+// --dataflow-order flag, if given, beats the configured order.
+func engineOptions(dataflowOrder string) []graft.EngineOption {
+	cache, cacheSize, workers := true, 1000, 10
+	if settings != nil {
+		cfg := settings.Config
+		if settings.IsSet("performance.enable_caching") {
+			cache = cfg.Performance.EnableCaching
+		}
+		if settings.IsSet("performance.cache.expression_cache_size") {
+			cacheSize = cfg.Performance.Cache.ExpressionCacheSize
+		}
+		if settings.IsSet("performance.concurrency.max_workers") && cfg.Performance.Concurrency.MaxWorkers > 0 {
+			workers = cfg.Performance.Concurrency.MaxWorkers
+		}
+		if dataflowOrder == "" && settings.IsSet("engine.dataflow_order") {
+			dataflowOrder = cfg.Engine.DataflowOrder
+		}
+	}
+	if dataflowOrder == "" {
+		dataflowOrder = "alphabetical"
+	}
+
+	return []graft.EngineOption{
+		graft.WithCache(cache, cacheSize),
+		graft.WithConcurrency(workers),
+		graft.WithEnhancedParser(true),
+		graft.WithDataflowOrder(dataflowOrder),
+	}
+}
+
+// configMergeStrategies are the merge strategies declared in the merge
+// section of .graft.yml
+func configMergeStrategies() []graft.MergeStrategy {
+	if settings == nil {
+		return nil
+	}
+	var strategies []graft.MergeStrategy
+	for _, s := range settings.Config.Merge.Strategies {
+		strategies = append(strategies, graft.MergeStrategy{Path: s.Path, List: s.List, Key: s.Key, Dedupe: s.Dedupe, Map: s.Map})
+	}
+	return strategies
+}
+
+// setFlag records a flag that overrides a setting, unless the settings
+// could not be loaded
+func setFlag(key, flag, value string, err error) error {
+	if settings == nil || err != nil {
+		return err
+	}
+	return settings.SetFlag(key, flag, value)
+}
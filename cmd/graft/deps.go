@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/voxelbrain/goptions"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+type depsOpts struct {
+	FallbackAppend bool               `goptions:"--fallback-append, description='Default merge normally tries to key merge, then inline. This flag says do an append instead of an inline.'"`
+	EnableGoPatch  bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
+	MultiDoc       bool               `goptions:"--multi-doc, -m, description='Treat multi-doc yaml as multiple files.'"`
+	Format         string             `goptions:"--format, description='Output format: dot (default), json or mermaid'"`
+	DepsOf         string             `goptions:"--deps-of, description='Only show what the operators at or beneath this path depend on'"`
+	DependentsOf   string             `goptions:"--dependents-of, description='Only show the operators that depend on those at or beneath this path'"`
+	Help           bool               `goptions:"--help, -h"`
+	Files          goptions.Remainder `goptions:"description='The files to merge, in order'"`
+}
+
+// cmdDeps merges the given files without evaluating them, and returns the
+// graph of dependencies between their operator calls
+func cmdDeps(options depsOpts) (*graft.DependencyGraph, error) {
+	switch options.Format {
+	case "", "dot", "json", "mermaid":
+	default:
+		return nil, ansi.Errorf("@R{Invalid --format} @c{%s}@R{. Must be 'dot', 'json' or 'mermaid'.}", options.Format)
+	}
+
+	doc, err := cmdMergeEval(mergeOpts{
+		SkipEval:       true,
+		FallbackAppend: options.FallbackAppend,
+		EnableGoPatch:  options.EnableGoPatch,
+		MultiDoc:       options.MultiDoc,
+		Files:          options.Files,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := graft.Dependencies(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.DepsOf != "" {
+		g = g.Dependencies(options.DepsOf)
+	}
+	if options.DependentsOf != "" {
+		g = g.Dependents(options.DependentsOf)
+	}
+	return g, nil
+}
+
+// formatDeps renders g as Graphviz DOT, JSON or a Mermaid flowchart. Each
+// edge points from an operator call to a call it depends on.
+func formatDeps(g *graft.DependencyGraph, format string) (string, error) {
+	switch format {
+	case "json":
+		if g.Nodes == nil {
+			g.Nodes = []*graft.DependencyNode{}
+		}
+		if g.Edges == nil {
+			g.Edges = []graft.DependencyEdge{}
+		}
+		out, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+
+	case "mermaid":
+		ids := map[string]string{}
+		var out strings.Builder
+		out.WriteString("flowchart LR\n")
+		for i, n := range g.Nodes {
+			ids[n.Path] = fmt.Sprintf("n%d", i)
+			out.WriteString(fmt.Sprintf("  %s[\"%s<br/>%s\"]\n", ids[n.Path], mermaidText(n.Path), mermaidText(n.Operator)))
+		}
+		for _, e := range g.Edges {
+			out.WriteString(fmt.Sprintf("  %s --> %s\n", ids[e.From], ids[e.To]))
+		}
+		return strings.TrimSuffix(out.String(), "\n"), nil
+
+	default:
+		var out strings.Builder
+		out.WriteString("digraph graft {\n  rankdir=LR;\n  node [shape=box];\n")
+		for _, n := range g.Nodes {
+			out.WriteString(fmt.Sprintf("  %s [label=%s, tooltip=%s];\n",
+				strconv.Quote(n.Path), strconv.Quote(n.Path+"\n"+n.Operator), strconv.Quote(n.Source)))
+		}
+		for _, e := range g.Edges {
+			out.WriteString(fmt.Sprintf("  %s -> %s;\n", strconv.Quote(e.From), strconv.Quote(e.To)))
+		}
+		out.WriteString("}")
+		return out.String(), nil
+	}
+}
+
+// mermaidText escapes s for use inside a quoted Mermaid label
+func mermaidText(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/geofffranks/yaml"
+	"github.com/gonvenience/ytbx"
+	"github.com/homeport/dyff/pkg/dyff"
+	"github.com/voxelbrain/goptions"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+type diffOpts struct {
+	Format         string             `goptions:"--format, description='Output format: human (default), json, yaml, patch or github'"`
+	Include        []string           `goptions:"--include, description='Only show differences at or beneath paths matching this pattern (may be specified more than once)'"`
+	Exclude        []string           `goptions:"--exclude, description='Hide differences at or beneath paths matching this pattern (may be specified more than once)'"`
+	IgnoreOrder    bool               `goptions:"--ignore-order, description='Compare lists without regard to the order of their entries'"`
+	Merge          bool               `goptions:"--merge, description='Merge and evaluate the files before the -- and the files after it, and compare the results'"`
+	Prune          []string           `goptions:"--prune, description='With --merge, prune these keys from both sides (may be specified more than once)'"`
+	CherryPick     []string           `goptions:"--cherry-pick, description='With --merge, only compare these keys (may be specified more than once)'"`
+	SecretsFile    string             `goptions:"--secrets-file, description='With --merge, answer vault, awsparam and awssecret calls from this secret bundle, instead of Vault and AWS'"`
+	Redact         bool               `goptions:"--redact, description='With --merge, mask secrets and the values derived from them as REDACTED'"`
+	SkipEval       bool               `goptions:"--skip-eval, description='With --merge, do not evaluate graft logic after merging'"`
+	EnableGoPatch  bool               `goptions:"--go-patch, description='With --merge, enable the use of go-patch when parsing files to be merged'"`
+	FallbackAppend bool               `goptions:"--fallback-append, description='With --merge, append lists that cannot be key-merged instead of merging them inline'"`
+	Help           bool               `goptions:"--help, -h"`
+	Files          goptions.Remainder `goptions:"description='Show the semantic differences between two YAML files, or with --merge, between the files before and after --'"`
+}
+
+// diffSide is one of the two things compared by graft diff: a file, or with
+// --merge, the result of merging a list of files
+type diffSide struct {
+	name string
+	doc  graft.Document
+}
+
+// cmdDiff compares the two files given, or with --merge, the results of
+// merging the two lists of files given, returning the differences in the
+// format asked for, and whether there were any
+func cmdDiff(options diffOpts) (string, bool, error) {
+	for _, pattern := range append(append([]string{}, options.Include...), options.Exclude...) {
+		if err := graft.ValidatePathPattern(pattern); err != nil {
+			return "", false, ansi.Errorf("@R{Invalid path pattern} @c{%s}@R{: %s}", pattern, err)
+		}
+	}
+
+	switch options.Format {
+	case "", "human", "json", "yaml", "patch", "github":
+	default:
+		return "", false, ansi.Errorf("@R{Invalid --format} @c{%s}@R{. Must be 'human', 'json', 'yaml', 'patch' or 'github'.}", options.Format)
+	}
+
+	if !options.Merge {
+		if len(options.Prune) > 0 || len(options.CherryPick) > 0 || options.SecretsFile != "" || options.Redact || options.SkipEval || options.EnableGoPatch || options.FallbackAppend {
+			return "", false, ansi.Errorf("@R{--prune, --cherry-pick, --secrets-file, --redact, --skip-eval, --go-patch and --fallback-append need} @m{--merge}")
+		}
+		if len(options.Files) != 2 {
+			return "", false, ansi.Errorf("@R{graft diff needs exactly two files to compare}")
+		}
+		if options.Format == "" || options.Format == "human" {
+			return diffFiles(options)
+		}
+	}
+
+	from, to, err := loadDiffSides(options)
+	if err != nil {
+		return "", false, err
+	}
+
+	if options.Format == "" || options.Format == "human" {
+		return diffDocuments(from, to, options)
+	}
+
+	engine, err := graft.NewEngine()
+	if err != nil {
+		return "", false, ansi.Errorf("@R{Failed to create graft engine}: %s", err.Error())
+	}
+	changes, err := engine.Diff(from.doc, to.doc, graft.DiffOptions{
+		Include:     options.Include,
+		Exclude:     options.Exclude,
+		IgnoreOrder: options.IgnoreOrder,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	output, err := formatDiff(changes, from, to, options)
+	return output, len(changes) > 0, err
+}
+
+// loadDiffSides parses the two files to compare, or with --merge, merges
+// and evaluates the files on either side of the --
+func loadDiffSides(options diffOpts) (diffSide, diffSide, error) {
+	if !options.Merge {
+		engine, err := graft.NewEngine()
+		if err != nil {
+			return diffSide{}, diffSide{}, ansi.Errorf("@R{Failed to create graft engine}: %s", err.Error())
+		}
+		files, err := loadInputFiles(options.Files, false)
+		if err != nil {
+			return diffSide{}, diffSide{}, err
+		}
+		docs, err := parseDocuments(engine, files, false, nil)
+		if err != nil {
+			return diffSide{}, diffSide{}, err
+		}
+		return diffSide{name: options.Files[0], doc: docs[0]}, diffSide{name: options.Files[1], doc: docs[1]}, nil
+	}
+
+	var left, right []string
+	split := false
+	for _, file := range options.Files {
+		if file == "--" && !split {
+			split = true
+		} else if split {
+			right = append(right, file)
+		} else {
+			left = append(left, file)
+		}
+	}
+	if !split || len(left) == 0 || len(right) == 0 {
+		return diffSide{}, diffSide{}, ansi.Errorf("@R{graft diff --merge needs the files to merge on each side of a} @m{--}@R{, as in} @c{graft diff --merge base.yml old.yml -- base.yml new.yml}")
+	}
+
+	if err := useSecretBundle(mergeOpts{SecretsFile: options.SecretsFile}); err != nil {
+		return diffSide{}, diffSide{}, err
+	}
+	redactor := fingerprintSecrets()
+
+	sides := []diffSide{}
+	for _, files := range [][]string{left, right} {
+		doc, err := cmdMergeEval(mergeOpts{
+			SkipEval:       options.SkipEval,
+			Prune:          options.Prune,
+			CherryPick:     options.CherryPick,
+			Redact:         options.Redact,
+			redactor:       redactor,
+			EnableGoPatch:  options.EnableGoPatch,
+			FallbackAppend: options.FallbackAppend,
+			Files:          files,
+		})
+		if err != nil {
+			return diffSide{}, diffSide{}, err
+		}
+		sides = append(sides, diffSide{name: strings.Join(files, " "), doc: doc})
+	}
+	return sides[0], sides[1], nil
+}
+
+// diffFiles describes the differences between two files for people to read
+func diffFiles(options diffOpts) (string, bool, error) {
+	from, to, err := ytbx.LoadFiles(options.Files[0], options.Files[1])
+	if err != nil {
+		return "", false, err
+	}
+	return writeHumanDiff(from, to, options)
+}
+
+// writeHumanDiff compares two inputs with dyff, writing its report
+func writeHumanDiff(from, to ytbx.InputFile, options diffOpts) (string, bool, error) {
+	report, err := dyff.CompareInputFiles(from, to, dyff.IgnoreOrderChanges(options.IgnoreOrder))
+	if err != nil {
+		return "", false, err
+	}
+	report.Diffs = filterDiffs(report.Diffs, options.Include, options.Exclude)
+
+	reportWriter := &dyff.HumanReport{
+		Report:            report,
+		DoNotInspectCerts: false,
+		NoTableStyle:      false,
+		OmitHeader:        true,
+	}
+
+	var buf bytes.Buffer
+	out := bufio.NewWriter(&buf)
+	if err := reportWriter.WriteReport(out); err != nil {
+		return "", false, fmt.Errorf("failed to write report: %v", err)
+	}
+	if err := out.Flush(); err != nil {
+		return "", false, fmt.Errorf("failed to flush report: %v", err)
+	}
+
+	return buf.String(), len(report.Diffs) > 0, nil
+}
+
+// fingerprintSecrets returns the Redactor used by graft diff --merge
+// --redact. Each secret is replaced by a fingerprint keyed by a random salt,
+// so that a secret that changed still shows up as a difference, but the
+// fingerprint means nothing outside of this run.
+func fingerprintSecrets() graft.Redactor {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return graft.RedactSecrets
+	}
+	return func(path string, value interface{}) interface{} {
+		mac := hmac.New(sha256.New, salt)
+		fmt.Fprintf(mac, "%v", value)
+		return fmt.Sprintf("REDACTED-%x", mac.Sum(nil)[:4])
+	}
+}
+
+// diffDocuments describes the differences between two merged documents for
+// people to read
+func diffDocuments(from, to diffSide, options diffOpts) (string, bool, error) {
+	inputs := []ytbx.InputFile{}
+	for _, side := range []diffSide{from, to} {
+		data, err := yaml.Marshal(side.doc.GetData())
+		if err != nil {
+			return "", false, err
+		}
+		docs, err := ytbx.LoadDocuments(data)
+		if err != nil {
+			return "", false, err
+		}
+		inputs = append(inputs, ytbx.InputFile{Location: side.name, Documents: docs})
+	}
+	return writeHumanDiff(inputs[0], inputs[1], options)
+}
+
+// filterDiffs keeps the differences found by dyff that --include and
+// --exclude let through
+func filterDiffs(diffs []dyff.Diff, include, exclude []string) []dyff.Diff {
+	if len(include) == 0 && len(exclude) == 0 {
+		return diffs
+	}
+
+	kept := []dyff.Diff{}
+DIFFS:
+	for _, d := range diffs {
+		path := ""
+		if d.Path != nil {
+			path = d.Path.ToDotStyle()
+		}
+		for _, pattern := range exclude {
+			if graft.MatchPath(pattern, path) {
+				continue DIFFS
+			}
+		}
+		if len(include) == 0 {
+			kept = append(kept, d)
+			continue
+		}
+		for _, pattern := range include {
+			if graft.MatchPath(pattern, path) {
+				kept = append(kept, d)
+				continue DIFFS
+			}
+		}
+	}
+	return kept
+}
+
+// formatDiff renders changes between the from and to documents as JSON,
+// YAML, a patch, or GitHub workflow annotations
+func formatDiff(changes []graft.DiffChange, from, to diffSide, options diffOpts) (string, error) {
+	if changes == nil {
+		changes = []graft.DiffChange{}
+	}
+
+	switch options.Format {
+	case "json":
+		out, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+
+	case "yaml":
+		out, err := yaml.Marshal(changes)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(string(out), "\n"), nil
+
+	case "patch":
+		var b strings.Builder
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n", from.name, to.name)
+		for _, change := range changes {
+			fmt.Fprintf(&b, "@@ $.%s @@ %s\n", change.Path, change.Kind)
+			if change.From != nil {
+				b.WriteString(patchLines("-", change.From))
+			}
+			if change.To != nil {
+				b.WriteString(patchLines("+", change.To))
+			}
+		}
+		return strings.TrimSuffix(b.String(), "\n"), nil
+
+	case "github":
+		lines := []string{}
+		for _, change := range changes {
+			lines = append(lines, githubAnnotation(change, from.doc, to.doc))
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	return "", ansi.Errorf("@R{Invalid --format} @c{%s}", options.Format)
+}
+
+// patchLines renders value as YAML, with each line marked by prefix
+func patchLines(prefix string, value interface{}) string {
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		out = []byte(fmt.Sprintf("%v\n", value))
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		b.WriteString(prefix + " " + line + "\n")
+	}
+	return b.String()
+}
+
+// githubAnnotation renders change as a GitHub Actions workflow command, so
+// that it is shown against the line of the file it was found in. Removals
+// point at the old file, everything else at the new one.
+func githubAnnotation(change graft.DiffChange, from, to graft.Document) string {
+	doc := to
+	if change.Kind == graft.DiffRemoved {
+		doc = from
+	}
+
+	props := []string{}
+	if source, ok := doc.Provenance(change.Path); ok && source.File != "" {
+		props = append(props, "file="+githubProperty(source.File))
+		if source.Line > 0 {
+			props = append(props, fmt.Sprintf("line=%d", source.Line))
+		}
+	}
+	props = append(props, "title="+githubProperty(fmt.Sprintf("$.%s %s", change.Path, change.Kind)))
+
+	var message string
+	switch change.Kind {
+	case graft.DiffAdded:
+		message = "added " + compactValue(change.To)
+	case graft.DiffRemoved:
+		message = "removed " + compactValue(change.From)
+	default:
+		message = fmt.Sprintf("%s from %s to %s", change.Kind, compactValue(change.From), compactValue(change.To))
+	}
+	return fmt.Sprintf("::notice %s::%s", strings.Join(props, ","), githubData(message))
+}
+
+// compactValue renders value on a single line
+func compactValue(value interface{}) string {
+	out, err := json.Marshal(jsonSafe(value))
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(out)
+}
+
+// jsonSafe converts the maps of a YAML value to ones encoding/json accepts
+func jsonSafe(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprintf("%v", k)] = jsonSafe(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = jsonSafe(val)
+		}
+		return l
+	}
+	return value
+}
+
+// githubData escapes the message of a workflow command
+func githubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// githubProperty escapes a property of a workflow command
+func githubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
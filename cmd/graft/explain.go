@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/voxelbrain/goptions"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/internal/utils/tree"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+type explainOpts struct {
+	SkipEval       bool               `goptions:"--skip-eval, description='Do not evaluate graft logic after merging docs'"`
+	FallbackAppend bool               `goptions:"--fallback-append, description='Default merge normally tries to key merge, then inline. This flag says do an append instead of an inline.'"`
+	EnableGoPatch  bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
+	MultiDoc       bool               `goptions:"--multi-doc, -m, description='Treat multi-doc yaml as multiple files.'"`
+	JSON           bool               `goptions:"--json, description='Output provenance as JSON'"`
+	Help           bool               `goptions:"--help, -h"`
+	Args           goptions.Remainder `goptions:"description='The path to explain, followed by the files to merge'"`
+}
+
+// explanation is one line of `graft explain` output
+type explanation struct {
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+	graft.ValueSource
+}
+
+// cmdExplain merges the given files and reports which file, line and
+// operator produced the value at path and everything beneath it
+func cmdExplain(options explainOpts) ([]explanation, error) {
+	if len(options.Args) < 2 {
+		return nil, ansi.Errorf("@R{Missing Input:} usage: graft explain <path> file1.yml [file2.yml ...]")
+	}
+	path := options.Args[0]
+
+	doc, err := cmdMergeEval(mergeOpts{
+		SkipEval:       options.SkipEval,
+		FallbackAppend: options.FallbackAppend,
+		EnableGoPatch:  options.EnableGoPatch,
+		MultiDoc:       options.MultiDoc,
+		Files:          options.Args[1:],
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := doc.Get(path)
+	if err != nil {
+		return nil, ansi.Errorf("@R{`%s` could not be found in the merged document}", path)
+	}
+
+	var explanations []explanation
+	var walk func(path string, value interface{})
+	walk = func(path string, value interface{}) {
+		e := explanation{Path: path}
+		e.ValueSource, _ = doc.Provenance(path)
+
+		switch v := value.(type) {
+		case map[interface{}]interface{}:
+			explanations = append(explanations, e)
+			keys := make([]string, 0, len(v))
+			lookup := make(map[string]interface{}, len(v))
+			for k, val := range v {
+				key := fmt.Sprintf("%v", k)
+				keys = append(keys, key)
+				lookup[key] = val
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(joinPath(path, key), lookup[key])
+			}
+
+		case []interface{}:
+			explanations = append(explanations, e)
+			for i, item := range v {
+				walk(joinPath(path, entryName(item, strconv.Itoa(i))), item)
+			}
+
+		default:
+			e.Value = v
+			explanations = append(explanations, e)
+		}
+	}
+	walk(path, value)
+
+	return explanations, nil
+}
+
+// formatExplanations renders explanations as text, or JSON if asked to
+func formatExplanations(explanations []explanation, asJSON bool) (string, error) {
+	if asJSON {
+		out, err := json.MarshalIndent(explanations, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+
+	var out string
+	for _, e := range explanations {
+		out += ansi.Sprintf("@c{%s}", e.Path)
+		if e.Value != nil {
+			out += fmt.Sprintf(": %v", e.Value)
+		}
+		out += "\n"
+		if e.File != "" || e.Line != 0 {
+			out += ansi.Sprintf("  from @m{%s}\n", e.ValueSource.String())
+		}
+		if e.Operator != "" {
+			out += ansi.Sprintf("  via  @G{%s}\n", e.Operator)
+		}
+	}
+	return out, nil
+}
+
+// entryName addresses a list entry by its name, key or id field, the same
+// way graft paths do, falling back to its index
+func entryName(o interface{}, def string) string {
+	m, ok := o.(map[interface{}]interface{})
+	if !ok {
+		return def
+	}
+	for _, field := range tree.NameFields {
+		if s, ok := m[field].(string); ok {
+			return s
+		}
+	}
+	return def
+}
+
+func joinPath(path, key string) string {
+	if path == "" || path == "$" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft/operators"
+)
+
+// useVaultGenerate sets up the vault-generate operator for a merge run with
+// options, forgetting what earlier runs generated
+func useVaultGenerate(options mergeOpts) {
+	operators.VaultGenerateMissing = options.VaultGenerateMissing
+	operators.VaultGenerateDryRun = options.VaultGenerateDryRun
+	operators.ResetVaultGenerated()
+}
+
+// formatGenerated lists the secrets a --vault-generate-dry-run found missing,
+// one per line, with the policy that would generate them
+func formatGenerated(secrets []operators.GeneratedSecret) string {
+	if len(secrets) == 0 {
+		return "no secrets would be generated"
+	}
+
+	var out strings.Builder
+	for _, secret := range secrets {
+		path := secret.Path
+		if secret.Target != "" {
+			path = fmt.Sprintf("vault@%s %s", secret.Target, path)
+		}
+		policy := strings.TrimSpace(secret.Policy + " " + strings.Join(secret.Args, " "))
+		out.WriteString(ansi.Sprintf("would generate @c{%s}:@m{%s} (%s)\n", path, strings.Join(secret.Keys, ","), policy))
+	}
+	out.WriteString(fmt.Sprintf("%d secret(s) would be generated", len(secrets)))
+	return out.String()
+}
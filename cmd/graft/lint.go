@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/voxelbrain/goptions"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+type lintOpts struct {
+	EnableGoPatch bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
+	MultiDoc      bool               `goptions:"--multi-doc, -m, description='Treat multi-doc yaml as multiple files.'"`
+	JSON          bool               `goptions:"--json, description='Output problems as JSON'"`
+	Help          bool               `goptions:"--help, -h"`
+	Files         goptions.Remainder `goptions:"description='The files to check, in the order they would be merged'"`
+}
+
+// cmdLint checks the given files for mistakes without merging or evaluating
+// them, so no Vault, AWS or NATS lookups are made
+func cmdLint(options lintOpts) ([]graft.LintIssue, error) {
+	files, err := loadInputFiles(options.Files, options.MultiDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	engine, err := graft.NewEngine()
+	if err != nil {
+		return nil, ansi.Errorf("@R{Failed to create graft engine}: %s", err.Error())
+	}
+
+	docs, err := parseDocuments(engine, files, options.EnableGoPatch, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return graft.LintWithStrategies(configMergeStrategies(), docs...), nil
+}
+
+// formatLintIssues renders issues one per line followed by a summary, or as
+// JSON if asked to
+func formatLintIssues(issues []graft.LintIssue, asJSON bool) (string, error) {
+	if asJSON {
+		if issues == nil {
+			issues = []graft.LintIssue{}
+		}
+		out, err := json.MarshalIndent(issues, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+
+	var out string
+	errors, warnings := 0, 0
+	for _, issue := range issues {
+		if issue.Severity == graft.LintError {
+			errors++
+			out += ansi.Sprintf("@R{%s}\n", issue.String())
+		} else {
+			warnings++
+			out += ansi.Sprintf("@Y{%s}\n", issue.String())
+		}
+	}
+
+	if len(issues) == 0 {
+		out += ansi.Sprintf("@G{no problems found}")
+	} else {
+		out += fmt.Sprintf("%d error(s), %d warning(s)", errors, warnings)
+	}
+	return out, nil
+}
+
+// lintExitCode is 0 when there are no problems, 1 when there are only
+// warnings, and 2 when there is at least one error
+func lintExitCode(issues []graft.LintIssue) int {
+	code := 0
+	for _, issue := range issues {
+		if issue.Severity == graft.LintError {
+			return 2
+		}
+		code = 1
+	}
+	return code
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft/operators"
+)
+
+// useLookupRecording sets up --record and --replay for a merge run with
+// options
+func useLookupRecording(options mergeOpts) error {
+	operators.ReplayLookups(nil)
+	operators.StopRecordingLookups()
+	if options.RecordEncrypt && options.Record == "" {
+		return ansi.Errorf("@R{--record-encrypt needs} @m{--record}")
+	}
+
+	if options.Replay != "" {
+		passphrase, err := secretsPassphrase()
+		if err != nil {
+			return err
+		}
+		lookups, err := operators.LoadLookups(options.Replay, passphrase)
+		if err != nil {
+			return err
+		}
+		operators.ReplayLookups(lookups)
+	}
+	if options.Record != "" {
+		if options.RecordEncrypt {
+			if passphrase, err := secretsPassphrase(); err != nil {
+				return err
+			} else if passphrase == "" {
+				return ansi.Errorf("@R{--record-encrypt needs a passphrase in} @m{GRAFT_SECRETS_KEY} @R{or} @m{GRAFT_SECRETS_KEY_FILE}")
+			}
+		}
+		operators.StartRecordingLookups()
+	}
+	return nil
+}
+
+// saveLookupRecording writes the lookups recorded by a merge run to the
+// file named by --record. Failed runs are saved too, for bug reports.
+func saveLookupRecording(options mergeOpts) error {
+	if options.Record == "" {
+		return nil
+	}
+	operators.StopRecordingLookups()
+
+	passphrase := ""
+	if options.RecordEncrypt {
+		var err error
+		if passphrase, err = secretsPassphrase(); err != nil {
+			return err
+		}
+	}
+	data, err := operators.MarshalLookups(operators.RecordedLookups(), passphrase)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(options.Record, data, 0600); err != nil {
+		return ansi.Errorf("@R{unable to write recorded lookups to} @c{%s}: %s", options.Record, err)
+	}
+	return nil
+}
@@ -1,24 +1,23 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 
 	"github.com/cppforlife/go-patch/patch"
-	"github.com/gonvenience/ytbx"
-	"github.com/homeport/dyff/pkg/dyff"
 	"github.com/mattn/go-isatty"
 	"github.com/wayneeseguin/graft/internal/utils/ansi"
 
 	"github.com/wayneeseguin/graft/internal/utils/tree"
 	"github.com/wayneeseguin/graft/log"
 	"github.com/wayneeseguin/graft/pkg/graft"
-	_ "github.com/wayneeseguin/graft/pkg/graft/operators" // Register operators
+	"github.com/wayneeseguin/graft/pkg/graft/operators" // Register operators
 
 	"strings"
 
@@ -69,15 +68,37 @@ type jsonOpts struct {
 }
 
 type mergeOpts struct {
-	SkipEval       bool               `goptions:"--skip-eval, description='Do not evaluate graft logic after merging docs'"`
-	Prune          []string           `goptions:"--prune, description='Specify keys to prune from final output (may be specified more than once)'"`
-	CherryPick     []string           `goptions:"--cherry-pick, description='The opposite of prune, specify keys to cherry-pick from final output (may be specified more than once)'"`
-	FallbackAppend bool               `goptions:"--fallback-append, description='Default merge normally tries to key merge, then inline. This flag says do an append instead of an inline.'"`
-	EnableGoPatch  bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
-	MultiDoc       bool               `goptions:"--multi-doc, -m, description='Treat multi-doc yaml as multiple files.'"`
-	DataflowOrder  string             `goptions:"--dataflow-order, description='Order of operations in dataflow output: alphabetical (default) or insertion'"`
-	Help           bool               `goptions:"--help, -h"`
-	Files          goptions.Remainder `goptions:"description='List of files to merge. To read STDIN, specify a filename of \\'-\\'.'"`
+	SkipEval             bool               `goptions:"--skip-eval, description='Do not evaluate graft logic after merging docs'"`
+	Prune                []string           `goptions:"--prune, description='Specify keys to prune from final output (may be specified more than once)'"`
+	CherryPick           []string           `goptions:"--cherry-pick, description='The opposite of prune, specify keys to cherry-pick from final output (may be specified more than once)'"`
+	FallbackAppend       bool               `goptions:"--fallback-append, description='Default merge normally tries to key merge, then inline. This flag says do an append instead of an inline.'"`
+	EnableGoPatch        bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
+	JSONPatch            []string           `goptions:"--json-patch, description='Apply this file as an RFC 6902 JSON Patch, where it appears among the files to merge, or after them (may be specified more than once)'"`
+	MergePatch           []string           `goptions:"--merge-patch, description='Apply this file as an RFC 7386 JSON Merge Patch, where it appears among the files to merge, or after them (may be specified more than once)'"`
+	MergeStrategy        string             `goptions:"--merge-strategy, description='Merge the lists and maps at the paths this file declares as it says, on top of the merge strategies in .graft.yml'"`
+	MultiDoc             bool               `goptions:"--multi-doc, -m, description='Treat multi-doc yaml as multiple files.'"`
+	DataflowOrder        string             `goptions:"--dataflow-order, description='Order of operations in dataflow output: alphabetical (default) or insertion'"`
+	PreserveOrder        bool               `goptions:"--preserve-order, description='Output keys in the order they were first seen across the merged files, instead of sorting them'"`
+	PreserveComments     bool               `goptions:"--preserve-comments, description='Keep comments from the merged files, using the last file to define each key'"`
+	ErrorFormat          string             `goptions:"--error-format, description='Format of errors on stderr: text (default) or json, one record per line'"`
+	Explain              bool               `goptions:"--explain, description='Print each operator call, the inputs it resolved and the value it produced to stderr'"`
+	ExplainFormat        string             `goptions:"--explain-format, description='Format of --explain output: tree (default) or json'"`
+	ExplainPath          string             `goptions:"--explain-path, description='Only explain operator calls at or beneath this path'"`
+	VaultGenerateMissing bool               `goptions:"--vault-generate-missing, description='Generate a random secret in vault for each (( vault ... )) call that finds nothing, instead of failing'"`
+	VaultGenerateDryRun  bool               `goptions:"--vault-generate-dry-run, description='List the secrets vault-generate would write, instead of writing them and printing the merge'"`
+	SecretsFile          string             `goptions:"--secrets-file, description='Answer vault, awsparam and awssecret calls from this secret bundle, instead of Vault and AWS'"`
+	Redact               bool               `goptions:"--redact, description='Mask the values of vault, awsparam and awssecret calls, and of everything derived from them, as REDACTED'"`
+	SecretPolicy         string             `goptions:"--secret-policy, description='Fail if a value derived from vault, awsparam or awssecret ends up outside the paths this policy file allows'"`
+	Record               string             `goptions:"--record, description='Record the values of vault, awsparam, awssecret, nats and remote load calls to this file'"`
+	RecordEncrypt        bool               `goptions:"--record-encrypt, description='Encrypt the secret values of --record with the passphrase in GRAFT_SECRETS_KEY or GRAFT_SECRETS_KEY_FILE'"`
+	Replay               string             `goptions:"--replay, description='Serve vault, awsparam, awssecret, nats and remote load calls from a --record file, failing on any that were not recorded'"`
+	Help                 bool               `goptions:"--help, -h"`
+	Files                goptions.Remainder `goptions:"description='List of files to merge. To read STDIN, specify a filename of \\'-\\'.'"`
+
+	// trace records the evaluation when --explain is given
+	trace *graft.EvalTrace
+	// redactor masks secrets in place of REDACTED when --redact is given
+	redactor graft.Redactor
 }
 
 // checkForCycles detects circular references in the data structure
@@ -132,21 +153,24 @@ func checkForCycles(root interface{}, maxDepth int) error {
 
 func main() {
 	var options struct {
-		Debug   bool   `goptions:"-D, --debug, description='Enable debugging'"`
-		Trace   bool   `goptions:"-T, --trace, description='Enable trace mode debugging (very verbose)'"`
-		Version bool   `goptions:"-v, --version, description='Display version information'"`
-		Color   string `goptions:"--color, description='Control color output (on/off/auto, default: auto)'"`
-		Action  goptions.Verbs
-		Merge   mergeOpts `goptions:"merge"`
-		Fan     mergeOpts `goptions:"fan"`
-		JSON    jsonOpts  `goptions:"json"`
-		Diff    struct {
-			Files goptions.Remainder `goptions:"description='Show the semantic differences between two YAML files'"`
-		} `goptions:"diff"`
-		VaultInfo struct {
-			EnableGoPatch bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
-			Files         goptions.Remainder `goptions:"description='List vault references in the given files'"`
-		} `goptions:"vaultinfo"`
+		Debug     bool   `goptions:"-D, --debug, description='Enable debugging'"`
+		Trace     bool   `goptions:"-T, --trace, description='Enable trace mode debugging (very verbose)'"`
+		Version   bool   `goptions:"-v, --version, description='Display version information'"`
+		Color     string `goptions:"--color, description='Control color output (on/off/auto, default: auto)'"`
+		Action    goptions.Verbs
+		Merge     mergeOpts     `goptions:"merge"`
+		Fan       mergeOpts     `goptions:"fan"`
+		JSON      jsonOpts      `goptions:"json"`
+		Explain   explainOpts   `goptions:"explain"`
+		Lint      lintOpts      `goptions:"lint"`
+		Deps      depsOpts      `goptions:"deps"`
+		Config    configOpts    `goptions:"config"`
+		Targets   targetsOpts   `goptions:"targets"`
+		Diff      diffOpts      `goptions:"diff"`
+		Patch     patchOpts     `goptions:"patch"`
+		VaultInfo vaultInfoOpts `goptions:"vaultinfo"`
+		RefsInfo  refsInfoOpts  `goptions:"refsinfo"`
+		Secrets   secretsOpts   `goptions:"secrets"`
 	}
 	getopts(&options)
 
@@ -159,7 +183,7 @@ func main() {
 		log.DebugOn = true
 	}
 
-	if options.JSON.Help || options.Merge.Help || options.Fan.Help {
+	if options.JSON.Help || options.Merge.Help || options.Fan.Help || options.Explain.Help || options.Lint.Help || options.Deps.Help || options.Config.Help || options.Targets.Help || options.VaultInfo.Help || options.RefsInfo.Help || options.Secrets.Help || options.Diff.Help || options.Patch.Help {
 		usage()
 		return
 	}
@@ -170,16 +194,36 @@ func main() {
 		return
 	}
 
+	var settingsErr error
+	settings = nil
+	if usesSettings[options.Action] {
+		settings, settingsErr = loadSettings()
+		if settingsErr != nil && options.Action != "config" {
+			log.PrintfStdErr("%s\n", settingsErr.Error())
+			exit(2)
+			return
+		}
+	}
+	if settings != nil {
+		defineTargets(settings)
+	}
+
 	// Handle color flag
 	shouldEnableColor := false
 	switch options.Color {
 	case "on":
 		shouldEnableColor = true
+		settingsErr = setFlag("engine.color_output", "--color", "true", settingsErr)
 	case "off":
 		shouldEnableColor = false
+		settingsErr = setFlag("engine.color_output", "--color", "false", settingsErr)
 	case "auto", "":
-		// Auto-detect based on whether stderr is a terminal
-		shouldEnableColor = isatty.IsTerminal(os.Stderr.Fd())
+		if settings != nil && settings.IsSet("engine.color_output") {
+			shouldEnableColor = settings.Config.Engine.ColorOutput
+		} else {
+			// Auto-detect based on whether stderr is a terminal
+			shouldEnableColor = isatty.IsTerminal(os.Stderr.Fd())
+		}
 	default:
 		log.PrintfStdErr("Invalid --color option: %s. Must be 'on', 'off', or 'auto'.\n", options.Color)
 		exit(1)
@@ -189,12 +233,47 @@ func main() {
 
 	switch options.Action {
 	case "merge":
-		tree, err := cmdMergeEval(options.Merge)
-		if err != nil {
+		if err := validateErrorFormat(options.Merge.ErrorFormat); err != nil {
 			log.PrintfStdErr("%s\n", err.Error())
 			exit(2)
 			return
 		}
+		if err := validateExplainFormat(options.Merge.ExplainFormat); err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		if options.Merge.Explain {
+			options.Merge.trace = graft.NewEvalTrace()
+		}
+		useVaultGenerate(options.Merge)
+		if err := useSecretBundle(options.Merge); err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		if err := useLookupRecording(options.Merge); err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		doc, err := cmdMergeEval(options.Merge)
+		if rerr := saveLookupRecording(options.Merge); rerr != nil {
+			log.PrintfStdErr("%s\n", rerr.Error())
+			exit(2)
+			return
+		}
+		printExplain(options.Merge, "")
+		if err != nil {
+			printError(err, options.Merge.ErrorFormat)
+			exit(2)
+			return
+		}
+		if options.Merge.VaultGenerateDryRun {
+			printfStdOut("%s\n", formatGenerated(operators.VaultGenerated()))
+			return
+		}
+		tree := doc.GetData()
 
 		log.TRACE("Converting the following data back to YML:")
 		log.TRACE("%#v", tree)
@@ -206,7 +285,7 @@ func main() {
 			return
 		}
 
-		merged, err := yaml.Marshal(tree)
+		merged, err := marshalDocument(doc, options.Merge)
 		if err != nil {
 			log.PrintfStdErr("Unable to convert merged result back to YAML: %s\nData:\n%#v", err.Error(), tree)
 			exit(2)
@@ -216,14 +295,45 @@ func main() {
 		printfStdOut("%s\n", string(merged))
 
 	case "fan":
+		if err := validateErrorFormat(options.Fan.ErrorFormat); err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		if err := validateExplainFormat(options.Fan.ExplainFormat); err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		useVaultGenerate(options.Fan)
+		if err := useSecretBundle(options.Fan); err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		if err := useLookupRecording(options.Fan); err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
 		trees, err := cmdFanEval(options.Fan)
+		if rerr := saveLookupRecording(options.Fan); rerr != nil {
+			log.PrintfStdErr("%s\n", rerr.Error())
+			exit(2)
+			return
+		}
 		if err != nil {
-			log.PrintfStdErr("%s\n", err.Error())
+			printError(err, options.Fan.ErrorFormat)
 			exit(2)
 			return
 		}
+		if options.Fan.VaultGenerateDryRun {
+			printfStdOut("%s\n", formatGenerated(operators.VaultGenerated()))
+			return
+		}
 
-		for _, tree := range trees {
+		for _, doc := range trees {
+			tree := doc.GetData()
 			log.TRACE("Converting the following data back to YML:")
 			log.TRACE("%#v", tree)
 
@@ -234,7 +344,7 @@ func main() {
 				return
 			}
 
-			merged, err := yaml.Marshal(tree)
+			merged, err := marshalDocument(doc, options.Fan)
 			if err != nil {
 				log.PrintfStdErr("Unable to convert merged result back to YAML: %s\nData:\n%#v", err.Error(), tree)
 				exit(2)
@@ -245,18 +355,29 @@ func main() {
 		}
 
 	case "vaultinfo":
-		graft.VaultRefs = map[string][]string{}
-		graft.SkipVault = true
-		options.Merge.Files = options.VaultInfo.Files
-		options.Merge.EnableGoPatch = options.VaultInfo.EnableGoPatch
-		_, err := cmdMergeEval(options.Merge)
+		output, err := cmdVaultInfo(options.VaultInfo)
 		if err != nil {
 			log.PrintfStdErr("%s\n", err.Error())
 			exit(2)
 			return
 		}
-
-		printfStdOut("%s\n", formatVaultRefs())
+		printfStdOut("%s\n", output)
+	case "secrets":
+		output, err := cmdSecrets(options.Secrets)
+		if err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		printfStdOut("%s\n", output)
+	case "refsinfo":
+		output, err := cmdRefsInfo(options.RefsInfo)
+		if err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		printfStdOut("%s\n", output)
 	case "json":
 		jsons, err := cmdJSONEval(options.JSON)
 		if err != nil {
@@ -268,17 +389,88 @@ func main() {
 			printfStdOut("%s\n", output)
 		}
 
+	case "explain":
+		explanations, err := cmdExplain(options.Explain)
+		if err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		output, err := formatExplanations(explanations, options.Explain.JSON)
+		if err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		printfStdOut("%s\n", output)
+
+	case "lint":
+		issues, err := cmdLint(options.Lint)
+		if err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		output, err := formatLintIssues(issues, options.Lint.JSON)
+		if err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		printfStdOut("%s\n", output)
+		if code := lintExitCode(issues); code != 0 {
+			exit(code)
+			return
+		}
+
+	case "deps":
+		g, err := cmdDeps(options.Deps)
+		if err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		output, err := formatDeps(g, options.Deps.Format)
+		if err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		printfStdOut("%s\n", output)
+
+	case "config":
+		output, code := cmdConfig(options.Config, settings, settingsErr)
+		if code != 0 {
+			log.PrintfStdErr("%s\n", output)
+			exit(code)
+			return
+		}
+		printfStdOut("%s\n", output)
+
+	case "targets":
+		output, code, err := cmdTargets(options.Targets, settings)
+		if err != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			exit(2)
+			return
+		}
+		printfStdOut("%s\n", output)
+		if code != 0 {
+			exit(code)
+			return
+		}
+
 	case "diff":
 		// For diff, check stdout instead of stderr when auto-detecting
-		if options.Color == "auto" || options.Color == "" {
+		if (options.Color == "auto" || options.Color == "") && (settings == nil || !settings.IsSet("engine.color_output")) {
 			ansi.Color(isatty.IsTerminal(os.Stdout.Fd()))
 		}
 		// Otherwise use the already set color preference from above
-		if len(options.Diff.Files) != 2 {
+		if len(options.Diff.Files) != 2 && !options.Diff.Merge {
 			usage()
 			return
 		}
-		output, differences, err := diffFiles(options.Diff.Files)
+		output, differences, err := cmdDiff(options.Diff)
 		if err != nil {
 			log.PrintfStdErr("%s\n", err)
 			exit(2)
@@ -287,7 +479,17 @@ func main() {
 		printfStdOut("%s\n", output)
 		if differences {
 			exit(1)
+			return
+		}
+
+	case "patch":
+		output, err := cmdPatch(options.Patch)
+		if err != nil {
+			log.PrintfStdErr("%s\n", err)
+			exit(2)
+			return
 		}
+		printfStdOut("%s\n", output)
 
 	default:
 		usage()
@@ -380,10 +582,26 @@ func splitLoadYamlFile(file string) ([]YamlFile, error) {
 	return docs, nil
 }
 
-func cmdMergeEval(options mergeOpts) (map[interface{}]interface{}, error) {
+func cmdMergeEval(options mergeOpts) (graft.Document, error) {
+	files, err := loadInputFiles(withPatchFiles(options), options.MultiDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := mergeAllDocuments(files, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// loadInputFiles opens the files named on the command line, reading STDIN if
+// none were given. With multiDoc, each document of a file is loaded on its own.
+func loadInputFiles(paths []string, multiDoc bool) ([]YamlFile, error) {
 	files := []YamlFile{}
 
-	if len(options.Files) < 1 {
+	if len(paths) < 1 {
 		stdinInfo, err := os.Stdin.Stat()
 		if err != nil {
 			return nil, ansi.Errorf("@R{Error statting STDIN} - Bailing out: %s\n", err.Error())
@@ -393,11 +611,11 @@ func cmdMergeEval(options mergeOpts) (map[interface{}]interface{}, error) {
 			return nil, ansi.Errorf("@R{Error reading STDIN}: no data found. Did you forget to pipe data to STDIN, or specify yaml files to merge?")
 		}
 
-		options.Files = append(options.Files, "-")
+		paths = append(paths, "-")
 	}
 
-	for _, file := range options.Files {
-		if options.MultiDoc {
+	for _, file := range paths {
+		if multiDoc {
 			docs, err := splitLoadYamlFile(file)
 			if err != nil {
 				return nil, err
@@ -411,16 +629,10 @@ func cmdMergeEval(options mergeOpts) (map[interface{}]interface{}, error) {
 			files = append(files, yamlFile)
 		}
 	}
-
-	result, err := mergeAllDocs(files, options)
-	if err != nil {
-		return nil, err
-	}
-
-	return result, nil
+	return files, nil
 }
 
-func cmdFanEval(options mergeOpts) ([]map[interface{}]interface{}, error) {
+func cmdFanEval(options mergeOpts) ([]graft.Document, error) {
 	stdinInfo, err := os.Stdin.Stat()
 	if err != nil {
 		return nil, ansi.Errorf("@R{Error statting STDIN} - Bailing out: %s\n", err.Error())
@@ -433,7 +645,7 @@ func cmdFanEval(options mergeOpts) ([]map[interface{}]interface{}, error) {
 		return nil, ansi.Errorf("@R{Missing Input:} You must specify at least a source document to graft fan. If no files are specified, STDIN is used. Using STDIN for source and target docs only works with -m.")
 	}
 
-	roots := []map[interface{}]interface{}{}
+	roots := []graft.Document{}
 	sourcePath := options.Files[0]
 	options.Files = options.Files[1:]
 
@@ -475,7 +687,11 @@ func cmdFanEval(options mergeOpts) ([]map[interface{}]interface{}, error) {
 	for _, doc := range docs {
 		sourceBuffer := bytes.NewBuffer(sourceBytes)
 		source = YamlFile{Path: source.Path, Reader: io.NopCloser(sourceBuffer)}
-		result, err := mergeAllDocs([]YamlFile{source, doc}, options)
+		if options.Explain {
+			options.trace = graft.NewEvalTrace()
+		}
+		result, err := mergeAllDocuments([]YamlFile{source, doc}, options)
+		printExplain(options, doc.Path)
 		if err != nil {
 			return nil, err
 		}
@@ -503,7 +719,9 @@ func cmdJSONEval(options jsonOpts) ([]string, error) {
 }
 
 type yamlVaultSecret struct {
+	Target     string `yaml:"target,omitempty"` // empty for the default vault
 	Key        string
+	Version    uint `yaml:"version,omitempty"`
 	References []string
 }
 
@@ -513,14 +731,26 @@ type yamlVaultRefs struct {
 	Secrets []yamlVaultSecret
 }
 
-func (refs byKey) Len() int           { return len(refs) }
-func (refs byKey) Swap(i, j int)      { refs[i], refs[j] = refs[j], refs[i] }
-func (refs byKey) Less(i, j int) bool { return refs[i].Key < refs[j].Key }
+func (refs byKey) Len() int      { return len(refs) }
+func (refs byKey) Swap(i, j int) { refs[i], refs[j] = refs[j], refs[i] }
+func (refs byKey) Less(i, j int) bool {
+	if refs[i].Key != refs[j].Key {
+		return refs[i].Key < refs[j].Key
+	}
+	return refs[i].Target < refs[j].Target
+}
 
-func formatVaultRefs() string {
+func formatVaultRefs(vaultRefs map[string]map[string][]string) string {
 	refs := yamlVaultRefs{}
-	for secret, srcs := range graft.VaultRefs {
-		refs.Secrets = append(refs.Secrets, yamlVaultSecret{secret, srcs})
+	for target, secrets := range vaultRefs {
+		for secret, srcs := range secrets {
+			refs.Secrets = append(refs.Secrets, yamlVaultSecret{
+				Target:     target,
+				Key:        secret,
+				Version:    operators.VaultReferenceVersion(target, secret),
+				References: srcs,
+			})
+		}
 	}
 
 	sort.Sort(byKey(refs.Secrets))
@@ -530,7 +760,7 @@ func formatVaultRefs() string {
 
 	output, err := yaml.Marshal(refs)
 	if err != nil {
-		panic(fmt.Sprintf("Could not marshal YAML for vault references: %+v", graft.VaultRefs))
+		panic(fmt.Sprintf("Could not marshal YAML for vault references: %+v", vaultRefs))
 	}
 
 	return string(output)
@@ -602,58 +832,86 @@ func validatePath(data map[interface{}]interface{}, path string) error {
 	return nil
 }
 
-func mergeAllDocs(files []YamlFile, options mergeOpts) (map[interface{}]interface{}, error) {
-	// Create engine with settings from options
-	engineOpts := []graft.EngineOption{
-		graft.WithCache(true, 1000),
-		graft.WithConcurrency(10),
-		graft.WithEnhancedParser(true),
+// validateErrorFormat checks the value given to --error-format
+func validateErrorFormat(format string) error {
+	switch format {
+	case "", "text", "json":
+		return nil
+	}
+	return ansi.Errorf("@R{Invalid --error-format} @c{%s}@R{. Must be 'text' or 'json'.}", format)
+}
+
+// printError reports err on stderr. With the json error format, each failure
+// is written as a JSON record on a line of its own.
+func printError(err error, format string) {
+	if format != "json" {
+		log.PrintfStdErr("%s\n", err.Error())
+		return
 	}
+	for _, record := range graft.ErrorRecords(err) {
+		out, jsonErr := json.Marshal(record)
+		if jsonErr != nil {
+			log.PrintfStdErr("%s\n", err.Error())
+			return
+		}
+		log.PrintfStdErr("%s\n", out)
+	}
+}
 
-	// Set dataflow order if specified (default to alphabetical if not set)
-	dataflowOrder := options.DataflowOrder
-	if dataflowOrder == "" {
-		dataflowOrder = "alphabetical"
+// marshalDocument converts a merged document back to YAML. Keys are sorted
+// unless --preserve-order or --preserve-comments was given.
+func marshalDocument(doc graft.Document, options mergeOpts) ([]byte, error) {
+	if options.PreserveOrder || options.PreserveComments {
+		return doc.ToYAML()
 	}
-	engineOpts = append(engineOpts, graft.WithDataflowOrder(dataflowOrder))
+	return yaml.Marshal(doc.GetData())
+}
 
-	engine, err := graft.NewEngine(engineOpts...)
+func mergeAllDocs(files []YamlFile, options mergeOpts) (map[interface{}]interface{}, error) {
+	merged, err := mergeAllDocuments(files, options)
 	if err != nil {
-		return nil, ansi.Errorf("@R{Failed to create graft engine}: %s", err.Error())
+		return nil, err
 	}
 
-	// Parse all documents
-	docs := []graft.Document{}
-	for _, file := range files {
-		log.DEBUG("Processing file '%s'", file.Path)
+	// The CLI expects a map[interface{}]interface{}
+	return merged.GetData().(map[interface{}]interface{}), nil
+}
 
-		data, err := readFile(&file)
+func mergeAllDocuments(files []YamlFile, options mergeOpts) (graft.Document, error) {
+	var policy *graft.SecretPolicy
+	if options.SecretPolicy != "" {
+		data, err := os.ReadFile(options.SecretPolicy)
 		if err != nil {
-			return nil, err
+			return nil, ansi.Errorf("@R{Unable to read secret policy} @m{%s}: %s", options.SecretPolicy, err)
 		}
-
-		// Check if it's a go-patch document
-		if options.EnableGoPatch {
-			_, parseErr := parseYAML(data)
-			if isArrayError(parseErr) {
-				log.DEBUG("Detected root of document as an array. Attempting go-patch parsing")
-				ops, err := parseGoPatch(data)
-				if err != nil {
-					return nil, ansi.Errorf("@m{%s}: @R{%s}\n", file.Path, err.Error())
-				}
-				// Create a go-patch document
-				doc := graft.NewGoPatchDocument(ops)
-				docs = append(docs, doc)
-				continue
-			}
+		if policy, err = graft.ParseSecretPolicy(data); err != nil {
+			return nil, ansi.Errorf("@m{%s}: %s", options.SecretPolicy, err)
 		}
+	}
 
-		// Parse as YAML
-		doc, err := engine.ParseYAML(data)
+	// Strategies given with --merge-strategy come first, so they win over
+	// those in .graft.yml for the paths both match
+	var strategies []graft.MergeStrategy
+	if options.MergeStrategy != "" {
+		data, err := os.ReadFile(options.MergeStrategy)
 		if err != nil {
-			return nil, ansi.Errorf("@m{%s}: @R{%s}\n", file.Path, err.Error())
+			return nil, ansi.Errorf("@R{Unable to read merge strategies} @m{%s}: %s", options.MergeStrategy, err)
 		}
-		docs = append(docs, doc)
+		if strategies, err = graft.ParseMergeStrategies(data); err != nil {
+			return nil, ansi.Errorf("@m{%s}: %s", options.MergeStrategy, err)
+		}
+	}
+	strategies = append(strategies, configMergeStrategies()...)
+
+	// Create engine with settings from options and .graft.yml
+	engine, err := graft.NewEngine(engineOptions(options.DataflowOrder)...)
+	if err != nil {
+		return nil, ansi.Errorf("@R{Failed to create graft engine}: %s", err.Error())
+	}
+
+	docs, err := parseDocuments(engine, files, options.EnableGoPatch, patchFormats(options))
+	if err != nil {
+		return nil, err
 	}
 
 	// Merge all documents
@@ -664,10 +922,32 @@ func mergeAllDocs(files []YamlFile, options mergeOpts) (map[interface{}]interfac
 		mergeBuilder = mergeBuilder.WithArrayMergeStrategy(graft.AppendArrays)
 	}
 
+	if len(strategies) > 0 {
+		mergeBuilder = mergeBuilder.WithMergeStrategies(strategies...)
+	}
+
 	if options.SkipEval {
 		mergeBuilder = mergeBuilder.SkipEvaluation()
 	}
 
+	if options.PreserveOrder {
+		mergeBuilder = mergeBuilder.PreserveOrder()
+	}
+
+	if options.PreserveComments {
+		mergeBuilder = mergeBuilder.PreserveComments()
+	}
+
+	if options.trace != nil {
+		mergeBuilder = mergeBuilder.WithTrace(options.trace)
+	}
+
+	if options.Redact && options.redactor != nil {
+		mergeBuilder = mergeBuilder.WithRedactor(options.redactor)
+	} else if options.Redact {
+		mergeBuilder = mergeBuilder.Redact()
+	}
+
 	// Apply cherry-pick keys at the builder level
 	if len(options.CherryPick) > 0 {
 		mergeBuilder = mergeBuilder.WithCherryPick(options.CherryPick...)
@@ -685,46 +965,111 @@ func mergeAllDocs(files []YamlFile, options mergeOpts) (map[interface{}]interfac
 		if strings.Contains(err.Error(), "error(s) detected:") {
 			return nil, err
 		}
-		return nil, ansi.Errorf("@R{Merge failed}: %s", err.Error())
+		return nil, fmt.Errorf("%s: %w", ansi.Sprintf("@R{Merge failed}"), err)
 	}
 
-	// Get the raw data for backward compatibility
-	// The CLI expects a map[interface{}]interface{}
-	return merged.GetData().(map[interface{}]interface{}), nil
+	if policy != nil {
+		if err := policy.Enforce(merged); err != nil {
+			return nil, err
+		}
+	}
+
+	return merged, nil
 }
 
-func diffFiles(paths []string) (string, bool, error) {
-	if len(paths) != 2 {
-		return "", false, ansi.Errorf("incorrect number of files given to diffFiles(); please file a bug report")
+// withPatchFiles returns the files to merge, followed by the files given to
+// --json-patch and --merge-patch that are not among them
+func withPatchFiles(options mergeOpts) []string {
+	paths := append([]string{}, options.Files...)
+	for _, patch := range append(append([]string{}, options.JSONPatch...), options.MergePatch...) {
+		listed := false
+		for _, path := range options.Files {
+			listed = listed || path == patch
+		}
+		if !listed {
+			paths = append(paths, patch)
+		}
 	}
+	return paths
+}
 
-	from, to, err := ytbx.LoadFiles(paths[0], paths[1])
-	if err != nil {
-		return "", false, err
+// patchFormats maps the files given to --json-patch and --merge-patch to
+// their formats
+func patchFormats(options mergeOpts) map[string]graft.PatchFormat {
+	formats := map[string]graft.PatchFormat{}
+	for _, path := range options.JSONPatch {
+		formats[path] = graft.JSONPatchFormat
 	}
-
-	report, err := dyff.CompareInputFiles(from, to)
-	if err != nil {
-		return "", false, err
+	for _, path := range options.MergePatch {
+		formats[path] = graft.MergePatchFormat
 	}
+	return formats
+}
 
-	reportWriter := &dyff.HumanReport{
-		Report:            report,
-		DoNotInspectCerts: false,
-		NoTableStyle:      false,
-		OmitHeader:        true,
+// patchFormat says whether file is a JSON Patch or JSON Merge Patch, going
+// by the formats given on the command line, then by its contents, which
+// give away JSON Patches, then by its name, which gives away merge patches
+// named like `tweaks.merge-patch.json`
+func patchFormat(file YamlFile, data []byte, formats map[string]graft.PatchFormat) (graft.PatchFormat, bool) {
+	if format, ok := formats[file.Path]; ok {
+		return format, true
 	}
-
-	var buf bytes.Buffer
-	out := bufio.NewWriter(&buf)
-	if err := reportWriter.WriteReport(out); err != nil {
-		return "", false, fmt.Errorf("failed to write report: %v", err)
+	if graft.IsJSONPatch(data) {
+		return graft.JSONPatchFormat, true
 	}
-	if err := out.Flush(); err != nil {
-		return "", false, fmt.Errorf("failed to flush report: %v", err)
+	if strings.Contains(filepath.Base(file.Path), ".merge-patch.") {
+		return graft.MergePatchFormat, true
 	}
+	return "", false
+}
 
-	return buf.String(), len(report.Diffs) > 0, nil
+// parseDocuments parses each file into a document named after it, treating
+// files whose root is a list as go-patch operations when enableGoPatch is
+// set, and JSON Patches and JSON Merge Patches as such
+func parseDocuments(engine graft.Engine, files []YamlFile, enableGoPatch bool, patches map[string]graft.PatchFormat) ([]graft.Document, error) {
+	docs := []graft.Document{}
+	for _, file := range files {
+		log.DEBUG("Processing file '%s'", file.Path)
+
+		data, err := readFile(&file)
+		if err != nil {
+			return nil, err
+		}
+
+		if format, ok := patchFormat(file, data, patches); ok {
+			log.DEBUG("Parsing '%s' as a %s", file.Path, format)
+			doc, err := graft.ParsePatch(data, format)
+			if err != nil {
+				return nil, ansi.Errorf("@m{%s}: @R{%s}\n", file.Path, err.Error())
+			}
+			docs = append(docs, graft.WithSourceName(doc, file.Path))
+			continue
+		}
+
+		// Check if it's a go-patch document
+		if enableGoPatch {
+			_, parseErr := parseYAML(data)
+			if isArrayError(parseErr) {
+				log.DEBUG("Detected root of document as an array. Attempting go-patch parsing")
+				ops, err := parseGoPatch(data)
+				if err != nil {
+					return nil, ansi.Errorf("@m{%s}: @R{%s}\n", file.Path, err.Error())
+				}
+				// Create a go-patch document
+				doc := graft.NewGoPatchDocument(ops)
+				docs = append(docs, doc)
+				continue
+			}
+		}
+
+		// Parse as YAML
+		doc, err := engine.ParseYAML(data)
+		if err != nil {
+			return nil, ansi.Errorf("@m{%s}: @R{%s}\n", file.Path, err.Error())
+		}
+		docs = append(docs, graft.WithSourceName(doc, file.Path))
+	}
+	return docs, nil
 }
 
 type RootIsArrayError struct {
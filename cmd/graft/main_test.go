@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -16,6 +18,8 @@ import (
 
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/wayneeseguin/graft/log"
+	"github.com/wayneeseguin/graft/pkg/graft"
+	"github.com/wayneeseguin/graft/pkg/graft/operators"
 )
 
 func openFiles(paths []string) ([]YamlFile, error) {
@@ -586,6 +590,90 @@ storage: 4096
 			So(stdout, ShouldEqual, "")
 			So(stderr, ShouldContainSubstring, "$.nested.key.override: provide nested override\n")
 		})
+		Convey("--error-format=json reports one record per failure", func() {
+			os.Args = []string{"graft", "merge", "--error-format", "json", "../../assets/error-format/base.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldEqual, `{"type":"evaluation_error","path":"$.jobs.web.size","operator":"grab","position":{"line":5,"column":3,"file":"../../assets/error-format/base.yml"},"file":"../../assets/error-format/base.yml","message":"Unable to resolve `+"`meta.size`: `$.meta.size`"+` could not be found in the datastructure"}
+{"type":"evaluation_error","path":"$.jobs.web.url","operator":"concat","position":{"line":6,"column":3,"file":"../../assets/error-format/base.yml"},"file":"../../assets/error-format/base.yml","message":"Unable to resolve `+"`meta.host`: `$.meta.host`"+` could not be found in the datastructure"}
+`)
+			So(rc, ShouldEqual, 2)
+		})
+		Convey("--error-format=json reports parameters that were not set", func() {
+			os.Args = []string{"graft", "merge", "--error-format", "json", "../../assets/params/global.yml", "../../assets/params/fail.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldContainSubstring, `"type":"evaluation_error","path":"$.nested.key.override","operator":"param"`)
+			So(stderr, ShouldContainSubstring, `"message":"provide nested override"}`)
+		})
+		Convey("--error-format rejects unknown formats", func() {
+			os.Args = []string{"graft", "merge", "--error-format", "xml", "../../assets/error-format/base.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldEqual, "Invalid --error-format xml. Must be 'text' or 'json'.\n")
+			So(rc, ShouldEqual, 2)
+		})
+		Convey("--explain traces operator calls to stderr", func() {
+			os.Args = []string{"graft", "merge", "--explain", "--explain-path", "meta", "../../assets/explain-trace/base.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldContainSubstring, "size: small\n")
+			So(stderr, ShouldEqual, `$.meta.size: (( grab meta.sizes.large || "small" ))
+  input  meta.sizes.large || "small" = "small"
+    tried  meta.sizes.large: Unable to resolve `+"`meta.sizes.large`: `$.meta.sizes`"+` could not be found in the datastructure
+    won    "small" = "small"
+  value  "small"
+$.meta.url: (( concat "https://" meta.name "." meta.domain ))
+  input  "https://" = "https://"
+  input  meta.name = "web"
+  input  "." = "."
+  input  meta.domain = "example.com"
+  value  "https://web.example.com"
+`)
+		})
+		Convey("--explain-format rejects unknown formats", func() {
+			os.Args = []string{"graft", "merge", "--explain", "--explain-format", "xml", "../../assets/explain-trace/base.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldEqual, "Invalid --explain-format xml. Must be 'tree' or 'json'.\n")
+			So(rc, ShouldEqual, 2)
+		})
+		Convey("--explain shows the default a vault call fell back to", func() {
+			os.Args = []string{"graft", "merge", "--explain", "--secrets-file", "../../assets/secrets/bundle.yml", "../../assets/explain-trace/vault.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "password: changeme\n\n")
+			So(stderr, ShouldEqual, `$.password: (( vault "secret/missing:password" || "changeme" ))
+  input  "secret/missing:password" = "secret/missing:password"
+  input  "changeme" = "changeme"
+  value  "changeme"
+`)
+		})
+		Convey("fan --explain traces the merge into each target", func() {
+			os.Args = []string{"graft", "fan", "--explain", "--explain-path", "meta.size", "../../assets/explain-trace/base.yml", "../../assets/explain-trace/targets.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldContainSubstring, "name: worker\n")
+			trace := `$.meta.size: (( grab meta.sizes.large || "small" ))
+  input  meta.sizes.large || "small" = "small"
+    tried  meta.sizes.large: Unable to resolve ` + "`meta.sizes.large`: `$.meta.sizes`" + ` could not be found in the datastructure
+    won    "small" = "small"
+  value  "small"
+`
+			So(stderr, ShouldEqual, "--- ../../assets/explain-trace/targets.yml[0]\n"+trace+
+				"--- ../../assets/explain-trace/targets.yml[1]\n"+trace)
+		})
 		Convey("Pruning takes place after parameters", func() {
 			os.Args = []string{"graft", "merge", "--prune", "nested", "../../assets/params/global.yml", "../../assets/params/fail.yml"}
 			stdout = ""
@@ -644,7 +732,10 @@ quux: quux
 				stderr = ""
 				main()
 				So(stdout, ShouldEqual, "")
-				So(stderr, ShouldContainSubstring, "cycle detected")
+				So(stderr, ShouldEqual, `Merge failed: cycle detected in operator data-flow graph: a -> b -> a
+    $.a: (( concat "a" b )) (../../assets/concat/loop.yml:1)
+    $.b: (( concat a "b" )) (../../assets/concat/loop.yml:2)
+`)
 			})
 		})
 
@@ -771,6 +862,171 @@ quux: quux
 			So(stderr, ShouldEqual, "")
 		})
 
+		Convey("vaultinfo reports the versions vault calls are pinned to", func() {
+			os.Args = []string{"graft", "vaultinfo", "../../assets/vaultinfo/versions.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, `secrets:
+- key: secret/db:@created_time
+  references:
+  - meta.created
+- key: secret/db:password
+  references:
+  - meta.latest
+- key: secret/db:password@v2
+  version: 2
+  references:
+  - meta.pinned
+
+`)
+			So(stderr, ShouldEqual, "")
+		})
+
+		Convey("vaultinfo names the target of references to vaults other than the default", func() {
+			os.Args = []string{"graft", "vaultinfo", "../../assets/vaultinfo/alternatives.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldStartWith, `secrets:
+- target: production
+  key: secret/app:token
+  references:
+  - meta.token
+- key: secret/db:password
+  references:
+  - meta.legacy
+  - meta.password
+`)
+			So(stderr, ShouldEqual, "")
+		})
+
+		Convey("vaultinfo groups references by target, secret and key", func() {
+			os.Args = []string{"graft", "vaultinfo", "--format", "yaml", "../../assets/vaultinfo/alternatives.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, `targets:
+- target: default
+  secrets:
+  - path: secret/db
+    keys:
+    - key: password
+      references:
+      - meta.legacy
+      - meta.password
+    - key: password
+      version: 2
+      references:
+      - meta.pinned
+    - key: user
+      references:
+      - meta.user
+  - path: secret/legacy/db
+    keys:
+    - key: user
+      references:
+      - meta.user
+  - path: secret/shared/db
+    keys:
+    - key: password
+      references:
+      - meta.password
+  - path: secret/v2/db
+    keys:
+    - key: password
+      references:
+      - meta.legacy
+- target: production
+  secrets:
+  - path: secret/app
+    keys:
+    - key: token
+      references:
+      - meta.token
+
+`)
+			So(stderr, ShouldEqual, "")
+		})
+
+		Convey("vaultinfo lists the references to one target as JSON", func() {
+			os.Args = []string{"graft", "vaultinfo", "--format", "json", "--target", "production", "../../assets/vaultinfo/alternatives.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, `{
+  "targets": [
+    {
+      "target": "production",
+      "secrets": [
+        {
+          "path": "secret/app",
+          "keys": [
+            {
+              "key": "token",
+              "references": [
+                "meta.token"
+              ]
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}
+`)
+			So(stderr, ShouldEqual, "")
+		})
+
+		Convey("vaultinfo writes a read policy for exactly the referenced secrets", func() {
+			os.Args = []string{"graft", "vaultinfo", "--policy", "../../assets/vaultinfo/alternatives.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, `# read policy for the default vault
+path "secret/data/db" {
+  capabilities = ["read"]
+}
+path "secret/legacy/db" {
+  capabilities = ["read"]
+}
+path "secret/shared/db" {
+  capabilities = ["read"]
+}
+path "secret/v2/db" {
+  capabilities = ["read"]
+}
+
+# read policy for vault@production
+path "secret/app" {
+  capabilities = ["read"]
+}
+`)
+			So(stderr, ShouldEqual, "")
+
+			os.Args = []string{"graft", "vaultinfo", "--policy", "--target", "default", "--kv2", "secret", "../../assets/vaultinfo/versions.yml"}
+			stdout = ""
+			main()
+			So(stdout, ShouldEqual, `# read policy for the default vault
+path "secret/data/db" {
+  capabilities = ["read"]
+}
+path "secret/metadata/db" {
+  capabilities = ["read"]
+}
+`)
+			So(stderr, ShouldEqual, "")
+		})
+
+		Convey("vaultinfo rejects unknown formats", func() {
+			os.Args = []string{"graft", "vaultinfo", "--format", "xml", "../../assets/vaultinfo/single.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldContainSubstring, "Unknown vaultinfo format xml")
+		})
+
 		Convey("vaultinfo can handle improper yaml", func() {
 			os.Args = []string{"graft", "vaultinfo", "../../assets/vaultinfo/improper.yml"}
 			stdout = ""
@@ -780,6 +1036,251 @@ quux: quux
 			So(stderr, ShouldContainSubstring, "parse_error: failed to parse YAML")
 		})
 
+		Convey("refsinfo lists external references without contacting the services", func() {
+			os.Args = []string{"graft", "refsinfo", "../../assets/refsinfo/external.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `references:
+- operator: awsparam
+  target: default
+  path: /app/prod/db/password
+  references:
+  - db.password
+- operator: awssecret
+  target: default
+  path: app/db-admin
+  references:
+  - db.admin
+- operator: awssecret
+  target: prod
+  path: app/token
+  references:
+  - token
+- operator: file
+  target: default
+  path: ../../assets/refsinfo/motd.txt
+  references:
+  - motd
+- operator: load
+  target: default
+  path: https://example.com/defaults.yml
+  references:
+  - remote
+- operator: nats
+  target: default
+  path: kv:flags/app
+  references:
+  - flags
+- operator: vault
+  target: default
+  path: secret/db:password
+  references:
+  - db.vault
+
+`)
+		})
+
+		Convey("refsinfo writes an IAM policy for the AWS references of one target", func() {
+			os.Args = []string{"graft", "refsinfo", "--iam-policy", "../../assets/refsinfo/external.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldContainSubstring, "AWS references go to several targets (default, prod); pick one with --target")
+
+			os.Setenv("AWS_REGION", "us-east-1")
+			defer os.Unsetenv("AWS_REGION")
+			os.Args = []string{"graft", "refsinfo", "--iam-policy", "--target", "default", "--aws-account", "123456789012", "../../assets/refsinfo/external.yml"}
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "GraftReadParameters",
+      "Effect": "Allow",
+      "Action": [
+        "ssm:GetParameter"
+      ],
+      "Resource": [
+        "arn:aws:ssm:us-east-1:123456789012:parameter/app/prod/db/password"
+      ]
+    },
+    {
+      "Sid": "GraftReadSecrets",
+      "Effect": "Allow",
+      "Action": [
+        "secretsmanager:GetSecretValue"
+      ],
+      "Resource": [
+        "arn:aws:secretsmanager:us-east-1:123456789012:secret:app/db-admin-??????"
+      ]
+    }
+  ]
+}
+`)
+		})
+
+		Convey("refsinfo reports the references to one target as JSON", func() {
+			os.Args = []string{"graft", "refsinfo", "--format", "json", "--target", "prod", "../../assets/refsinfo/external.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `{
+  "references": [
+    {
+      "operator": "awssecret",
+      "target": "prod",
+      "path": "app/token",
+      "references": [
+        "token"
+      ]
+    }
+  ]
+}
+`)
+		})
+
+		Convey("merge answers vault and aws calls from a secret bundle", func() {
+			graft.SkipVault = false // left on by the vaultinfo tests
+			defer operators.UseSecretBundle(nil)
+			os.Args = []string{"graft", "merge", "--secrets-file", "../../assets/secrets/bundle.yml", "../../assets/secrets/manifest.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `db:
+  host: db.example.com
+  password: hunter2
+token: prod-token
+
+`)
+		})
+
+		Convey("secrets encrypts bundles that merge can decrypt", func() {
+			graft.SkipVault = false // left on by the vaultinfo tests
+			defer operators.UseSecretBundle(nil)
+			os.Setenv("GRAFT_SECRETS_KEY", "correct horse")
+			defer os.Unsetenv("GRAFT_SECRETS_KEY")
+
+			os.Args = []string{"graft", "secrets", "encrypt", "../../assets/secrets/bundle.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldStartWith, "graft_secret_bundle: 1\n")
+			So(stdout, ShouldNotContainSubstring, "hunter2")
+
+			sealed, err := os.CreateTemp("", "graft-bundle-*.yml")
+			So(err, ShouldBeNil)
+			defer os.Remove(sealed.Name())
+			_, err = sealed.WriteString(stdout)
+			So(err, ShouldBeNil)
+			sealed.Close()
+
+			os.Args = []string{"graft", "merge", "--secrets-file", sealed.Name(), "../../assets/secrets/manifest.yml"}
+			stdout = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldContainSubstring, "password: hunter2")
+
+			os.Args = []string{"graft", "secrets", "decrypt", sealed.Name()}
+			stdout = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			plain, err := os.ReadFile("../../assets/secrets/bundle.yml")
+			So(err, ShouldBeNil)
+			So(stdout, ShouldEqual, string(plain))
+
+			os.Setenv("GRAFT_SECRETS_KEY", "battery staple")
+			os.Args = []string{"graft", "merge", "--secrets-file", sealed.Name(), "../../assets/secrets/manifest.yml"}
+			stdout = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldContainSubstring, "wrong passphrase")
+		})
+
+		Convey("merge --redact masks secrets and the values derived from them", func() {
+			graft.SkipVault = false // left on by the vaultinfo tests
+			defer operators.UseSecretBundle(nil)
+			os.Args = []string{"graft", "merge", "--secrets-file", "../../assets/secrets/bundle.yml", "--redact", "../../assets/secrets/derived.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `creds:
+  password: REDACTED
+  token: REDACTED
+  user: admin
+db:
+  url: REDACTED
+  user: admin
+meta:
+  password: REDACTED
+  token: REDACTED
+  user: admin
+token: REDACTED
+
+`)
+		})
+
+		Convey("merge --secret-policy fails when secrets end up outside the allowed paths", func() {
+			graft.SkipVault = false // left on by the vaultinfo tests
+			defer operators.UseSecretBundle(nil)
+			os.Args = []string{"graft", "merge", "--secrets-file", "../../assets/secrets/bundle.yml", "--secret-policy", "../../assets/secrets/policy.yml", "../../assets/secrets/derived.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldContainSubstring, "2 error(s) detected")
+			So(stderr, ShouldContainSubstring, `$.db.url holds a secret from (( vault "secret/db:password" )) at $.meta.password; the secret policy allows secrets only under meta.*, creds.*`)
+			So(stderr, ShouldContainSubstring, `$.token holds a secret from (( awssecret@production "app/token" )) at $.meta.token`)
+
+			os.Args = []string{"graft", "merge", "--secrets-file", "../../assets/secrets/bundle.yml", "--secret-policy", "../../assets/secrets/policy.yml", "--prune", "db", "--prune", "token", "../../assets/secrets/derived.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldContainSubstring, "creds:")
+		})
+
+		Convey("merge replays the lookups it recorded, without vault or aws", func() {
+			graft.SkipVault = false // left on by the vaultinfo tests
+			defer operators.UseSecretBundle(nil)
+			defer operators.ReplayLookups(nil)
+			recording, err := os.CreateTemp("", "graft-lookups-*.yml")
+			So(err, ShouldBeNil)
+			recording.Close()
+			defer os.Remove(recording.Name())
+
+			os.Args = []string{"graft", "merge", "--secrets-file", "../../assets/secrets/bundle.yml", "--record", recording.Name(), "../../assets/secrets/manifest.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			recorded := stdout
+
+			data, err := os.ReadFile(recording.Name())
+			So(err, ShouldBeNil)
+			So(string(data), ShouldContainSubstring, "key: secret/db:password")
+
+			os.Args = []string{"graft", "merge", "--replay", recording.Name(), "../../assets/secrets/manifest.yml"}
+			stdout = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, recorded)
+
+			os.Args = []string{"graft", "merge", "--replay", recording.Name(), "../../assets/vaultinfo/alternatives.yml"}
+			stdout = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldContainSubstring, "was recorded; record the merge again with --record")
+		})
+
 		Convey("Adding (dynamic) prune support for list entries (edge case scenario)", func() {
 			os.Args = []string{"graft", "merge", "../../assets/prune/prune-in-lists/fileA.yml", "../../assets/prune/prune-in-lists/fileB.yml"}
 			stdout = ""
@@ -1392,7 +1893,316 @@ int: 7776000
         non_basic_services_allowed: true
 
 `)
-			}
+			}
+		})
+
+		Convey("--preserve-order keeps first-seen key order across files", func() {
+			os.Args = []string{"graft", "merge", "--preserve-order", "../../assets/preserve-order/base.yml", "../../assets/preserve-order/overlay.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `name: my-deployment
+meta:
+  zone: z1
+  size: large
+  extra: added
+instance_groups:
+- name: web
+  instances: 3
+  azs:
+  - z1
+  vm_type: large
+- name: worker
+  vm_type: small
+  instances: 1
+copy:
+  zone: z1
+  size: large
+  extra: added
+update:
+  canaries: 1
+
+`)
+		})
+
+		Convey("--preserve-comments keeps comments from the last file to define a key", func() {
+			os.Args = []string{"graft", "merge", "--preserve-order", "--preserve-comments", "../../assets/preserve-comments/base.yml", "../../assets/preserve-comments/overlay.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `# Base template for the web tier
+
+meta:
+  quota: 20
+  # overridden per environment
+  name: api
+jobs:
+# the frontend
+- name: web
+  instances: 2 # HA pair
+quota: 20 # copied from meta
+
+`)
+		})
+
+		Convey("explain reports the file, line and operator behind a value", func() {
+			os.Args = []string{"graft", "explain", "jobs.web", "../../assets/explain/base.yml", "../../assets/explain/prod.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `jobs.web
+  from ../../assets/explain/base.yml:5:3
+jobs.web.instances: 3
+  from ../../assets/explain/base.yml:6:3
+  via  (( grab meta.instances ))
+jobs.web.name: web
+  from ../../assets/explain/base.yml:5:3
+
+`)
+		})
+
+		Convey("explain fails for paths that are not in the merged document", func() {
+			os.Args = []string{"graft", "explain", "jobs.db", "../../assets/explain/base.yml", "../../assets/explain/prod.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldContainSubstring, "`jobs.db` could not be found in the merged document")
+		})
+
+		Convey("diff --format json lists the filtered differences and exits 1", func() {
+			os.Args = []string{"graft", "diff", "--format", "json", "--include", "jobs.*.instances", "--include", "meta", "--ignore-order", "../../assets/diff/old.yml", "../../assets/diff/new.yml"}
+			stdout = ""
+			stderr = ""
+			rc = 0
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `[
+  {
+    "path": "jobs.web.instances",
+    "kind": "modified",
+    "from": 2,
+    "to": 4
+  },
+  {
+    "path": "meta.env",
+    "kind": "modified",
+    "from": "staging",
+    "to": "production"
+  }
+]
+`)
+			So(rc, ShouldEqual, 1)
+		})
+
+		Convey("diff --format github annotates the lines that changed", func() {
+			os.Args = []string{"graft", "diff", "--format", "github", "--exclude", "meta", "../../assets/diff/old.yml", "../../assets/diff/new.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `::notice file=../../assets/diff/new.yml,line=8,title=$.jobs.web.instances modified::modified from 2 to 4
+::notice file=../../assets/diff/old.yml,line=9,title=$.jobs.db.persistent_disk removed::removed 10240
+::notice file=../../assets/diff/new.yml,line=9,title=$.jobs.worker added::added {"instances":1,"name":"worker"}
+::notice file=../../assets/diff/new.yml,line=4,title=$.jobs reordered::reordered from ["web","db"] to ["db","web"]
+`)
+		})
+
+		Convey("diff exits 0 for files without differences", func() {
+			os.Args = []string{"graft", "diff", "--format", "patch", "../../assets/diff/old.yml", "../../assets/diff/old.yml"}
+			stdout = ""
+			stderr = ""
+			rc = 0
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, "--- ../../assets/diff/old.yml\n+++ ../../assets/diff/old.yml\n")
+			So(rc, ShouldEqual, 0)
+		})
+
+		Convey("diff --merge compares the merged and evaluated results of each side", func() {
+			graft.SkipVault = false // left on by the vaultinfo tests
+			defer operators.UseSecretBundle(nil)
+			os.Args = []string{"graft", "diff", "--merge", "--secrets-file", "../../assets/secrets/bundle.yml", "--format", "patch", "--prune", "meta",
+				"../../assets/diff/merge/base.yml", "../../assets/diff/merge/staging.yml", "--",
+				"../../assets/diff/merge/base.yml", "../../assets/diff/merge/production.yml"}
+			stdout = ""
+			stderr = ""
+			rc = 0
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `--- ../../assets/diff/merge/base.yml ../../assets/diff/merge/staging.yml
++++ ../../assets/diff/merge/base.yml ../../assets/diff/merge/production.yml
+@@ $.jobs.web.env @@ modified
+- staging
++ production
+@@ $.jobs.web.instances @@ modified
+- 2
++ 4
+@@ $.jobs.web.url @@ modified
+- postgres://admin:hunter2@db
++ postgres://prod:hunter2@db
+`)
+			So(rc, ShouldEqual, 1)
+
+			Convey("masking secrets with --redact, while still showing that they changed", func() {
+				os.Args = []string{"graft", "diff", "--merge", "--secrets-file", "../../assets/secrets/bundle.yml", "--redact", "--format", "json", "--include", "jobs.web.url",
+					"../../assets/diff/merge/base.yml", "../../assets/diff/merge/staging.yml", "--",
+					"../../assets/diff/merge/base.yml", "../../assets/diff/merge/production.yml"}
+				stdout = ""
+				stderr = ""
+				main()
+				So(stderr, ShouldEqual, "")
+				So(stdout, ShouldContainSubstring, `"path": "jobs.web.url"`)
+				So(stdout, ShouldContainSubstring, `"from": "REDACTED-`)
+				So(stdout, ShouldNotContainSubstring, "hunter2")
+			})
+		})
+
+		Convey("diff --merge needs a -- between the two sides", func() {
+			os.Args = []string{"graft", "diff", "--merge", "../../assets/diff/merge/base.yml", "../../assets/diff/merge/staging.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldContainSubstring, "graft diff --merge needs the files to merge on each side of a --")
+		})
+
+		Convey("patch writes the go-patch ops that turn one file into another", func() {
+			os.Args = []string{"graft", "patch", "../../assets/patch/upstream.yml", "../../assets/patch/local.yml"}
+			stdout = ""
+			stderr = ""
+			rc = 0
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `- type: remove
+  path: /instance_groups/name=diego-cell
+- type: replace
+  path: /instance_groups/name=api/instances
+  value: 3
+- type: replace
+  path: /instance_groups/name=api/jobs/name=cloud_controller_ng/properties/ssl
+  value: true
+- type: replace
+  path: /instance_groups/-
+  value:
+    instances: 1
+    name: tcp-router
+- type: replace
+  path: /variables?
+  value:
+  - name: router_ca
+    type: certificate
+`)
+			So(rc, ShouldEqual, 0)
+		})
+
+		Convey("patch needs exactly two files", func() {
+			os.Args = []string{"graft", "patch", "../../assets/patch/upstream.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldContainSubstring, "graft patch needs exactly two files to compare")
+			So(rc, ShouldEqual, 2)
+		})
+
+		Convey("lint exits 0 when nothing is wrong", func() {
+			os.Args = []string{"graft", "lint", "../../assets/lint/base.yml", "../../assets/lint/prod.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, "no problems found\n")
+			So(rc, ShouldEqual, 0)
+		})
+
+		Convey("lint reports problems with their locations and exits 2 on errors", func() {
+			os.Args = []string{"graft", "lint", "../../assets/lint/base.yml", "../../assets/lint/broken.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `../../assets/lint/base.yml:2:3: warning: $.meta.env: (( param )) is not overridden by any of the given files
+../../assets/lint/base.yml:7:3: error: $.jobs.web.instances: `+"`$.meta.instances`"+` is not defined by any file
+../../assets/lint/broken.yml:2:3: warning: $.meta.db_host: `+"`$.meta.hosts.db`"+` is not defined by any file; the fallback after `+"`||`"+` will always be used
+../../assets/lint/broken.yml:5:3: error: $.jobs.0: malformed array operator (( insert after web ))
+../../assets/lint/broken.yml:7:3: error: $.jobs.worker.size: unknown operator (( frobnicate ))
+3 error(s), 2 warning(s)
+`)
+			So(rc, ShouldEqual, 2)
+		})
+
+		Convey("lint exits 1 when there are only warnings", func() {
+			os.Args = []string{"graft", "lint", "--json", "../../assets/lint/base.yml", "../../assets/lint/prod.yml", "../../assets/lint/unused.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `[
+  {
+    "severity": "warning",
+    "file": "../../assets/lint/prod.yml",
+    "line": 3,
+    "column": 3,
+    "path": "meta.instances",
+    "message": "this value is unused; a later (( param )) replaces it"
+  },
+  {
+    "severity": "warning",
+    "file": "../../assets/lint/unused.yml",
+    "line": 2,
+    "column": 3,
+    "path": "meta.instances",
+    "operator": "(( param \"set this per environment\" ))",
+    "message": "(( param )) is not overridden by any of the given files"
+  }
+]
+`)
+			So(rc, ShouldEqual, 1)
+		})
+
+		Convey("deps prints the operator dependency graph as DOT", func() {
+			os.Args = []string{"graft", "deps", "--deps-of", "jobs.web.url", "../../assets/deps/base.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `digraph graft {
+  rankdir=LR;
+  node [shape=box];
+  "jobs.web.url" [label="jobs.web.url\ngrab", tooltip="(( grab meta.url ))"];
+  "meta.name" [label="meta.name\nconcat", tooltip="(( concat meta.env \"-web\" ))"];
+  "meta.url" [label="meta.url\nconcat", tooltip="(( concat \"https://\" meta.name \".\" meta.domain ))"];
+  "jobs.web.url" -> "meta.url";
+  "meta.url" -> "meta.name";
+}
+`)
+		})
+
+		Convey("deps prints the dependents of a path as Mermaid", func() {
+			os.Args = []string{"graft", "deps", "--format", "mermaid", "--dependents-of", "meta.url", "../../assets/deps/base.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, `flowchart LR
+  n0["jobs.web.url<br/>grab"]
+  n1["meta.url<br/>concat"]
+  n0 --> n1
+`)
+		})
+
+		Convey("deps rejects unknown formats", func() {
+			os.Args = []string{"graft", "deps", "--format", "svg", "../../assets/deps/base.yml"}
+			stdout = ""
+			stderr = ""
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldEqual, "Invalid --format svg. Must be 'dot', 'json' or 'mermaid'.\n")
+			So(rc, ShouldEqual, 2)
 		})
 
 		Convey("Sort test cases", func() {
@@ -2345,6 +3155,130 @@ key2:
     super_nested: 2
   other: 3
 
+`)
+			})
+		})
+		Convey("Support JSON Patch and JSON Merge Patch files", func() {
+			Convey("JSON Patches are detected, and applied in sequence with the other files", func() {
+				os.Args = []string{"graft", "merge", "../../assets/json-patch/base.yml", "../../assets/json-patch/scale.json", "../../assets/json-patch/overlay.yml"}
+				stdout = ""
+				stderr = ""
+				main()
+				So(stderr, ShouldEqual, "")
+				So(stdout, ShouldEqual, `jobs:
+- instances: 4
+  name: web
+- instances: 1
+  name: worker
+- instances: 1
+  name: cron
+meta:
+  env: staging
+  owner: ops
+name: app
+
+`)
+			})
+			Convey("merge patches are detected by name, removing keys set to null", func() {
+				os.Args = []string{"graft", "merge", "../../assets/json-patch/base.yml", "../../assets/json-patch/overlay.yml", "../../assets/json-patch/tweaks.merge-patch.json"}
+				stdout = ""
+				stderr = ""
+				main()
+				So(stderr, ShouldEqual, "")
+				So(stdout, ShouldEqual, `jobs:
+- instances: 6
+  name: web
+meta:
+  debug: true
+  env: production
+  owner: ops
+  region: us-east-1
+
+`)
+			})
+			Convey("--merge-patch applies files after the others, unless they are among them", func() {
+				os.Args = []string{"graft", "merge", "--merge-patch", "../../assets/json-patch/overlay.yml", "../../assets/json-patch/base.yml"}
+				stdout = ""
+				stderr = ""
+				main()
+				So(stderr, ShouldEqual, "")
+				So(stdout, ShouldContainSubstring, "  owner: ops\n")
+				So(stdout, ShouldContainSubstring, "name: app\n")
+			})
+			Convey("patches that do not apply fail the merge, naming the file and operation", func() {
+				os.Args = []string{"graft", "merge", "--json-patch", "../../assets/json-patch/broken.json", "../../assets/json-patch/base.yml", "../../assets/json-patch/broken.json"}
+				stdout = ""
+				stderr = ""
+				main()
+				So(stderr, ShouldEqual, "Merge failed: ../../assets/json-patch/broken.json: JSON Patch operation [0] (remove /meta/missing): Expected to find a map key 'missing' for path '/meta/missing' (found map keys: 'debug', 'env')\n")
+				So(stdout, ShouldEqual, "")
+			})
+		})
+		Convey("Support merge strategy files", func() {
+			Convey("lists and maps merge as the strategies for their paths say", func() {
+				os.Args = []string{"graft", "merge", "--merge-strategy", "../../assets/merge-strategy/strategy.yml", "../../assets/merge-strategy/base.yml", "../../assets/merge-strategy/overlay.yml"}
+				stdout = ""
+				stderr = ""
+				main()
+				So(stderr, ShouldEqual, "")
+				So(stdout, ShouldEqual, `jobs:
+- id: web
+  instances: 2
+  networks:
+  - default
+  - public
+- id: db
+  instances: 3
+  networks:
+  - private
+- id: worker
+  instances: 1
+  networks:
+  - default
+meta:
+  allowed_cidrs:
+  - 10.0.0.0/8
+  - 192.168.0.0/16
+  - 172.16.0.0/12
+  tags:
+    team: platform
+
+`)
+			})
+			Convey("bad strategies are reported with the file they are in", func() {
+				os.Args = []string{"graft", "--color", "off", "merge", "--merge-strategy", "../../assets/merge-strategy/bad.yml", "../../assets/merge-strategy/base.yml"}
+				stdout = ""
+				stderr = ""
+				rc = 256
+				main()
+				So(stdout, ShouldEqual, "")
+				So(stderr, ShouldContainSubstring, "../../assets/merge-strategy/bad.yml: merge strategy for jobs has unknown list mode shuffle")
+				So(rc, ShouldEqual, 2)
+			})
+		})
+		Convey("Set array operators", func() {
+			Convey("union, intersect and subtract simple lists, and dedupe lists merged on a key", func() {
+				os.Args = []string{"graft", "--color", "off", "merge", "../../assets/set-ops/base.yml", "../../assets/set-ops/overlay.yml"}
+				stdout = ""
+				stderr = ""
+				main()
+				So(stderr, ShouldEqual, "warning: $.jobs: collapsing duplicate list entries with name: web\n")
+				So(stdout, ShouldEqual, `allowed_cidrs:
+- 10.0.0.0/8
+- 192.168.0.0/16
+- 172.16.0.0/12
+jobs:
+- instances: 4
+  name: web
+  networks:
+  - default
+ports:
+- 80
+- 443
+zones:
+- z1
+- z3
+
 `)
 			})
 		})
@@ -2482,6 +3416,373 @@ func TestDebug(t *testing.T) {
 	})
 }
 
+func TestConfig(t *testing.T) {
+	var stdout string
+	printfStdOut = func(format string, args ...interface{}) {
+		stdout = stdout + fmt.Sprintf(format, args...)
+	}
+	var stderr string
+	log.PrintfStdErr = func(format string, args ...interface{}) {
+		stderr += fmt.Sprintf(format, args...)
+	}
+
+	rc := 256 // invalid return code to catch any issues
+	exit = func(code int) {
+		rc = code
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	project := filepath.Join(dir, ".graft.yml")
+	Convey("graft config", t, func() {
+		stdout, stderr, rc = "", "", 0
+
+		Convey("show lists each setting and where it came from", func() {
+			So(os.WriteFile(project, []byte("engine:\n  dataflow_order: insertion\n"), 0644), ShouldBeNil)
+			t.Setenv("VAULT_TOKEN", "s.do-not-print")
+
+			os.Args = []string{"graft", "--color", "off", "config", "show"}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(rc, ShouldEqual, 0)
+			So(stdout, ShouldContainSubstring, "engine.dataflow_order                    insertion  (project "+project+")\n")
+			So(stdout, ShouldContainSubstring, "engine.vault.token                       <redacted>  (env VAULT_TOKEN)\n")
+			So(stdout, ShouldContainSubstring, "engine.color_output                      false  (flag --color)\n")
+			So(stdout, ShouldNotContainSubstring, "engine.output_format")
+			So(stdout, ShouldNotContainSubstring, "logging.")
+			So(stdout, ShouldEndWith, "project file: "+project+"\n")
+			So(stdout, ShouldNotContainSubstring, "s.do-not-print")
+		})
+
+		Convey("validate reports bad settings with their origin", func() {
+			So(os.WriteFile(project, []byte("engine:\n  dataflow_order: sideways\n"), 0644), ShouldBeNil)
+
+			os.Args = []string{"graft", "config", "validate"}
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldStartWith, "engine.dataflow_order: must be one of: ")
+			So(stderr, ShouldEndWith, " (project "+project+")\n1 problem(s) found\n")
+			So(rc, ShouldEqual, 2)
+		})
+
+		Convey("validate accepts a good configuration", func() {
+			So(os.WriteFile(project, []byte("engine:\n  dataflow_order: insertion\n"), 0644), ShouldBeNil)
+
+			os.Args = []string{"graft", "config", "validate"}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldEqual, "configuration is valid\nproject file: "+project+"\n")
+		})
+
+		Convey("validate leaves out settings graft does not act on", func() {
+			So(os.WriteFile(project, []byte("logging:\n  level: shouting\n"), 0644), ShouldBeNil)
+
+			os.Args = []string{"graft", "config", "validate"}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldStartWith, "configuration is valid\n")
+		})
+
+		Convey("lint merges with the merge strategies declared in the project file", func() {
+			So(os.WriteFile(project, []byte("merge:\n  strategies:\n    - path: jobs\n      key: id\n"), 0644), ShouldBeNil)
+			base := filepath.Join(dir, "base.yml")
+			So(os.WriteFile(base, []byte("jobs:\n- id: web\n  port: 80\n"), 0644), ShouldBeNil)
+			overlay := filepath.Join(dir, "overlay.yml")
+			So(os.WriteFile(overlay, []byte("jobs:\n- id: db\n  port: (( grab jobs.web.port ))\n"), 0644), ShouldBeNil)
+
+			os.Args = []string{"graft", "lint", base, overlay}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldNotContainSubstring, "jobs.web.port")
+			So(rc, ShouldEqual, 0)
+		})
+
+		Convey("merge uses the merge strategies declared in the project file", func() {
+			So(os.WriteFile(project, []byte("merge:\n  strategies:\n    - path: jobs\n      key: id\n    - path: meta.allowed_cidrs\n      list: append\n      dedupe: true\n"), 0644), ShouldBeNil)
+
+			os.Args = []string{"graft", "merge", filepath.Join(wd, "../../assets/merge-strategy/base.yml"), filepath.Join(wd, "../../assets/merge-strategy/overlay.yml")}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldContainSubstring, "- id: web\n")
+			So(stdout, ShouldContainSubstring, "  allowed_cidrs:\n  - 10.0.0.0/8\n  - 192.168.0.0/16\n  - 172.16.0.0/12\n")
+
+			stdout = ""
+			os.Args = []string{"graft", "--color", "off", "config", "show"}
+			main()
+			So(stdout, ShouldContainSubstring, "merge.strategies.1.dedupe")
+		})
+
+		Convey("validate reports bad merge strategies", func() {
+			So(os.WriteFile(project, []byte("merge:\n  strategies:\n    - path: jobs\n      list: append\n      key: id\n"), 0644), ShouldBeNil)
+
+			os.Args = []string{"graft", "config", "validate"}
+			main()
+			So(stderr, ShouldStartWith, "merge.strategies.0.key: only applies to list mode merge (project "+project+")")
+			So(rc, ShouldEqual, 2)
+		})
+
+		Convey("other commands refuse to run with a broken project file", func() {
+			So(os.WriteFile(project, []byte("engine:\n  dataflow: insertion\n"), 0644), ShouldBeNil)
+
+			os.Args = []string{"graft", "merge", filepath.Join(wd, "../../assets/deps/base.yml")}
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldContainSubstring, "Invalid configuration: parsing config file "+project)
+			So(stderr, ShouldContainSubstring, "field dataflow not found")
+			So(rc, ShouldEqual, 2)
+		})
+
+		Convey("commands that do not read settings ignore a broken project file", func() {
+			So(os.WriteFile(project, []byte("engine:\n  dataflow: insertion\n"), 0644), ShouldBeNil)
+
+			os.Args = []string{"graft", "json", filepath.Join(wd, "../../assets/deps/base.yml")}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(stdout, ShouldStartWith, "{")
+			So(rc, ShouldEqual, 0)
+		})
+
+		Convey("settings are not exported to the environment", func() {
+			So(os.WriteFile(project, []byte("engine:\n  vault:\n    address: https://vault.example.com\n"), 0644), ShouldBeNil)
+			plain := filepath.Join(dir, "plain.yml")
+			So(os.WriteFile(plain, []byte("name: web\n"), 0644), ShouldBeNil)
+
+			os.Args = []string{"graft", "merge", plain}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(os.Getenv("VAULT_ADDR"), ShouldEqual, "")
+		})
+	})
+}
+
+func TestTargets(t *testing.T) {
+	var stdout string
+	printfStdOut = func(format string, args ...interface{}) {
+		stdout = stdout + fmt.Sprintf(format, args...)
+	}
+	var stderr string
+	log.PrintfStdErr = func(format string, args ...interface{}) {
+		stderr += fmt.Sprintf(format, args...)
+	}
+
+	rc := 256 // invalid return code to catch any issues
+	exit = func(code int) {
+		rc = code
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	project := filepath.Join(dir, ".graft.yml")
+	if err := os.WriteFile(project, []byte(`targets:
+  vault:
+    production:
+      address: https://vault.example.com
+      token: s.do-not-print
+    staging:
+      address: https://vault.staging.example.com
+  nats:
+    events:
+      address: nats://nats.example.com:4222
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VAULT_STAGING_NAMESPACE", "staging")
+
+	Convey("graft targets", t, func() {
+		stdout, stderr, rc = "", "", 0
+
+		Convey("list shows each target and where it is declared", func() {
+			os.Args = []string{"graft", "--color", "off", "targets", "list", "production", "staging", "events"}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(rc, ShouldEqual, 0)
+			So(stdout, ShouldEqual, ""+
+				"vault@production  https://vault.example.com          project "+project+"\n"+
+				"vault@staging     https://vault.staging.example.com  project "+project+"; env VAULT_STAGING_NAMESPACE\n"+
+				"nats@events       nats://nats.example.com:4222       project "+project+"\n")
+		})
+
+		Convey("check reports the targets that are not usable", func() {
+			os.Args = []string{"graft", "--color", "off", "targets", "check", "vault@production", "vault@staging"}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(rc, ShouldEqual, 2)
+			So(stdout, ShouldStartWith, "vault@production  ok\nvault@staging     vault target 'staging' configuration not found")
+			So(stdout, ShouldEndWith, "1 of 2 target(s) have problems\n")
+			So(stdout, ShouldNotContainSubstring, "s.do-not-print")
+		})
+
+		Convey("check passes once every target is complete", func() {
+			t.Setenv("VAULT_STAGING_TOKEN", "s.also-secret")
+			os.Args = []string{"graft", "targets", "--json", "check", "staging"}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(rc, ShouldEqual, 0)
+
+			var checked []map[string]interface{}
+			So(json.Unmarshal([]byte(stdout), &checked), ShouldBeNil)
+			So(len(checked), ShouldEqual, 1)
+			So(checked[0]["name"], ShouldEqual, "staging")
+			So(checked[0]["problems"], ShouldBeNil)
+			So(stdout, ShouldNotContainSubstring, "s.also-secret")
+		})
+
+		Convey("naming an unknown target is an error", func() {
+			os.Args = []string{"graft", "--color", "off", "targets", "check", "nowhere"}
+			main()
+			So(stdout, ShouldEqual, "")
+			So(stderr, ShouldEqual, "No target named nowhere is declared\n")
+			So(rc, ShouldEqual, 2)
+		})
+	})
+}
+
+// TestVaultCommands runs the commands that talk to vault against one mock,
+// since the default vault client outlives a run of main()
+func TestVaultCommands(t *testing.T) {
+	var stdout string
+	printfStdOut = func(format string, args ...interface{}) {
+		stdout = stdout + fmt.Sprintf(format, args...)
+	}
+	var stderr string
+	log.PrintfStdErr = func(format string, args ...interface{}) {
+		stderr += fmt.Sprintf(format, args...)
+	}
+
+	rc := 256 // invalid return code to catch any issues
+	exit = func(code int) {
+		rc = code
+	}
+
+	writes := 0
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/sys/internal/ui/mounts":
+			fmt.Fprintf(w, `{"data":{"secret":{"secret/":{"type":"kv","options":{"version":"1"}},"kv/":{"type":"kv","options":{"version":"2"}}}}}`)
+		case r.Method != "GET":
+			writes++
+			w.WriteHeader(204)
+		case r.URL.Path == "/v1/secret/app":
+			fmt.Fprintf(w, `{"data":{"username":"admin"}}`)
+		case r.URL.Path == "/v1/kv/data/db":
+			version := r.URL.Query().Get("version")
+			if version == "" {
+				version = "7"
+			}
+			fmt.Fprintf(w, `{"data":{"data":{"password":"v%s"},"metadata":{"created_time":"2024-01-01T00:00:00Z","version":%s}}}`, version, version)
+		case r.URL.Path == "/v1/kv/metadata/db":
+			fmt.Fprintf(w, `{"data":{"created_time":"2024-01-01T00:00:00Z","updated_time":"2024-07-01T00:00:00Z","current_version":7,"versions":{}}}`)
+		default:
+			w.WriteHeader(404)
+			fmt.Fprintf(w, `{"errors":[]}`)
+		}
+	}))
+	defer mock.Close()
+	t.Setenv("VAULT_ADDR", mock.URL)
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	dir := t.TempDir()
+	generate := filepath.Join(dir, "generate.yml")
+	if err := os.WriteFile(generate, []byte(`username: (( vault-generate "secret/app:username" ))
+deploy:   (( vault-generate "secret/deploy:private" "ssh" 4096 ))
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lookup := filepath.Join(dir, "lookup.yml")
+	if err := os.WriteFile(lookup, []byte(`password: (( vault "secret/app:password" ))
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	versions := filepath.Join(dir, "versions.yml")
+	if err := os.WriteFile(versions, []byte(`latest:  (( vault "kv/db:password" ))
+pinned:  (( vault "kv/db:password@v2" ))
+created: (( vault "kv/db:@created_time" ))
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("graft merge --vault-generate-dry-run", t, func() {
+		stdout, stderr, rc = "", "", 0
+		graft.SkipVault = false // left on by the vaultinfo tests
+
+		Convey("lists the secrets vault-generate would write", func() {
+			os.Args = []string{"graft", "--color", "off", "merge", "--vault-generate-dry-run", generate}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(rc, ShouldEqual, 0)
+			So(stdout, ShouldEqual, ""+
+				"would generate secret/deploy:private,public,fingerprint (ssh 4096)\n"+
+				"1 secret(s) would be generated\n")
+			So(writes, ShouldEqual, 0)
+		})
+
+		Convey("includes plain vault calls with --vault-generate-missing", func() {
+			os.Args = []string{"graft", "--color", "off", "merge", "--vault-generate-missing", "--vault-generate-dry-run", generate, lookup}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(rc, ShouldEqual, 0)
+			So(stdout, ShouldEqual, ""+
+				"would generate secret/deploy:private,public,fingerprint (ssh 4096)\n"+
+				"would generate secret/app:password (random)\n"+
+				"2 secret(s) would be generated\n")
+			So(writes, ShouldEqual, 0)
+		})
+	})
+
+	Convey("graft vaultinfo --resolve", t, func() {
+		stdout, stderr, rc = "", "", 0
+
+		Convey("reports the versions vault resolved each secret to", func() {
+			os.Args = []string{"graft", "vaultinfo", "--resolve", versions}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(rc, ShouldEqual, 0)
+			So(stdout, ShouldEqual, `secrets:
+- key: kv/db:@created_time
+  references:
+  - created
+- key: kv/db:password
+  version: 7
+  references:
+  - latest
+- key: kv/db:password@v2
+  version: 2
+  references:
+  - pinned
+
+`)
+		})
+
+		Convey("never writes to vault", func() {
+			os.Args = []string{"graft", "vaultinfo", "--resolve", generate}
+			main()
+			So(stderr, ShouldEqual, "")
+			So(rc, ShouldEqual, 0)
+			So(writes, ShouldEqual, 0)
+		})
+	})
+}
+
 func TestFan(t *testing.T) {
 	var stdout string
 	printfStdOut = func(format string, args ...interface{}) {
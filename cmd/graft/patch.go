@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/cppforlife/go-patch/patch"
+	"github.com/geofffranks/yaml"
+	"github.com/voxelbrain/goptions"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+type patchOpts struct {
+	Help  bool               `goptions:"--help, -h"`
+	Files goptions.Remainder `goptions:"description='Print the go-patch ops that turn the first YAML file into the second'"`
+}
+
+// cmdPatch returns the go-patch ops file that turns the first of the two
+// files given into the second
+func cmdPatch(options patchOpts) (string, error) {
+	if len(options.Files) != 2 {
+		return "", ansi.Errorf("@R{graft patch needs exactly two files to compare}")
+	}
+
+	from, to, err := loadDiffSides(diffOpts{Files: options.Files})
+	if err != nil {
+		return "", err
+	}
+
+	engine, err := graft.NewEngine()
+	if err != nil {
+		return "", ansi.Errorf("@R{Failed to create graft engine}: %s", err.Error())
+	}
+	ops, err := engine.GoPatch(from.doc, to.doc)
+	if err != nil {
+		return "", err
+	}
+
+	defs, err := patch.NewOpDefinitionsFromOps(ops)
+	if err != nil {
+		return "", err
+	}
+	out, err := yaml.Marshal(defs)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
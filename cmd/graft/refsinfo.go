@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/geofffranks/yaml"
+	"github.com/voxelbrain/goptions"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft"
+	"github.com/wayneeseguin/graft/pkg/graft/operators"
+)
+
+type refsInfoOpts struct {
+	EnableGoPatch bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
+	Format        string             `goptions:"--format, description='Output format: yaml (default) or json'"`
+	Target        string             `goptions:"--target, description='Only report the references to this target (default for the default configuration)'"`
+	IAMPolicy     bool               `goptions:"--iam-policy, description='Output an AWS IAM policy document that can read exactly the referenced parameters and secrets'"`
+	AwsAccount    string             `goptions:"--aws-account, description='AWS account ID to use in the ARNs of --iam-policy (default *)'"`
+	Help          bool               `goptions:"--help, -h"`
+	Files         goptions.Remainder `goptions:"description='List external references in the given files'"`
+}
+
+// refsInfo is the external references of the files given to refsinfo
+type refsInfo struct {
+	References []refsInfoRef `json:"references" yaml:"references"`
+}
+
+type refsInfoRef struct {
+	Operator   string   `json:"operator" yaml:"operator"`
+	Target     string   `json:"target" yaml:"target"`
+	Path       string   `json:"path" yaml:"path"`
+	References []string `json:"references" yaml:"references"`
+}
+
+// iamPolicy is an AWS IAM policy document
+type iamPolicy struct {
+	Version   string               `json:"Version"`
+	Statement []iamPolicyStatement `json:"Statement"`
+}
+
+type iamPolicyStatement struct {
+	Sid      string   `json:"Sid"`
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource []string `json:"Resource"`
+}
+
+// cmdRefsInfo merges the files given to refsinfo without contacting vault,
+// AWS, NATS or remote load locations, or reading (( file )) files, and reports the references to data
+// outside of the files that the merge made
+func cmdRefsInfo(options refsInfoOpts) (string, error) {
+	switch options.Format {
+	case "", "yaml", "json":
+	default:
+		return "", ansi.Errorf("@R{Unknown refsinfo format} @c{%s}@R{. Must be 'yaml' or 'json'.}", options.Format)
+	}
+
+	skipVault, skipAws, skipNats, skipRemoteLoads, skipFileReads := graft.SkipVault, operators.SkipAws, operators.SkipNats, operators.SkipRemoteLoads, operators.SkipFileReads
+	defer func() {
+		graft.SkipVault, operators.SkipAws, operators.SkipNats, operators.SkipRemoteLoads, operators.SkipFileReads = skipVault, skipAws, skipNats, skipRemoteLoads, skipFileReads
+		graft.TrackExternalRefs = false
+	}()
+	operators.SkipAws, operators.SkipNats, operators.SkipRemoteLoads, operators.SkipFileReads = true, true, true, true
+	graft.VaultRefs = map[string][]string{}
+	graft.SkipVault = true
+	graft.TrackVaultRefs = false
+	graft.TrackExternalRefs = true
+	operators.ResetVaultTargetRefs()
+	operators.ResetExternalRefs()
+
+	merge := mergeOpts{
+		Files:               options.Files,
+		EnableGoPatch:       options.EnableGoPatch,
+		VaultGenerateDryRun: true,
+	}
+	useVaultGenerate(merge)
+	if _, err := cmdMergeEval(merge); err != nil {
+		return "", err
+	}
+
+	refs := selectExternalRefs(collectExternalRefs(), options.Target)
+	if options.IAMPolicy {
+		return formatIAMPolicy(refs, options.AwsAccount)
+	}
+
+	info := refsInfo{References: []refsInfoRef{}}
+	for _, ref := range refs {
+		info.References = append(info.References, refsInfoRef{
+			Operator:   ref.Operator,
+			Target:     vaultTargetName(ref.Target),
+			Path:       ref.Path,
+			References: ref.References,
+		})
+	}
+	if options.Format == "json" {
+		out, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+	out, err := yaml.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// collectExternalRefs gathers the references tracked by the operators with
+// those made by vault calls, sorted by operator, target and path
+func collectExternalRefs() []operators.ExternalRef {
+	refs := operators.ExternalRefs()
+	for target, paths := range operators.VaultTargetRefs() {
+		for path, heres := range paths {
+			references := append([]string{}, heres...)
+			sort.Strings(references)
+			refs = append(refs, operators.ExternalRef{Operator: "vault", Target: target, Path: path, References: references})
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].Operator != refs[j].Operator {
+			return refs[i].Operator < refs[j].Operator
+		}
+		if refs[i].Target != refs[j].Target {
+			return refs[i].Target < refs[j].Target
+		}
+		return refs[i].Path < refs[j].Path
+	})
+	return refs
+}
+
+// selectExternalRefs keeps the references to target, all of them if no
+// target is named
+func selectExternalRefs(refs []operators.ExternalRef, target string) []operators.ExternalRef {
+	if target == "" {
+		return refs
+	}
+	if target == defaultVaultTarget {
+		target = ""
+	}
+	selected := []operators.ExternalRef{}
+	for _, ref := range refs {
+		if ref.Target == target {
+			selected = append(selected, ref)
+		}
+	}
+	return selected
+}
+
+// formatIAMPolicy writes an IAM policy document that can read the parameters
+// and secrets the awsparam and awssecret calls of refs read, and nothing else.
+// A document grants access in one account, so the calls must all go to the
+// same target.
+func formatIAMPolicy(refs []operators.ExternalRef, account string) (string, error) {
+	if account == "" {
+		account = "*"
+	}
+
+	var targets []string
+	params, secrets := map[string]bool{}, map[string]bool{}
+	for _, ref := range refs {
+		if ref.Operator != "awsparam" && ref.Operator != "awssecret" {
+			continue
+		}
+		if !containsTarget(targets, ref.Target) {
+			targets = append(targets, ref.Target)
+		}
+
+		region := operators.AwsTargetRegion(ref.Target)
+		if region == "" {
+			region = "*"
+		}
+		if ref.Operator == "awsparam" {
+			params[awsParamARN(ref.Path, region, account)] = true
+		} else {
+			secrets[awsSecretARN(ref.Path, region, account)] = true
+		}
+	}
+
+	switch {
+	case len(targets) == 0:
+		return "", ansi.Errorf("@R{no} @c{awsparam} @R{or} @c{awssecret} @R{references to write an IAM policy for}")
+	case len(targets) > 1:
+		names := make([]string, len(targets))
+		for i, target := range targets {
+			names[i] = vaultTargetName(target)
+		}
+		sort.Strings(names)
+		return "", ansi.Errorf("@R{AWS references go to several targets} (@c{%s})@R{; pick one with} @m{--target}", strings.Join(names, ", "))
+	}
+
+	policy := iamPolicy{Version: "2012-10-17", Statement: []iamPolicyStatement{}}
+	if len(params) > 0 {
+		policy.Statement = append(policy.Statement, iamPolicyStatement{
+			Sid:      "GraftReadParameters",
+			Effect:   "Allow",
+			Action:   []string{"ssm:GetParameter"},
+			Resource: sortedKeys(params),
+		})
+	}
+	if len(secrets) > 0 {
+		policy.Statement = append(policy.Statement, iamPolicyStatement{
+			Sid:      "GraftReadSecrets",
+			Effect:   "Allow",
+			Action:   []string{"secretsmanager:GetSecretValue"},
+			Resource: sortedKeys(secrets),
+		})
+	}
+	out, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// awsParamARN is the ARN of the SSM parameter name, unless it is one already
+func awsParamARN(name, region, account string) string {
+	if strings.HasPrefix(name, "arn:") {
+		return name
+	}
+	return fmt.Sprintf("arn:aws:ssm:%s:%s:parameter/%s", region, account, strings.TrimPrefix(name, "/"))
+}
+
+// awsSecretARN is the ARN of the Secrets Manager secret name, unless it is one
+// already. Secrets Manager appends six random characters to the name of a
+// secret in its ARN.
+func awsSecretARN(name, region, account string) string {
+	if strings.HasPrefix(name, "arn:") {
+		return name
+	}
+	return fmt.Sprintf("arn:aws:secretsmanager:%s:%s:secret:%s-??????", region, account, name)
+}
+
+func containsTarget(targets []string, target string) bool {
+	for _, t := range targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
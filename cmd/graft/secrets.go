@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/voxelbrain/goptions"
+	"github.com/wayneeseguin/graft/internal/config"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft/operators"
+)
+
+type secretsOpts struct {
+	Help bool               `goptions:"--help, -h"`
+	Args goptions.Remainder `goptions:"description='encrypt FILE: seal a secret bundle with the passphrase in GRAFT_SECRETS_KEY or GRAFT_SECRETS_KEY_FILE; decrypt FILE: print it back'"`
+}
+
+// useSecretBundle answers the vault, awsparam and awssecret calls of a merge
+// run from the secret bundle named by --secrets-file or the configuration,
+// if any
+func useSecretBundle(options mergeOpts) error {
+	path := options.SecretsFile
+	if path == "" {
+		path = secretsSettings().File
+	}
+	if path == "" {
+		operators.UseSecretBundle(nil)
+		return nil
+	}
+
+	passphrase, err := secretsPassphrase()
+	if err != nil {
+		return err
+	}
+	bundle, err := operators.LoadSecretBundle(path, passphrase)
+	if err != nil {
+		return err
+	}
+	operators.UseSecretBundle(bundle)
+	return nil
+}
+
+// secretsSettings are the secrets settings, with GRAFT_SECRETS_FILE and
+// GRAFT_SECRETS_KEY_FILE over the configuration files. Commands run without
+// settings take them from the environment alone.
+func secretsSettings() config.SecretsConfig {
+	if settings == nil {
+		return config.SecretsConfig{
+			File:    os.Getenv("GRAFT_SECRETS_FILE"),
+			KeyFile: os.Getenv("GRAFT_SECRETS_KEY_FILE"),
+		}
+	}
+	return settings.Config.Engine.Secrets
+}
+
+// secretsPassphrase is the passphrase of secret bundles, from
+// GRAFT_SECRETS_KEY or else the key file named in the secrets settings
+func secretsPassphrase() (string, error) {
+	if key := os.Getenv("GRAFT_SECRETS_KEY"); key != "" {
+		return key, nil
+	}
+	file := secretsSettings().KeyFile
+	if file == "" {
+		return "", nil
+	}
+	key, err := os.ReadFile(file) // #nosec G304 - the key file is named by the user
+	if err != nil {
+		return "", ansi.Errorf("@R{unable to read secret bundle key file} @c{%s}: %s", file, err)
+	}
+	return strings.TrimRight(string(key), "\r\n"), nil
+}
+
+// cmdSecrets runs `graft secrets encrypt FILE` or `graft secrets decrypt
+// FILE`, returning the bundle to print
+func cmdSecrets(options secretsOpts) (string, error) {
+	if len(options.Args) != 2 {
+		return "", ansi.Errorf("@R{Usage: graft secrets encrypt|decrypt FILE}")
+	}
+	action, file := options.Args[0], options.Args[1]
+	if action != "encrypt" && action != "decrypt" {
+		return "", ansi.Errorf("@R{Unknown secrets action} @c{%s}@R{. Must be 'encrypt' or 'decrypt'.}", action)
+	}
+
+	data, err := os.ReadFile(file) // #nosec G304 - the bundle is named by the user
+	if err != nil {
+		return "", ansi.Errorf("@R{unable to read secret bundle} @c{%s}: %s", file, err)
+	}
+	passphrase, err := secretsPassphrase()
+	if err != nil {
+		return "", err
+	}
+
+	var out []byte
+	if action == "encrypt" {
+		out, err = operators.EncryptSecretBundle(data, passphrase)
+	} else {
+		out, err = operators.DecryptSecretBundle(data, passphrase)
+	}
+	if err != nil {
+		return "", ansi.Errorf("@R{unable to %s} @c{%s}: %s", action, file, err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/voxelbrain/goptions"
+	"github.com/wayneeseguin/graft/internal/config"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft/operators"
+)
+
+type targetsOpts struct {
+	JSON bool               `goptions:"--json, description='Output targets as JSON'"`
+	Help bool               `goptions:"--help, -h"`
+	Args goptions.Remainder `goptions:"description='list: show the vault, aws and nats targets; check: make sure each resolves to a usable configuration. Either may be followed by target names, like production or vault@production'"`
+}
+
+// defineTargets hands the targets declared in the configuration files, and
+// the vault and aws settings for calls that name no target, to the
+// target-aware operators
+func defineTargets(s *config.Effective) {
+	vault, aws := s.Config.Engine.Vault, s.Config.Engine.AWS
+	// config validate rejects timeouts that do not parse
+	timeout, _ := time.ParseDuration(vault.Timeout)
+	defs := operators.TargetDefinitions{
+		Vault: map[string]operators.VaultTarget{},
+		AWS:   map[string]operators.AwsTarget{},
+		NATS:  map[string]operators.NatsTarget{},
+		DefaultVault: operators.VaultTarget{
+			URL:        vault.Address,
+			Token:      vault.Token,
+			Namespace:  vault.Namespace,
+			SkipVerify: vault.SkipVerify,
+			AuthMethod: vault.Auth.Method,
+			AuthMount:  vault.Auth.Mount,
+			AuthRole:   vault.Auth.Role,
+			RoleID:     vault.Auth.RoleID,
+			SecretID:   vault.Auth.SecretID,
+			JWTFile:    vault.Auth.JWTFile,
+			Username:   vault.Auth.Username,
+			Password:   vault.Auth.Password,
+			Timeout:    timeout,
+		},
+		DefaultAWS: operators.AwsTarget{
+			Region:          aws.Region,
+			Profile:         aws.Profile,
+			AccessKeyID:     aws.AccessKeyID,
+			SecretAccessKey: aws.SecretAccessKey,
+			SessionToken:    aws.SessionToken,
+			Endpoint:        aws.Endpoint,
+		},
+	}
+	for name, t := range s.Config.Targets.Vault {
+		defs.Vault[name] = operators.VaultTarget{
+			URL:        t.Address,
+			Token:      t.Token,
+			Namespace:  t.Namespace,
+			SkipVerify: t.TLS.SkipVerify,
+			CACert:     t.TLS.CACert,
+			ClientCert: t.TLS.ClientCert,
+			ClientKey:  t.TLS.ClientKey,
+			AuthMethod: t.Auth.Method,
+			AuthMount:  t.Auth.Mount,
+			AuthRole:   t.Auth.Role,
+			RoleID:     t.Auth.RoleID,
+			SecretID:   t.Auth.SecretID,
+			JWTFile:    t.Auth.JWTFile,
+			Username:   t.Auth.Username,
+			Password:   t.Auth.Password,
+			Timeout:    t.Timeout,
+			CacheTTL:   t.CacheTTL,
+		}
+	}
+	for name, t := range s.Config.Targets.AWS {
+		defs.AWS[name] = operators.AwsTarget{
+			Region:          t.Region,
+			Profile:         t.Profile,
+			Role:            t.Role,
+			ExternalID:      t.ExternalID,
+			AccessKeyID:     t.AccessKeyID,
+			SecretAccessKey: t.SecretAccessKey,
+			SessionToken:    t.SessionToken,
+			Endpoint:        t.Endpoint,
+			MaxRetries:      t.MaxRetries,
+			HTTPTimeout:     t.Timeout,
+			CacheTTL:        t.CacheTTL,
+		}
+	}
+	for name, t := range s.Config.Targets.NATS {
+		defs.NATS[name] = operators.NatsTarget{
+			URL:                t.Address,
+			TLS:                t.TLS.CACert != "" || t.TLS.ClientCert != "" || t.TLS.SkipVerify,
+			CAFile:             t.TLS.CACert,
+			CertFile:           t.TLS.ClientCert,
+			KeyFile:            t.TLS.ClientKey,
+			InsecureSkipVerify: t.TLS.SkipVerify,
+			Timeout:            t.Timeout,
+			Retries:            t.Retries,
+			CacheTTL:           t.CacheTTL,
+		}
+	}
+	operators.DefineTargets(defs)
+}
+
+// cmdTargets runs `graft targets list` or `graft targets check`, returning
+// what to print and the exit code. Check fails when any target has problems.
+func cmdTargets(options targetsOpts, s *config.Effective) (string, int, error) {
+	action := "list"
+	if len(options.Args) > 0 {
+		action = options.Args[0]
+	}
+	if action != "list" && action != "check" {
+		return "", 2, ansi.Errorf("@R{Unknown targets action} @c{%s}@R{. Must be 'list' or 'check'.}", action)
+	}
+
+	var wanted []string
+	if len(options.Args) > 1 {
+		wanted = options.Args[1:]
+	}
+	targets, err := selectTargets(operators.Targets(), wanted)
+	if err != nil {
+		return "", 2, err
+	}
+
+	code := 0
+	if action == "check" {
+		for i, t := range targets {
+			targets[i] = operators.CheckTarget(t.Type, t.Name)
+			if len(targets[i].Problems) > 0 {
+				code = 2
+			}
+		}
+	}
+
+	if options.JSON {
+		if targets == nil {
+			targets = []operators.TargetStatus{}
+		}
+		out, err := json.MarshalIndent(targets, "", "  ")
+		if err != nil {
+			return "", 2, err
+		}
+		return string(out), code, nil
+	}
+	if len(targets) == 0 {
+		return "no targets are declared", 0, nil
+	}
+	if action == "check" {
+		return formatTargetCheck(targets), code, nil
+	}
+	return formatTargets(targets, s), code, nil
+}
+
+// selectTargets picks the targets named in wanted, as name or type@name, out
+// of all of them. Naming nothing selects every target.
+func selectTargets(all []operators.TargetStatus, wanted []string) ([]operators.TargetStatus, error) {
+	if len(wanted) == 0 {
+		return all, nil
+	}
+
+	var selected []operators.TargetStatus
+	for _, want := range wanted {
+		found := false
+		for _, t := range all {
+			if strings.EqualFold(want, t.Name) || strings.EqualFold(want, t.Type+"@"+t.Name) {
+				selected = append(selected, t)
+				found = true
+			}
+		}
+		if !found {
+			return nil, ansi.Errorf("@R{No target named} @c{%s}@R{ is declared}", want)
+		}
+	}
+	return selected, nil
+}
+
+// formatTargets lists each target with what it connects to and where it is
+// declared: a configuration file, environment variables or both
+func formatTargets(targets []operators.TargetStatus, s *config.Effective) string {
+	rows := make([][]string, 0, len(targets))
+	for _, t := range targets {
+		var from []string
+		if t.Defined {
+			from = append(from, targetFile(s, t))
+		}
+		if len(t.EnvVars) > 0 {
+			from = append(from, "env "+strings.Join(t.EnvVars, ", "))
+		}
+		address := t.Address
+		if address == "" {
+			address = "-"
+		}
+		rows = append(rows, []string{t.Type + "@" + t.Name, address, strings.Join(from, "; ")})
+	}
+	return formatColumns(rows)
+}
+
+// formatTargetCheck reports whether each target is usable, and what is
+// wrong with those that are not
+func formatTargetCheck(targets []operators.TargetStatus) string {
+	var out strings.Builder
+	failed := 0
+	width := 0
+	for _, t := range targets {
+		if n := len(t.Type + "@" + t.Name); n > width {
+			width = n
+		}
+	}
+	for _, t := range targets {
+		name := fmt.Sprintf("%-*s", width, t.Type+"@"+t.Name)
+		if len(t.Problems) == 0 {
+			out.WriteString(ansi.Sprintf("%s  @G{ok}\n", name))
+			continue
+		}
+		failed++
+		for _, problem := range t.Problems {
+			out.WriteString(ansi.Sprintf("%s  @R{%s}\n", name, problem))
+		}
+	}
+	out.WriteString(fmt.Sprintf("%d of %d target(s) have problems", failed, len(targets)))
+	return out.String()
+}
+
+// targetFile names the configuration file that declares t
+func targetFile(s *config.Effective, t operators.TargetStatus) string {
+	prefix := fmt.Sprintf("targets.%s.%s.", t.Type, t.Name)
+	for _, setting := range s.Settings() {
+		if strings.HasPrefix(setting.Key, prefix) && (setting.Origin.Layer == config.LayerUser || setting.Origin.Layer == config.LayerProject) {
+			return setting.Origin.String()
+		}
+	}
+	return "config"
+}
+
+// formatColumns lines rows up in columns two spaces apart
+func formatColumns(rows [][]string) string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			if i == len(row)-1 {
+				line.WriteString(cell)
+			} else {
+				line.WriteString(fmt.Sprintf("%-*s  ", widths[i], cell))
+			}
+		}
+		lines = append(lines, line.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/log"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+func validateExplainFormat(format string) error {
+	switch format {
+	case "", "tree", "json":
+		return nil
+	}
+	return ansi.Errorf("@R{Invalid --explain-format} @c{%s}@R{. Must be 'tree' or 'json'.}", format)
+}
+
+// formatTrace renders the operator calls recorded in trace beneath prefix as
+// a tree, or as JSON if asked to
+func formatTrace(trace *graft.EvalTrace, prefix string, format string) (string, error) {
+	entries := trace.Entries(prefix)
+	if format == "json" {
+		if entries == nil {
+			entries = []*graft.TraceEntry{}
+		}
+		out, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out) + "\n", nil
+	}
+
+	var out strings.Builder
+	for _, e := range entries {
+		out.WriteString(ansi.Sprintf("@c{$.%s}: @G{%s}\n", e.Path, e.Source))
+		for _, input := range e.Inputs {
+			writeTraceInput(&out, input, "input", "  ")
+		}
+		if e.Error != "" {
+			out.WriteString(ansi.Sprintf("  error  @R{%s}\n", oneLine(e.Error)))
+		} else {
+			out.WriteString(fmt.Sprintf("  value  %s\n", traceJSON(e.Value)))
+		}
+	}
+	return out.String(), nil
+}
+
+// printExplain writes the evaluation recorded for --explain to stderr, if
+// there is one. The tree format names the target it was recorded for, when
+// fan records one per target.
+func printExplain(options mergeOpts, target string) {
+	if options.trace == nil {
+		return
+	}
+	explained, err := formatTrace(options.trace, options.ExplainPath, options.ExplainFormat)
+	if err != nil {
+		log.PrintfStdErr("Unable to format --explain output: %s\n", err.Error())
+		return
+	}
+	if target != "" && options.ExplainFormat != "json" {
+		explained = ansi.Sprintf("@*{--- %s}\n", target) + explained
+	}
+	log.PrintfStdErr("%s", explained)
+}
+
+// writeTraceInput writes one resolved argument, followed by the alternatives
+// of a `||` or the arguments of a nested operator call, one level deeper
+func writeTraceInput(out *strings.Builder, input *graft.TraceInput, label, indent string) {
+	if input.Error != "" {
+		out.WriteString(ansi.Sprintf("%s%-5s  %s: @R{%s}\n", indent, label, input.Expr, oneLine(input.Error)))
+	} else {
+		out.WriteString(fmt.Sprintf("%s%-5s  %s = %s\n", indent, label, input.Expr, traceJSON(input.Value)))
+	}
+
+	for _, child := range input.Inputs {
+		childLabel := "input"
+		if input.IsAlternatives() {
+			childLabel = "tried"
+			if child.Expr == input.Chosen {
+				childLabel = "won"
+			}
+		}
+		writeTraceInput(out, child, childLabel, indent+"  ")
+	}
+}
+
+func traceJSON(value interface{}) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/geofffranks/yaml"
+	"github.com/voxelbrain/goptions"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft"
+	"github.com/wayneeseguin/graft/pkg/graft/operators"
+)
+
+type vaultInfoOpts struct {
+	EnableGoPatch bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
+	Resolve       bool               `goptions:"--resolve, description='Read the secrets from vault, to report the versions they resolve to'"`
+	Format        string             `goptions:"--format, description='Output format: list (default), yaml or json'"`
+	Policy        bool               `goptions:"--policy, description='Output a vault HCL policy that can read exactly the referenced secrets'"`
+	Target        string             `goptions:"--target, description='Only report the references to this vault target (default for the default vault)'"`
+	KV2           []string           `goptions:"--kv2, description='Name a kv v2 mount, for --policy to cover its data/ and metadata/ paths (can be repeated)'"`
+	Help          bool               `goptions:"--help, -h"`
+	Files         goptions.Remainder `goptions:"description='List vault references in the given files'"`
+}
+
+// defaultVaultTarget names the vault configured by VAULT_ADDR and friends in
+// the output of vaultinfo
+const defaultVaultTarget = "default"
+
+// vaultInfo is the vault references of the files given to vaultinfo,
+// grouped by target, secret and key
+type vaultInfo struct {
+	Targets []vaultInfoTarget `json:"targets" yaml:"targets"`
+}
+
+type vaultInfoTarget struct {
+	Target  string            `json:"target" yaml:"target"`
+	Secrets []vaultInfoSecret `json:"secrets" yaml:"secrets"`
+}
+
+type vaultInfoSecret struct {
+	Path string         `json:"path" yaml:"path"`
+	Keys []vaultInfoKey `json:"keys" yaml:"keys"`
+}
+
+type vaultInfoKey struct {
+	Key        string   `json:"key" yaml:"key"`
+	Version    uint     `json:"version,omitempty" yaml:"version,omitempty"`
+	References []string `json:"references" yaml:"references"`
+}
+
+// cmdVaultInfo merges the files given to vaultinfo, without vault unless
+// resolving, and reports the vault references the merge made
+func cmdVaultInfo(options vaultInfoOpts) (string, error) {
+	switch options.Format {
+	case "", "list", "yaml", "json":
+	default:
+		return "", ansi.Errorf("@R{Unknown vaultinfo format} @c{%s}@R{. Must be 'list', 'yaml' or 'json'.}", options.Format)
+	}
+
+	graft.VaultRefs = map[string][]string{}
+	graft.SkipVault = !options.Resolve
+	graft.TrackVaultRefs = options.Resolve
+	operators.ResetVaultTargetRefs()
+	operators.ResetResolvedVaultVersions()
+
+	// resolving reads from vault, but must never write to it
+	merge := mergeOpts{
+		Files:               options.Files,
+		EnableGoPatch:       options.EnableGoPatch,
+		VaultGenerateDryRun: true,
+	}
+	useVaultGenerate(merge)
+	if _, err := cmdMergeEval(merge); err != nil {
+		return "", err
+	}
+
+	refs := selectVaultTargetRefs(operators.VaultTargetRefs(), options.Target)
+	if options.Policy {
+		return formatVaultPolicy(refs, options.KV2), nil
+	}
+	switch options.Format {
+	case "json":
+		out, err := json.MarshalIndent(groupVaultRefs(refs), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	case "yaml":
+		out, err := yaml.Marshal(groupVaultRefs(refs))
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+	return formatVaultRefs(refs), nil
+}
+
+// selectVaultTargetRefs keeps the references to target, all of them if no
+// target is named. The default vault is named "".
+func selectVaultTargetRefs(refs map[string]map[string][]string, target string) map[string]map[string][]string {
+	if target == "" {
+		return refs
+	}
+	if target == defaultVaultTarget {
+		target = ""
+	}
+	selected := map[string]map[string][]string{}
+	if paths, ok := refs[target]; ok {
+		selected[target] = paths
+	}
+	return selected
+}
+
+// sortedVaultTargets lists the targets of refs, the default vault first
+func sortedVaultTargets(refs map[string]map[string][]string) []string {
+	targets := make([]string, 0, len(refs))
+	for target := range refs {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// vaultTargetName is how vaultinfo names target
+func vaultTargetName(target string) string {
+	if target == "" {
+		return defaultVaultTarget
+	}
+	return target
+}
+
+// groupVaultRefs arranges refs by target, then secret, then key. A key
+// lists the version it is pinned or resolved to, and metadata keys keep the
+// @ they are named with.
+func groupVaultRefs(refs map[string]map[string][]string) vaultInfo {
+	info := vaultInfo{Targets: []vaultInfoTarget{}}
+	for _, target := range sortedVaultTargets(refs) {
+		secrets := map[string]*vaultInfoSecret{}
+		for path, heres := range refs[target] {
+			ref, _ := operators.ParseVaultReference(path)
+			key := ref.Key
+			if ref.Metadata {
+				key = "@" + key
+			}
+
+			secret, ok := secrets[ref.Secret]
+			if !ok {
+				secret = &vaultInfoSecret{Path: ref.Secret}
+				secrets[ref.Secret] = secret
+			}
+			references := append([]string{}, heres...)
+			sort.Strings(references)
+			secret.Keys = append(secret.Keys, vaultInfoKey{
+				Key:        key,
+				Version:    operators.VaultReferenceVersion(target, path),
+				References: references,
+			})
+		}
+
+		t := vaultInfoTarget{Target: vaultTargetName(target), Secrets: []vaultInfoSecret{}}
+		for _, secret := range secrets {
+			sort.Slice(secret.Keys, func(i, j int) bool {
+				if secret.Keys[i].Key != secret.Keys[j].Key {
+					return secret.Keys[i].Key < secret.Keys[j].Key
+				}
+				return secret.Keys[i].Version < secret.Keys[j].Version
+			})
+			t.Secrets = append(t.Secrets, *secret)
+		}
+		sort.Slice(t.Secrets, func(i, j int) bool { return t.Secrets[i].Path < t.Secrets[j].Path })
+		info.Targets = append(info.Targets, t)
+	}
+	return info
+}
+
+// formatVaultPolicy writes a vault policy for each target that can read the
+// secrets of refs, and nothing else. Secrets on kv v2 mounts are read through
+// their data/ path, and their metadata through the metadata/ path.
+func formatVaultPolicy(refs map[string]map[string][]string, kv2 []string) string {
+	var out strings.Builder
+	for i, target := range sortedVaultTargets(refs) {
+		// a secret is on a kv v2 mount when any reference to it is versioned
+		versioned := map[string]bool{}
+		for path := range refs[target] {
+			ref, _ := operators.ParseVaultReference(path)
+			if ref.Metadata || operators.VaultReferenceVersion(target, path) != 0 {
+				versioned[ref.Secret] = true
+			}
+		}
+
+		policies := map[string]bool{}
+		for path := range refs[target] {
+			ref, _ := operators.ParseVaultReference(path)
+			policies[vaultPolicyPath(ref, versioned[ref.Secret], kv2)] = true
+		}
+		paths := make([]string, 0, len(policies))
+		for path := range policies {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		if target == "" {
+			out.WriteString("# read policy for the default vault\n")
+		} else {
+			out.WriteString(fmt.Sprintf("# read policy for vault@%s\n", target))
+		}
+		for _, path := range paths {
+			out.WriteString(fmt.Sprintf("path %q {\n  capabilities = [\"read\"]\n}\n", path))
+		}
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// vaultPolicyPath is the API path that reading ref goes through. On kv v2
+// mounts, named in kv2 or else taken to be the first part of the path, that
+// is the data/ or metadata/ path of the secret.
+func vaultPolicyPath(ref operators.VaultReference, versioned bool, kv2 []string) string {
+	secret := strings.Trim(ref.Secret, "/")
+	mount := ""
+	for _, m := range kv2 {
+		m = strings.Trim(m, "/")
+		if (secret == m || strings.HasPrefix(secret, m+"/")) && len(m) > len(mount) {
+			mount = m
+		}
+	}
+	if mount == "" {
+		if !versioned {
+			return secret
+		}
+		mount = strings.SplitN(secret, "/", 2)[0]
+	}
+
+	api := "data"
+	if ref.Metadata {
+		api = "metadata"
+	}
+	return strings.TrimSuffix(mount+"/"+api+"/"+strings.Trim(strings.TrimPrefix(secret, mount), "/"), "/")
+}
@@ -22,6 +22,12 @@ type Config struct {
 	// Logging configuration
 	Logging LoggingConfig `yaml:"logging" json:"logging"`
 
+	// Named targets of the target-aware operators
+	Targets TargetsConfig `yaml:"targets" json:"targets"`
+
+	// How the lists and maps at given paths merge
+	Merge MergeConfig `yaml:"merge" json:"merge"`
+
 	// Feature flags
 	Features map[string]bool `yaml:"features" json:"features"`
 
@@ -38,6 +44,9 @@ type EngineConfig struct {
 	// AWS configuration
 	AWS AWSConfig `yaml:"aws" json:"aws"`
 
+	// Offline secrets configuration
+	Secrets SecretsConfig `yaml:"secrets" json:"secrets"`
+
 	// Parser configuration
 	Parser ParserConfig `yaml:"parser" json:"parser"`
 
@@ -54,23 +63,113 @@ type EngineConfig struct {
 
 // VaultConfig contains HashiCorp Vault settings
 type VaultConfig struct {
-	Address    string `yaml:"address" json:"address" env:"VAULT_ADDR"`
-	Token      string `yaml:"token" json:"token" env:"VAULT_TOKEN"`
-	SkipVerify bool   `yaml:"skip_verify" json:"skip_verify" env:"VAULT_SKIP_VERIFY"`
-	Namespace  string `yaml:"namespace" json:"namespace" env:"VAULT_NAMESPACE"`
-	Timeout    string `yaml:"timeout" json:"timeout" default:"30s"`
+	Address    string          `yaml:"address" json:"address" env:"VAULT_ADDR"`
+	Token      string          `yaml:"token" json:"token" env:"VAULT_TOKEN" secret:"true"`
+	SkipVerify bool            `yaml:"skip_verify" json:"skip_verify" env:"VAULT_SKIP_VERIFY"`
+	Namespace  string          `yaml:"namespace" json:"namespace" env:"VAULT_NAMESPACE"`
+	Timeout    string          `yaml:"timeout" json:"timeout" default:"30s"`
+	Auth       VaultAuthConfig `yaml:"auth" json:"auth"`
+}
+
+// SecretsConfig names an encrypted secret bundle that answers vault,
+// awsparam and awssecret calls in place of Vault and AWS
+type SecretsConfig struct {
+	File    string `yaml:"file" json:"file" env:"GRAFT_SECRETS_FILE"`
+	KeyFile string `yaml:"key_file" json:"key_file" env:"GRAFT_SECRETS_KEY_FILE"` // holds the passphrase, unless GRAFT_SECRETS_KEY is set
 }
 
 // AWSConfig contains AWS settings
 type AWSConfig struct {
 	Region          string `yaml:"region" json:"region" env:"AWS_REGION"`
 	Profile         string `yaml:"profile" json:"profile" env:"AWS_PROFILE"`
-	AccessKeyID     string `yaml:"access_key_id" json:"access_key_id" env:"AWS_ACCESS_KEY_ID"`
-	SecretAccessKey string `yaml:"secret_access_key" json:"secret_access_key" env:"AWS_SECRET_ACCESS_KEY"`
-	SessionToken    string `yaml:"session_token" json:"session_token" env:"AWS_SESSION_TOKEN"`
+	AccessKeyID     string `yaml:"access_key_id" json:"access_key_id" env:"AWS_ACCESS_KEY_ID" secret:"true"`
+	SecretAccessKey string `yaml:"secret_access_key" json:"secret_access_key" env:"AWS_SECRET_ACCESS_KEY" secret:"true"`
+	SessionToken    string `yaml:"session_token" json:"session_token" env:"AWS_SESSION_TOKEN" secret:"true"`
 	Endpoint        string `yaml:"endpoint" json:"endpoint" env:"AWS_ENDPOINT"`
 }
 
+// TargetsConfig declares the targets that operators like
+// (( vault@production ... )) connect to, by name. VAULT_<TARGET>_*,
+// AWS_<TARGET>_* and NATS_<TARGET>_* environment variables override them.
+type TargetsConfig struct {
+	Vault map[string]VaultTargetConfig `yaml:"vault" json:"vault"`
+	AWS   map[string]AWSTargetConfig   `yaml:"aws" json:"aws"`
+	NATS  map[string]NATSTargetConfig  `yaml:"nats" json:"nats"`
+}
+
+// VaultTargetConfig contains the settings of one Vault target
+type VaultTargetConfig struct {
+	Address   string          `yaml:"address" json:"address"`
+	Namespace string          `yaml:"namespace" json:"namespace"`
+	Token     string          `yaml:"token" json:"token" secret:"true"`
+	Auth      VaultAuthConfig `yaml:"auth" json:"auth"`
+	TLS       TLSConfig       `yaml:"tls" json:"tls"`
+	Timeout   time.Duration   `yaml:"timeout" json:"timeout"`
+	CacheTTL  time.Duration   `yaml:"cache_ttl" json:"cache_ttl"`
+}
+
+// VaultAuthConfig says how to authenticate to Vault. The environment
+// variables are those of the default Vault; a target named production reads
+// VAULT_PRODUCTION_AUTH_METHOD and so on instead.
+type VaultAuthConfig struct {
+	Method   string `yaml:"method" json:"method" env:"VAULT_AUTH_METHOD"` // token (default), approle, kubernetes, userpass or cert
+	Mount    string `yaml:"mount" json:"mount" env:"VAULT_AUTH_MOUNT"`    // defaults to the name of the method
+	Role     string `yaml:"role" json:"role" env:"VAULT_AUTH_ROLE"`       // kubernetes and cert
+	RoleID   string `yaml:"role_id" json:"role_id" env:"VAULT_ROLE_ID"`   // approle
+	SecretID string `yaml:"secret_id" json:"secret_id" env:"VAULT_SECRET_ID" secret:"true"`
+	JWTFile  string `yaml:"jwt_file" json:"jwt_file" env:"VAULT_AUTH_JWT_FILE"` // kubernetes
+	Username string `yaml:"username" json:"username" env:"VAULT_AUTH_USERNAME"` // userpass
+	Password string `yaml:"password" json:"password" env:"VAULT_AUTH_PASSWORD" secret:"true"`
+}
+
+// AWSTargetConfig contains the settings of one AWS target
+type AWSTargetConfig struct {
+	Region          string        `yaml:"region" json:"region"`
+	Profile         string        `yaml:"profile" json:"profile"`
+	Role            string        `yaml:"role" json:"role"`
+	ExternalID      string        `yaml:"external_id" json:"external_id"`
+	AccessKeyID     string        `yaml:"access_key_id" json:"access_key_id" secret:"true"`
+	SecretAccessKey string        `yaml:"secret_access_key" json:"secret_access_key" secret:"true"`
+	SessionToken    string        `yaml:"session_token" json:"session_token" secret:"true"`
+	Endpoint        string        `yaml:"endpoint" json:"endpoint"`
+	MaxRetries      int           `yaml:"max_retries" json:"max_retries"`
+	Timeout         time.Duration `yaml:"timeout" json:"timeout"`
+	CacheTTL        time.Duration `yaml:"cache_ttl" json:"cache_ttl"`
+}
+
+// NATSTargetConfig contains the settings of one NATS target
+type NATSTargetConfig struct {
+	Address  string        `yaml:"address" json:"address"`
+	TLS      TLSConfig     `yaml:"tls" json:"tls"`
+	Timeout  time.Duration `yaml:"timeout" json:"timeout"`
+	Retries  int           `yaml:"retries" json:"retries"`
+	CacheTTL time.Duration `yaml:"cache_ttl" json:"cache_ttl"`
+}
+
+// TLSConfig contains the TLS files and options used to connect to a target
+type TLSConfig struct {
+	CACert     string `yaml:"ca_cert" json:"ca_cert"`
+	ClientCert string `yaml:"client_cert" json:"client_cert"`
+	ClientKey  string `yaml:"client_key" json:"client_key"`
+	SkipVerify bool   `yaml:"skip_verify" json:"skip_verify"`
+}
+
+// MergeConfig declares how the lists and maps at the paths of merged
+// documents matching a pattern merge, in place of array operators like
+// (( merge on name )) or (( replace )) in every overlay
+type MergeConfig struct {
+	Strategies []MergeStrategyConfig `yaml:"strategies" json:"strategies"`
+}
+
+// MergeStrategyConfig is the merge strategy of the paths matching Path
+type MergeStrategyConfig struct {
+	Path   string `yaml:"path" json:"path"`
+	List   string `yaml:"list" json:"list"` // merge, inline, append, prepend, replace, union, intersect or subtract
+	Key    string `yaml:"key" json:"key"`   // lists of maps merge on it, name by default
+	Dedupe bool   `yaml:"dedupe" json:"dedupe"`
+	Map    string `yaml:"map" json:"map"` // merge, or replace to not deep-merge maps
+}
+
 // ParserConfig contains parser settings
 type ParserConfig struct {
 	StrictYAML      bool `yaml:"strict_yaml" json:"strict_yaml" default:"false"`
@@ -0,0 +1,355 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileName is the name of the project configuration file, looked for
+// in the working directory and each of its parents
+const ProjectFileName = ".graft.yml"
+
+// Layer is one of the places a setting can come from
+type Layer string
+
+// Layers, from lowest to highest precedence
+const (
+	LayerDefault Layer = "default"
+	LayerUser    Layer = "user"
+	LayerProject Layer = "project"
+	LayerEnv     Layer = "env"
+	LayerFlag    Layer = "flag"
+)
+
+// Origin says where the effective value of a setting came from. Source is
+// the file, environment variable or flag that set it.
+type Origin struct {
+	Layer  Layer  `json:"layer"`
+	Source string `json:"source,omitempty"`
+}
+
+func (o Origin) String() string {
+	if o.Source == "" {
+		return string(o.Layer)
+	}
+	return fmt.Sprintf("%s %s", o.Layer, o.Source)
+}
+
+// Setting is the effective value of one configuration key
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Secret bool        `json:"secret,omitempty"`
+	Origin Origin      `json:"origin"`
+}
+
+// Effective is the configuration graft runs with: the defaults, overridden
+// by the user file, the project file, the environment and finally command
+// line flags. It remembers which of those set each key.
+type Effective struct {
+	Config      *Config
+	UserFile    string
+	ProjectFile string
+
+	origins map[string]Origin
+}
+
+// FindProjectFile returns the ProjectFileName in dir or the nearest of its
+// parents, or "" if there is none
+func FindProjectFile(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// UserConfigFile returns where the user configuration file lives:
+// $XDG_CONFIG_HOME/graft/config.yml, or ~/.config/graft/config.yml when
+// XDG_CONFIG_HOME is not set. The file may not exist.
+func UserConfigFile() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "graft", "config.yml")
+}
+
+// Resolve builds the effective configuration for a graft run started in
+// dir, from the user file, the project file and the environment
+func Resolve(dir string) (*Effective, error) {
+	e := &Effective{
+		Config:  DefaultConfig(),
+		origins: map[string]Origin{},
+	}
+
+	if path := UserConfigFile(); path != "" {
+		if _, err := os.Stat(path); err == nil {
+			if err := e.loadFile(path, LayerUser); err != nil {
+				return nil, err
+			}
+			e.UserFile = path
+		}
+	}
+
+	if path := FindProjectFile(dir); path != "" {
+		if err := e.loadFile(path, LayerProject); err != nil {
+			return nil, err
+		}
+		e.ProjectFile = path
+	}
+
+	loader := NewLoader()
+	if err := loader.LoadFromEnvironment(e.Config); err != nil {
+		return nil, fmt.Errorf("applying environment overrides: %w", err)
+	}
+	for key, env := range loader.Applied() {
+		e.origins[key] = Origin{Layer: LayerEnv, Source: env}
+	}
+
+	return e, nil
+}
+
+// loadFile applies the settings in the YAML file at path on top of the
+// current ones. Keys graft does not know about are an error.
+func (e *Effective) loadFile(path string, layer Layer) error {
+	// #nosec G304 - reading the user's own configuration files is the point
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(e.Config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	keys := nodeKeys(&root, "")
+	for _, key := range keys {
+		// a target is replaced as a whole, so forget where the settings of
+		// an earlier declaration came from
+		if parts := strings.SplitN(key, ".", 4); len(parts) == 4 && parts[0] == "targets" {
+			declared := strings.Join(parts[:3], ".") + "."
+			for old, origin := range e.origins {
+				if strings.HasPrefix(old, declared) && origin.Source != path {
+					delete(e.origins, old)
+				}
+			}
+		}
+	}
+	for _, key := range keys {
+		e.origins[key] = Origin{Layer: layer, Source: path}
+	}
+	return nil
+}
+
+// SetFlag overrides the setting at key (such as engine.dataflow_order) with
+// value, given on the command line as flag
+func (e *Effective) SetFlag(key, flag, value string) error {
+	if err := setKey(reflect.ValueOf(e.Config).Elem(), strings.Split(key, "."), value); err != nil {
+		return fmt.Errorf("%s: %w", flag, err)
+	}
+	e.origins[key] = Origin{Layer: LayerFlag, Source: flag}
+	return nil
+}
+
+// Origin returns where the setting at key came from
+func (e *Effective) Origin(key string) Origin {
+	if e == nil {
+		return Origin{Layer: LayerDefault}
+	}
+	if o, ok := e.origins[key]; ok {
+		return o
+	}
+	return Origin{Layer: LayerDefault}
+}
+
+// IsSet reports whether anything other than the defaults set key
+func (e *Effective) IsSet(key string) bool {
+	return e.Origin(key).Layer != LayerDefault
+}
+
+// Settings lists every setting with its effective value and origin, in the
+// order they are declared
+func (e *Effective) Settings() []Setting {
+	var settings []Setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			key := yamlKey(prefix, field)
+			value := v.Field(i)
+
+			switch {
+			case value.Kind() == reflect.Struct:
+				walk(value, key)
+
+			case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Struct:
+				for i := 0; i < value.Len(); i++ {
+					walk(value.Index(i), fmt.Sprintf("%s.%d", key, i))
+				}
+
+			case value.Kind() == reflect.Map:
+				names := make([]string, 0, value.Len())
+				for _, k := range value.MapKeys() {
+					names = append(names, fmt.Sprintf("%v", k.Interface()))
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					if value.Type().Elem().Kind() == reflect.Struct {
+						walk(value.MapIndex(reflect.ValueOf(name)), key+"."+name)
+						continue
+					}
+					settings = append(settings, Setting{
+						Key:    key + "." + name,
+						Value:  value.MapIndex(reflect.ValueOf(name)).Interface(),
+						Origin: e.Origin(key + "." + name),
+					})
+				}
+
+			default:
+				s := Setting{
+					Key:    key,
+					Value:  value.Interface(),
+					Secret: field.Tag.Get("secret") == "true",
+					Origin: e.Origin(key),
+				}
+				if d, ok := s.Value.(time.Duration); ok {
+					s.Value = d.String()
+				}
+				settings = append(settings, s)
+			}
+		}
+	}
+	walk(reflect.ValueOf(e.Config).Elem(), "")
+	return settings
+}
+
+// nodeKeys lists the dotted keys of every value set in a YAML document
+func nodeKeys(n *yaml.Node, prefix string) []string {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		var keys []string
+		for _, c := range n.Content {
+			keys = append(keys, nodeKeys(c, prefix)...)
+		}
+		return keys
+
+	case yaml.MappingNode:
+		var keys []string
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			keys = append(keys, nodeKeys(n.Content[i+1], key)...)
+		}
+		return keys
+
+	case yaml.SequenceNode:
+		var keys []string
+		for i, c := range n.Content {
+			keys = append(keys, nodeKeys(c, fmt.Sprintf("%s.%d", prefix, i))...)
+		}
+		return keys
+
+	default:
+		if prefix == "" {
+			return nil
+		}
+		return []string{prefix}
+	}
+}
+
+// setKey parses value into the field of v named by the YAML keys in path
+func setKey(v reflect.Value, path []string, value string) error {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || yamlKey("", field) != path[0] {
+			continue
+		}
+		f := v.Field(i)
+
+		if f.Kind() == reflect.Struct {
+			if len(path) < 2 {
+				return fmt.Errorf("%s is a section, not a setting", path[0])
+			}
+			return setKey(f, path[1:], value)
+		}
+		if len(path) > 1 && f.Kind() != reflect.Map {
+			return fmt.Errorf("unknown setting %s", strings.Join(path, "."))
+		}
+
+		switch {
+		case f.Type() == reflect.TypeOf(time.Duration(0)):
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			f.SetInt(int64(d))
+		case f.Kind() == reflect.String:
+			f.SetString(value)
+		case f.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			f.SetBool(b)
+		case f.Kind() == reflect.Int || f.Kind() == reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return err
+			}
+			f.SetInt(n)
+		case f.Kind() == reflect.Map && len(path) == 2:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			if f.IsNil() {
+				f.Set(reflect.MakeMap(f.Type()))
+			}
+			f.SetMapIndex(reflect.ValueOf(path[1]), reflect.ValueOf(b))
+		default:
+			return fmt.Errorf("cannot set %s", strings.Join(path, "."))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown setting %s", strings.Join(path, "."))
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolate points the user config at an empty directory and clears the
+// environment variables the config reads, so the developer's own settings
+// do not leak into a test
+func isolate(t *testing.T) string {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	for _, env := range []string{"VAULT_ADDR", "VAULT_TOKEN", "VAULT_NAMESPACE", "VAULT_SKIP_VERIFY",
+		"AWS_REGION", "AWS_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_ENDPOINT",
+		"GRAFT_LOG_LEVEL"} {
+		t.Setenv(env, "")
+	}
+	return xdg
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindProjectFile(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := FindProjectFile(nested); got != "" {
+		t.Errorf("Expected no project file, got %s", got)
+	}
+
+	writeFile(t, filepath.Join(root, "a", ProjectFileName), "version: \"1.0\"\n")
+	if got, want := FindProjectFile(nested), filepath.Join(root, "a", ProjectFileName); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	xdg := isolate(t)
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(xdg, "graft", "config.yml"), `
+engine:
+  dataflow_order: insertion
+  vault:
+    address: https://user.example.com
+    namespace: team
+performance:
+  cache:
+    ttl: 10m
+`)
+	writeFile(t, filepath.Join(dir, ProjectFileName), `
+engine:
+  vault:
+    address: https://project.example.com
+`)
+	t.Setenv("VAULT_NAMESPACE", "from-env")
+
+	e, err := Resolve(dir)
+	if err != nil {
+		t.Fatalf("Failed to resolve config: %v", err)
+	}
+
+	if e.Config.Engine.DataflowOrder != "insertion" {
+		t.Errorf("Expected dataflow order from the user file, got %s", e.Config.Engine.DataflowOrder)
+	}
+	if e.Config.Engine.Vault.Address != "https://project.example.com" {
+		t.Errorf("Expected the project file to beat the user file, got %s", e.Config.Engine.Vault.Address)
+	}
+	if e.Config.Engine.Vault.Namespace != "from-env" {
+		t.Errorf("Expected the environment to beat the files, got %s", e.Config.Engine.Vault.Namespace)
+	}
+	if e.Config.Performance.Cache.TTL != 10*time.Minute {
+		t.Errorf("Expected a 10m cache TTL, got %s", e.Config.Performance.Cache.TTL)
+	}
+
+	if err := e.SetFlag("engine.dataflow_order", "--dataflow-order", "alphabetical"); err != nil {
+		t.Fatal(err)
+	}
+	if e.Config.Engine.DataflowOrder != "alphabetical" {
+		t.Errorf("Expected the flag to beat everything, got %s", e.Config.Engine.DataflowOrder)
+	}
+
+	origins := map[string]string{
+		"engine.dataflow_order":  "flag --dataflow-order",
+		"engine.vault.address":   "project " + filepath.Join(dir, ProjectFileName),
+		"engine.vault.namespace": "env VAULT_NAMESPACE",
+		"performance.cache.ttl":  "user " + filepath.Join(xdg, "graft", "config.yml"),
+		"engine.output_format":   "default",
+	}
+	for key, want := range origins {
+		if got := e.Origin(key).String(); got != want {
+			t.Errorf("Expected %s to come from %q, got %q", key, want, got)
+		}
+	}
+	if e.IsSet("engine.output_format") {
+		t.Error("Expected engine.output_format to be left at its default")
+	}
+}
+
+func TestResolveRejectsUnknownKeys(t *testing.T) {
+	isolate(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ProjectFileName), "engine:\n  dataflow: insertion\n")
+
+	_, err := Resolve(dir)
+	if err == nil || !strings.Contains(err.Error(), "field dataflow not found") {
+		t.Errorf("Expected an unknown field error, got %v", err)
+	}
+}
+
+func TestEnvironmentDurations(t *testing.T) {
+	t.Setenv("GRAFT_PERFORMANCE_CACHE_TTL", "90s")
+
+	cfg := DefaultConfig()
+	loader := NewLoader()
+	if err := loader.LoadFromEnvironment(cfg); err != nil {
+		t.Fatalf("Failed to load from environment: %v", err)
+	}
+	if cfg.Performance.Cache.TTL != 90*time.Second {
+		t.Errorf("Expected a 90s cache TTL, got %s", cfg.Performance.Cache.TTL)
+	}
+	if got := loader.Applied()["performance.cache.ttl"]; got != "GRAFT_PERFORMANCE_CACHE_TTL" {
+		t.Errorf("Expected the TTL to be recorded as coming from GRAFT_PERFORMANCE_CACHE_TTL, got %q", got)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	isolate(t)
+	t.Setenv("VAULT_TOKEN", "s.secret")
+
+	e, err := Resolve(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, s := range e.Settings() {
+		if s.Key == "engine.vault.token" {
+			found = true
+			if !s.Secret {
+				t.Error("Expected the vault token to be marked secret")
+			}
+			if s.Origin.String() != "env VAULT_TOKEN" {
+				t.Errorf("Expected the token to come from VAULT_TOKEN, got %s", s.Origin)
+			}
+		}
+		if s.Key == "performance.cache.ttl" && s.Value != "5m0s" {
+			t.Errorf("Expected durations to be shown as strings, got %v", s.Value)
+		}
+	}
+	if !found {
+		t.Error("Expected engine.vault.token to be listed")
+	}
+}
+
+func TestResolveTargets(t *testing.T) {
+	xdg := isolate(t)
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(xdg, "graft", "config.yml"), `
+targets:
+  vault:
+    production:
+      address: https://vault.user.example.com
+      namespace: user
+    staging:
+      address: https://vault.staging.example.com
+`)
+	writeFile(t, filepath.Join(dir, ProjectFileName), `
+targets:
+  vault:
+    production:
+      address: https://vault.example.com
+      token: s.do-not-print
+      tls:
+        ca_cert: /etc/ssl/vault-ca.pem
+      timeout: 10s
+      cache_ttl: 1m
+  nats:
+    events:
+      address: nats://nats.example.com:4222
+      retries: 5
+`)
+
+	e, err := Resolve(dir)
+	if err != nil {
+		t.Fatalf("Failed to resolve config: %v", err)
+	}
+
+	production := e.Config.Targets.Vault["production"]
+	if production.Address != "https://vault.example.com" || production.TLS.CACert != "/etc/ssl/vault-ca.pem" {
+		t.Errorf("Expected the project declaration of production, got %+v", production)
+	}
+	if production.Timeout != 10*time.Second || production.CacheTTL != time.Minute {
+		t.Errorf("Expected durations to be parsed, got %s and %s", production.Timeout, production.CacheTTL)
+	}
+	if production.Namespace != "" {
+		t.Errorf("Expected the project declaration to replace the user one as a whole, got namespace %q", production.Namespace)
+	}
+	if e.IsSet("targets.vault.production.namespace") {
+		t.Error("Expected the namespace of the replaced declaration to be forgotten")
+	}
+	if _, ok := e.Config.Targets.Vault["staging"]; !ok {
+		t.Error("Expected the staging target from the user file to be kept")
+	}
+	if e.Config.Targets.NATS["events"].Retries != 5 {
+		t.Errorf("Expected 5 retries for nats events, got %d", e.Config.Targets.NATS["events"].Retries)
+	}
+
+	found := false
+	for _, s := range e.Settings() {
+		if s.Key == "targets.vault.production.token" {
+			found = true
+			if !s.Secret {
+				t.Error("Expected target tokens to be marked secret")
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected targets.vault.production.token to be listed")
+	}
+	if got := e.Origin("targets.nats.events.address").String(); got != "project "+filepath.Join(dir, ProjectFileName) {
+		t.Errorf("Expected the nats address to come from the project file, got %s", got)
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Targets.Vault = map[string]VaultTargetConfig{
+		"production": {Address: "vault.example.com", Auth: VaultAuthConfig{Method: "magic"}},
+		"ci":         {Address: "https://vault.example.com", Auth: VaultAuthConfig{Method: "approle", RoleID: "graft-ci"}},
+	}
+	cfg.Engine.Vault.Auth.Method = "oidc"
+	cfg.Targets.AWS = map[string]AWSTargetConfig{
+		"production": {Region: "us-east-1", AccessKeyID: "AKIAEXAMPLE"},
+	}
+	cfg.Targets.NATS = map[string]NATSTargetConfig{
+		"events": {Address: "nats://nats.example.com:4222", TLS: TLSConfig{ClientCert: "client.pem"}},
+	}
+
+	err := Validate(cfg)
+	if err == nil {
+		t.Fatal("Expected the targets to fail validation")
+	}
+	for _, want := range []string{
+		"targets.vault.production.address",
+		"targets.vault.production.auth.method",
+		"'targets.aws.production' with value '<redacted>'",
+		"targets.nats.events.tls",
+		"engine.vault.auth.method",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected a problem with %s, got %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "AKIAEXAMPLE") {
+		t.Error("Expected validation errors not to include secrets")
+	}
+	if strings.Contains(err.Error(), "targets.vault.ci") {
+		t.Errorf("Expected vault@ci to log in with approle, got %v", err)
+	}
+}
@@ -12,22 +12,35 @@ import (
 // Loader handles configuration loading from various sources
 type Loader struct {
 	envPrefix string
+
+	// applied maps the key of each setting taken from the environment to
+	// the variable it came from
+	applied map[string]string
 }
 
 // NewLoader creates a new configuration loader
 func NewLoader() *Loader {
 	return &Loader{
 		envPrefix: "GRAFT_",
+		applied:   map[string]string{},
 	}
 }
 
 // LoadFromEnvironment loads configuration from environment variables
 func (l *Loader) LoadFromEnvironment(cfg *Config) error {
-	return l.applyEnvOverrides(reflect.ValueOf(cfg).Elem(), "")
+	return l.applyEnvOverrides(reflect.ValueOf(cfg).Elem(), "", "")
+}
+
+// Applied returns the keys of the settings LoadFromEnvironment took from the
+// environment (such as engine.vault.address), mapped to the variable each
+// one came from
+func (l *Loader) Applied() map[string]string {
+	return l.applied
 }
 
-// applyEnvOverrides recursively applies environment variable overrides
-func (l *Loader) applyEnvOverrides(v reflect.Value, prefix string) error {
+// applyEnvOverrides recursively applies environment variable overrides.
+// keyPrefix is the dotted YAML key of v.
+func (l *Loader) applyEnvOverrides(v reflect.Value, prefix, keyPrefix string) error {
 	t := v.Type()
 
 	for i := 0; i < v.NumField(); i++ {
@@ -56,6 +69,11 @@ func (l *Loader) applyEnvOverrides(v reflect.Value, prefix string) error {
 			}
 		}
 
+		key := yamlKey(keyPrefix, fieldType)
+		if value := os.Getenv(envName); value != "" && field.Kind() != reflect.Struct && field.Kind() != reflect.Map {
+			l.record(key, envName)
+		}
+
 		// Handle different field types
 		switch field.Kind() {
 		case reflect.Struct:
@@ -65,7 +83,7 @@ func (l *Loader) applyEnvOverrides(v reflect.Value, prefix string) error {
 				newPrefix += "_"
 			}
 			newPrefix += strings.ToUpper(fieldType.Name)
-			if err := l.applyEnvOverrides(field, newPrefix); err != nil {
+			if err := l.applyEnvOverrides(field, newPrefix, key); err != nil {
 				return err
 			}
 
@@ -84,6 +102,17 @@ func (l *Loader) applyEnvOverrides(v reflect.Value, prefix string) error {
 			}
 
 		case reflect.Int, reflect.Int64:
+			// time.Duration is an int64 too
+			if field.Type() == reflect.TypeOf(time.Duration(0)) {
+				if value := os.Getenv(envName); value != "" {
+					duration, err := time.ParseDuration(value)
+					if err != nil {
+						return fmt.Errorf("parsing duration from %s: %w", envName, err)
+					}
+					field.Set(reflect.ValueOf(duration))
+				}
+				continue
+			}
 			if value := os.Getenv(envName); value != "" {
 				intVal, err := strconv.ParseInt(value, 10, 64)
 				if err != nil {
@@ -104,20 +133,9 @@ func (l *Loader) applyEnvOverrides(v reflect.Value, prefix string) error {
 		case reflect.Map:
 			// Handle map[string]bool for features
 			if fieldType.Name == "Features" {
-				l.loadFeaturesFromEnv(field, envName)
+				l.loadFeaturesFromEnv(field, envName, key)
 			}
 
-		default:
-			// Handle time.Duration
-			if field.Type() == reflect.TypeOf(time.Duration(0)) {
-				if value := os.Getenv(envName); value != "" {
-					duration, err := time.ParseDuration(value)
-					if err != nil {
-						return fmt.Errorf("parsing duration from %s: %w", envName, err)
-					}
-					field.Set(reflect.ValueOf(duration))
-				}
-			}
 		}
 	}
 
@@ -125,7 +143,7 @@ func (l *Loader) applyEnvOverrides(v reflect.Value, prefix string) error {
 }
 
 // loadFeaturesFromEnv loads feature flags from environment variables
-func (l *Loader) loadFeaturesFromEnv(field reflect.Value, prefix string) {
+func (l *Loader) loadFeaturesFromEnv(field reflect.Value, prefix, key string) {
 	// Look for environment variables like GRAFT_FEATURES_FEATURENAME=true
 	environ := os.Environ()
 	featurePrefix := prefix + "_"
@@ -141,12 +159,32 @@ func (l *Loader) loadFeaturesFromEnv(field reflect.Value, prefix string) {
 				featureName := strings.ToLower(strings.TrimPrefix(parts[0], featurePrefix))
 				if value, err := strconv.ParseBool(parts[1]); err == nil {
 					field.SetMapIndex(reflect.ValueOf(featureName), reflect.ValueOf(value))
+					l.record(key+"."+featureName, parts[0])
 				}
 			}
 		}
 	}
 }
 
+func (l *Loader) record(key, envName string) {
+	if l.applied == nil {
+		l.applied = map[string]string{}
+	}
+	l.applied[key] = envName
+}
+
+// yamlKey is the dotted YAML key of field, beneath parent
+func yamlKey(parent string, field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
 // MergeConfigs merges multiple configurations, with later configs taking precedence
 func MergeConfigs(base *Config, overlays ...*Config) *Config {
 	result := *base // Start with a copy of base
@@ -160,6 +198,7 @@ func MergeConfigs(base *Config, overlays ...*Config) *Config {
 		mergeEngine(&result.Engine, &overlay.Engine)
 		mergePerformance(&result.Performance, &overlay.Performance)
 		mergeLogging(&result.Logging, &overlay.Logging)
+		mergeTargets(&result.Targets, &overlay.Targets)
 
 		// Merge features map
 		if overlay.Features != nil {
@@ -219,6 +258,9 @@ func mergeVault(base, overlay *VaultConfig) {
 		base.Timeout = overlay.Timeout
 	}
 	base.SkipVerify = overlay.SkipVerify
+	if overlay.Auth.Method != "" {
+		base.Auth = overlay.Auth
+	}
 }
 
 // mergeAWS merges AWS configurations
@@ -346,3 +388,38 @@ func mergeLogging(base, overlay *LoggingConfig) {
 	}
 	base.EnableColor = overlay.EnableColor
 }
+
+// mergeTargets merges target declarations. A target declared in the overlay
+// replaces the base declaration of the same name as a whole.
+func mergeTargets(base, overlay *TargetsConfig) {
+	if len(overlay.Vault) > 0 {
+		merged := make(map[string]VaultTargetConfig, len(base.Vault)+len(overlay.Vault))
+		for name, target := range base.Vault {
+			merged[name] = target
+		}
+		for name, target := range overlay.Vault {
+			merged[name] = target
+		}
+		base.Vault = merged
+	}
+	if len(overlay.AWS) > 0 {
+		merged := make(map[string]AWSTargetConfig, len(base.AWS)+len(overlay.AWS))
+		for name, target := range base.AWS {
+			merged[name] = target
+		}
+		for name, target := range overlay.AWS {
+			merged[name] = target
+		}
+		base.AWS = merged
+	}
+	if len(overlay.NATS) > 0 {
+		merged := make(map[string]NATSTargetConfig, len(base.NATS)+len(overlay.NATS))
+		for name, target := range base.NATS {
+			merged[name] = target
+		}
+		for name, target := range overlay.NATS {
+			merged[name] = target
+		}
+		base.NATS = merged
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/wayneeseguin/graft/internal/utils/pathglob"
 )
 
 // ValidationError represents a configuration validation error
@@ -55,6 +59,16 @@ func Validate(cfg *Config) error {
 		errors = append(errors, errs...)
 	}
 
+	// Validate target declarations
+	if errs := validateTargets(&cfg.Targets); len(errs) > 0 {
+		errors = append(errors, errs...)
+	}
+
+	// Validate merge strategies
+	if errs := validateMerge(&cfg.Merge); len(errs) > 0 {
+		errors = append(errors, errs...)
+	}
+
 	// Validate version
 	if cfg.Version == "" {
 		errors = append(errors, ValidationError{
@@ -90,7 +104,7 @@ func validateEngine(cfg *EngineConfig) ValidationErrors {
 	}
 
 	// Validate dataflow order
-	validOrders := []string{"breadth-first", "depth-first", "legacy"}
+	validOrders := []string{"alphabetical", "insertion", "breadth-first", "depth-first", "legacy"}
 	if !contains(validOrders, cfg.DataflowOrder) {
 		errors = append(errors, ValidationError{
 			Field:   "engine.dataflow_order",
@@ -133,6 +147,9 @@ func validateVault(cfg *VaultConfig) ValidationErrors {
 		}
 	}
 
+	// Validate authentication
+	errors = append(errors, validateVaultAuth("engine.vault.auth", &cfg.Auth)...)
+
 	// Validate timeout
 	if cfg.Timeout != "" {
 		if _, err := time.ParseDuration(cfg.Timeout); err != nil {
@@ -417,6 +434,156 @@ func validateLogging(cfg *LoggingConfig) ValidationErrors {
 	return errors
 }
 
+// validateVaultAuth checks that an auth method is one graft knows. The
+// settings the method logs in with may come from the environment instead.
+func validateVaultAuth(field string, auth *VaultAuthConfig) ValidationErrors {
+	validMethods := []string{"", "token", "approle", "kubernetes", "userpass", "cert"}
+	if !contains(validMethods, auth.Method) {
+		return ValidationErrors{{
+			Field:   field + ".method",
+			Value:   auth.Method,
+			Message: "must be one of: [token approle kubernetes userpass cert]",
+		}}
+	}
+	return nil
+}
+
+// validateMerge validates the merge strategies
+func validateMerge(cfg *MergeConfig) ValidationErrors {
+	var errors ValidationErrors
+
+	for i, s := range cfg.Strategies {
+		field := fmt.Sprintf("merge.strategies.%d", i)
+		if s.Path == "" {
+			errors = append(errors, ValidationError{
+				Field:   field + ".path",
+				Value:   s.Path,
+				Message: "path cannot be empty",
+			})
+		} else if err := pathglob.Validate(s.Path); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   field + ".path",
+				Value:   s.Path,
+				Message: fmt.Sprintf("invalid path pattern: %s", err),
+			})
+		}
+		if !contains([]string{"", "merge", "inline", "append", "prepend", "replace", "union", "intersect", "subtract"}, s.List) {
+			errors = append(errors, ValidationError{
+				Field:   field + ".list",
+				Value:   s.List,
+				Message: "must be one of: [merge inline append prepend replace union intersect subtract]",
+			})
+		}
+		if s.Key != "" && s.List != "" && s.List != "merge" {
+			errors = append(errors, ValidationError{
+				Field:   field + ".key",
+				Value:   s.Key,
+				Message: "only applies to list mode merge",
+			})
+		}
+		if !contains([]string{"", "merge", "replace"}, s.Map) {
+			errors = append(errors, ValidationError{
+				Field:   field + ".map",
+				Value:   s.Map,
+				Message: "must be one of: [merge replace]",
+			})
+		}
+	}
+
+	return errors
+}
+
+// validateTargets validates the settings given for each target. Settings a
+// target needs but does not declare may still come from the environment, so
+// only `graft targets check` can tell whether a target is complete.
+func validateTargets(cfg *TargetsConfig) ValidationErrors {
+	var errors ValidationErrors
+
+	for _, name := range targetNames(cfg.Vault) {
+		target := cfg.Vault[name]
+		field := "targets.vault." + name
+		errors = append(errors, validateTargetURL(field+".address", target.Address)...)
+		errors = append(errors, validateVaultAuth(field+".auth", &target.Auth)...)
+		errors = append(errors, validateTLS(field+".tls", &target.TLS)...)
+		errors = append(errors, validateTargetDurations(field, target.Timeout, target.CacheTTL)...)
+	}
+
+	for _, name := range targetNames(cfg.AWS) {
+		target := cfg.AWS[name]
+		field := "targets.aws." + name
+		if target.Region != "" && !isValidAWSRegion(target.Region) {
+			errors = append(errors, ValidationError{
+				Field:   field + ".region",
+				Value:   target.Region,
+				Message: "invalid AWS region format",
+			})
+		}
+		if (target.AccessKeyID == "") != (target.SecretAccessKey == "") {
+			errors = append(errors, ValidationError{
+				Field:   field,
+				Value:   "<redacted>",
+				Message: "access_key_id and secret_access_key must be given together",
+			})
+		}
+		errors = append(errors, validateTargetURL(field+".endpoint", target.Endpoint)...)
+		if target.MaxRetries < 0 {
+			errors = append(errors, ValidationError{
+				Field:   field + ".max_retries",
+				Value:   target.MaxRetries,
+				Message: "cannot be negative",
+			})
+		}
+		errors = append(errors, validateTargetDurations(field, target.Timeout, target.CacheTTL)...)
+	}
+
+	for _, name := range targetNames(cfg.NATS) {
+		target := cfg.NATS[name]
+		field := "targets.nats." + name
+		errors = append(errors, validateTargetURL(field+".address", target.Address)...)
+		errors = append(errors, validateTLS(field+".tls", &target.TLS)...)
+		if target.Retries < 0 {
+			errors = append(errors, ValidationError{
+				Field:   field + ".retries",
+				Value:   target.Retries,
+				Message: "cannot be negative",
+			})
+		}
+		errors = append(errors, validateTargetDurations(field, target.Timeout, target.CacheTTL)...)
+	}
+
+	return errors
+}
+
+func validateTargetURL(field, address string) ValidationErrors {
+	if address == "" {
+		return nil
+	}
+	if u, err := url.Parse(address); err != nil {
+		return ValidationErrors{{Field: field, Value: address, Message: fmt.Sprintf("invalid URL: %v", err)}}
+	} else if u.Scheme == "" || u.Host == "" {
+		return ValidationErrors{{Field: field, Value: address, Message: "invalid URL: must have scheme and host"}}
+	}
+	return nil
+}
+
+func validateTLS(field string, cfg *TLSConfig) ValidationErrors {
+	if (cfg.ClientCert == "") != (cfg.ClientKey == "") {
+		return ValidationErrors{{Field: field, Value: cfg.ClientCert, Message: "client_cert and client_key must be given together"}}
+	}
+	return nil
+}
+
+func validateTargetDurations(field string, timeout, cacheTTL time.Duration) ValidationErrors {
+	var errors ValidationErrors
+	if timeout < 0 {
+		errors = append(errors, ValidationError{Field: field + ".timeout", Value: timeout, Message: "cannot be negative"})
+	}
+	if cacheTTL < 0 {
+		errors = append(errors, ValidationError{Field: field + ".cache_ttl", Value: cacheTTL, Message: "cannot be negative"})
+	}
+	return errors
+}
+
 // Helper functions
 
 func contains(slice []string, item string) bool {
@@ -428,6 +595,18 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
+// targetNames returns the names of the targets in one of the maps of a
+// TargetsConfig, sorted
+func targetNames(targets interface{}) []string {
+	v := reflect.ValueOf(targets)
+	names := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		names = append(names, k.String())
+	}
+	sort.Strings(names)
+	return names
+}
+
 func isValidAWSRegion(region string) bool {
 	// Basic validation for AWS region format
 	// Format: xx-xxxx-n (e.g., us-east-1, eu-west-2)
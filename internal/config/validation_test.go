@@ -181,6 +181,30 @@ func TestValidateAWSEndpoint(t *testing.T) {
 	}
 }
 
+func TestValidateMergeStrategies(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Merge.Strategies = []MergeStrategyConfig{
+		{Path: "jobs", Key: "id"},
+		{Path: "meta.cidrs", List: "shuffle"},
+		{List: "append"},
+	}
+
+	err := Validate(cfg)
+	if err == nil {
+		t.Error("Expected validation error for invalid merge strategies")
+	}
+
+	if !containsError(err, "merge.strategies.1.list") {
+		t.Errorf("Expected 'merge.strategies.1.list' error, got: %v", err)
+	}
+	if !containsError(err, "path cannot be empty") {
+		t.Errorf("Expected 'path cannot be empty' error, got: %v", err)
+	}
+	if containsError(err, "merge.strategies.0") {
+		t.Errorf("Expected no error for the first strategy, got: %v", err)
+	}
+}
+
 func TestValidateParserMaxDocumentSize(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.Engine.Parser.MaxDocumentSize = 0
@@ -37,6 +37,8 @@ var (
 	}
 
 	re = regexp.MustCompile(`(?s)@[kKrRgGyYbBmMpPcCwW*]{.*?}`)
+
+	escapes = regexp.MustCompile("\033\\[[0-9;]*m")
 )
 
 // isTerminal checks if the given file descriptor is a terminal
@@ -90,3 +92,9 @@ func Sprintf(format string, a ...interface{}) string {
 func Errorf(format string, a ...interface{}) error {
 	return fmt.Errorf(colorize(format), a...)
 }
+
+// Strip removes any ANSI color codes from s, such as those left in an error
+// message that was formatted while color was enabled
+func Strip(s string) string {
+	return escapes.ReplaceAllString(s, "")
+}
@@ -186,6 +186,19 @@ func TestErrorf(t *testing.T) {
 	}
 }
 
+func TestStrip(t *testing.T) {
+	Color(true)
+	defer Color(false)
+
+	colored := Sprintf("@R{Fatal error} in @c{%s}", "main.go")
+	if got := Strip(colored); got != "Fatal error in main.go" {
+		t.Errorf("Strip(%q) = %q, want %q", colored, got, "Fatal error in main.go")
+	}
+	if got := Strip("plain"); got != "plain" {
+		t.Errorf("Strip(%q) = %q, want %q", "plain", got, "plain")
+	}
+}
+
 func TestAllColors(t *testing.T) {
 	Color(true)
 
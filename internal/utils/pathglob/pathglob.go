@@ -0,0 +1,66 @@
+// Package pathglob matches the dotted paths of YAML documents, like
+// `jobs.web.properties.password`, against patterns like `jobs.*.properties`
+// or `**.password`.
+package pathglob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether the dotted path p is at or beneath a path that
+// pattern matches. Patterns are matched one segment at a time: `*` matches
+// any single segment (or part of one, as in `*_key`) and `**` matches any
+// number of segments. A leading `$.` is ignored.
+func Match(pattern, p string) bool {
+	return match(Segments(pattern), Segments(p), false)
+}
+
+// MatchExact reports whether pattern matches the dotted path p itself,
+// rather than one of its parents
+func MatchExact(pattern, p string) bool {
+	return match(Segments(pattern), Segments(p), true)
+}
+
+// Validate checks that pattern can be used with Match and MatchExact
+func Validate(pattern string) error {
+	for _, segment := range Segments(pattern) {
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Segments splits a dotted path, or a pattern, into its segments
+func Segments(p string) []string {
+	p = strings.TrimPrefix(strings.TrimPrefix(p, "$"), ".")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, ".")
+}
+
+// match matches the segments of a path against those of a pattern. Unless
+// exact is set, the path only has to start with something the pattern
+// matches.
+func match(pattern, segments []string, exact bool) bool {
+	if len(pattern) == 0 {
+		return !exact || len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if match(pattern[1:], segments[i:], exact) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return match(pattern[1:], segments[1:], exact)
+}
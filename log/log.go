@@ -3,7 +3,9 @@ package log
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 )
 
 var DebugOn bool = false
@@ -12,16 +14,68 @@ var TraceOn bool = false
 // PrintfStdErr is a configurable hook to print to error output
 var PrintfStdErr func(string, ...interface{})
 
+// concealed holds the values that DEBUG and TRACE never print
+var concealed = struct {
+	sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}{values: map[string]bool{}}
+
 func init() {
 	PrintfStdErr = func(format string, args ...interface{}) {
 		fmt.Fprintf(os.Stderr, format, args...)
 	}
 }
 
+// Conceal keeps values out of debug and trace messages from now on; each
+// occurrence is printed as REDACTED instead
+func Conceal(values ...string) {
+	concealed.Lock()
+	defer concealed.Unlock()
+
+	added := false
+	for _, v := range values {
+		if v != "" && !concealed.values[v] {
+			concealed.values[v] = true
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// longest first, so that a value containing another is hidden whole
+	sorted := make([]string, 0, len(concealed.values))
+	for v := range concealed.values {
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, v := range sorted {
+		pairs = append(pairs, v, "REDACTED")
+	}
+	concealed.replacer = strings.NewReplacer(pairs...)
+}
+
+// conceal replaces the concealed values in content
+func conceal(content string) string {
+	concealed.RLock()
+	defer concealed.RUnlock()
+	if concealed.replacer == nil {
+		return content
+	}
+	return concealed.replacer.Replace(content)
+}
+
 // DEBUG - Prints out a debug message
 func DEBUG(format string, args ...interface{}) {
 	if DebugOn {
-		content := fmt.Sprintf(format, args...)
+		content := conceal(fmt.Sprintf(format, args...))
 		lines := strings.Split(content, "\n")
 		for i, line := range lines {
 			lines[i] = "DEBUG> " + line
@@ -34,7 +88,7 @@ func DEBUG(format string, args ...interface{}) {
 // TRACE - Prints out a trace message
 func TRACE(format string, args ...interface{}) {
 	if TraceOn {
-		content := fmt.Sprintf(format, args...)
+		content := conceal(fmt.Sprintf(format, args...))
 		lines := strings.Split(content, "\n")
 		for i, line := range lines {
 			lines[i] = "-----> " + line
@@ -31,5 +31,12 @@ func TestDebug(t *testing.T) {
 			DEBUG("test debugging")
 			So(stderr, ShouldEqual, "")
 		})
+		Convey("Never prints concealed values", func() {
+			stderr = ""
+			DebugOn = true
+			Conceal("hunter2", "hunter2-and-more")
+			DEBUG("password is %s, url has %s", "hunter2", "x-hunter2-and-more")
+			So(stderr, ShouldEqual, "DEBUG> password is REDACTED, url has x-REDACTED\n")
+		})
 	})
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
 	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 	vaultkv "github.com/cloudfoundry-community/vaultkv"
+	"github.com/cppforlife/go-patch/patch"
 )
 
 // Document represents a YAML/JSON document in a more user-friendly format
@@ -61,6 +62,15 @@ type Document interface {
 	// GetData returns the underlying data (for backward compatibility)
 	GetData() interface{}
 
+	// Provenance reports the file, line and column that last wrote the value
+	// at path, and the operator call that produced it, if any
+	Provenance(path string) (ValueSource, bool)
+
+	// Tainted returns the paths whose values came from a sensitive operator
+	// call, such as (( vault )), or were derived from one, each with the call
+	// it came from
+	Tainted() map[string]TaintSource
+
 	// Additional type-safe getters
 	GetInt64(path string) (int64, error)
 	GetFloat64(path string) (float64, error)
@@ -84,6 +94,12 @@ type Engine interface {
 	// Evaluate processes operators in a document
 	Evaluate(ctx context.Context, doc Document) (Document, error)
 
+	// Diff returns the differences between two documents
+	Diff(from, to Document, options DiffOptions) ([]DiffChange, error)
+
+	// GoPatch returns the go-patch operations that turn one document into another
+	GoPatch(from, to Document) (patch.Ops, error)
+
 	// Output operations
 	ToYAML(doc Document) ([]byte, error)
 	ToJSON(doc Document) ([]byte, error)
@@ -148,6 +164,20 @@ const (
 	ReplaceArrays
 	// PrependArrays prepends new array elements
 	PrependArrays
+	// UnionArrays keeps every distinct element of both arrays, once each,
+	// as (( union )) does. Arrays of maps still merge on their name.
+	UnionArrays
+	// IntersectArrays keeps the elements found in both arrays, as
+	// (( intersect )) does. Arrays of maps still merge on their name.
+	IntersectArrays
+	// SubtractArrays removes the elements of the new array from the
+	// original, as (( subtract )) does. Arrays of maps still merge on their
+	// name.
+	SubtractArrays
+	// DedupeArrays merges arrays of maps on their name like the default,
+	// collapsing entries with the same name into one with a warning, as
+	// (( merge on name dedupe )) does
+	DedupeArrays
 )
 
 // MergeBuilder provides a fluent interface for merge operations
@@ -161,15 +191,44 @@ type MergeBuilder interface {
 	// WithArrayMergeStrategy sets how arrays are merged
 	WithArrayMergeStrategy(strategy ArrayMergeStrategy) MergeBuilder
 
+	// WithMergeStrategies says how the lists and maps at the paths the
+	// strategies match merge, in place of array operators in the overlays
+	WithMergeStrategies(strategies ...MergeStrategy) MergeBuilder
+
 	// SkipEvaluation skips operator evaluation after merging
 	SkipEvaluation() MergeBuilder
 
 	// EnableGoPatch enables go-patch format parsing
 	EnableGoPatch() MergeBuilder
 
+	// WithPatch adds an RFC 6902 JSON Patch or RFC 7386 JSON Merge Patch to
+	// the documents to merge. It applies to the result of merging the
+	// documents before it, and later documents merge on top of it.
+	WithPatch(data []byte, format PatchFormat) MergeBuilder
+
 	// FallbackAppend uses append instead of inline for arrays by default
 	FallbackAppend() MergeBuilder
 
+	// PreserveOrder emits keys in first-seen order across the merged documents
+	// when the result is converted with ToYAML, instead of sorting them
+	PreserveOrder() MergeBuilder
+
+	// PreserveComments keeps the comments of the merged documents when the
+	// result is converted with ToYAML
+	PreserveComments() MergeBuilder
+
+	// WithTrace records every operator call made while evaluating the merged
+	// document into trace
+	WithTrace(trace *EvalTrace) MergeBuilder
+
+	// Redact masks every value that came from a sensitive operator call, or
+	// was derived from one, as REDACTED in the result
+	Redact() MergeBuilder
+
+	// WithRedactor masks every value that came from a sensitive operator
+	// call, or was derived from one, with what redactor returns for it
+	WithRedactor(redactor Redactor) MergeBuilder
+
 	// Execute performs the merge operation
 	Execute() (Document, error)
 }
@@ -386,6 +445,14 @@ var (
 	// SkipVault disables vault operations when true
 	SkipVault bool
 
+	// TrackVaultRefs records vault references in VaultRefs even when vault
+	// operations are not skipped
+	TrackVaultRefs bool
+
+	// TrackExternalRefs records the references made by the awsparam,
+	// awssecret, nats, file and load operators, for refsinfo
+	TrackExternalRefs bool
+
 	// SkipAws disables AWS operations when true
 	SkipAws bool
 
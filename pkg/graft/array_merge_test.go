@@ -132,6 +132,83 @@ steps:
 			So(steps[3], ShouldEqual, "Test")
 		})
 
+		Convey("Set strategies with WithArrayMergeStrategy", func() {
+			base := []byte(`
+allowed_cidrs: [10.0.0.0/8, 192.168.0.0/16, 10.0.0.0/8]
+`)
+			overlay := []byte(`
+allowed_cidrs: [192.168.0.0/16, 172.16.0.0/12]
+`)
+			baseDoc, _ := engine.ParseYAML(base)
+			overlayDoc, _ := engine.ParseYAML(overlay)
+			merge := func(strategy ArrayMergeStrategy) []interface{} {
+				result, err := engine.Merge(ctx, baseDoc, overlayDoc).
+					WithArrayMergeStrategy(strategy).
+					Execute()
+				So(err, ShouldBeNil)
+				cidrs, _ := result.GetSlice("allowed_cidrs")
+				return cidrs
+			}
+
+			So(merge(UnionArrays), ShouldResemble, []interface{}{"10.0.0.0/8", "192.168.0.0/16", "172.16.0.0/12"})
+			So(merge(IntersectArrays), ShouldResemble, []interface{}{"192.168.0.0/16"})
+			So(merge(SubtractArrays), ShouldResemble, []interface{}{"10.0.0.0/8"})
+		})
+
+		Convey("Set strategies leave arrays of maps merging on their name", func() {
+			base := []byte(`
+zones: [z1, z2]
+jobs:
+  - name: web
+    instances: 2
+`)
+			overlay := []byte(`
+zones: [z2, z3]
+jobs:
+  - name: web
+    instances: 4
+`)
+			baseDoc, _ := engine.ParseYAML(base)
+			overlayDoc, _ := engine.ParseYAML(overlay)
+
+			result, err := engine.Merge(ctx, baseDoc, overlayDoc).
+				WithArrayMergeStrategy(UnionArrays).
+				Execute()
+			So(err, ShouldBeNil)
+
+			zones, _ := result.GetSlice("zones")
+			So(zones, ShouldResemble, []interface{}{"z1", "z2", "z3"})
+			jobs, _ := result.GetSlice("jobs")
+			So(jobs, ShouldResemble, []interface{}{map[interface{}]interface{}{"name": "web", "instances": 4}})
+		})
+
+		Convey("Dedupe strategy collapses entries with the same name", func() {
+			base := []byte(`
+jobs:
+  - name: web
+    instances: 2
+  - name: web
+    azs: [z1]
+`)
+			overlay := []byte(`
+jobs:
+  - name: web
+    instances: 4
+`)
+			baseDoc, _ := engine.ParseYAML(base)
+			overlayDoc, _ := engine.ParseYAML(overlay)
+
+			result, err := engine.Merge(ctx, baseDoc, overlayDoc).
+				WithArrayMergeStrategy(DedupeArrays).
+				Execute()
+			So(err, ShouldBeNil)
+
+			jobs, _ := result.GetSlice("jobs")
+			So(jobs, ShouldResemble, []interface{}{
+				map[interface{}]interface{}{"name": "web", "instances": 4, "azs": []interface{}{"z1"}},
+			})
+		})
+
 		Convey("Array operators override merge strategy", func() {
 			base := []byte(`
 items:
@@ -0,0 +1,219 @@
+package graft
+
+import (
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Comments records the YAML comments found in the source documents, indexed
+// by the dotted path of the key (or list entry) they are attached to.
+//
+// Like KeyOrder, comments live alongside the document data rather than in
+// it, which means a value that an operator replaces keeps the comments of the
+// key that held the (( ... )) expression.
+type Comments struct {
+	entries map[string]yamlComment
+
+	// head and foot are the comments of the document itself, above the first
+	// key and below the last one
+	head string
+	foot string
+}
+
+// yamlComment holds the comments yaml.v3 attached to a mapping key and to its
+// value (or to a list entry, which only has a value)
+type yamlComment struct {
+	KeyHead string
+	KeyLine string
+	KeyFoot string
+	Head    string
+	Line    string
+	Foot    string
+}
+
+func (c yamlComment) empty() bool {
+	return c == yamlComment{}
+}
+
+// NewComments creates an empty Comments table
+func NewComments() *Comments {
+	return &Comments{entries: make(map[string]yamlComment)}
+}
+
+// commentsFromNode records every comment found in a parsed yaml.v3 node tree
+func commentsFromNode(node *yaml.Node) *Comments {
+	c := NewComments()
+	if node == nil {
+		return c
+	}
+
+	root := node
+	if node.Kind == yaml.DocumentNode {
+		c.head, c.foot = node.HeadComment, node.FootComment
+		if len(node.Content) == 0 {
+			return c
+		}
+		root = node.Content[0]
+		if c.head == "" && root.Kind == yaml.MappingNode && len(root.Content) > 0 {
+			c.head = splitDocumentHead(root.Content[0])
+		}
+	}
+	if rootComment := (yamlComment{Head: root.HeadComment, Line: root.LineComment, Foot: root.FootComment}); !rootComment.empty() {
+		c.entries[""] = rootComment
+	}
+	c.record(root, "")
+	return c
+}
+
+// splitDocumentHead takes the comment at the top of a document out of the
+// head comment of its first key. yaml.v3 only keeps such a comment on the
+// document when there is no `---` above it, otherwise giving it to the first
+// key with the blank line that ends it; returns "" if there is none.
+func splitDocumentHead(key *yaml.Node) string {
+	i := strings.LastIndex(key.HeadComment, "\n\n")
+	switch {
+	case strings.HasSuffix(key.HeadComment, "\n"):
+		head := strings.TrimRight(key.HeadComment, "\n")
+		key.HeadComment = ""
+		return head
+	case i >= 0:
+		head := key.HeadComment[:i]
+		key.HeadComment = key.HeadComment[i+2:]
+		return head
+	}
+	return ""
+}
+
+// record walks node, storing the comments of every key and list entry
+// beneath it
+func (c *Comments) record(node *yaml.Node, path string) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		if node.Alias != nil {
+			c.record(node.Alias, path)
+		}
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			sub := joinKeyPath(path, key.Value)
+			comment := yamlComment{
+				KeyHead: key.HeadComment,
+				KeyLine: key.LineComment,
+				KeyFoot: key.FootComment,
+				Head:    value.HeadComment,
+				Line:    value.LineComment,
+				Foot:    value.FootComment,
+			}
+			// A key set to a value is defined by this document, comments or
+			// not; maps and lists are merged into instead, so only those with
+			// comments of their own count
+			if (value.Kind != yaml.MappingNode && value.Kind != yaml.SequenceNode) || !comment.empty() {
+				c.entries[sub] = comment
+			}
+			c.record(value, sub)
+		}
+
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			sub := joinKeyPath(path, yamlNodeName(child, strconv.Itoa(i)))
+			if comment := (yamlComment{Head: child.HeadComment, Line: child.LineComment, Foot: child.FootComment}); !comment.empty() {
+				c.entries[sub] = comment
+			}
+			c.record(child, sub)
+		}
+	}
+}
+
+// Get returns the comments attached to the key or list entry at path
+func (c *Comments) Get(path string) (head, line, foot string) {
+	if c == nil {
+		return "", "", ""
+	}
+	e := c.entries[path]
+	return joinComment(e.KeyHead, e.Head), joinComment(e.KeyLine, e.Line), joinComment(e.KeyFoot, e.Foot)
+}
+
+// Merge folds the comments of other into c. Every key other sets to a value
+// takes the comments other has for it, or none if it has none, so the last
+// document to define a key decides its comments. Maps and lists other only
+// merges into keep their comments unless other comments them too.
+func (c *Comments) Merge(other *Comments) {
+	if other == nil {
+		return
+	}
+	for path, comment := range other.entries {
+		c.entries[path] = comment
+	}
+	if other.head != "" {
+		c.head = other.head
+	}
+	if other.foot != "" {
+		c.foot = other.foot
+	}
+}
+
+// Clone returns an independent copy of the comments
+func (c *Comments) Clone() *Comments {
+	if c == nil {
+		return nil
+	}
+	clone := NewComments()
+	clone.Merge(c)
+	return clone
+}
+
+// applyToKey attaches the comments recorded for path to the key and value
+// nodes being emitted for it
+func (c *Comments) applyToKey(path string, key, value *yaml.Node) {
+	if c == nil {
+		return
+	}
+	e, ok := c.entries[path]
+	if !ok {
+		return
+	}
+
+	key.HeadComment, key.LineComment, key.FootComment = e.KeyHead, e.KeyLine, e.KeyFoot
+	value.HeadComment, value.FootComment = e.Head, e.Foot
+	if value.Kind == yaml.ScalarNode {
+		value.LineComment = e.Line
+	} else {
+		// A trailing comment on `key: (( grab ... ))` was attached to the
+		// expression; once that becomes a map or list it belongs on the key
+		key.LineComment = joinComment(key.LineComment, e.Line)
+	}
+}
+
+// applyToValue attaches the comments recorded for path to a list entry or to
+// the root of the document
+func (c *Comments) applyToValue(path string, value *yaml.Node) {
+	if c == nil {
+		return
+	}
+	if e, ok := c.entries[path]; ok {
+		value.HeadComment, value.LineComment, value.FootComment = e.Head, e.Line, e.Foot
+	}
+}
+
+// joinComment combines two comments, skipping empty ones
+func joinComment(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + "\n" + b
+	}
+}
+
+// documentComments returns the comments carried by doc, if any
+func documentComments(doc Document) *Comments {
+	if d, ok := doc.(*document); ok {
+		return d.comments
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package graft
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestComments(t *testing.T) {
+	Convey("Comments", t, func() {
+		Convey("records comments by the path of the key they belong to", func() {
+			var node yaml.Node
+			err := yaml.Unmarshal([]byte(`# top of file
+
+# about meta
+meta: # meta line
+  quota: 10 # why ten
+jobs:
+  # the web job
+  - name: web
+`), &node)
+			So(err, ShouldBeNil)
+
+			comments := commentsFromNode(&node)
+			So(comments.head, ShouldEqual, "# top of file")
+
+			head, line, _ := comments.Get("meta")
+			So(head, ShouldEqual, "# about meta")
+			So(line, ShouldEqual, "# meta line")
+
+			_, line, _ = comments.Get("meta.quota")
+			So(line, ShouldEqual, "# why ten")
+
+			head, _, _ = comments.Get("jobs.web")
+			So(head, ShouldEqual, "# the web job")
+
+			head, line, foot := comments.Get("jobs.web.name")
+			So(head+line+foot, ShouldEqual, "")
+		})
+
+		Convey("takes the comment above the first key after --- as the document's", func() {
+			var node yaml.Node
+			err := yaml.Unmarshal([]byte(`---
+# top of file
+
+# about meta
+meta: {}
+`), &node)
+			So(err, ShouldBeNil)
+
+			comments := commentsFromNode(&node)
+			So(comments.head, ShouldEqual, "# top of file")
+			head, _, _ := comments.Get("meta")
+			So(head, ShouldEqual, "# about meta")
+		})
+
+		Convey("takes each key's comments from the last document that defined it", func() {
+			parse := func(src string) *Comments {
+				var node yaml.Node
+				So(yaml.Unmarshal([]byte(src), &node), ShouldBeNil)
+				return commentsFromNode(&node)
+			}
+			a := parse(`
+# about meta
+meta:
+  # agreed in OPS-123
+  quota: 10 # do not raise
+  name: web # from a
+`)
+			a.Merge(parse(`
+meta:
+  quota: 20
+  name: api # from b
+`))
+
+			head, _, _ := a.Get("meta")
+			So(head, ShouldEqual, "# about meta")
+			head, line, foot := a.Get("meta.quota")
+			So(head+line+foot, ShouldEqual, "")
+			_, line, _ = a.Get("meta.name")
+			So(line, ShouldEqual, "# from b")
+		})
+	})
+}
+
+func TestMergeBuilderPreserveComments(t *testing.T) {
+	Convey("MergeBuilder.PreserveComments", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+
+		base, err := engine.ParseYAML([]byte(`
+meta:
+  # agreed in OPS-123
+  quota: 10
+limit: (( grab meta.quota )) # keep in sync with meta
+copy: (( grab meta )) # whole block
+`))
+		So(err, ShouldBeNil)
+
+		overlay, err := engine.ParseYAML([]byte(`
+meta:
+  quota: 20 # raised for launch
+`))
+		So(err, ShouldBeNil)
+
+		Convey("keeps comments through merge and evaluation", func() {
+			result, err := engine.Merge(context.Background(), base, overlay).PreserveComments().Execute()
+			So(err, ShouldBeNil)
+
+			out, err := result.ToYAML()
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `copy: # whole block
+  quota: 20
+limit: 20 # keep in sync with meta
+meta:
+  quota: 20 # raised for launch
+`)
+		})
+
+		Convey("combines with PreserveOrder", func() {
+			result, err := engine.Merge(context.Background(), base, overlay).PreserveOrder().PreserveComments().Execute()
+			So(err, ShouldBeNil)
+
+			out, err := result.ToYAML()
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `meta:
+  quota: 20 # raised for launch
+limit: 20 # keep in sync with meta
+copy: # whole block
+  quota: 20
+`)
+		})
+
+		Convey("lays lists out as PreserveOrder does without it", func() {
+			doc, err := engine.ParseYAML([]byte(`
+jobs:
+- name: web
+  zones:
+  - z1
+  - z2
+  pairs:
+  - - a
+    - b
+  script: |
+    steps:
+      - build
+meta:
+  tags: [x]
+`))
+			So(err, ShouldBeNil)
+
+			ordered, err := engine.Merge(context.Background(), doc).PreserveOrder().Execute()
+			So(err, ShouldBeNil)
+			commented, err := engine.Merge(context.Background(), doc).PreserveOrder().PreserveComments().Execute()
+			So(err, ShouldBeNil)
+
+			want, err := ordered.ToYAML()
+			So(err, ShouldBeNil)
+			got, err := commented.ToYAML()
+			So(err, ShouldBeNil)
+			So(string(got), ShouldEqual, string(want))
+		})
+
+		Convey("drops comments by default", func() {
+			result, err := engine.Merge(context.Background(), base, overlay).Execute()
+			So(err, ShouldBeNil)
+
+			out, err := result.ToYAML()
+			So(err, ShouldBeNil)
+			So(string(out), ShouldNotContainSubstring, "#")
+		})
+	})
+}
@@ -0,0 +1,197 @@
+package graft
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+)
+
+// CycleError is returned when operator calls depend on each other in a loop,
+// so that none of them can be evaluated first
+type CycleError struct {
+	// Cycle lists the calls in the loop in order: each one needs the result
+	// of the next, and the last needs the result of the first
+	Cycle []CycleStep
+}
+
+// CycleStep is one of the operator calls in a CycleError
+type CycleStep struct {
+	Path     string   `json:"path"`
+	Operator string   `json:"operator"`
+	Source   string   `json:"source"`
+	Position Position `json:"position,omitempty"`
+}
+
+// Path returns the cycle as `a.b -> c.d -> a.b`
+func (e *CycleError) Path() string {
+	if len(e.Cycle) == 0 {
+		return ""
+	}
+	paths := make([]string, 0, len(e.Cycle)+1)
+	for _, step := range e.Cycle {
+		paths = append(paths, step.Path)
+	}
+	paths = append(paths, e.Cycle[0].Path)
+	return strings.Join(paths, " -> ")
+}
+
+func (e *CycleError) Error() string {
+	msg := ansi.Sprintf("@*{cycle detected in operator data-flow graph}: @m{%s}", e.Path())
+	for _, step := range e.Cycle {
+		msg += ansi.Sprintf("\n    @c{$.%s}: @G{%s}", step.Path, step.Source)
+		if step.Position.Line > 0 {
+			msg += fmt.Sprintf(" (%s:%d)", step.Position.File, step.Position.Line)
+		}
+	}
+	return msg
+}
+
+// findCycles reports every loop among the operator calls in all, given the
+// dependency pairs of the data flow graph ([a,b] means 'b' requires 'a'). It
+// finds the strongly connected components of the graph and describes one
+// loop through each of them, in path order.
+func (ev *Evaluator) findCycles(all map[string]*Opcall, g [][]*Opcall) error {
+	// needs[x] are the calls whose results x requires
+	needs := map[*Opcall][]*Opcall{}
+	for _, pair := range g {
+		needs[pair[1]] = append(needs[pair[1]], pair[0])
+	}
+
+	nodes := make([]*Opcall, 0, len(all))
+	for _, op := range all {
+		nodes = append(nodes, op)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return opcallPath(nodes[i]) < opcallPath(nodes[j]) })
+	for _, op := range nodes {
+		sort.Slice(needs[op], func(i, j int) bool { return opcallPath(needs[op][i]) < opcallPath(needs[op][j]) })
+	}
+
+	// Tarjan's strongly connected components
+	index := map[*Opcall]int{}
+	lowlink := map[*Opcall]int{}
+	onStack := map[*Opcall]bool{}
+	var stack []*Opcall
+	var components [][]*Opcall
+
+	var connect func(op *Opcall)
+	connect = func(op *Opcall) {
+		index[op] = len(index)
+		lowlink[op] = index[op]
+		stack = append(stack, op)
+		onStack[op] = true
+
+		for _, dep := range needs[op] {
+			if _, seen := index[dep]; !seen {
+				connect(dep)
+				if lowlink[dep] < lowlink[op] {
+					lowlink[op] = lowlink[dep]
+				}
+			} else if onStack[dep] && index[dep] < lowlink[op] {
+				lowlink[op] = index[dep]
+			}
+		}
+
+		if lowlink[op] == index[op] {
+			var component []*Opcall
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == op {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+	for _, op := range nodes {
+		if _, seen := index[op]; !seen {
+			connect(op)
+		}
+	}
+
+	var cycles []error
+	for _, component := range components {
+		members := map[*Opcall]bool{}
+		for _, op := range component {
+			members[op] = true
+		}
+		sort.Slice(component, func(i, j int) bool { return opcallPath(component[i]) < opcallPath(component[j]) })
+
+		start := component[0]
+		if len(component) == 1 && !containsOpcall(needs[start], start) {
+			continue
+		}
+		cycles = append(cycles, ev.cycleError(cycleFrom(start, needs, members)))
+	}
+
+	if len(cycles) == 0 {
+		return ansi.Errorf("@*{cycle detected in operator data-flow graph}")
+	}
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i].(*CycleError).Cycle[0].Path < cycles[j].(*CycleError).Cycle[0].Path
+	})
+	if len(cycles) == 1 {
+		return cycles[0]
+	}
+	return MultiError{Errors: cycles}
+}
+
+// cycleFrom finds the shortest loop from start back to itself that stays
+// within members
+func cycleFrom(start *Opcall, needs map[*Opcall][]*Opcall, members map[*Opcall]bool) []*Opcall {
+	prev := map[*Opcall]*Opcall{}
+	queue := []*Opcall{start}
+	for len(queue) > 0 {
+		op := queue[0]
+		queue = queue[1:]
+		for _, dep := range needs[op] {
+			if !members[dep] {
+				continue
+			}
+			if dep == start {
+				loop := []*Opcall{op}
+				for op != start {
+					op = prev[op]
+					loop = append(loop, op)
+				}
+				// loop runs backwards from op to start
+				for i, j := 0, len(loop)-1; i < j; i, j = i+1, j-1 {
+					loop[i], loop[j] = loop[j], loop[i]
+				}
+				return loop
+			}
+			if _, seen := prev[dep]; !seen {
+				prev[dep] = op
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return []*Opcall{start}
+}
+
+func (ev *Evaluator) cycleError(loop []*Opcall) *CycleError {
+	e := &CycleError{}
+	for _, op := range loop {
+		path := opcallPath(op)
+		e.Cycle = append(e.Cycle, CycleStep{
+			Path:     path,
+			Operator: op.Name(),
+			Source:   op.src,
+			Position: ev.sourcePosition(path),
+		})
+	}
+	return e
+}
+
+func containsOpcall(list []*Opcall, op *Opcall) bool {
+	for _, o := range list {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
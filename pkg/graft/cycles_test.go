@@ -0,0 +1,92 @@
+package graft
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCycleDetection(t *testing.T) {
+	Convey("Cycle detection", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+
+		YAML := func(s string) map[interface{}]interface{} {
+			doc, err := engine.ParseYAML([]byte(s))
+			So(err, ShouldBeNil)
+			return doc.RawData().(map[interface{}]interface{})
+		}
+
+		Convey("names every call in the loop, in order", func() {
+			ev := &Evaluator{Tree: YAML(`
+a:
+  b: (( grab c.d ))
+c:
+  d: (( concat "x" e ))
+e: (( grab a.b ))
+ok: (( grab a ))
+`)}
+			_, err := ev.DataFlow(EvalPhase)
+
+			var cycle *CycleError
+			So(errors.As(err, &cycle), ShouldBeTrue)
+			So(cycle.Path(), ShouldEqual, "a.b -> c.d -> e -> a.b")
+			So(cycle.Cycle, ShouldResemble, []CycleStep{
+				{Path: "a.b", Operator: "grab", Source: "(( grab c.d ))"},
+				{Path: "c.d", Operator: "concat", Source: `(( concat "x" e ))`},
+				{Path: "e", Operator: "grab", Source: "(( grab a.b ))"},
+			})
+		})
+
+		Convey("reports a call that depends on itself", func() {
+			ev := &Evaluator{Tree: YAML(`
+a: (( concat "x" a ))
+`)}
+			_, err := ev.DataFlow(EvalPhase)
+
+			var cycle *CycleError
+			So(errors.As(err, &cycle), ShouldBeTrue)
+			So(cycle.Path(), ShouldEqual, "a -> a")
+		})
+
+		Convey("reports each separate loop", func() {
+			ev := &Evaluator{Tree: YAML(`
+a: (( grab b ))
+b: (( grab a ))
+x: (( grab y ))
+y: (( grab z ))
+z: (( grab x ))
+`)}
+			_, err := ev.DataFlow(EvalPhase)
+
+			var multi MultiError
+			So(errors.As(err, &multi), ShouldBeTrue)
+			So(multi.Errors, ShouldHaveLength, 2)
+			So(multi.Errors[0].(*CycleError).Path(), ShouldEqual, "a -> b -> a")
+			So(multi.Errors[1].(*CycleError).Path(), ShouldEqual, "x -> y -> z -> x")
+		})
+
+		Convey("comes back from the engine with source locations", func() {
+			doc, err := engine.ParseYAML([]byte(`meta:
+  foo: (( grab meta.bar ))
+  bar: (( grab meta.foo ))
+`))
+			So(err, ShouldBeNil)
+
+			_, err = engine.Merge(context.Background(), WithSourceName(doc, "loop.yml")).Execute()
+
+			var cycle *CycleError
+			So(errors.As(err, &cycle), ShouldBeTrue)
+			So(cycle.Path(), ShouldEqual, "meta.bar -> meta.foo -> meta.bar")
+			So(cycle.Cycle[0].Position, ShouldResemble, Position{Line: 3, Column: 3, File: "loop.yml"})
+
+			records := ErrorRecords(err)
+			So(records, ShouldHaveLength, 1)
+			So(records[0].Type, ShouldEqual, "cycle_error")
+			So(records[0].Path, ShouldEqual, "$.meta.bar")
+			So(records[0].Message, ShouldEqual, "cycle detected in operator data-flow graph: meta.bar -> meta.foo -> meta.bar")
+		})
+	})
+}
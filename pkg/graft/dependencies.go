@@ -0,0 +1,164 @@
+package graft
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/wayneeseguin/graft/internal/utils/tree"
+)
+
+// DependencyGraph is the graph Evaluator.DataFlow uses to order operator
+// calls: one node per call, and an edge from each call to every call whose
+// result it needs.
+type DependencyGraph struct {
+	Nodes []*DependencyNode `json:"nodes"`
+	Edges []DependencyEdge  `json:"edges"`
+}
+
+// DependencyNode is an operator call in a DependencyGraph
+type DependencyNode struct {
+	Path     string `json:"path"`
+	Operator string `json:"operator"`
+	Source   string `json:"source"`
+}
+
+// DependencyEdge says that the operator call at From needs the result of the
+// one at To
+type DependencyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Dependencies builds the dependency graph of the operator calls in doc,
+// without running any of them. Calls from every phase are included; calls
+// only depend on others in the same phase.
+func Dependencies(doc Document) (*DependencyGraph, error) {
+	data, ok := doc.RawData().(map[interface{}]interface{})
+	if !ok {
+		return &DependencyGraph{}, nil
+	}
+
+	ev := &Evaluator{
+		Tree: deepCopyMap(data),
+		Deps: map[string][]tree.Cursor{},
+	}
+	return ev.DependencyGraph(MergePhase, ParamPhase, EvalPhase)
+}
+
+// DependencyGraph builds the graph DataFlow would use for each of phases
+func (ev *Evaluator) DependencyGraph(phases ...OperatorPhase) (*DependencyGraph, error) {
+	g := &DependencyGraph{}
+	seen := map[DependencyEdge]bool{}
+
+	for _, phase := range phases {
+		all, _, pairs, errs := ev.dataFlowGraph(phase)
+		if len(errs.Errors) > 0 {
+			return nil, errs
+		}
+
+		for _, op := range all {
+			g.Nodes = append(g.Nodes, &DependencyNode{
+				Path:     opcallPath(op),
+				Operator: op.Name(),
+				Source:   op.src,
+			})
+		}
+		for _, pair := range pairs {
+			edge := DependencyEdge{From: opcallPath(pair[1]), To: opcallPath(pair[0])}
+			if !seen[edge] {
+				seen[edge] = true
+				g.Edges = append(g.Edges, edge)
+			}
+		}
+	}
+
+	g.sort()
+	return g, nil
+}
+
+// Dependencies returns the part of the graph that the calls at or beneath
+// path need, directly or indirectly, including those calls themselves
+func (g *DependencyGraph) Dependencies(path string) *DependencyGraph {
+	return g.reachable(path, func(e DependencyEdge) (string, string) { return e.From, e.To })
+}
+
+// Dependents returns the part of the graph that needs the calls at or
+// beneath path, directly or indirectly, including those calls themselves
+func (g *DependencyGraph) Dependents(path string) *DependencyGraph {
+	return g.reachable(path, func(e DependencyEdge) (string, string) { return e.To, e.From })
+}
+
+// Node returns the node for the call at path, or nil
+func (g *DependencyGraph) Node(path string) *DependencyNode {
+	for _, n := range g.Nodes {
+		if n.Path == path {
+			return n
+		}
+	}
+	return nil
+}
+
+// reachable walks the graph from the nodes at or beneath path, following
+// each edge in the direction given by step
+func (g *DependencyGraph) reachable(path string, step func(DependencyEdge) (string, string)) *DependencyGraph {
+	path = strings.TrimPrefix(path, "$.")
+
+	next := map[string][]string{}
+	for _, e := range g.Edges {
+		from, to := step(e)
+		next[from] = append(next[from], to)
+	}
+
+	keep := map[string]bool{}
+	var queue []string
+	for _, n := range g.Nodes {
+		if n.Path == path || strings.HasPrefix(n.Path, path+".") {
+			keep[n.Path] = true
+			queue = append(queue, n.Path)
+		}
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, q := range next[p] {
+			if !keep[q] {
+				keep[q] = true
+				queue = append(queue, q)
+			}
+		}
+	}
+
+	sub := &DependencyGraph{}
+	for _, n := range g.Nodes {
+		if keep[n.Path] {
+			sub.Nodes = append(sub.Nodes, n)
+		}
+	}
+	for _, e := range g.Edges {
+		from, to := step(e)
+		if keep[from] && keep[to] {
+			sub.Edges = append(sub.Edges, e)
+		}
+	}
+	return sub
+}
+
+func (g *DependencyGraph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].Path < g.Nodes[j].Path
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+}
+
+// opcallPath is where op was found, as written in the document
+func opcallPath(op *Opcall) string {
+	if op.where != nil {
+		return op.where.String()
+	}
+	return op.canonical.String()
+}
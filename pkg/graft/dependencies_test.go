@@ -0,0 +1,70 @@
+package graft
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDependencies(t *testing.T) {
+	Convey("Dependencies", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+
+		doc, err := engine.ParseYAML([]byte(`meta:
+  env: prod
+  name: (( concat meta.env "-web" ))
+  url: (( concat "https://" meta.name ))
+jobs:
+- name: web
+  url: (( grab meta.url ))
+- name: db
+  env: (( grab meta.env ))
+`))
+		So(err, ShouldBeNil)
+
+		g, err := Dependencies(doc)
+		So(err, ShouldBeNil)
+
+		Convey("has a node for each operator call", func() {
+			So(g.Nodes, ShouldResemble, []*DependencyNode{
+				{Path: "jobs.db.env", Operator: "grab", Source: "(( grab meta.env ))"},
+				{Path: "jobs.web.url", Operator: "grab", Source: "(( grab meta.url ))"},
+				{Path: "meta.name", Operator: "concat", Source: `(( concat meta.env "-web" ))`},
+				{Path: "meta.url", Operator: "concat", Source: `(( concat "https://" meta.name ))`},
+			})
+		})
+
+		Convey("has an edge from each call to the calls it needs", func() {
+			So(g.Edges, ShouldResemble, []DependencyEdge{
+				{From: "jobs.web.url", To: "meta.url"},
+				{From: "meta.url", To: "meta.name"},
+			})
+		})
+
+		Convey("does not evaluate the document", func() {
+			v, err := doc.GetString("meta.name")
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, `(( concat meta.env "-web" ))`)
+		})
+
+		Convey("can be limited to the dependencies of a path", func() {
+			sub := g.Dependencies("$.jobs.web")
+			So(sub.Node("jobs.web.url"), ShouldNotBeNil)
+			So(sub.Node("meta.name"), ShouldNotBeNil)
+			So(sub.Node("jobs.db.env"), ShouldBeNil)
+			So(sub.Edges, ShouldHaveLength, 2)
+
+			So(g.Dependencies("meta.name").Nodes, ShouldHaveLength, 1)
+		})
+
+		Convey("can be limited to the dependents of a path", func() {
+			sub := g.Dependents("meta.name")
+			So(sub.Nodes, ShouldHaveLength, 3)
+			So(sub.Node("jobs.db.env"), ShouldBeNil)
+			So(sub.Edges, ShouldResemble, g.Edges)
+
+			So(g.Dependents("jobs").Nodes, ShouldHaveLength, 2)
+		})
+	})
+}
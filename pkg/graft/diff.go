@@ -67,6 +67,12 @@ KEYSEARCH:
 	return ""
 }
 
+// entryName is how the entries of a list keyed on key are told apart, and
+// named in the paths of their differences
+func entryName(entry interface{}, key string) string {
+	return fmt.Sprintf("%v", entry.(map[interface{}]interface{})[key])
+}
+
 func mapify(l []interface{}, key string) map[interface{}]interface{} {
 	m := make(map[interface{}]interface{})
 
@@ -159,6 +165,10 @@ func (d DiffType) Value() interface{} {
 type DiffScalar struct {
 	Old string
 	New string
+
+	// OldValue and NewValue are the values Old and New render
+	OldValue interface{}
+	NewValue interface{}
 }
 
 func (d DiffScalar) Changed() bool {
@@ -224,6 +234,13 @@ type DiffList struct {
 	Removed map[string]Diffable
 	Added   map[string]Diffable
 	Common  map[string]Diffable
+
+	// Key is what the entries were matched on: name, id or key (see keyed),
+	// or "" for lists compared index by index
+	Key string
+	// the lists compared, in their original order
+	Old []interface{}
+	New []interface{}
 }
 
 func (d DiffList) Changed() bool {
@@ -275,8 +292,10 @@ func Diff(a, b interface{}) (Diffable, error) {
 	switch typeof(a) {
 	case Scalar:
 		return DiffScalar{
-			Old: yamlmarshal(a),
-			New: yamlmarshal(b),
+			Old:      yamlmarshal(a),
+			New:      yamlmarshal(b),
+			OldValue: a,
+			NewValue: b,
 		}, nil
 
 	case Map:
@@ -312,63 +331,39 @@ func Diff(a, b interface{}) (Diffable, error) {
 		return x, nil
 
 	case SimpleList:
-		la := a.([]interface{})
-		lb := b.([]interface{})
-		x := DiffList{
-			Removed: make(map[string]Diffable),
-			Added:   make(map[string]Diffable),
-			Common:  make(map[string]Diffable),
-		}
-		for i, v1 := range la {
-			if i < len(lb) {
-				v2 := lb[i]
-				d, err := Diff(v1, v2)
-				if err != nil {
-					return x, err
-				}
-				x.Common[fmt.Sprintf("%d", i)] = d
-				continue
-			}
-
-			x.Removed[fmt.Sprintf("%d", i)] = DiffNone{v1}
-			continue
-		}
-
-		for i, v2 := range lb {
-			if i < len(la) {
-				continue
-			}
-
-			x.Added[fmt.Sprintf("%d", i)] = DiffNone{v2}
-			continue
-		}
-		return x, nil
+		return diffByIndex(a.([]interface{}), b.([]interface{}))
 
 	case KeyedList:
 		la := a.([]interface{})
 		lb := b.([]interface{})
 		key := keyed(la)
-
-		ma := mapify(la, key)
-		mb := mapify(lb, key)
+		if keyed(lb) != key {
+			return diffByIndex(la, lb)
+		}
 
 		x := DiffList{
 			Removed: make(map[string]Diffable),
 			Added:   make(map[string]Diffable),
 			Common:  make(map[string]Diffable),
+			Key:     key,
+			Old:     la,
+			New:     lb,
 		}
 
+		ma := mapify(la, key)
+		mb := mapify(lb, key)
+
 		for k, v1 := range ma {
 			if v2, ok := mb[k]; ok {
 				d, err := Diff(v1, v2)
 				if err != nil {
 					return x, err
 				}
-				x.Common[fmt.Sprintf("%v", k)] = d
+				x.Common[entryName(v1, key)] = d
 				continue
 			}
 
-			x.Removed[fmt.Sprintf("%v", k)] = DiffNone{v1}
+			x.Removed[entryName(v1, key)] = DiffNone{v1}
 			continue
 		}
 
@@ -377,7 +372,7 @@ func Diff(a, b interface{}) (Diffable, error) {
 				continue
 			}
 
-			x.Added[fmt.Sprintf("%v", k)] = DiffNone{v2}
+			x.Added[entryName(v2, key)] = DiffNone{v2}
 			continue
 		}
 		return x, nil
@@ -386,3 +381,38 @@ func Diff(a, b interface{}) (Diffable, error) {
 		return DiffScalar{}, fmt.Errorf("not implemented yet!")
 	}
 }
+
+// diffByIndex compares two lists entry by entry
+func diffByIndex(la, lb []interface{}) (Diffable, error) {
+	x := DiffList{
+		Removed: make(map[string]Diffable),
+		Added:   make(map[string]Diffable),
+		Common:  make(map[string]Diffable),
+		Old:     la,
+		New:     lb,
+	}
+	for i, v1 := range la {
+		if i < len(lb) {
+			v2 := lb[i]
+			d, err := Diff(v1, v2)
+			if err != nil {
+				return x, err
+			}
+			x.Common[fmt.Sprintf("%d", i)] = d
+			continue
+		}
+
+		x.Removed[fmt.Sprintf("%d", i)] = DiffNone{v1}
+		continue
+	}
+
+	for i, v2 := range lb {
+		if i < len(la) {
+			continue
+		}
+
+		x.Added[fmt.Sprintf("%d", i)] = DiffNone{v2}
+		continue
+	}
+	return x, nil
+}
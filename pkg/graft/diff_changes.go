@@ -0,0 +1,268 @@
+package graft
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+)
+
+// DiffKind says how a DiffChange differs between two documents
+type DiffKind string
+
+const (
+	// DiffAdded marks a value only found in the new document
+	DiffAdded DiffKind = "added"
+	// DiffRemoved marks a value only found in the old document
+	DiffRemoved DiffKind = "removed"
+	// DiffModified marks a value found in both documents, that changed
+	DiffModified DiffKind = "modified"
+	// DiffReordered marks a list whose entries are the same in both
+	// documents, but in a different order. From and To list the names of
+	// the entries, or their values for lists without named entries.
+	DiffReordered DiffKind = "reordered"
+)
+
+// DiffChange is a single difference between two documents. Path is dotted,
+// naming list entries by their name, id or key the way array merges match
+// them, like `jobs.web.instances`, or by index when they have none.
+type DiffChange struct {
+	Path string      `json:"path" yaml:"path"`
+	Kind DiffKind    `json:"kind" yaml:"kind"`
+	From interface{} `json:"from,omitempty" yaml:"from,omitempty"`
+	To   interface{} `json:"to,omitempty" yaml:"to,omitempty"`
+}
+
+// MarshalJSON converts the maps of From and To, which YAML keys by
+// interface{}, to ones encoding/json accepts
+func (c DiffChange) MarshalJSON() ([]byte, error) {
+	type change DiffChange
+	from, err := deinterface(c.From, false)
+	if err != nil {
+		return nil, err
+	}
+	to, err := deinterface(c.To, false)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(change{Path: c.Path, Kind: c.Kind, From: from, To: to})
+}
+
+// DiffOptions controls which differences Changes reports
+type DiffOptions struct {
+	// Include limits the differences to those at or beneath paths matching
+	// one of these patterns (see MatchPath)
+	Include []string
+	// Exclude drops differences at or beneath paths matching one of these
+	// patterns
+	Exclude []string
+	// IgnoreOrder compares lists without regard to the order of their
+	// entries, so entries that only moved are not reported
+	IgnoreOrder bool
+}
+
+// Changes compares two documents and returns their differences, walking
+// maps in key order and lists in the order of their entries
+func Changes(from, to Document, options DiffOptions) ([]DiffChange, error) {
+	var a, b interface{} = map[interface{}]interface{}{}, map[interface{}]interface{}{}
+	if from != nil && from.GetData() != nil {
+		a = from.GetData()
+	}
+	if to != nil && to.GetData() != nil {
+		b = to.GetData()
+	}
+
+	diff, err := Diff(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return DiffChanges(diff, options)
+}
+
+// DiffChanges lists the differences diff, as found by Diff, holds
+func DiffChanges(diff Diffable, options DiffOptions) ([]DiffChange, error) {
+	for _, pattern := range append(append([]string{}, options.Include...), options.Exclude...) {
+		if err := ValidatePathPattern(pattern); err != nil {
+			return nil, ansi.Errorf("@R{invalid path pattern} @c{%s}@R{: %s}", pattern, err)
+		}
+	}
+
+	d := &differ{options: options}
+	d.walk("", diff)
+	return d.changes, nil
+}
+
+// differ walks the result of Diff, collecting the differences it holds
+type differ struct {
+	options DiffOptions
+	changes []DiffChange
+}
+
+func (d *differ) note(change DiffChange) {
+	for _, pattern := range d.options.Exclude {
+		if MatchPath(pattern, change.Path) {
+			return
+		}
+	}
+	if len(d.options.Include) > 0 {
+		included := false
+		for _, pattern := range d.options.Include {
+			if MatchPath(pattern, change.Path) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return
+		}
+	}
+	d.changes = append(d.changes, change)
+}
+
+func (d *differ) walk(path string, diff Diffable) {
+	switch x := diff.(type) {
+	case DiffType:
+		d.note(DiffChange{Path: path, Kind: DiffModified, From: x.Old, To: x.New})
+
+	case DiffScalar:
+		if x.Changed() {
+			d.note(DiffChange{Path: path, Kind: DiffModified, From: x.OldValue, To: x.NewValue})
+		}
+
+	case DiffMap:
+		for _, k := range sortkeys(mergeDiffables(x.Common, x.Removed)) {
+			if sub, ok := x.Common[k]; ok {
+				d.walk(joinKeyPath(path, k), sub)
+			} else {
+				d.note(DiffChange{Path: joinKeyPath(path, k), Kind: DiffRemoved, From: x.Removed[k].Value()})
+			}
+		}
+		for _, k := range sortkeys(x.Added) {
+			d.note(DiffChange{Path: joinKeyPath(path, k), Kind: DiffAdded, To: x.Added[k].Value()})
+		}
+
+	case DiffList:
+		if x.Key != "" {
+			d.walkKeyedList(path, x)
+		} else {
+			d.walkList(path, x)
+		}
+	}
+}
+
+// mergeDiffables combines the entries of a and b
+func mergeDiffables(a, b map[string]Diffable) map[string]Diffable {
+	m := make(map[string]Diffable, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
+
+// walkKeyedList walks the entries of a list matched up by name, then notes
+// whether the entries both lists hold moved
+func (d *differ) walkKeyedList(path string, x DiffList) {
+	var orderA, orderB []interface{}
+	for _, entry := range x.Old {
+		n := entryName(entry, x.Key)
+		if sub, ok := x.Common[n]; ok {
+			orderA = append(orderA, n)
+			d.walk(joinKeyPath(path, n), sub)
+		} else {
+			d.note(DiffChange{Path: joinKeyPath(path, n), Kind: DiffRemoved, From: entry})
+		}
+	}
+	for _, entry := range x.New {
+		n := entryName(entry, x.Key)
+		if _, ok := x.Common[n]; ok {
+			orderB = append(orderB, n)
+		} else {
+			d.note(DiffChange{Path: joinKeyPath(path, n), Kind: DiffAdded, To: entry})
+		}
+	}
+	d.compareOrder(path, orderA, orderB)
+}
+
+// walkList walks the entries of a list compared index by index, or compares
+// the lists as bags of values when order is ignored. Lists holding the same
+// values in a different order are reported as reordered.
+func (d *differ) walkList(path string, x DiffList) {
+	la, lb := x.Old, x.New
+	if !d.options.IgnoreOrder {
+		if x.Changed() && sameValues(la, lb) {
+			d.note(DiffChange{Path: path, Kind: DiffReordered, From: la, To: lb})
+			return
+		}
+		for i := range la {
+			k := strconv.Itoa(i)
+			if sub, ok := x.Common[k]; ok {
+				d.walk(joinKeyPath(path, k), sub)
+			} else {
+				d.note(DiffChange{Path: joinKeyPath(path, k), Kind: DiffRemoved, From: la[i]})
+			}
+		}
+		for i := len(la); i < len(lb); i++ {
+			d.note(DiffChange{Path: joinKeyPath(path, strconv.Itoa(i)), Kind: DiffAdded, To: lb[i]})
+		}
+		return
+	}
+
+	unmatched := map[string][]int{}
+	for i, entry := range lb {
+		v := yamlmarshal(entry)
+		unmatched[v] = append(unmatched[v], i)
+	}
+	for i, entry := range la {
+		v := yamlmarshal(entry)
+		if len(unmatched[v]) > 0 {
+			unmatched[v] = unmatched[v][1:]
+			continue
+		}
+		d.note(DiffChange{Path: joinKeyPath(path, strconv.Itoa(i)), Kind: DiffRemoved, From: entry})
+	}
+	var added []int
+	for _, indexes := range unmatched {
+		added = append(added, indexes...)
+	}
+	sort.Ints(added)
+	for _, i := range added {
+		d.note(DiffChange{Path: joinKeyPath(path, strconv.Itoa(i)), Kind: DiffAdded, To: lb[i]})
+	}
+}
+
+// compareOrder notes that the entries common to both lists moved, unless
+// order is ignored
+func (d *differ) compareOrder(path string, a, b []interface{}) {
+	if d.options.IgnoreOrder || len(a) != len(b) {
+		return
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			d.note(DiffChange{Path: path, Kind: DiffReordered, From: a, To: b})
+			return
+		}
+	}
+}
+
+// sameValues reports whether two lists hold the same values, in any order
+func sameValues(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := map[string]int{}
+	for _, v := range a {
+		count[yamlmarshal(v)]++
+	}
+	for _, v := range b {
+		key := yamlmarshal(v)
+		count[key]--
+		if count[key] < 0 {
+			return false
+		}
+	}
+	return true
+}
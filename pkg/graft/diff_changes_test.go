@@ -0,0 +1,121 @@
+package graft
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChanges(t *testing.T) {
+	Convey("Changes", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+
+		parse := func(src string) Document {
+			doc, err := engine.ParseYAML([]byte(src))
+			So(err, ShouldBeNil)
+			return doc
+		}
+		from := parse(`
+meta:
+  env: staging
+  zones: [z1, z2, z3]
+jobs:
+- name: web
+  instances: 2
+- name: db
+  instances: 1
+  persistent_disk: 10240
+`)
+		to := parse(`
+meta:
+  env: production
+  zones: [z3, z1, z2]
+jobs:
+- name: db
+  instances: 1
+- name: web
+  instances: 4
+- name: worker
+  instances: 1
+`)
+
+		Convey("reports each difference, naming list entries the way merges match them", func() {
+			changes, err := engine.Diff(from, to, DiffOptions{})
+			So(err, ShouldBeNil)
+			So(changes, ShouldResemble, []DiffChange{
+				{Path: "jobs.web.instances", Kind: DiffModified, From: 2, To: 4},
+				{Path: "jobs.db.persistent_disk", Kind: DiffRemoved, From: 10240},
+				{Path: "jobs.worker", Kind: DiffAdded, To: map[interface{}]interface{}{"name": "worker", "instances": 1}},
+				{Path: "jobs", Kind: DiffReordered, From: []interface{}{"web", "db"}, To: []interface{}{"db", "web"}},
+				{Path: "meta.env", Kind: DiffModified, From: "staging", To: "production"},
+				{Path: "meta.zones", Kind: DiffReordered, From: []interface{}{"z1", "z2", "z3"}, To: []interface{}{"z3", "z1", "z2"}},
+			})
+		})
+
+		Convey("can ignore the order of list entries", func() {
+			changes, err := Changes(from, to, DiffOptions{IgnoreOrder: true, Exclude: []string{"jobs"}})
+			So(err, ShouldBeNil)
+			So(changes, ShouldResemble, []DiffChange{
+				{Path: "meta.env", Kind: DiffModified, From: "staging", To: "production"},
+			})
+
+			changes, err = Changes(
+				parse(`list: [a, b, c, b]`),
+				parse(`list: [b, d, a, c]`),
+				DiffOptions{IgnoreOrder: true})
+			So(err, ShouldBeNil)
+			So(changes, ShouldResemble, []DiffChange{
+				{Path: "list.3", Kind: DiffRemoved, From: "b"},
+				{Path: "list.1", Kind: DiffAdded, To: "d"},
+			})
+		})
+
+		Convey("compares lists without named entries index by index", func() {
+			changes, err := Changes(parse(`list: [a, b]`), parse(`list: [a, c, d]`), DiffOptions{})
+			So(err, ShouldBeNil)
+			So(changes, ShouldResemble, []DiffChange{
+				{Path: "list.1", Kind: DiffModified, From: "b", To: "c"},
+				{Path: "list.2", Kind: DiffAdded, To: "d"},
+			})
+		})
+
+		Convey("filters differences by path", func() {
+			changes, err := Changes(from, to, DiffOptions{Include: []string{"jobs.*.instances", "meta"}, Exclude: []string{"meta.zones"}})
+			So(err, ShouldBeNil)
+			So(changes, ShouldResemble, []DiffChange{
+				{Path: "jobs.web.instances", Kind: DiffModified, From: 2, To: 4},
+				{Path: "meta.env", Kind: DiffModified, From: "staging", To: "production"},
+			})
+
+			_, err = Changes(from, to, DiffOptions{Include: []string{"jobs.["}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("lists the differences found by Diff", func() {
+			diff, err := Diff(from.GetData(), to.GetData())
+			So(err, ShouldBeNil)
+			changes, err := DiffChanges(diff, DiffOptions{Include: []string{"jobs.*.instances"}})
+			So(err, ShouldBeNil)
+			So(changes, ShouldResemble, []DiffChange{
+				{Path: "jobs.web.instances", Kind: DiffModified, From: 2, To: 4},
+			})
+		})
+
+		Convey("compares lists named by different keys index by index", func() {
+			changes, err := Changes(parse(`list: [{name: a}]`), parse(`list: [{id: a}]`), DiffOptions{})
+			So(err, ShouldBeNil)
+			So(changes, ShouldResemble, []DiffChange{
+				{Path: "list.0.name", Kind: DiffRemoved, From: "a"},
+				{Path: "list.0.id", Kind: DiffAdded, To: "a"},
+			})
+		})
+
+		Convey("marshals to JSON", func() {
+			out, err := json.Marshal(DiffChange{Path: "jobs.worker", Kind: DiffAdded, To: map[interface{}]interface{}{"name": "worker"}})
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `{"path":"jobs.worker","kind":"added","to":{"name":"worker"}}`)
+		})
+	})
+}
@@ -13,6 +13,20 @@ import (
 // document implements the Document interface
 type document struct {
 	data map[interface{}]interface{}
+
+	// order holds the key order recorded when the document was parsed
+	order *KeyOrder
+	// comments holds the comments recorded when the document was parsed
+	comments *Comments
+	// sources records where each value was last written (see Provenance)
+	sources map[string]ValueSource
+	// taints records the values that hold or derive from secrets (see Tainted)
+	taints map[string]TaintSource
+
+	// preserveOrder makes ToYAML emit keys in recorded order instead of sorted
+	preserveOrder bool
+	// preserveComments makes ToYAML emit the recorded comments
+	preserveComments bool
 }
 
 // NewDocument creates a new document from a map
@@ -234,6 +248,17 @@ func convertToJSONCompatible(v interface{}) interface{} {
 
 // ToYAML converts the document to YAML bytes
 func (d *document) ToYAML() ([]byte, error) {
+	if d.preserveOrder || d.preserveComments {
+		var order *KeyOrder
+		if d.preserveOrder {
+			order = d.order
+		}
+		var comments *Comments
+		if d.preserveComments {
+			comments = d.comments
+		}
+		return marshalOrderedYAML(d.data, order, comments)
+	}
 	return yaml.Marshal(d.data)
 }
 
@@ -253,12 +278,33 @@ func (d *document) RawData() interface{} {
 func (d *document) Clone() Document {
 	cloned := deepCopy(d.data)
 	if clonedMap, ok := cloned.(map[interface{}]interface{}); ok {
-		return NewDocument(clonedMap)
+		clone := d.withData(clonedMap)
+		clone.order = d.order.Clone()
+		clone.comments = d.comments.Clone()
+		clone.sources = copySources(d.sources)
+		if d.taints != nil {
+			clone.taints = copyTaints(d.taints)
+		}
+		return clone
 	}
 	// Fallback - this shouldn't happen
 	return NewDocument(make(map[interface{}]interface{}))
 }
 
+// withData returns a document holding data that carries the same key order,
+// comments and sources as d
+func (d *document) withData(data map[interface{}]interface{}) *document {
+	return &document{
+		data:             data,
+		order:            d.order,
+		comments:         d.comments,
+		sources:          d.sources,
+		taints:           d.taints,
+		preserveOrder:    d.preserveOrder,
+		preserveComments: d.preserveComments,
+	}
+}
+
 // ensurePathExists creates intermediate maps/slices as needed for the given path
 func (d *document) ensurePathExists(cursor *tree.Cursor) error {
 	// This is a simplified implementation
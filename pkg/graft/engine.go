@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
 	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 	vaultkv "github.com/cloudfoundry-community/vaultkv"
+	"github.com/cppforlife/go-patch/patch"
 	"github.com/wayneeseguin/graft/internal/utils/tree"
 	"gopkg.in/yaml.v3"
 )
@@ -250,7 +251,7 @@ func (e *DefaultEngine) AddVaultRef(path string, keys []string) {
 	e.vaultRefs[path] = append(e.vaultRefs[path], keys...)
 
 	// Also update global VaultRefs for backward compatibility with vaultinfo command
-	if SkipVault || e.skipVault {
+	if SkipVault || e.skipVault || TrackVaultRefs {
 		if VaultRefs[path] == nil {
 			VaultRefs[path] = []string{}
 		}
@@ -482,13 +483,23 @@ func (e *DefaultEngine) ParseYAML(data []byte) (Document, error) {
 		return nil, nil
 	}
 
-	// First parse as generic interface to check document type
-	var genericResult interface{}
-	err := yaml.Unmarshal(data, &genericResult)
+	// Parse into a node tree first so the source key order and comments can be recorded,
+	// then decode as generic interface to check document type
+	var node yaml.Node
+	err := yaml.Unmarshal(data, &node)
 	if err != nil {
 		return nil, NewParseError("failed to parse YAML", err)
 	}
 
+	if node.Kind == 0 {
+		return nil, nil
+	}
+
+	var genericResult interface{}
+	if err := node.Decode(&genericResult); err != nil {
+		return nil, NewParseError("failed to parse YAML", err)
+	}
+
 	if genericResult == nil {
 		return nil, nil
 	}
@@ -496,11 +507,21 @@ func (e *DefaultEngine) ParseYAML(data []byte) (Document, error) {
 	// Check that root is a map/hash - handle both v2 and v3 map types
 	switch result := genericResult.(type) {
 	case map[interface{}]interface{}:
-		return NewDocument(result), nil
+		return &document{
+			data:     result,
+			order:    keyOrderFromNode(&node),
+			comments: commentsFromNode(&node),
+			sources:  sourcesFromNode(&node),
+		}, nil
 	case map[string]interface{}:
 		// Convert map[string]interface{} to map[interface{}]interface{} for compatibility
 		converted := convertStringMapToInterfaceMap(result).(map[interface{}]interface{})
-		return NewDocument(converted), nil
+		return &document{
+			data:     converted,
+			order:    keyOrderFromNode(&node),
+			comments: commentsFromNode(&node),
+			sources:  sourcesFromNode(&node),
+		}, nil
 	default:
 		// Return plain error for compatibility with tests
 		return nil, fmt.Errorf("Root of YAML document is not a hash/map:")
@@ -584,6 +605,17 @@ func (e *DefaultEngine) Evaluate(ctx context.Context, doc Document) (Document, e
 
 	// Create evaluator
 	ev := e.createEvaluator(data)
+	var comments *Comments
+	if d, ok := doc.(*document); ok {
+		if d.preserveOrder {
+			ev.KeyOrder = d.order
+		}
+		if d.preserveComments {
+			comments = d.comments
+		}
+		ev.Sources = copySources(d.sources)
+	}
+	ev.Trace = GetEvalTrace(ctx)
 
 	// Extract cherry-pick paths from context if present
 	if cherryPickPaths := GetCherryPickPaths(ctx); cherryPickPaths != nil && len(cherryPickPaths) > 0 {
@@ -598,7 +630,21 @@ func (e *DefaultEngine) Evaluate(ctx context.Context, doc Document) (Document, e
 	}
 
 	// Return evaluated document
-	return NewDocument(ev.Tree), nil
+	result := withTaints(withSources(NewDocument(ev.Tree), ev.Sources), ev.taints)
+	if ev.KeyOrder != nil || comments != nil {
+		return withOutputLayout(result, ev.KeyOrder, comments), nil
+	}
+	return result, nil
+}
+
+// Diff returns the differences between two documents
+func (e *DefaultEngine) Diff(from, to Document, options DiffOptions) ([]DiffChange, error) {
+	return Changes(from, to, options)
+}
+
+// GoPatch returns the go-patch operations that turn one document into another
+func (e *DefaultEngine) GoPatch(from, to Document) (patch.Ops, error) {
+	return GoPatch(from, to)
 }
 
 // ToYAML converts a document to YAML bytes
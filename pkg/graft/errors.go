@@ -1,9 +1,11 @@
 package graft
 
 import (
+	"errors"
 	"fmt"
 	"github.com/wayneeseguin/graft/internal/utils/ansi"
 	"github.com/wayneeseguin/graft/log"
+	"github.com/wayneeseguin/graft/pkg/graft/merger"
 	"sort"
 	"strings"
 )
@@ -24,6 +26,12 @@ func (e MultiError) Error() string {
 	return ansi.Sprintf("@r{%d} error(s) detected:\n%s\n", len(e.Errors), strings.Join(s, ""))
 }
 
+// Unwrap returns the collected errors, so errors.Is and errors.As can find
+// a specific failure among them
+func (e MultiError) Unwrap() []error {
+	return e.Errors
+}
+
 // Count ...
 func (e *MultiError) Count() int {
 	return len(e.Errors)
@@ -91,7 +99,7 @@ func (e WarningError) HasContext(context ErrorContext) bool {
 // Warn prints the configured warning to stderr.
 func (e WarningError) Warn() {
 	if !dontPrintWarning {
-		log.PrintfStdErr(ansi.Sprintf("@Y{warning:} %s\n", e.warning))
+		log.PrintfStdErr("%s", ansi.Sprintf("@Y{warning:} %s\n", e.warning))
 	}
 }
 
@@ -217,3 +225,150 @@ func GetErrorType(err error) ErrorType {
 	}
 	return ""
 }
+
+// OpcallError is returned when an operator call fails to parse or run. It
+// wraps the underlying error with the path of the (( ... )) expression, the
+// name of the operator, and where the expression was written, if known.
+type OpcallError struct {
+	Type     ErrorType // ParseError or EvaluationError
+	Path     string
+	Operator string
+	Source   string
+	Position Position
+	Err      error
+}
+
+func (e *OpcallError) Error() string {
+	return fmt.Sprintf("$.%s: %s", e.Path, e.Err)
+}
+
+func (e *OpcallError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorRecord is a structured description of a single failure, for tools
+// that would otherwise have to pick apart error messages
+type ErrorRecord struct {
+	Type     string    `json:"type"`
+	Path     string    `json:"path,omitempty"`
+	Operator string    `json:"operator,omitempty"`
+	Position *Position `json:"position,omitempty"`
+	File     string    `json:"file,omitempty"`
+	Message  string    `json:"message"`
+}
+
+// ErrorRecords breaks err down into one record per failure, flattening any
+// MultiError or ExprErrorList it contains. Messages have color codes removed.
+func ErrorRecords(err error) []ErrorRecord {
+	if err == nil {
+		return nil
+	}
+
+	var records []ErrorRecord
+	switch e := err.(type) {
+	case MultiError:
+		for _, sub := range e.Errors {
+			records = append(records, ErrorRecords(sub)...)
+		}
+	case *MultiError:
+		for _, sub := range e.Errors {
+			records = append(records, ErrorRecords(sub)...)
+		}
+	case merger.MultiError:
+		for _, sub := range e.Errors {
+			records = append(records, ErrorRecords(sub)...)
+		}
+	case *ExprErrorList:
+		for _, sub := range e.Errors {
+			records = append(records, ErrorRecords(sub)...)
+		}
+	default:
+		// an error wrapping several failures is reported as each of them
+		for inner := errors.Unwrap(err); inner != nil; inner = errors.Unwrap(inner) {
+			if isMultiError(inner) {
+				return ErrorRecords(inner)
+			}
+		}
+		records = append(records, errorRecord(err))
+	}
+	return records
+}
+
+func isMultiError(err error) bool {
+	switch err.(type) {
+	case MultiError, *MultiError, merger.MultiError, *ExprErrorList:
+		return true
+	}
+	return false
+}
+
+// errorRecord describes a single failure. It walks the chain of wrapped
+// errors from the outside in, so the innermost error that knows a field wins.
+func errorRecord(err error) ErrorRecord {
+	r := ErrorRecord{Type: "error", Message: err.Error()}
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch e := e.(type) {
+		case *OpcallError:
+			r.Type = string(e.Type)
+			r.Path = e.Path
+			r.Operator = e.Operator
+			r.Message = e.Err.Error()
+			if e.Position.Line > 0 {
+				pos := e.Position
+				r.Position = &pos
+			}
+
+		case merger.PathError:
+			r.Type = string(MergeError)
+			r.Path = e.Path
+			r.Message = e.Message
+
+		case *GraftError:
+			r.Type = string(e.Type)
+			if e.Path != "" {
+				r.Path = e.Path
+			}
+			r.Message = e.Message
+			if e.Cause != nil {
+				r.Message += ": " + e.Cause.Error()
+			}
+
+		case *CycleError:
+			r.Type = "cycle_error"
+			r.Message = "cycle detected in operator data-flow graph: " + e.Path()
+			if len(e.Cycle) > 0 {
+				r.Path = e.Cycle[0].Path
+				r.Operator = e.Cycle[0].Operator
+				if e.Cycle[0].Position.Line > 0 {
+					pos := e.Cycle[0].Position
+					r.Position = &pos
+				}
+			}
+
+		case *SecretLeak:
+			r.Type = "secret_leak"
+			r.Path = e.Path
+			r.Operator = e.Source.Operator
+
+		case *ExprError:
+			r.Type = e.Type.String()
+			r.Message = e.Message
+			// an operator's position in the document beats one inside the
+			// expression
+			if e.Position.Line > 0 && r.Position == nil {
+				pos := e.Position
+				r.Position = &pos
+			}
+		}
+	}
+
+	if r.Path != "" && !strings.HasPrefix(r.Path, "$") {
+		r.Path = "$." + r.Path
+	}
+	if r.Position != nil {
+		r.File = r.Position.File
+	}
+	r.Message = ansi.Strip(r.Message)
+	return r
+}
@@ -0,0 +1,99 @@
+package graft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/wayneeseguin/graft/pkg/graft/merger"
+)
+
+func TestErrorRecords(t *testing.T) {
+	Convey("ErrorRecords", t, func() {
+		Convey("returns typed errors from the engine", func() {
+			engine, err := NewEngine()
+			So(err, ShouldBeNil)
+
+			doc, err := engine.ParseYAML([]byte(`meta:
+  name: web
+jobs:
+- name: web
+  size: (( grab meta.nope ))
+`))
+			So(err, ShouldBeNil)
+
+			_, err = engine.Merge(context.Background(), WithSourceName(doc, "base.yml")).Execute()
+			So(err, ShouldNotBeNil)
+
+			var opErr *OpcallError
+			So(errors.As(err, &opErr), ShouldBeTrue)
+			So(opErr.Operator, ShouldEqual, "grab")
+			So(opErr.Path, ShouldEqual, "jobs.web.size")
+
+			records := ErrorRecords(err)
+			So(records, ShouldHaveLength, 1)
+			So(records[0], ShouldResemble, ErrorRecord{
+				Type:     "evaluation_error",
+				Path:     "$.jobs.web.size",
+				Operator: "grab",
+				Position: &Position{Line: 5, Column: 3, File: "base.yml"},
+				File:     "base.yml",
+				Message:  "Unable to resolve `meta.nope`: `$.meta.nope` could not be found in the datastructure",
+			})
+		})
+
+		Convey("names the operator as it was called, even when registered more than once", func() {
+			OpRegistry["fetch"] = OpRegistry["grab"]
+			defer delete(OpRegistry, "fetch")
+
+			for _, name := range []string{"grab", "fetch"} {
+				op, err := ParseOpcall(EvalPhase, fmt.Sprintf("(( %s meta.name ))", name))
+				So(err, ShouldBeNil)
+				So(op.Name(), ShouldEqual, name)
+			}
+			So(NewNamedOpcall("grab", "", OpRegistry["grab"], nil, "").Name(), ShouldEqual, "grab")
+
+			op, err := ParseOpcallCompat(EvalPhase, "(( meta.count * 2 ))")
+			So(err, ShouldBeNil)
+			So(op.Name(), ShouldEqual, "*")
+		})
+
+		Convey("keeps the message of an OpcallError unchanged", func() {
+			err := &OpcallError{Type: EvaluationError, Path: "a.b", Operator: "grab", Err: fmt.Errorf("boom")}
+			So(err.Error(), ShouldEqual, "$.a.b: boom")
+		})
+
+		Convey("flattens nested and wrapped error lists", func() {
+			err := fmt.Errorf("merge failed: %w", &MultiError{Errors: []error{
+				merger.PathError{Path: "$.jobs", Message: "cannot merge"},
+				MultiError{Errors: []error{NewOperatorError("vault", "no token", nil)}},
+			}})
+
+			records := ErrorRecords(err)
+			So(records, ShouldHaveLength, 2)
+			So(records[0], ShouldResemble, ErrorRecord{Type: "merge_error", Path: "$.jobs", Message: "cannot merge"})
+			So(records[1], ShouldResemble, ErrorRecord{Type: "operator_error", Message: "operator 'vault': no token"})
+		})
+
+		Convey("uses the most specific type in the chain", func() {
+			exprErr := NewSyntaxError("unexpected token", Position{Line: 1, Column: 9})
+			err := &OpcallError{Type: ParseError, Path: "x", Operator: "grab", Err: exprErr}
+
+			records := ErrorRecords(err)
+			So(records, ShouldHaveLength, 1)
+			So(records[0].Type, ShouldEqual, "syntax_error")
+			So(records[0].Path, ShouldEqual, "$.x")
+			So(records[0].Message, ShouldEqual, "unexpected token")
+			So(records[0].Position, ShouldResemble, &Position{Line: 1, Column: 9})
+		})
+
+		Convey("describes untyped errors as they are", func() {
+			So(ErrorRecords(fmt.Errorf("something broke")), ShouldResemble, []ErrorRecord{
+				{Type: "error", Message: "something broke"},
+			})
+			So(ErrorRecords(nil), ShouldBeNil)
+		})
+	})
+}
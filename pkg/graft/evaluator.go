@@ -22,6 +22,9 @@ type Evaluator struct {
 	SkipEval bool
 	Here     *tree.Cursor
 
+	// Target is the @target of the operator call being run, if it names one
+	Target string
+
 	CheckOps []*Opcall
 
 	Only []string
@@ -53,6 +56,23 @@ type Evaluator struct {
 	// But this won't be evaluated:
 	//   - services.api.port: (( grab defaults.api_port )) // Not under cherry-pick path
 	CherryPickPaths []string
+
+	// KeyOrder, when set, is kept up to date as operators copy maps around
+	// the tree so that ordered output follows the source of grabbed data.
+	KeyOrder *KeyOrder
+
+	// Sources, when set, records where each value was last written; operators
+	// that run are noted against the path they write to.
+	Sources map[string]ValueSource
+
+	// Trace, when set, records every operator call that RunOps makes
+	Trace *EvalTrace
+
+	// taints records the paths holding values that came from sensitive
+	// operator calls, and tainting the tainted values that the operator call
+	// being run has read or produced (see taint.go)
+	taints   map[string]TaintSource
+	tainting []taintRead
 }
 
 // SetEngine sets the engine for the evaluator
@@ -80,16 +100,17 @@ func nameOfObj(o interface{}, def string) string {
 	return def
 }
 
-// DataFlow ...
-func (ev *Evaluator) DataFlow(phase OperatorPhase) ([]*Opcall, error) {
+// dataFlowGraph finds the operator calls for phase in the tree and the
+// dependencies between them. Each [a,b] in g means 'b' calls or requires 'a'.
+func (ev *Evaluator) dataFlowGraph(phase OperatorPhase) (all map[string]*Opcall, insertionOrder []string, g [][]*Opcall, errors MultiError) {
 	ev.Here = &tree.Cursor{}
 
 	log.DEBUG("DataFlow: starting phase %v", phase)
 
-	all := map[string]*Opcall{}
-	insertionOrder := []string{} // Track insertion order
+	all = map[string]*Opcall{}
+	insertionOrder = []string{} // Track insertion order
 	locs := []*tree.Cursor{}
-	errors := MultiError{Errors: []error{}}
+	errors = MultiError{Errors: []error{}}
 
 	// forward decls of co-recursive function
 	var check func(interface{})
@@ -102,7 +123,17 @@ func (ev *Evaluator) DataFlow(phase OperatorPhase) ([]*Opcall, error) {
 			}
 			op, err := ParseOpcallCompat(phase, s)
 			if err != nil {
-				errors.Append(err)
+				parseErr := &OpcallError{
+					Type:     ParseError,
+					Path:     ev.Here.String(),
+					Source:   s,
+					Position: ev.sourcePosition(ev.Here.String()),
+					Err:      err,
+				}
+				if m := opcallNameRx.FindStringSubmatch(strings.TrimSpace(s)); m != nil {
+					parseErr.Operator = m[1]
+				}
+				errors.Append(parseErr)
 			} else if op != nil {
 				op.where = ev.Here.Copy()
 				if canon, err := op.where.Canonical(ev.Tree); err == nil {
@@ -217,7 +248,6 @@ func (ev *Evaluator) DataFlow(phase OperatorPhase) ([]*Opcall, error) {
 	// construct the data flow graph, where a -> b means 'b' calls or requires 'a'
 	// represent the graph as list of adjancies, where [a,b] = a -> b
 	// []{ []*Opcall{ grabStaticValue, grabTheThingThatGrabsTheStaticValue}}
-	var g [][]*Opcall
 	for _, a := range all {
 		for _, path := range a.Dependencies(ev, locs) {
 			// First try the path as-is
@@ -258,6 +288,13 @@ func (ev *Evaluator) DataFlow(phase OperatorPhase) ([]*Opcall, error) {
 		}
 	}
 
+	return all, insertionOrder, g, errors
+}
+
+// DataFlow ...
+func (ev *Evaluator) DataFlow(phase OperatorPhase) ([]*Opcall, error) {
+	all, insertionOrder, g, errors := ev.dataFlowGraph(phase)
+
 	if len(ev.Only) > 0 {
 		/*
 			[],
@@ -473,7 +510,7 @@ func (ev *Evaluator) DataFlow(phase OperatorPhase) ([]*Opcall, error) {
 		wave++
 		free := freeNodes(g)
 		if len(free) == 0 {
-			return nil, ansi.Errorf("@*{cycle detected in operator data-flow graph}")
+			return nil, ev.findCycles(all, g)
 		}
 
 		for _, node := range free {
@@ -739,10 +776,26 @@ func (ev *Evaluator) CheckForCycles(maxDepth int) error {
 // RunOp ...
 func (ev *Evaluator) RunOp(op *Opcall) error {
 
+	ev.tainting = nil
+	if ev.Trace != nil {
+		ev.Trace.begin(op)
+	}
 	resp, err := op.Run(ev)
+	if ev.Trace != nil {
+		ev.Trace.end(ev.traceable(resp), err)
+	}
 	if err != nil {
+		ev.tainting = nil
 		return err
 	}
+	ev.recordTaint(op, resp)
+
+	if ev.KeyOrder != nil {
+		ev.recordKeyOrder(op, resp)
+	}
+	if ev.Sources != nil {
+		ev.recordSource(op, resp)
+	}
 
 	switch resp.Type {
 	case Replace:
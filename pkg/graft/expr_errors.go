@@ -29,10 +29,28 @@ const (
 
 // Position tracks location in source
 type Position struct {
-	Offset int    // Byte offset in source
-	Line   int    // 1-based line number
-	Column int    // 1-based column number
-	File   string // Optional filename
+	Offset int    `json:"offset,omitempty"` // Byte offset in source
+	Line   int    `json:"line,omitempty"`   // 1-based line number
+	Column int    `json:"column,omitempty"` // 1-based column number
+	File   string `json:"file,omitempty"`   // Optional filename
+}
+
+// String returns the name used for the error type in structured output
+func (t ExprErrorType) String() string {
+	switch t {
+	case SyntaxError:
+		return "syntax_error"
+	case TypeError:
+		return "type_error"
+	case ReferenceError:
+		return "reference_error"
+	case ExprEvaluationError:
+		return "evaluation_error"
+	case ExprOperatorError:
+		return "operator_error"
+	default:
+		return "expression_error"
+	}
 }
 
 // Error implements the error interface
@@ -26,6 +26,7 @@ func EvaluateExpr(e *Expr, ev *Evaluator) (*Response, error) {
 			return nil, WrapError(err, ReferenceError, e.Pos).
 				WithContext(fmt.Sprintf("while resolving reference '%s'", e.Reference))
 		}
+		ev.TaintFrom(e.Reference)
 		return &Response{
 			Type:  Replace,
 			Value: v,
@@ -149,7 +150,10 @@ func evaluateOperatorCall(e *Expr, ev *Evaluator) (*Response, error) {
 		}
 	}
 
-	// Run the operator
+	// Run the operator against the @target the parser found for it
+	was := ev.Target
+	ev.Target = e.Target
+	defer func() { ev.Target = was }()
 	return op.Run(ev, evaluatedArgs)
 }
 
@@ -104,6 +104,9 @@ func registerDefaultOperators(engine *graft.DefaultEngine) error {
 	if err := engine.RegisterOperator("vault-try", &operators.VaultTryOperator{}); err != nil {
 		return err
 	}
+	if err := engine.RegisterOperator("vault-generate", &operators.VaultGenerateOperator{}); err != nil {
+		return err
+	}
 	if err := engine.RegisterOperator("file", &operators.FileOperator{}); err != nil {
 		return err
 	}
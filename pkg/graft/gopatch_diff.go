@@ -0,0 +1,220 @@
+package graft
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cppforlife/go-patch/patch"
+)
+
+// GoPatch computes the go-patch operations that turn one document into
+// another: a `replace` for every value added or changed, and a `remove` for
+// every value dropped. List entries with a name, id or key are addressed by
+// it, like `/jobs/name=web/instances`, so the ops keep applying when entries
+// are added to, or move around in, the document being patched. Entries only
+// found in the new document are inserted after their predecessor.
+//
+// Values that go-patch paths cannot address, like map keys containing `:`
+// or `=`, or lists whose entries moved around, are replaced wholesale along
+// with the map or list holding them.
+func GoPatch(from, to Document) (patch.Ops, error) {
+	var a, b interface{} = map[interface{}]interface{}{}, map[interface{}]interface{}{}
+	if from != nil && from.GetData() != nil {
+		a = from.GetData()
+	}
+	if to != nil && to.GetData() != nil {
+		b = to.GetData()
+	}
+
+	p := &goPatcher{ops: patch.Ops{}}
+	p.compare([]patch.Token{patch.RootToken{}}, a, b)
+	return p.ops, nil
+}
+
+// goPatcher walks two documents side by side, collecting the go-patch
+// operations that turn the first into the second
+type goPatcher struct {
+	ops patch.Ops
+}
+
+func (p *goPatcher) replace(tokens []patch.Token, value interface{}) {
+	p.ops = append(p.ops, patch.ReplaceOp{Path: patch.NewPointer(tokens), Value: value})
+}
+
+func (p *goPatcher) remove(tokens []patch.Token) {
+	p.ops = append(p.ops, patch.RemoveOp{Path: patch.NewPointer(tokens)})
+}
+
+func (p *goPatcher) compare(tokens []patch.Token, a, b interface{}) {
+	if yamlmarshal(a) == yamlmarshal(b) {
+		return
+	}
+	if typeof(a) != typeof(b) {
+		p.replace(tokens, b)
+		return
+	}
+
+	switch typeof(a) {
+	case Map:
+		p.compareMap(tokens, a.(map[interface{}]interface{}), b.(map[interface{}]interface{}))
+
+	case KeyedList:
+		la, lb := a.([]interface{}), b.([]interface{})
+		key := keyed(la)
+		if keyed(lb) != key || !patchableNames(key, la) || !patchableNames(key, lb) {
+			p.compareList(tokens, la, lb)
+			return
+		}
+		p.compareKeyedList(tokens, key, la, lb)
+
+	case SimpleList:
+		p.compareList(tokens, a.([]interface{}), b.([]interface{}))
+
+	default:
+		p.replace(tokens, b)
+	}
+}
+
+func (p *goPatcher) compareMap(tokens []patch.Token, ma, mb map[interface{}]interface{}) {
+	for _, m := range []map[interface{}]interface{}{ma, mb} {
+		for k := range m {
+			if s, ok := k.(string); !ok || !patchableKey(s) {
+				p.replace(tokens, mb)
+				return
+			}
+		}
+	}
+
+	for _, k := range sortedDiffKeys(ma) {
+		if _, ok := mb[k]; !ok {
+			p.remove(withToken(tokens, patch.KeyToken{Key: k.(string)}))
+		}
+	}
+	for _, k := range sortedDiffKeys(mb) {
+		if v, ok := ma[k]; ok {
+			p.compare(withToken(tokens, patch.KeyToken{Key: k.(string)}), v, mb[k])
+		} else {
+			p.replace(withToken(tokens, patch.KeyToken{Key: k.(string), Optional: true}), mb[k])
+		}
+	}
+}
+
+// compareKeyedList matches up the entries of two lists by the value of key.
+// Lists whose common entries changed order are replaced wholesale, since
+// go-patch cannot move entries, as are lists with no entries in common.
+func (p *goPatcher) compareKeyedList(tokens []patch.Token, key string, la, lb []interface{}) {
+	name := func(entry interface{}) string {
+		return entry.(map[interface{}]interface{})[key].(string)
+	}
+	ma, mb := map[string]interface{}{}, map[string]interface{}{}
+	for _, entry := range la {
+		ma[name(entry)] = entry
+	}
+	for _, entry := range lb {
+		mb[name(entry)] = entry
+	}
+
+	var orderA, orderB []string
+	for _, entry := range la {
+		if _, ok := mb[name(entry)]; ok {
+			orderA = append(orderA, name(entry))
+		}
+	}
+	for _, entry := range lb {
+		if _, ok := ma[name(entry)]; ok {
+			orderB = append(orderB, name(entry))
+		}
+	}
+	if len(orderB) == 0 || strings.Join(orderA, "\x00") != strings.Join(orderB, "\x00") {
+		p.replace(tokens, lb)
+		return
+	}
+
+	for _, entry := range la {
+		if _, ok := mb[name(entry)]; !ok {
+			p.remove(withToken(tokens, patch.MatchingIndexToken{Key: key, Value: name(entry)}))
+		}
+	}
+	for i, entry := range lb {
+		n := name(entry)
+		if other, ok := ma[n]; ok {
+			p.compare(withToken(tokens, patch.MatchingIndexToken{Key: key, Value: n}), other, entry)
+			continue
+		}
+		switch {
+		case i == len(lb)-1:
+			p.replace(withToken(tokens, patch.AfterLastIndexToken{}), entry)
+		case i == 0:
+			p.replace(withToken(tokens, patch.IndexToken{Index: 0, Modifiers: []patch.Modifier{patch.BeforeModifier{}}}), entry)
+		default:
+			p.replace(withToken(tokens, patch.MatchingIndexToken{Key: key, Value: name(lb[i-1]), Modifiers: []patch.Modifier{patch.AfterModifier{}}}), entry)
+		}
+	}
+}
+
+// compareList compares two lists entry by entry when they are the same
+// length, appends or removes the entries at the end when one list starts
+// with the other, and replaces the whole list otherwise
+func (p *goPatcher) compareList(tokens []patch.Token, la, lb []interface{}) {
+	switch {
+	case len(la) == len(lb):
+		for i := range la {
+			p.compare(withToken(tokens, patch.IndexToken{Index: i}), la[i], lb[i])
+		}
+
+	case len(la) < len(lb) && yamlmarshal(la) == yamlmarshal(lb[:len(la)]):
+		for _, entry := range lb[len(la):] {
+			p.replace(withToken(tokens, patch.AfterLastIndexToken{}), entry)
+		}
+
+	case len(la) > len(lb) && yamlmarshal(la[:len(lb)]) == yamlmarshal(lb):
+		for i := len(la) - 1; i >= len(lb); i-- {
+			p.remove(withToken(tokens, patch.IndexToken{Index: i}))
+		}
+
+	default:
+		p.replace(tokens, lb)
+	}
+}
+
+// withToken returns a copy of tokens, with token appended
+func withToken(tokens []patch.Token, token patch.Token) []patch.Token {
+	return append(append(make([]patch.Token, 0, len(tokens)+1), tokens...), token)
+}
+
+// patchableKey reports whether a go-patch path can address the map key k:
+// go-patch reads `:` as the start of a modifier, `=` as a name lookup, a
+// trailing `?` as optional, and integers and `-` as list indexes
+func patchableKey(k string) bool {
+	if _, err := strconv.Atoi(k); err == nil {
+		return false
+	}
+	return k != "" && k != "-" && !strings.ContainsAny(k, ":=") && !strings.HasSuffix(k, "?")
+}
+
+// patchableNames reports whether go-patch can look up every entry of l by
+// its key, which needs string values that are unique within the list
+func patchableNames(key string, l []interface{}) bool {
+	seen := map[string]bool{}
+	for _, entry := range l {
+		n, ok := entry.(map[interface{}]interface{})[key].(string)
+		if !ok || seen[n] || strings.Contains(n, ":") || strings.HasSuffix(n, "?") {
+			return false
+		}
+		seen[n] = true
+	}
+	return true
+}
+
+func sortedDiffKeys(m map[interface{}]interface{}) []interface{} {
+	keys := make([]interface{}, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprintf("%v", keys[i]) < fmt.Sprintf("%v", keys[j])
+	})
+	return keys
+}
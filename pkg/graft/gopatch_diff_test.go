@@ -0,0 +1,125 @@
+package graft
+
+import (
+	"testing"
+
+	"github.com/cppforlife/go-patch/patch"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGoPatch(t *testing.T) {
+	Convey("GoPatch", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+
+		parse := func(src string) Document {
+			doc, err := engine.ParseYAML([]byte(src))
+			So(err, ShouldBeNil)
+			return doc
+		}
+		paths := func(ops patch.Ops) []string {
+			defs, err := patch.NewOpDefinitionsFromOps(ops)
+			So(err, ShouldBeNil)
+			var l []string
+			for _, def := range defs {
+				l = append(l, def.Type+" "+*def.Path)
+			}
+			return l
+		}
+		roundTrip := func(from, to string) []string {
+			ops, err := engine.GoPatch(parse(from), parse(to))
+			So(err, ShouldBeNil)
+			patched, err := ops.Apply(parse(from).GetData())
+			So(err, ShouldBeNil)
+			So(yamlmarshal(patched), ShouldEqual, yamlmarshal(parse(to).GetData()))
+			return paths(ops)
+		}
+
+		Convey("addresses named list entries by name", func() {
+			So(roundTrip(`
+meta:
+  env: staging
+  debug: true
+jobs:
+- name: web
+  instances: 2
+- name: db
+  instances: 1
+  persistent_disk: 10240
+- name: cron
+  instances: 1
+`, `
+meta:
+  env: production
+  owner: ops
+jobs:
+- name: canary
+  instances: 1
+- name: web
+  instances: 4
+- name: worker
+  instances: 1
+- name: db
+  instances: 1
+- name: metrics
+  instances: 1
+`), ShouldResemble, []string{
+				"remove /jobs/name=cron",
+				"replace /jobs/0:before",
+				"replace /jobs/name=web/instances",
+				"replace /jobs/name=web:after",
+				"remove /jobs/name=db/persistent_disk",
+				"replace /jobs/-",
+				"remove /meta/debug",
+				"replace /meta/env",
+				"replace /meta/owner?",
+			})
+		})
+
+		Convey("appends to, trims, and patches lists by index", func() {
+			So(roundTrip(`
+zones: [z1, z2]
+ports: [80, 443, 8080]
+hosts: [a, b, c]
+`, `
+zones: [z1, z2, z3, z4]
+ports: [80]
+hosts: [a, x, c]
+`), ShouldResemble, []string{
+				"replace /hosts/1",
+				"remove /ports/2",
+				"remove /ports/1",
+				"replace /zones/-",
+				"replace /zones/-",
+			})
+		})
+
+		Convey("replaces what go-patch paths cannot address wholesale", func() {
+			So(roundTrip(`
+jobs:
+- name: web
+- name: db
+zones: [z1, z2, z3]
+links:
+  "a:b": 1
+`, `
+jobs:
+- name: db
+- name: web
+zones: [z3, z1]
+links:
+  "a:b": 2
+`), ShouldResemble, []string{
+				"replace /jobs",
+				"replace /links",
+				"replace /zones",
+			})
+		})
+
+		Convey("returns no ops for identical documents", func() {
+			ops, err := engine.GoPatch(parse("a: 1"), parse("a: 1"))
+			So(err, ShouldBeNil)
+			So(len(ops), ShouldEqual, 0)
+		})
+	})
+}
@@ -77,6 +77,14 @@ func (g *goPatchDocument) GetData() interface{} {
 	return g.ops
 }
 
+func (g *goPatchDocument) Provenance(path string) (ValueSource, bool) {
+	return ValueSource{}, false
+}
+
+func (g *goPatchDocument) Tainted() map[string]TaintSource {
+	return map[string]TaintSource{}
+}
+
 func (g *goPatchDocument) GetInt64(path string) (int64, error) {
 	return 0, fmt.Errorf("go-patch documents do not support GetInt64 operations")
 }
@@ -138,6 +138,14 @@ func NewOpcall(op Operator, args []*Expr, src string) *Opcall {
 	}
 }
 
+// NewNamedOpcall creates a new call to op, which is registered as name, run
+// against target (as in vault@target), or the default target if it is ""
+func NewNamedOpcall(name, target string, op Operator, args []*Expr, src string) *Opcall {
+	call := NewOpcall(op, args, src)
+	call.name, call.target = name, target
+	return call
+}
+
 // DefaultKeyGenerator returns a key generator function
 // This seems to be used for generating unique keys, possibly for caching
 func DefaultKeyGenerator() func() (string, error) {
@@ -3,6 +3,7 @@ package graft
 import (
 	"context"
 	"fmt"
+
 	"github.com/wayneeseguin/graft/internal/utils/tree"
 )
 
@@ -32,6 +33,10 @@ const (
 type Response struct {
 	Type  Action
 	Value interface{}
+	// Fallback is set by sensitive operators when Value is the call's
+	// || default rather than a secret they looked up, so that it carries
+	// only the taint of the default's own expression
+	Fallback bool
 }
 
 // Expr represents a parsed expression
@@ -118,6 +123,8 @@ type Opcall struct {
 	canonical *tree.Cursor
 	op        Operator
 	args      []*Expr
+	name      string // the name op was called by
+	target    string // the @target named in the call, if any
 }
 
 // Args returns the arguments for this operator call
@@ -150,6 +157,12 @@ func (op *Opcall) Src() string {
 	return op.src
 }
 
+// Target returns the target named in the call, such as "production" in
+// (( vault@production "secret/db:password" )), or "" if there is none
+func (op *Opcall) Target() string {
+	return op.target
+}
+
 // Dependencies returns the dependencies for this operator call
 func (op *Opcall) Dependencies(ev *Evaluator, locs []*tree.Cursor) []*tree.Cursor {
 	l := []*tree.Cursor{}
@@ -165,21 +178,40 @@ func (op *Opcall) Dependencies(ev *Evaluator, locs []*tree.Cursor) []*tree.Curso
 
 // Run executes this operator call
 func (op *Opcall) Run(ev *Evaluator) (*Response, error) {
-	was := ev.Here
-	ev.Here = op.where
+	was, wasTarget := ev.Here, ev.Target
+	ev.Here, ev.Target = op.where, op.Target()
 	r, err := op.op.Run(ev, op.args)
-	ev.Here = was
+	ev.Here, ev.Target = was, wasTarget
+	if err == nil && r != nil && !r.Fallback && IsSensitive(op.op) {
+		ev.taintCall(op, r.Value)
+	}
 
 	if err != nil {
+		opErr := &OpcallError{
+			Type:     EvaluationError,
+			Path:     "<generated>",
+			Operator: op.Name(),
+			Source:   op.src,
+			Err:      err,
+		}
 		if op.where != nil {
-			return nil, fmt.Errorf("$.%s: %s", op.where, err)
-		} else {
-			return nil, fmt.Errorf("$.<generated>: %s", err)
+			opErr.Path = op.where.String()
+			opErr.Position = ev.sourcePosition(opErr.Path)
 		}
+		return nil, opErr
 	}
 	return r, nil
 }
 
+// Name returns the name the operator being called is registered under, as
+// recorded by the parser, or "" for calls built without one
+func (op *Opcall) Name() string {
+	if null, ok := op.op.(NullOperator); ok && null.Missing != "" {
+		return null.Missing
+	}
+	return op.name
+}
+
 // IsOperator checks if an expression is an operator call
 func (e *Expr) IsOperator() bool {
 	return e != nil && e.Type == OperatorCall
@@ -0,0 +1,399 @@
+package graft
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/geofffranks/yaml"
+)
+
+// PatchFormat says how to read a merge input that patches the documents
+// merged before it, rather than being merged with them
+type PatchFormat string
+
+const (
+	// DetectPatchFormat reads a patch whose root is a list as a JSON Patch,
+	// and one whose root is a map as a JSON Merge Patch
+	DetectPatchFormat PatchFormat = ""
+	// JSONPatchFormat reads a patch as an RFC 6902 JSON Patch
+	JSONPatchFormat PatchFormat = "json-patch"
+	// MergePatchFormat reads a patch as an RFC 7386 JSON Merge Patch
+	MergePatchFormat PatchFormat = "merge-patch"
+)
+
+// String names the format for error messages
+func (f PatchFormat) String() string {
+	switch f {
+	case JSONPatchFormat:
+		return "JSON Patch"
+	case MergePatchFormat:
+		return "JSON Merge Patch"
+	}
+	return "patch"
+}
+
+// JSONPatchOperation is a single operation of an RFC 6902 JSON Patch
+type JSONPatchOperation struct {
+	Op    string      `yaml:"op" json:"op"`
+	Path  string      `yaml:"path" json:"path"`
+	From  string      `yaml:"from,omitempty" json:"from,omitempty"`
+	Value interface{} `yaml:"value,omitempty" json:"value,omitempty"`
+
+	hasValue bool
+}
+
+// JSONPatch is an RFC 6902 JSON Patch: a list of add, remove, replace,
+// move, copy and test operations, applied in order
+type JSONPatch []JSONPatchOperation
+
+// IsJSONPatch reports whether data looks like a JSON Patch: a list of maps
+// that each have a known `op` and a `path`. go-patch ops files, whose
+// entries have a `type` instead, are not mistaken for one.
+func IsJSONPatch(data []byte) bool {
+	var l []interface{}
+	if err := yaml.Unmarshal(data, &l); err != nil || len(l) == 0 {
+		return false
+	}
+	for _, entry := range l {
+		m, ok := entry.(map[interface{}]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m["path"].(string); !ok {
+			return false
+		}
+		switch m["op"] {
+		case "add", "remove", "replace", "move", "copy", "test":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ParseJSONPatch parses a JSON Patch, written as JSON or YAML
+func ParseJSONPatch(data []byte) (JSONPatch, error) {
+	var l []map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("Root of JSON Patch is not a list of operations: %s", err)
+	}
+
+	p := JSONPatch{}
+	for i, entry := range l {
+		op := JSONPatchOperation{}
+		op.Op, _ = entry["op"].(string)
+		path, ok := entry["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("JSON Patch operation [%d]: Missing path", i)
+		}
+		op.Path = path
+		op.Value, op.hasValue = entry["value"]
+		op.From, _ = entry["from"].(string)
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if !op.hasValue {
+				return nil, fmt.Errorf("JSON Patch operation [%d]: Missing value for '%s' operation", i, op.Op)
+			}
+		case "move", "copy":
+			if _, ok := entry["from"].(string); !ok {
+				return nil, fmt.Errorf("JSON Patch operation [%d]: Missing from for '%s' operation", i, op.Op)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("JSON Patch operation [%d]: Unknown op '%s'", i, op.Op)
+		}
+
+		for _, pointer := range []string{op.Path, op.From} {
+			if pointer != "" && !strings.HasPrefix(pointer, "/") {
+				return nil, fmt.Errorf("JSON Patch operation [%d]: Expected path '%s' to start with '/'", i, pointer)
+			}
+		}
+		p = append(p, op)
+	}
+	return p, nil
+}
+
+// Apply applies each operation of the patch in turn to doc, returning the
+// patched document. Should any operation fail, doc is left as it was.
+func (p JSONPatch) Apply(doc interface{}) (interface{}, error) {
+	doc = deepCopyValue(doc)
+	for i, op := range p {
+		var err error
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, fmt.Errorf("JSON Patch operation [%d] (%s %s): %s", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func (op JSONPatchOperation) apply(doc interface{}) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		return jsonPointerAdd(doc, op.Path, deepCopyValue(op.Value))
+
+	case "remove":
+		doc, _, err := jsonPointerRemove(doc, op.Path)
+		return doc, err
+
+	case "replace":
+		if op.Path == "" {
+			return deepCopyValue(op.Value), nil
+		}
+		if _, err := jsonPointerGet(doc, op.Path); err != nil {
+			return nil, err
+		}
+		doc, _, err := jsonPointerRemove(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, op.Path, deepCopyValue(op.Value))
+
+	case "move":
+		if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("Expected not to move '%s' into one of its own children", op.From)
+		}
+		doc, value, err := jsonPointerRemove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, op.Path, value)
+
+	case "copy":
+		value, err := jsonPointerGet(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, op.Path, deepCopyValue(value))
+
+	case "test":
+		value, err := jsonPointerGet(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if yamlmarshal(value) != yamlmarshal(op.Value) {
+			return nil, fmt.Errorf("Expected to find value '%v' for path '%s' but found '%v'", op.Value, op.Path, value)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("Unknown op '%s'", op.Op)
+}
+
+// jsonPointerTokens splits an RFC 6901 JSON Pointer into its unescaped
+// reference tokens
+func jsonPointerTokens(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens
+}
+
+// jsonPointerKey finds the key of m that token refers to. YAML maps can
+// have keys that are not strings, which are matched by how they print.
+func jsonPointerKey(m map[interface{}]interface{}, token string) (interface{}, bool) {
+	if _, ok := m[token]; ok {
+		return token, true
+	}
+	for k := range m {
+		if fmt.Sprintf("%v", k) == token {
+			return k, true
+		}
+	}
+	return token, false
+}
+
+// jsonPointerIndex parses token as an index into a list of length n
+func jsonPointerIndex(token, path string, n int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("Expected to find array index for path '%s' but found '%s'", path, token)
+	}
+	if i >= n {
+		return 0, fmt.Errorf("Expected to find array index '%d' but found array of length '%d' for path '%s'", i, n, path)
+	}
+	return i, nil
+}
+
+func jsonPointerMissingKey(token, path string, m map[interface{}]interface{}) error {
+	var keys []string
+	for k := range m {
+		keys = append(keys, fmt.Sprintf("'%v'", k))
+	}
+	sort.Strings(keys)
+	return fmt.Errorf("Expected to find a map key '%s' for path '%s' (found map keys: %s)", token, path, strings.Join(keys, ", "))
+}
+
+func jsonPointerMismatch(path string, obj interface{}) error {
+	return fmt.Errorf("Expected to find a map or array at path '%s' but found '%T'", path, obj)
+}
+
+// jsonPointerGet returns the value pointer refers to in doc
+func jsonPointerGet(doc interface{}, pointer string) (interface{}, error) {
+	obj := doc
+	path := ""
+	for _, token := range jsonPointerTokens(pointer) {
+		path += "/" + token
+		switch typed := obj.(type) {
+		case map[interface{}]interface{}:
+			k, ok := jsonPointerKey(typed, token)
+			if !ok {
+				return nil, jsonPointerMissingKey(token, path, typed)
+			}
+			obj = typed[k]
+		case []interface{}:
+			i, err := jsonPointerIndex(token, path, len(typed))
+			if err != nil {
+				return nil, err
+			}
+			obj = typed[i]
+		default:
+			return nil, jsonPointerMismatch(path, obj)
+		}
+	}
+	return obj, nil
+}
+
+// jsonPointerUpdate finds the map or list holding the value pointer refers
+// to, and replaces it with what update returns for it and the last token
+func jsonPointerUpdate(doc interface{}, pointer string, update func(parent interface{}, token, path string) (interface{}, error)) (interface{}, error) {
+	tokens := jsonPointerTokens(pointer)
+	if len(tokens) == 0 {
+		return update(nil, "", "")
+	}
+
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := jsonPointerGet(doc, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := update(parent, tokens[len(tokens)-1], pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return updated, nil
+	}
+
+	grandparent, err := jsonPointerGet(doc, parentPointer[:strings.LastIndex(parentPointer, "/")])
+	if err != nil {
+		return nil, err
+	}
+	token := jsonPointerTokens(parentPointer)[len(tokens)-2]
+	switch typed := grandparent.(type) {
+	case map[interface{}]interface{}:
+		k, _ := jsonPointerKey(typed, token)
+		typed[k] = updated
+	case []interface{}:
+		i, _ := strconv.Atoi(token)
+		typed[i] = updated
+	}
+	return doc, nil
+}
+
+// jsonPointerAdd adds value to doc at pointer, inserting it into lists and
+// setting it in maps
+func jsonPointerAdd(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	return jsonPointerUpdate(doc, pointer, func(parent interface{}, token, path string) (interface{}, error) {
+		switch typed := parent.(type) {
+		case nil:
+			if path == "" {
+				return value, nil
+			}
+		case map[interface{}]interface{}:
+			k, _ := jsonPointerKey(typed, token)
+			typed[k] = value
+			return typed, nil
+		case []interface{}:
+			i := len(typed)
+			if token != "-" {
+				var err error
+				if i, err = jsonPointerIndex(token, path, len(typed)+1); err != nil {
+					return nil, err
+				}
+			}
+			l := append(append(append([]interface{}{}, typed[:i]...), value), typed[i:]...)
+			return l, nil
+		}
+		return nil, jsonPointerMismatch(path, parent)
+	})
+}
+
+// jsonPointerRemove removes the value at pointer from doc, returning it
+func jsonPointerRemove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	var removed interface{}
+	doc, err := jsonPointerUpdate(doc, pointer, func(parent interface{}, token, path string) (interface{}, error) {
+		switch typed := parent.(type) {
+		case map[interface{}]interface{}:
+			k, ok := jsonPointerKey(typed, token)
+			if !ok {
+				return nil, jsonPointerMissingKey(token, path, typed)
+			}
+			removed = typed[k]
+			delete(typed, k)
+			return typed, nil
+		case []interface{}:
+			i, err := jsonPointerIndex(token, path, len(typed))
+			if err != nil {
+				return nil, err
+			}
+			removed = typed[i]
+			return append(append([]interface{}{}, typed[:i]...), typed[i+1:]...), nil
+		}
+		if path == "" {
+			return nil, fmt.Errorf("Expected not to remove the whole document")
+		}
+		return nil, jsonPointerMismatch(path, parent)
+	})
+	return doc, removed, err
+}
+
+// ParseMergePatch parses an RFC 7386 JSON Merge Patch, written as JSON or
+// YAML. Its root must be a map, since the document it patches is one.
+func ParseMergePatch(data []byte) (map[interface{}]interface{}, error) {
+	var p interface{}
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("Unable to parse JSON Merge Patch: %s", err)
+	}
+	if p == nil {
+		return map[interface{}]interface{}{}, nil
+	}
+	m, ok := p.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Root of JSON Merge Patch is not a hash/map")
+	}
+	return m, nil
+}
+
+// ApplyMergePatch applies an RFC 7386 JSON Merge Patch to target: maps in
+// the patch are merged into the maps of target key by key, with nulls
+// removing keys, and everything else, lists included, replaces what target
+// holds. target is left as it was.
+func ApplyMergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[interface{}]interface{})
+	if !ok {
+		return deepCopyValue(patch)
+	}
+	t, ok := target.(map[interface{}]interface{})
+	if !ok {
+		t = map[interface{}]interface{}{}
+	}
+	result := make(map[interface{}]interface{}, len(t))
+	for k, v := range t {
+		result[k] = v
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = ApplyMergePatch(result[k], v)
+	}
+	return result
+}
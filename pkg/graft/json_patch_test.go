@@ -0,0 +1,169 @@
+package graft
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONPatch(t *testing.T) {
+	Convey("JSONPatch", t, func() {
+		doc := func() interface{} {
+			return map[interface{}]interface{}{
+				"meta": map[interface{}]interface{}{"env": "staging", "a/b": 1, "m~n": 2},
+				"jobs": []interface{}{
+					map[interface{}]interface{}{"name": "web", "instances": 2},
+					map[interface{}]interface{}{"name": "db", "instances": 1},
+				},
+			}
+		}
+		apply := func(src string) (interface{}, error) {
+			p, err := ParseJSONPatch([]byte(src))
+			So(err, ShouldBeNil)
+			return p.Apply(doc())
+		}
+
+		Convey("applies add, remove, replace, move, copy and test in order", func() {
+			patched, err := apply(`[
+  {"op": "test", "path": "/meta/env", "value": "staging"},
+  {"op": "replace", "path": "/meta/env", "value": "production"},
+  {"op": "add", "path": "/jobs/1", "value": {"name": "worker"}},
+  {"op": "add", "path": "/jobs/-", "value": {"name": "cron"}},
+  {"op": "remove", "path": "/meta/a~1b"},
+  {"op": "move", "from": "/meta/m~0n", "path": "/meta/mn"},
+  {"op": "copy", "from": "/jobs/0/instances", "path": "/meta/instances"}
+]`)
+			So(err, ShouldBeNil)
+			So(yamlmarshal(patched), ShouldEqual, yamlmarshal(map[interface{}]interface{}{
+				"meta": map[interface{}]interface{}{"env": "production", "mn": 2, "instances": 2},
+				"jobs": []interface{}{
+					map[interface{}]interface{}{"name": "web", "instances": 2},
+					map[interface{}]interface{}{"name": "worker"},
+					map[interface{}]interface{}{"name": "db", "instances": 1},
+					map[interface{}]interface{}{"name": "cron"},
+				},
+			}))
+		})
+
+		Convey("reads patches written as YAML", func() {
+			patched, err := apply(`
+- op: replace
+  path: /jobs/1/instances
+  value: 3
+`)
+			So(err, ShouldBeNil)
+			So(patched.(map[interface{}]interface{})["jobs"].([]interface{})[1], ShouldResemble,
+				map[interface{}]interface{}{"name": "db", "instances": 3})
+		})
+
+		Convey("names the operation that failed, and leaves the document alone", func() {
+			original := doc()
+			p, err := ParseJSONPatch([]byte(`[
+  {"op": "replace", "path": "/meta/env", "value": "production"},
+  {"op": "remove", "path": "/meta/missing"}
+]`))
+			So(err, ShouldBeNil)
+			_, err = p.Apply(original)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "JSON Patch operation [1] (remove /meta/missing): Expected to find a map key 'missing' for path '/meta/missing' (found map keys: 'a/b', 'env', 'm~n')")
+			So(original.(map[interface{}]interface{})["meta"].(map[interface{}]interface{})["env"], ShouldEqual, "staging")
+
+			_, err = apply(`[{"op": "test", "path": "/jobs/0/instances", "value": 4}]`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Expected to find value '4' for path '/jobs/0/instances' but found '2'")
+
+			_, err = apply(`[{"op": "add", "path": "/jobs/3", "value": 1}]`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Expected to find array index '3' but found array of length '3' for path '/jobs/3'")
+		})
+
+		Convey("rejects malformed operations", func() {
+			_, err := ParseJSONPatch([]byte(`[{"op": "add", "path": "/a"}]`))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Missing value for 'add' operation")
+
+			_, err = ParseJSONPatch([]byte(`[{"op": "frobnicate", "path": "/a"}]`))
+			So(err, ShouldNotBeNil)
+
+			_, err = ParseJSONPatch([]byte(`[{"op": "remove", "path": "a"}]`))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("is told apart from go-patch ops files", func() {
+			So(IsJSONPatch([]byte(`[{"op": "remove", "path": "/a"}]`)), ShouldBeTrue)
+			So(IsJSONPatch([]byte("- type: remove\n  path: /a\n")), ShouldBeFalse)
+			So(IsJSONPatch([]byte("a: 1")), ShouldBeFalse)
+		})
+	})
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	Convey("ApplyMergePatch", t, func() {
+		target := map[interface{}]interface{}{
+			"meta":  map[interface{}]interface{}{"env": "staging", "debug": true},
+			"zones": []interface{}{"z1", "z2"},
+			"name":  "app",
+		}
+		p, err := ParseMergePatch([]byte(`{"meta": {"env": "production", "debug": null}, "zones": ["z3"], "name": null}`))
+		So(err, ShouldBeNil)
+
+		Convey("merges maps, removes nulls and replaces everything else", func() {
+			So(ApplyMergePatch(target, p), ShouldResemble, map[interface{}]interface{}{
+				"meta":  map[interface{}]interface{}{"env": "production"},
+				"zones": []interface{}{"z3"},
+			})
+			So(target["name"], ShouldEqual, "app")
+		})
+
+		Convey("needs a map at its root", func() {
+			_, err := ParseMergePatch([]byte(`["a"]`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMergeBuilderWithPatch(t *testing.T) {
+	Convey("MergeBuilder.WithPatch", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+		base, err := engine.ParseYAML([]byte("meta: {env: staging, debug: true}\njobs: [{name: web, instances: 2}]"))
+		So(err, ShouldBeNil)
+		overlay, err := engine.ParseYAML([]byte("meta: {owner: ops}"))
+		So(err, ShouldBeNil)
+
+		Convey("applies patches in sequence with the documents merged", func() {
+			result, err := engine.Merge(context.Background(), base).
+				WithPatch([]byte(`[{"op": "replace", "path": "/meta/env", "value": "production"}]`), DetectPatchFormat).
+				WithPatch([]byte(`{"meta": {"debug": null}}`), MergePatchFormat).
+				SkipEvaluation().
+				Execute()
+			So(err, ShouldBeNil)
+			So(result.GetData(), ShouldResemble, map[interface{}]interface{}{
+				"meta": map[interface{}]interface{}{"env": "production"},
+				"jobs": []interface{}{map[interface{}]interface{}{"name": "web", "instances": 2}},
+			})
+		})
+
+		Convey("lets later documents merge on top of a patched one", func() {
+			patch, err := ParsePatch([]byte(`{"meta": null}`), DetectPatchFormat)
+			So(err, ShouldBeNil)
+			So(IsPatchDocument(patch), ShouldBeTrue)
+
+			result, err := engine.Merge(context.Background(), base, patch, overlay).SkipEvaluation().Execute()
+			So(err, ShouldBeNil)
+			So(result.GetData().(map[interface{}]interface{})["meta"], ShouldResemble, map[interface{}]interface{}{"owner": "ops"})
+		})
+
+		Convey("fails on patches that do not apply", func() {
+			_, err := engine.Merge(context.Background(), base).
+				WithPatch([]byte(`[{"op": "remove", "path": "/meta/missing"}]`), JSONPatchFormat).
+				Execute()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Expected to find a map key 'missing' for path '/meta/missing'")
+
+			_, err = engine.Merge(context.Background(), base).WithPatch([]byte(`[{"op": "add"}]`), JSONPatchFormat).Execute()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,458 @@
+package graft
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yamlv2 "github.com/geofffranks/yaml"
+	"github.com/wayneeseguin/graft/internal/utils/tree"
+	"gopkg.in/yaml.v3"
+)
+
+// KeyOrder records the order in which map keys were first seen in the
+// source documents, indexed by the dotted path of the map that holds them.
+//
+// Documents keep using map[interface{}]interface{} for their data, so
+// ordering lives alongside the data instead of inside it. List entries are
+// addressed by their name/key/id field when they have one (the same way
+// graft addresses them in paths), otherwise by their index.
+type KeyOrder struct {
+	keys map[string][]string
+	seen map[string]map[string]bool
+}
+
+// NewKeyOrder creates an empty KeyOrder
+func NewKeyOrder() *KeyOrder {
+	return &KeyOrder{
+		keys: make(map[string][]string),
+		seen: make(map[string]map[string]bool),
+	}
+}
+
+// keyOrderFromNode records the key order found in a parsed yaml.v3 node tree
+func keyOrderFromNode(node *yaml.Node) *KeyOrder {
+	order := NewKeyOrder()
+	walkYAMLNode(node, "", func(parent string, key, value *yaml.Node) {
+		order.Add(parent, key.Value)
+	})
+	return order
+}
+
+// Add appends key to the ordering of the map at path, unless it was already seen
+func (o *KeyOrder) Add(path, key string) {
+	if o.seen[path] == nil {
+		o.seen[path] = make(map[string]bool)
+	}
+	if o.seen[path][key] {
+		return
+	}
+	o.seen[path][key] = true
+	o.keys[path] = append(o.keys[path], key)
+}
+
+// Keys returns the recorded key order for the map at path
+func (o *KeyOrder) Keys(path string) []string {
+	if o == nil {
+		return nil
+	}
+	return o.keys[path]
+}
+
+// Merge folds the ordering of other into o. Keys that o has already seen keep
+// their position; keys that only other knows about are appended.
+func (o *KeyOrder) Merge(other *KeyOrder) {
+	if other == nil {
+		return
+	}
+	for path, keys := range other.keys {
+		for _, key := range keys {
+			o.Add(path, key)
+		}
+	}
+}
+
+// Copy replays the ordering recorded at and beneath from onto to. It is used
+// when an operator copies a subtree from one place in the document to another
+// (e.g. grab and inject).
+func (o *KeyOrder) Copy(from, to string) {
+	copied := make(map[string][]string)
+	for path, keys := range o.keys {
+		switch {
+		case path == from:
+			copied[to] = keys
+		case from == "" || strings.HasPrefix(path, from+"."):
+			copied[joinKeyPath(to, strings.TrimPrefix(strings.TrimPrefix(path, from), "."))] = keys
+		}
+	}
+	for dest, keys := range copied {
+		for _, key := range keys {
+			o.Add(dest, key)
+		}
+	}
+}
+
+// Clone returns an independent copy of the ordering
+func (o *KeyOrder) Clone() *KeyOrder {
+	if o == nil {
+		return nil
+	}
+	clone := NewKeyOrder()
+	clone.Merge(o)
+	return clone
+}
+
+// sortKeys orders the keys of the map at path: keys with a recorded position
+// come first in that order, anything else (keys added by operators, for
+// instance) follows alphabetically.
+func (o *KeyOrder) sortKeys(path string, keys []string) []string {
+	present := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		present[k] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	placed := make(map[string]bool, len(keys))
+	if o != nil {
+		for _, k := range o.keys[path] {
+			if present[k] {
+				sorted = append(sorted, k)
+				placed[k] = true
+			}
+		}
+	}
+
+	var rest []string
+	for _, k := range keys {
+		if !placed[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(sorted, rest...)
+}
+
+// walkYAMLNode visits every mapping key beneath node, calling fn with the
+// path of the mapping that holds it and the key and value nodes
+func walkYAMLNode(node *yaml.Node, path string, fn func(parent string, key, value *yaml.Node)) {
+	if node == nil {
+		return
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkYAMLNode(child, path, fn)
+		}
+
+	case yaml.AliasNode:
+		walkYAMLNode(node.Alias, path, fn)
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fn(path, key, value)
+			walkYAMLNode(value, joinKeyPath(path, key.Value), fn)
+		}
+
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			walkYAMLNode(child, joinKeyPath(path, yamlNodeName(child, strconv.Itoa(i))), fn)
+		}
+	}
+}
+
+// yamlNodeName is the yaml.Node counterpart of nameOfObj
+func yamlNodeName(node *yaml.Node, def string) string {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return def
+	}
+	for _, field := range tree.NameFields {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == field && value.Kind == yaml.ScalarNode && value.Tag == "!!str" {
+				return value.Value
+			}
+		}
+	}
+	return def
+}
+
+// joinKeyPath appends a path component to a dotted path
+func joinKeyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	if key == "" {
+		return path
+	}
+	return path + "." + key
+}
+
+// orderedYAMLNode builds a yaml.v3 node tree for value, emitting map keys in
+// the order recorded by order and attaching the comments recorded by comments.
+// Either may be nil.
+func orderedYAMLNode(value interface{}, path string, order *KeyOrder, comments *Comments) (*yaml.Node, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(v))
+		lookup := make(map[string]interface{}, len(v))
+		for k := range v {
+			s := fmt.Sprintf("%v", k)
+			keys = append(keys, s)
+			lookup[s] = k
+		}
+
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, s := range order.sortKeys(path, keys) {
+			k := lookup[s]
+			keyNode, err := scalarYAMLNode(k)
+			if err != nil {
+				return nil, err
+			}
+			valueNode, err := orderedYAMLNode(v[k], joinKeyPath(path, s), order, comments)
+			if err != nil {
+				return nil, err
+			}
+			comments.applyToKey(joinKeyPath(path, s), keyNode, valueNode)
+			node.Content = append(node.Content, keyNode, valueNode)
+		}
+		return node, nil
+
+	case map[string]interface{}:
+		converted := make(map[interface{}]interface{}, len(v))
+		for k, val := range v {
+			converted[k] = val
+		}
+		return orderedYAMLNode(converted, path, order, comments)
+
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for i, item := range v {
+			itemPath := joinKeyPath(path, nameOfObj(item, strconv.Itoa(i)))
+			itemNode, err := orderedYAMLNode(item, itemPath, order, comments)
+			if err != nil {
+				return nil, err
+			}
+			comments.applyToValue(itemPath, itemNode)
+			node.Content = append(node.Content, itemNode)
+		}
+		return node, nil
+
+	default:
+		return scalarYAMLNode(v)
+	}
+}
+
+// orderedMapSlice converts value to a tree of yaml.MapSlice, with map keys
+// in the order recorded by order, for the marshaller the default output uses
+func orderedMapSlice(value interface{}, path string, order *KeyOrder) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(v))
+		lookup := make(map[string]interface{}, len(v))
+		for k := range v {
+			s := fmt.Sprintf("%v", k)
+			keys = append(keys, s)
+			lookup[s] = k
+		}
+
+		slice := make(yamlv2.MapSlice, 0, len(v))
+		for _, s := range order.sortKeys(path, keys) {
+			k := lookup[s]
+			slice = append(slice, yamlv2.MapItem{Key: k, Value: orderedMapSlice(v[k], joinKeyPath(path, s), order)})
+		}
+		return slice
+
+	case map[string]interface{}:
+		converted := make(map[interface{}]interface{}, len(v))
+		for k, val := range v {
+			converted[k] = val
+		}
+		return orderedMapSlice(converted, path, order)
+
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = orderedMapSlice(item, joinKeyPath(path, nameOfObj(item, strconv.Itoa(i))), order)
+		}
+		return list
+
+	default:
+		return v
+	}
+}
+
+// scalarYAMLNode lets yaml.v3 decide tag and quoting for a single value
+func scalarYAMLNode(value interface{}) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// marshalOrderedYAML renders data as YAML, with map keys in recorded order
+// and the recorded comments put back in place
+func marshalOrderedYAML(data interface{}, order *KeyOrder, comments *Comments) ([]byte, error) {
+	if comments == nil {
+		// Only yaml.v3 can write comments; without any, use the marshaller
+		// of the default output so that key order is all that changes
+		return yamlv2.Marshal(orderedMapSlice(data, "", order))
+	}
+
+	root, err := orderedYAMLNode(data, "", order, comments)
+	if err != nil {
+		return nil, err
+	}
+	comments.applyToValue("", root)
+
+	node := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}
+	if comments != nil {
+		node.HeadComment, node.FootComment = comments.head, comments.foot
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return outdentSequences(buf.Bytes()), nil
+}
+
+// outdentSequences moves the lists yaml.v3 writes beneath map keys, and
+// everything in them, two spaces to the left, so that they are laid out
+// like the default output:
+//
+//	jobs:
+//	- name: web
+//
+// out is returned as is if the result does not read back the same.
+func outdentSequences(out []byte) []byte {
+	lines := strings.Split(string(out), "\n")
+	var open []int     // the columns of the "- " of the lists being moved
+	block := -1        // the indent of the line starting a block scalar
+	opener := false    // the last line was a map key with its value below
+	openerIndent := 0  // the column of that key
+	var comments []int // the comment lines since that key
+	for i, line := range lines {
+		content := strings.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+
+		if content == "" || (block >= 0 && indent > block) {
+			lines[i] = shiftLeft(line, 2*len(open))
+			continue
+		}
+		block = -1
+
+		for len(open) > 0 && indent < open[len(open)-1] {
+			open = open[:len(open)-1]
+		}
+		if strings.HasPrefix(content, "#") {
+			lines[i] = shiftLeft(line, 2*len(open))
+			if opener && indent == openerIndent+2 {
+				comments = append(comments, i)
+			}
+			continue
+		}
+		if opener && indent == openerIndent+2 && (content == "-" || strings.HasPrefix(content, "- ")) {
+			open = append(open, indent)
+			// the comments above the first entry move with it
+			for _, c := range comments {
+				lines[c] = shiftLeft(lines[c], 2)
+			}
+		}
+		comments = nil
+		lines[i] = shiftLeft(line, 2*len(open))
+
+		// the column of the last key on the line, after any "- "s
+		key := indent
+		for strings.HasPrefix(content, "- ") {
+			content = strings.TrimLeft(content[2:], " ")
+			key = len(line) - len(content)
+		}
+		value := content
+		if at := strings.Index(value, " #"); at >= 0 {
+			value = value[:at]
+		}
+		value = strings.TrimRight(value, " ")
+		opener, openerIndent = strings.HasSuffix(value, ":"), key
+		if blockScalarStart.MatchString(value) {
+			block = indent
+		}
+	}
+
+	outdented := []byte(strings.Join(lines, "\n"))
+	var before, after interface{}
+	if yaml.Unmarshal(out, &before) != nil || yaml.Unmarshal(outdented, &after) != nil || !reflect.DeepEqual(before, after) {
+		return out
+	}
+	return outdented
+}
+
+// blockScalarStart matches a line ending in the | or > of a block scalar
+var blockScalarStart = regexp.MustCompile(`(^|[ :])[|>][0-9+-]*$`)
+
+// shiftLeft drops up to n leading spaces from line
+func shiftLeft(line string, n int) string {
+	for n > 0 && strings.HasPrefix(line, " ") {
+		line, n = line[1:], n-1
+	}
+	return line
+}
+
+// documentKeyOrder returns the key order carried by doc, if any
+func documentKeyOrder(doc Document) *KeyOrder {
+	if d, ok := doc.(*document); ok {
+		return d.order
+	}
+	return nil
+}
+
+// withOutputLayout attaches order and comments to doc so that ToYAML emits
+// keys in that order and with those comments. Passing nil for either leaves
+// that part of the output as it would be without it.
+func withOutputLayout(doc Document, order *KeyOrder, comments *Comments) Document {
+	d, ok := doc.(*document)
+	if !ok {
+		return doc
+	}
+	laidOut := d.withData(d.data)
+	laidOut.order, laidOut.preserveOrder = order, order != nil
+	laidOut.comments, laidOut.preserveComments = comments, comments != nil
+	return laidOut
+}
+
+// recordKeyOrder carries the key order of a grabbed or injected subtree over
+// to wherever the operator puts it, so copied maps keep their source order
+func (ev *Evaluator) recordKeyOrder(op *Opcall, resp *Response) {
+	args := op.Args()
+	if len(args) != 1 || args[0] == nil || args[0].Type != Reference || args[0].Reference == nil || op.where == nil {
+		return
+	}
+	from := args[0].Reference.String()
+
+	switch resp.Type {
+	case Replace:
+		switch resp.Value.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			ev.KeyOrder.Copy(from, op.where.String())
+		}
+
+	case Inject:
+		parent := op.where.Copy()
+		parent.Pop()
+		ev.KeyOrder.Copy(from, parent.String())
+	}
+}
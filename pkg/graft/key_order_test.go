@@ -0,0 +1,134 @@
+package graft
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestKeyOrder(t *testing.T) {
+	Convey("KeyOrder", t, func() {
+		Convey("records keys in source order from a yaml node", func() {
+			var node yaml.Node
+			err := yaml.Unmarshal([]byte(`
+zulu: 1
+alpha:
+  second: 2
+  first: 1
+jobs:
+- name: web
+  zz: 1
+  aa: 2
+- plain: true
+`), &node)
+			So(err, ShouldBeNil)
+
+			order := keyOrderFromNode(&node)
+			So(order.Keys(""), ShouldResemble, []string{"zulu", "alpha", "jobs"})
+			So(order.Keys("alpha"), ShouldResemble, []string{"second", "first"})
+			So(order.Keys("jobs.web"), ShouldResemble, []string{"name", "zz", "aa"})
+			So(order.Keys("jobs.1"), ShouldResemble, []string{"plain"})
+		})
+
+		Convey("keeps first-seen positions when merging", func() {
+			a := NewKeyOrder()
+			a.Add("", "b")
+			a.Add("", "a")
+			b := NewKeyOrder()
+			b.Add("", "c")
+			b.Add("", "a")
+			b.Add("", "b")
+
+			a.Merge(b)
+			So(a.Keys(""), ShouldResemble, []string{"b", "a", "c"})
+		})
+
+		Convey("copies a subtree's ordering to a new path", func() {
+			o := NewKeyOrder()
+			o.Add("meta", "z")
+			o.Add("meta", "y")
+			o.Add("meta.z", "2")
+			o.Add("meta.z", "1")
+			o.Add("metadata", "ignored")
+
+			o.Copy("meta", "copy")
+			So(o.Keys("copy"), ShouldResemble, []string{"z", "y"})
+			So(o.Keys("copy.z"), ShouldResemble, []string{"2", "1"})
+			So(o.Keys("copy.data"), ShouldBeNil)
+		})
+
+		Convey("puts unknown keys after known ones, alphabetically", func() {
+			o := NewKeyOrder()
+			o.Add("", "z")
+			o.Add("", "m")
+			So(o.sortKeys("", []string{"b", "m", "a", "z"}), ShouldResemble, []string{"z", "m", "a", "b"})
+
+			var nilOrder *KeyOrder
+			So(nilOrder.sortKeys("", []string{"b", "a"}), ShouldResemble, []string{"a", "b"})
+		})
+	})
+}
+
+func TestMergeBuilderPreserveOrder(t *testing.T) {
+	Convey("MergeBuilder.PreserveOrder", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+
+		doc1, err := engine.ParseYAML([]byte(`
+zeta: 1
+meta:
+  name: base
+  size: small
+`))
+		So(err, ShouldBeNil)
+
+		doc2, err := engine.ParseYAML([]byte(`
+beta: 2
+meta:
+  size: large
+  extra: yes
+zones: [z1, z2]
+`))
+		So(err, ShouldBeNil)
+
+		Convey("emits keys in first-seen order across documents", func() {
+			result, err := engine.Merge(context.Background(), doc1, doc2).PreserveOrder().Execute()
+			So(err, ShouldBeNil)
+
+			out, err := result.ToYAML()
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `zeta: 1
+meta:
+  name: base
+  size: large
+  extra: true
+beta: 2
+zones:
+- z1
+- z2
+`)
+		})
+
+		Convey("leaves RawData and default output untouched", func() {
+			result, err := engine.Merge(context.Background(), doc1, doc2).Execute()
+			So(err, ShouldBeNil)
+
+			out, err := result.ToYAML()
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `beta: 2
+meta:
+    extra: true
+    name: base
+    size: large
+zeta: 1
+zones:
+    - z1
+    - z2
+`)
+			_, ok := result.RawData().(map[interface{}]interface{})
+			So(ok, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,438 @@
+package graft
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wayneeseguin/graft/internal/utils/tree"
+	"github.com/wayneeseguin/graft/pkg/graft/merger"
+)
+
+// LintSeverity says how serious a LintIssue is
+type LintSeverity string
+
+const (
+	// LintWarning marks something that is likely a mistake, but will not
+	// stop a merge from succeeding
+	LintWarning LintSeverity = "warning"
+	// LintError marks something that will make a merge fail
+	LintError LintSeverity = "error"
+)
+
+// LintIssue is a problem found by Lint
+type LintIssue struct {
+	Severity LintSeverity `json:"severity"`
+	File     string       `json:"file,omitempty"`
+	Line     int          `json:"line,omitempty"`
+	Column   int          `json:"column,omitempty"`
+	Path     string       `json:"path,omitempty"`
+	Operator string       `json:"operator,omitempty"`
+	Message  string       `json:"message"`
+
+	// doc is the index of the document the issue was found in, used to keep
+	// issues in merge order
+	doc int
+}
+
+// String formats the issue as `file:line:column: severity: $.path: message`
+func (i LintIssue) String() string {
+	var b strings.Builder
+	if i.File != "" || i.Line != 0 {
+		b.WriteString(ValueSource{File: i.File, Line: i.Line, Column: i.Column}.String())
+		b.WriteString(": ")
+	}
+	b.WriteString(string(i.Severity))
+	b.WriteString(": ")
+	if i.Path != "" {
+		b.WriteString("$." + i.Path + ": ")
+	}
+	b.WriteString(i.Message)
+	return b.String()
+}
+
+// arrayOperators are the list modifiers handled by the merger rather than by
+// registered operators
+var arrayOperators = map[string]bool{
+	"merge":     true,
+	"replace":   true,
+	"inline":    true,
+	"append":    true,
+	"prepend":   true,
+	"insert":    true,
+	"delete":    true,
+	"union":     true,
+	"intersect": true,
+	"subtract":  true,
+}
+
+// opcallNameRx picks the operator name, and the @target if there is one, out
+// of a (( ... )) expression
+var opcallNameRx = regexp.MustCompile(`^\(\(\s*([a-zA-Z][a-zA-Z0-9_-]*)(?:@([a-zA-Z][a-zA-Z0-9_-]*))?(?:\s|\(|\)\))`)
+
+// Lint statically checks docs, given in merge order, for mistakes that would
+// make a merge fail or behave unexpectedly: unknown operators, wrong argument
+// counts, malformed array operators, references to paths that no document
+// defines and (( param )) values that are never overridden.
+//
+// No operator is run, so Lint never contacts Vault, AWS or NATS. Issues are
+// located using the provenance of each document (see WithSourceName).
+func Lint(docs ...Document) []LintIssue {
+	return LintWithStrategies(nil, docs...)
+}
+
+// LintWithStrategies is Lint for documents merged with the given merge
+// strategies, as `graft merge` does with those of .graft.yml
+func LintWithStrategies(strategies []MergeStrategy, docs ...Document) []LintIssue {
+	l := &linter{docs: docs}
+
+	// References and params are checked against whatever merged; the lists
+	// the merger could not merge are left empty, and references into them
+	// are not reported on top of the merge errors
+	m := &merger.Merger{Strategies: mergerStrategies(strategies)}
+	l.merged = map[interface{}]interface{}{}
+	for i, doc := range docs {
+		if data, ok := doc.RawData().(map[interface{}]interface{}); ok {
+			seen := m.Errors.Count()
+			_ = m.Merge(l.merged, deepCopyMap(data))
+			l.mergeErrors(i, m.Errors.Errors[seen:])
+		}
+	}
+
+	for i, doc := range docs {
+		if data, ok := doc.RawData().(map[interface{}]interface{}); ok {
+			l.walk(i, data, "")
+		}
+	}
+	l.params()
+
+	sort.SliceStable(l.issues, func(a, b int) bool {
+		x, y := l.issues[a], l.issues[b]
+		if x.doc != y.doc {
+			return x.doc < y.doc
+		}
+		if x.Line != y.Line {
+			return x.Line < y.Line
+		}
+		return x.Column < y.Column
+	})
+	return l.issues
+}
+
+type linter struct {
+	docs   []Document
+	merged map[interface{}]interface{}
+	failed bool // set if the merge failed
+	issues []LintIssue
+}
+
+// report records an issue found at path in the i'th document
+func (l *linter) report(severity LintSeverity, i int, path, src, format string, args ...interface{}) {
+	issue := LintIssue{
+		Severity: severity,
+		Path:     path,
+		Operator: src,
+		Message:  fmt.Sprintf(format, args...),
+		doc:      i,
+	}
+	if i >= 0 && i < len(l.docs) {
+		if loc, ok := l.docs[i].Provenance(path); ok {
+			issue.File, issue.Line, issue.Column = loc.File, loc.Line, loc.Column
+		}
+	}
+	l.issues = append(l.issues, issue)
+}
+
+// mergeErrors reports the errors the merger ran into merging the i'th
+// document, at the line of the path they name in that document
+func (l *linter) mergeErrors(i int, errs []error) {
+	for _, e := range errs {
+		l.failed = true
+		// misplaced (( merge )) is reported with its location by walk
+		if strings.Contains(e.Error(), "outside of a list") {
+			continue
+		}
+		var pathErr merger.PathError
+		if !errors.As(e, &pathErr) {
+			l.report(LintError, i, "", "", "%s", e.Error())
+			continue
+		}
+		l.report(LintError, i, l.located(i, strings.TrimPrefix(pathErr.Path, "$.")), "", "%s", pathErr.Message)
+	}
+}
+
+// located returns path, or the nearest of its parents that the i'th
+// document has a location for
+func (l *linter) located(i int, path string) string {
+	for sub := path; sub != ""; {
+		if _, ok := l.docs[i].Provenance(sub); ok {
+			return sub
+		}
+		if dot := strings.LastIndex(sub, "."); dot >= 0 {
+			sub = sub[:dot]
+		} else {
+			sub = ""
+		}
+	}
+	return path
+}
+
+// walk checks every (( ... )) expression in the i'th document
+func (l *linter) walk(i int, value interface{}, path string) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(v))
+		lookup := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			key := fmt.Sprintf("%v", k)
+			keys = append(keys, key)
+			lookup[key] = val
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			l.walk(i, lookup[key], joinKeyPath(path, key))
+		}
+
+	case []interface{}:
+		for idx, item := range v {
+			sub := joinKeyPath(path, nameOfObj(item, strconv.Itoa(idx)))
+			if s, ok := item.(string); ok && l.arrayOperator(i, v, s, sub) {
+				continue
+			}
+			l.walk(i, item, sub)
+		}
+
+	case string:
+		l.expression(i, v, path)
+	}
+}
+
+// arrayOperator checks entry as a list modifier, returning false if it is
+// not one
+func (l *linter) arrayOperator(i int, list []interface{}, entry, path string) bool {
+	m := opcallNameRx.FindStringSubmatch(strings.TrimSpace(entry))
+	if m == nil || !arrayOperators[m[1]] {
+		return false
+	}
+	if !merger.IsArrayOperator(list, strings.TrimSpace(entry)) {
+		l.report(LintError, i, path, entry, "malformed array operator %s", entry)
+	}
+	return true
+}
+
+// expression checks a single (( ... )) expression found at path
+func (l *linter) expression(i int, s, path string) {
+	src := strings.TrimSpace(s)
+	if !strings.HasPrefix(src, "((") || !strings.HasSuffix(src, "))") {
+		return
+	}
+
+	name := ""
+	if m := opcallNameRx.FindStringSubmatch(src); m != nil {
+		name = m[1]
+	}
+	if arrayOperators[name] && OpRegistry[name] == nil {
+		l.report(LintError, i, path, src, "%s can only be used inside a list", src)
+		return
+	}
+
+	phase := EvalPhase
+	if op, known := OpRegistry[name]; known {
+		phase = op.Phase()
+	}
+	opcall, err := ParseOpcall(phase, src)
+	if err != nil {
+		l.report(LintError, i, path, src, "unable to parse %s: %s", src, err)
+		return
+	}
+	if opcall == nil {
+		return // not an operator call, e.g. a ((bosh-variable))
+	}
+	if null, ok := opcall.Operator().(NullOperator); ok {
+		// infix expressions like (( a + b )) are only understood by the
+		// expression parser
+		opcall, err = ParseOpcallInfix(phase, src)
+		if err != nil || opcall == nil {
+			if null.Missing == "__infix__" {
+				l.report(LintError, i, path, src, "unable to parse %s", src)
+			} else {
+				l.report(LintError, i, path, src, "unknown operator (( %s ))", null.Missing)
+			}
+			return
+		}
+	}
+
+	if _, ok := GetOperatorInfo(name); ok {
+		if err := ValidateOperatorArgs(name, len(opcall.Args())); err != nil {
+			l.report(LintError, i, path, src, "%s", err)
+		}
+	}
+
+	switch name {
+	case "defer", "sort", "prune":
+		// arguments are not references into the document
+		return
+	}
+	for _, arg := range opcall.Args() {
+		l.references(arg, false, func(ref *tree.Cursor, hasFallback bool) {
+			if l.resolvable(ref) {
+				return
+			}
+			if hasFallback {
+				l.report(LintWarning, i, path, src, "`$.%s` is not defined by any file; the fallback after `||` will always be used", ref)
+			} else {
+				l.report(LintError, i, path, src, "`$.%s` is not defined by any file", ref)
+			}
+		})
+	}
+}
+
+// references calls fn for every document reference in e. References on the
+// left of a `||` have a fallback, so their absence is only a warning.
+func (l *linter) references(e *Expr, hasFallback bool, fn func(*tree.Cursor, bool)) {
+	if e == nil {
+		return
+	}
+	switch e.Type {
+	case Reference:
+		if e.Reference != nil {
+			fn(e.Reference, hasFallback)
+		}
+	case Or, LogicalOr:
+		l.references(e.Left, true, fn)
+		l.references(e.Right, hasFallback, fn)
+	case OperatorCall:
+		if e.Call != nil {
+			for _, arg := range e.Call.Args() {
+				l.references(arg, hasFallback, fn)
+			}
+		}
+	default:
+		l.references(e.Left, hasFallback, fn)
+		l.references(e.Right, hasFallback, fn)
+	}
+}
+
+// resolvable reports whether ref can be found in the merged document. Paths
+// that lead into the result of an operator, or into a map that an
+// (( inject )) adds keys to, cannot be checked statically and count as found.
+func (l *linter) resolvable(ref *tree.Cursor) bool {
+	var here interface{} = l.merged
+	for _, node := range ref.Nodes {
+		switch v := here.(type) {
+		case map[interface{}]interface{}:
+			val, ok := lookupKey(v, node)
+			if !ok {
+				return hasInject(v)
+			}
+			here = val
+
+		case []interface{}:
+			if v == nil {
+				// a list the merge failed on, which has been reported already
+				return l.failed
+			}
+			val, ok := lookupEntry(v, node)
+			if !ok {
+				return false
+			}
+			here = val
+
+		case string:
+			return isOpcall(v)
+
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// params warns about (( param )) values that survive the merge, which means
+// none of the documents overrode them
+func (l *linter) params() {
+	var walk func(value interface{}, path string)
+	walk = func(value interface{}, path string) {
+		switch v := value.(type) {
+		case map[interface{}]interface{}:
+			for k, val := range v {
+				walk(val, joinKeyPath(path, fmt.Sprintf("%v", k)))
+			}
+		case []interface{}:
+			for idx, item := range v {
+				walk(item, joinKeyPath(path, nameOfObj(item, strconv.Itoa(idx))))
+			}
+		case string:
+			if m := opcallNameRx.FindStringSubmatch(strings.TrimSpace(v)); m != nil && m[1] == "param" {
+				l.param(v, path)
+			}
+		}
+	}
+	walk(l.merged, "")
+}
+
+// param reports a single (( param )) that was never overridden, along with
+// any override that an earlier document made and that it discards
+func (l *linter) param(src, path string) {
+	declared := -1
+	for i := len(l.docs) - 1; i >= 0; i-- {
+		if v, err := l.docs[i].Get(path); err == nil && v == src {
+			declared = i
+			break
+		}
+	}
+
+	l.report(LintWarning, declared, path, strings.TrimSpace(src), "(( param )) is not overridden by any of the given files")
+
+	for i := 0; i < declared; i++ {
+		if v, err := l.docs[i].Get(path); err == nil && v != src {
+			if s, ok := v.(string); ok && isOpcall(s) {
+				continue
+			}
+			l.report(LintWarning, i, path, "", "this value is unused; a later (( param )) replaces it")
+		}
+	}
+}
+
+func lookupKey(m map[interface{}]interface{}, key string) (interface{}, bool) {
+	for k, v := range m {
+		if fmt.Sprintf("%v", k) == key {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func lookupEntry(list []interface{}, node string) (interface{}, bool) {
+	if idx, err := strconv.Atoi(node); err == nil {
+		if idx >= 0 && idx < len(list) {
+			return list[idx], true
+		}
+		return nil, false
+	}
+	for _, item := range list {
+		if nameOfObj(item, "") == node {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+func hasInject(m map[interface{}]interface{}) bool {
+	for _, v := range m {
+		if s, ok := v.(string); ok {
+			if name := opcallNameRx.FindStringSubmatch(strings.TrimSpace(s)); name != nil && name[1] == "inject" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isOpcall(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "((") && strings.HasSuffix(s, "))")
+}
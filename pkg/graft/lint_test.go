@@ -0,0 +1,157 @@
+package graft
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLint(t *testing.T) {
+	Convey("Lint", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+
+		parse := func(name, src string) Document {
+			doc, err := engine.ParseYAML([]byte(src))
+			So(err, ShouldBeNil)
+			return WithSourceName(doc, name)
+		}
+		messages := func(issues []LintIssue) []string {
+			var out []string
+			for _, issue := range issues {
+				out = append(out, issue.String())
+			}
+			return out
+		}
+
+		Convey("finds nothing wrong with a well-formed template", func() {
+			base := parse("base.yml", `meta:
+  name: (( param "name this deployment" ))
+  size: (( grab meta.sizes.small || "tiny" ))
+  sizes:
+    small: s1
+jobs:
+- name: web
+  instances: (( calc "meta.count * 2" ))
+- name: db
+  url: (( concat "db://" meta.name ))
+list:
+- (( append ))
+- ((bosh-managed-variable))
+`)
+			env := parse("env.yml", `meta:
+  name: prod
+  count: 2
+jobs:
+- (( insert after "web" ))
+- name: worker
+`)
+			So(Lint(base, env), ShouldBeEmpty)
+		})
+
+		Convey("reports unknown operators and bad argument counts", func() {
+			doc := parse("a.yml", `a: (( frobnicate b ))
+b: (( concat "x" ))
+c: (( base64 "x" "y" ))
+`)
+			So(messages(Lint(doc)), ShouldResemble, []string{
+				"a.yml:1:1: error: $.a: unknown operator (( frobnicate ))",
+				"a.yml:2:1: error: $.b: operator concat requires at least 2 arguments, got 1",
+				"a.yml:3:1: error: $.c: operator base64 accepts at most 1 arguments, got 2",
+			})
+		})
+
+		Convey("reports references that no file defines", func() {
+			doc := parse("a.yml", `meta:
+  name: web
+x: (( grab meta.nope ))
+y: (( grab meta.nope || meta.name ))
+`)
+			issues := Lint(doc)
+			So(messages(issues), ShouldResemble, []string{
+				"a.yml:3:1: error: $.x: `$.meta.nope` is not defined by any file",
+				"a.yml:4:1: warning: $.y: `$.meta.nope` is not defined by any file; the fallback after `||` will always be used",
+			})
+			So(issues[0].Operator, ShouldEqual, "(( grab meta.nope ))")
+		})
+
+		Convey("resolves references against all of the files", func() {
+			a := parse("a.yml", `x: (( grab meta.name ))`)
+			b := parse("b.yml", `meta: { name: web }`)
+			So(Lint(a, b), ShouldBeEmpty)
+		})
+
+		Convey("does not look inside the results of operators", func() {
+			doc := parse("a.yml", `base: (( load "other.yml" ))
+meta:
+  injected: (( inject base ))
+x: (( grab base.anything.at.all ))
+y: (( grab meta.from_inject ))
+`)
+			So(Lint(doc), ShouldBeEmpty)
+		})
+
+		Convey("reports malformed and misplaced array operators", func() {
+			doc := parse("a.yml", `jobs:
+- name: web
+- (( insert after ))
+- name: db
+x: (( append ))
+`)
+			So(messages(Lint(doc)), ShouldResemble, []string{
+				"a.yml:3:3: error: $.jobs.1: malformed array operator (( insert after ))",
+				"a.yml:5:1: error: $.x: (( append )) can only be used inside a list",
+			})
+		})
+
+		Convey("locates merge errors and keeps checking what did merge", func() {
+			a := parse("a.yml", `meta:
+  name: web
+jobs:
+- name: web
+`)
+			b := parse("b.yml", `jobs:
+- (( merge on id ))
+- id: worker
+x: (( grab meta.name ))
+y: (( param "set y" ))
+z: (( grab meta.missing ))
+w: (( grab jobs.worker.id ))
+`)
+			So(messages(Lint(a, b)), ShouldResemble, []string{
+				"b.yml:2:3: error: $.jobs.0: original object does not contain the key 'id' - cannot merge by key",
+				"b.yml:5:1: warning: $.y: (( param )) is not overridden by any of the given files",
+				"b.yml:6:1: error: $.z: `$.meta.missing` is not defined by any file",
+			})
+		})
+
+		Convey("locates a missing insertion point at its list", func() {
+			a := parse("a.yml", `jobs:
+- name: web
+`)
+			b := parse("b.yml", `meta: {}
+jobs:
+- (( insert after name "db" ))
+- name: worker
+`)
+			So(messages(Lint(a, b)), ShouldResemble, []string{
+				"b.yml:2:1: error: $.jobs: unable to find specified modification point with 'name: db'",
+			})
+		})
+
+		Convey("reports params that are never overridden, and the values they hide", func() {
+			a := parse("a.yml", `meta:
+  size: large
+`)
+			b := parse("b.yml", `meta:
+  size: (( param "how big?" ))
+`)
+			issues := Lint(a, b)
+			So(messages(issues), ShouldResemble, []string{
+				"a.yml:2:3: warning: $.meta.size: this value is unused; a later (( param )) replaces it",
+				"b.yml:2:3: warning: $.meta.size: (( param )) is not overridden by any of the given files",
+			})
+			So(issues[0].Severity, ShouldEqual, LintWarning)
+		})
+	})
+}
@@ -12,18 +12,23 @@ import (
 
 // mergeBuilderImpl implements the MergeBuilder interface
 type mergeBuilderImpl struct {
-	engine         Engine
-	ctx            context.Context
-	docs           []Document
-	pruneKeys      []string
-	cherryPickKeys []string
-	skipEvaluation bool
-	goPatch        bool
-	fallbackAppend bool
-	arrayStrategy  ArrayMergeStrategy
-	error          error                 // Stores any error from construction
-	mergeMetadata  *merger.MergeMetadata // Accumulated metadata from merges
-	patchOps       []patch.Ops           // Store parsed go-patch operations
+	engine           Engine
+	ctx              context.Context
+	docs             []Document
+	pruneKeys        []string
+	cherryPickKeys   []string
+	skipEvaluation   bool
+	goPatch          bool
+	fallbackAppend   bool
+	preserveOrder    bool
+	preserveComments bool
+	redactor         Redactor
+	arrayStrategy    ArrayMergeStrategy
+	strategies       []MergeStrategy
+	error            error                 // Stores any error from construction
+	mergeMetadata    *merger.MergeMetadata // Accumulated metadata from merges
+	patchOps         []patch.Ops           // Store parsed go-patch operations
+	tracker          *merger.SourceTracker // Follows list entries through the merge in progress
 }
 
 // WithPrune adds keys to remove from the final output
@@ -70,6 +75,23 @@ func (m *mergeBuilderImpl) EnableGoPatch() MergeBuilder {
 	return &newBuilder
 }
 
+// WithPatch adds a JSON Patch or JSON Merge Patch to the documents to merge,
+// to be applied to the result of merging the documents before it
+func (m *mergeBuilderImpl) WithPatch(data []byte, format PatchFormat) MergeBuilder {
+	if m.error != nil {
+		return m // Propagate error
+	}
+
+	newBuilder := *m // Copy the builder
+	doc, err := ParsePatch(data, format)
+	if err != nil {
+		newBuilder.error = NewParseError(fmt.Sprintf("failed to parse %s", format), err)
+		return &newBuilder
+	}
+	newBuilder.docs = append(append([]Document{}, m.docs...), doc)
+	return &newBuilder
+}
+
 // FallbackAppend uses append instead of inline for arrays by default
 func (m *mergeBuilderImpl) FallbackAppend() MergeBuilder {
 	if m.error != nil {
@@ -82,6 +104,57 @@ func (m *mergeBuilderImpl) FallbackAppend() MergeBuilder {
 	return &newBuilder
 }
 
+// PreserveOrder emits keys in the order they were first seen across the
+// merged documents instead of sorting them
+func (m *mergeBuilderImpl) PreserveOrder() MergeBuilder {
+	if m.error != nil {
+		return m // Propagate error
+	}
+
+	newBuilder := *m // Copy the builder
+	newBuilder.preserveOrder = true
+	return &newBuilder
+}
+
+// PreserveComments carries the comments of the merged documents into the
+// output, taking each key's comments from the last document that commented it
+func (m *mergeBuilderImpl) PreserveComments() MergeBuilder {
+	if m.error != nil {
+		return m // Propagate error
+	}
+
+	newBuilder := *m // Copy the builder
+	newBuilder.preserveComments = true
+	return &newBuilder
+}
+
+// WithTrace records the operator calls made during evaluation into trace
+func (m *mergeBuilderImpl) WithTrace(trace *EvalTrace) MergeBuilder {
+	if m.error != nil {
+		return m // Propagate error
+	}
+
+	newBuilder := *m // Copy the builder
+	newBuilder.ctx = WithEvalTrace(m.ctx, trace)
+	return &newBuilder
+}
+
+// Redact masks the secrets in the result as REDACTED
+func (m *mergeBuilderImpl) Redact() MergeBuilder {
+	return m.WithRedactor(RedactSecrets)
+}
+
+// WithRedactor masks the secrets in the result with redactor
+func (m *mergeBuilderImpl) WithRedactor(redactor Redactor) MergeBuilder {
+	if m.error != nil {
+		return m // Propagate error
+	}
+
+	newBuilder := *m // Copy the builder
+	newBuilder.redactor = redactor
+	return &newBuilder
+}
+
 // WithArrayMergeStrategy sets how arrays are merged
 func (m *mergeBuilderImpl) WithArrayMergeStrategy(strategy ArrayMergeStrategy) MergeBuilder {
 	if m.error != nil {
@@ -97,6 +170,48 @@ func (m *mergeBuilderImpl) WithArrayMergeStrategy(strategy ArrayMergeStrategy) M
 	return &newBuilder
 }
 
+// WithMergeStrategies says how the lists and maps at given paths merge
+func (m *mergeBuilderImpl) WithMergeStrategies(strategies ...MergeStrategy) MergeBuilder {
+	if m.error != nil {
+		return m // Propagate error
+	}
+
+	newBuilder := *m // Copy the builder
+	for _, s := range strategies {
+		if err := s.Validate(); err != nil {
+			newBuilder.error = NewConfigurationError(err.Error())
+			return &newBuilder
+		}
+	}
+	newBuilder.strategies = append(append([]MergeStrategy{}, m.strategies...), strategies...)
+	return &newBuilder
+}
+
+// newMerger returns a legacy merger set up as the builder is
+func (m *mergeBuilderImpl) newMerger() *merger.Merger {
+	return &merger.Merger{
+		AppendByDefault: m.fallbackAppend,
+		SetOpByDefault:  m.arrayStrategy.setOperation(),
+		DedupeByDefault: m.arrayStrategy == DedupeArrays,
+		Strategies:      mergerStrategies(m.strategies),
+		Tracker:         m.tracker,
+	}
+}
+
+// setOperation names the array operator of the union, intersect and
+// subtract strategies
+func (s ArrayMergeStrategy) setOperation() string {
+	switch s {
+	case UnionArrays:
+		return "union"
+	case IntersectArrays:
+		return "intersect"
+	case SubtractArrays:
+		return "subtract"
+	}
+	return ""
+}
+
 // Execute performs the merge operation
 func (m *mergeBuilderImpl) Execute() (Document, error) {
 	// Check for construction errors first
@@ -117,7 +232,7 @@ func (m *mergeBuilderImpl) Execute() (Document, error) {
 	}
 
 	// Handle single document case
-	if len(m.docs) == 1 {
+	if len(m.docs) == 1 && !IsGoPatchDocument(m.docs[0]) && !IsPatchDocument(m.docs[0]) {
 		// For single documents, we need to validate arrays even without merging
 		// to match legacy behavior for Issue #172
 		data := m.docs[0].RawData().(map[interface{}]interface{})
@@ -133,9 +248,9 @@ func (m *mergeBuilderImpl) Execute() (Document, error) {
 
 		if useArrayOperators || hasArraysWithMaps || hasPruneOps {
 			// Process through merger for validation and/or array operators
-			mergerInstance := &merger.Merger{
-				AppendByDefault: m.fallbackAppend,
-			}
+			m.tracker = merger.NewSourceTracker()
+			defer func() { m.tracker = nil }()
+			mergerInstance := m.newMerger()
 
 			// Create an empty base and merge our document into it
 			// This triggers the array validation logic
@@ -153,11 +268,13 @@ func (m *mergeBuilderImpl) Execute() (Document, error) {
 				return nil, err
 			}
 
+			m.setSources(m.tracker.Sources(base, nil, documentSources(m.docs[0])))
 			return m.applyPostProcessing(NewDocument(base))
 		}
 
 		// No special processing needed, just clone
 		result := m.docs[0].Clone()
+		m.setSources(documentSources(m.docs[0]))
 		return m.applyPostProcessing(result)
 	}
 
@@ -172,7 +289,8 @@ func (m *mergeBuilderImpl) Execute() (Document, error) {
 
 // mergeDocuments performs the actual document merging
 func (m *mergeBuilderImpl) mergeDocuments() (Document, error) {
-	// Separate regular documents from go-patch documents
+	// Separate regular documents, and the JSON Patches and JSON Merge Patches
+	// applied in sequence with them, from go-patch documents
 	var regularDocs []Document
 	for _, doc := range m.docs {
 		if IsGoPatchDocument(doc) {
@@ -190,17 +308,26 @@ func (m *mergeBuilderImpl) mergeDocuments() (Document, error) {
 		return NewDocument(make(map[interface{}]interface{})), nil
 	}
 
-	// Start with the first document as base
-	baseData := regularDocs[0].RawData().(map[interface{}]interface{})
+	// Start with the first document as base, or with an empty document when
+	// the first one patches it
+	first := 1
+	baseData := map[interface{}]interface{}{}
+	var sources map[string]ValueSource
+	if IsPatchDocument(regularDocs[0]) {
+		first = 0
+	} else {
+		baseData = regularDocs[0].RawData().(map[interface{}]interface{})
+		sources = documentSources(regularDocs[0])
+	}
 	result := deepCopyMap(baseData)
+	defer func() { m.tracker = nil }()
 
 	// Check if the first document needs special processing (contains prune operators)
 	// But skip this when skipEvaluation is true to preserve operators
 	if m.hasPruneOperators(baseData) && !m.skipEvaluation {
 		// Process the first document through merger to handle prune operators
-		mergerInstance := &merger.Merger{
-			AppendByDefault: m.fallbackAppend,
-		}
+		m.tracker = merger.NewSourceTracker()
+		mergerInstance := m.newMerger()
 
 		// Create an empty base and merge our first document into it
 		emptyBase := make(map[interface{}]interface{})
@@ -235,10 +362,11 @@ func (m *mergeBuilderImpl) mergeDocuments() (Document, error) {
 
 		// Use the processed result
 		result = emptyBase
+		sources = m.tracker.Sources(result, nil, sources)
 	}
 
 	// Merge subsequent documents
-	for i := 1; i < len(regularDocs); i++ {
+	for i := first; i < len(regularDocs); i++ {
 		// Check context cancellation during merge
 		select {
 		case <-m.ctx.Done():
@@ -246,7 +374,17 @@ func (m *mergeBuilderImpl) mergeDocuments() (Document, error) {
 		default:
 		}
 
+		if p, ok := regularDocs[i].(*patchDocument); ok {
+			patched, err := p.apply(result)
+			if err != nil {
+				return nil, err
+			}
+			result = patched
+			continue
+		}
+
 		overlayData := regularDocs[i].RawData().(map[interface{}]interface{})
+		m.tracker = merger.NewSourceTracker()
 		err := m.mergeInto(result, overlayData)
 		if err != nil {
 			// Check if this is a detailed merger error that should be preserved
@@ -255,8 +393,10 @@ func (m *mergeBuilderImpl) mergeDocuments() (Document, error) {
 			}
 			return nil, NewMergeError("failed to merge documents", err)
 		}
+		sources = m.tracker.Sources(result, sources, documentSources(regularDocs[i]))
 	}
 
+	m.setSources(sources)
 	return NewDocument(result), nil
 }
 
@@ -267,18 +407,18 @@ func (m *mergeBuilderImpl) mergeInto(base, overlay map[interface{}]interface{})
 	// 1. There are array operators in the overlay AND we're not skipping evaluation
 	// 2. There are arrays with maps (for merge-by-key behavior)
 	// 3. There are prune operators in either base or overlay (they need special handling during merge)
+	// 4. There are merge strategies, which only the legacy merger knows about
 	// Note: When skipEvaluation is true, we need to preserve operators in the output,
 	// so we use a custom merge approach for arrays with operators
 	needLegacyMerger := (!m.skipEvaluation && m.hasArrayOperators(overlay)) ||
 		m.hasArraysWithMaps(overlay) ||
 		m.hasPruneOperators(overlay) ||
 		m.hasPruneOperators(base) || // Also check base for prune operators
-		m.hasSortOperators(overlay)
+		m.hasSortOperators(overlay) ||
+		len(m.strategies) > 0
 
 	if needLegacyMerger {
-		mergerInstance := &merger.Merger{
-			AppendByDefault: m.fallbackAppend,
-		}
+		mergerInstance := m.newMerger()
 
 		// Create a copy of base to merge into
 		baseCopy := deepCopyMap(base)
@@ -387,16 +527,21 @@ func (m *mergeBuilderImpl) mergeValues(base, overlay interface{}) (interface{},
 			result := make([]interface{}, len(baseArray)+len(overlayArray))
 			copy(result, baseArray)
 			copy(result[len(baseArray):], overlayArray)
+			m.tracker.Track(result, baseArray, overlayArray, concatOrigins(len(baseArray), len(overlayArray), false))
 			return result, nil
 		case PrependArrays:
 			// Prepend arrays
 			result := make([]interface{}, len(overlayArray)+len(baseArray))
 			copy(result, overlayArray)
 			copy(result[len(overlayArray):], baseArray)
+			m.tracker.Track(result, baseArray, overlayArray, concatOrigins(len(baseArray), len(overlayArray), true))
 			return result, nil
 		case ReplaceArrays:
 			// Replace arrays
 			return deepCopyValue(overlayArray), nil
+		case UnionArrays, IntersectArrays, SubtractArrays:
+			// Set operations are left to the legacy merger, which has them
+			return m.mergeArraysWithSetOperation(baseArray, overlayArray)
 		case InlineArrays:
 			fallthrough
 		default:
@@ -410,37 +555,39 @@ func (m *mergeBuilderImpl) mergeValues(base, overlay interface{}) (interface{},
 	return deepCopyValue(overlay), nil
 }
 
-// mergeArraysWithOperators merges arrays using the legacy merger logic that supports operators
-func (m *mergeBuilderImpl) mergeArraysWithOperators(base, overlay []interface{}) (interface{}, error) {
-	// Use the existing merger package to handle array operators
-	baseMap := map[interface{}]interface{}{"array": base}
-	overlayMap := map[interface{}]interface{}{"array": overlay}
-
-	result, err := merger.Merge(baseMap, overlayMap)
-	if err != nil {
-		// Preserve the original error message from the merger, but need to adjust path context
-		// The merger uses "$.array.X" but we need to use the actual field name
-		// For now, preserve as-is since the test might need updating for the new API
+// mergeArraysWithSetOperation merges arrays with the set operation of the
+// array strategy, which only the legacy merger has
+func (m *mergeBuilderImpl) mergeArraysWithSetOperation(base, overlay []interface{}) (interface{}, error) {
+	mergerInstance := &merger.Merger{
+		Strategies: []merger.Strategy{{Path: "array", List: m.arrayStrategy.setOperation()}},
+		Tracker:    m.tracker,
+	}
+	result := map[interface{}]interface{}{"array": base}
+	if err := mergerInstance.Merge(result, map[interface{}]interface{}{"array": overlay}); err != nil {
 		return nil, err
 	}
+	return result["array"], nil
+}
 
-	// Extract the merged array
-	mergedArray, exists := result["array"]
-	if !exists {
-		// Fallback: if merger didn't work as expected, use simple logic
-		if m.fallbackAppend {
-			// Append arrays
-			finalResult := make([]interface{}, len(base)+len(overlay))
-			copy(finalResult, base)
-			copy(finalResult[len(base):], overlay)
-			return finalResult, nil
-		} else {
-			// Replace arrays (default behavior)
-			return deepCopyValue(overlay), nil
-		}
+// concatOrigins returns the origins of a list of the orig entries of the list
+// merged into followed by the n entries of the list merged in, or preceded
+// by them when prepend is set
+func concatOrigins(orig, n int, prepend bool) []merger.ListOrigin {
+	origins := make([]merger.ListOrigin, 0, orig+n)
+	added := make([]merger.ListOrigin, 0, n)
+	for i := 0; i < n; i++ {
+		added = append(added, merger.ListOrigin{Orig: -1, New: i})
 	}
-
-	return mergedArray, nil
+	if prepend {
+		origins = append(origins, added...)
+	}
+	for i := 0; i < orig; i++ {
+		origins = append(origins, merger.ListOrigin{Orig: i, New: -1})
+	}
+	if !prepend {
+		origins = append(origins, added...)
+	}
+	return origins
 }
 
 // hasArrayOperators checks if a map contains arrays with merge operators
@@ -470,7 +617,10 @@ func (m *mergeBuilderImpl) arrayHasOperators(array []interface{}) bool {
 				strings.Contains(str, "(( prepend ))") ||
 				strings.Contains(str, "(( replace ))") ||
 				strings.Contains(str, "(( inline ))") ||
-				strings.Contains(str, "(( merge") || // matches (( merge )) and (( merge on key ))
+				strings.Contains(str, "(( union ))") ||
+				strings.Contains(str, "(( intersect ))") ||
+				strings.Contains(str, "(( subtract ))") ||
+				strings.Contains(str, "(( merge") || // matches (( merge )), (( merge on key )) and (( merge on key dedupe ))
 				strings.Contains(str, "(( insert") || // matches various insert forms
 				strings.Contains(str, "(( delete") { // matches various delete forms
 				return true
@@ -590,13 +740,40 @@ func (m *mergeBuilderImpl) applyPostProcessing(doc Document) (Document, error) {
 		}
 	}
 
+	// Record which document last wrote each path, for Document.Provenance
+	sources := m.mergedSources()
+	result = withSources(result, sources)
+
+	// Carry the merged key order and comments through evaluation and into the output
+	var order *KeyOrder
+	if m.preserveOrder {
+		order = m.mergedKeyOrder()
+	}
+	var comments *Comments
+	if m.preserveComments {
+		comments = m.mergedComments()
+	}
+	if order != nil || comments != nil {
+		result = withOutputLayout(result, order, comments)
+	}
+
 	// Apply evaluation if not skipped
+	var taints map[string]TaintSource
 	if !m.skipEvaluation {
 		evaluated, err := m.applyEvaluation(result)
 		if err != nil {
 			return nil, err
 		}
 		result = evaluated
+		if evaluatedSources := documentSources(result); evaluatedSources != nil {
+			sources = evaluatedSources
+		}
+		taints = documentTaints(result)
+
+		// Mask secrets before pruning and cherry-picking move anything around
+		if m.redactor != nil {
+			result = redacted(result, m.redactor)
+		}
 	}
 
 	// Collect prune keys from both sources:
@@ -633,9 +810,55 @@ func (m *mergeBuilderImpl) applyPostProcessing(doc Document) (Document, error) {
 		result = cherryPicked
 	}
 
+	result = withTaints(withSources(result, sources), taints)
+	if order != nil || comments != nil {
+		result = withOutputLayout(result, order, comments)
+	}
+
 	return result, nil
 }
 
+// mergedKeyOrder combines the key order of every input document, in merge order
+func (m *mergeBuilderImpl) mergedKeyOrder() *KeyOrder {
+	order := NewKeyOrder()
+	for _, doc := range m.docs {
+		order.Merge(documentKeyOrder(doc))
+	}
+	return order
+}
+
+// setSources keeps where each path of the merged document was last written
+// in the merge metadata, alongside prune and sort paths
+func (m *mergeBuilderImpl) setSources(sources map[string]ValueSource) {
+	if m.mergeMetadata == nil {
+		m.mergeMetadata = &merger.MergeMetadata{
+			SortPaths: make(map[string]string),
+		}
+	}
+	if len(sources) == 0 {
+		sources = nil
+	}
+	m.mergeMetadata.Sources = sources
+}
+
+// mergedSources returns where each path of the merged document was last
+// written
+func (m *mergeBuilderImpl) mergedSources() map[string]ValueSource {
+	if m.mergeMetadata == nil {
+		return nil
+	}
+	return copySources(m.mergeMetadata.Sources)
+}
+
+// mergedComments combines the comments of every input document, in merge order
+func (m *mergeBuilderImpl) mergedComments() *Comments {
+	comments := NewComments()
+	for _, doc := range m.docs {
+		comments.Merge(documentComments(doc))
+	}
+	return comments
+}
+
 // applyGoPatch applies go-patch operations to the document
 func (m *mergeBuilderImpl) applyGoPatch(doc Document) (Document, error) {
 	// Get the raw data
@@ -0,0 +1,96 @@
+package graft
+
+import (
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft/merger"
+	"gopkg.in/yaml.v3"
+)
+
+// MergeStrategy says how the lists and maps at the paths matching Path
+// merge, so that overlays do not need (( merge on ... )), (( append )) and
+// the like to say it. Array operators in an overlay list still win.
+//
+// A merge strategy file, or the merge section of .graft.yml, looks like:
+//
+//	merge:
+//	  strategies:
+//	    - path: jobs
+//	      key: name
+//	    - path: jobs.*.networks
+//	      list: replace
+//	    - path: meta.allowed_cidrs
+//	      list: append
+//	      dedupe: true
+//	    - path: meta.tags
+//	      map: replace
+//
+// Path is matched against the path of the list or map itself, not those
+// beneath it; see MatchPath for the pattern syntax. The first strategy
+// whose path matches is the one used.
+type MergeStrategy struct {
+	Path string `yaml:"path" json:"path"`
+
+	// List is merge (on Key), inline, append, prepend, replace, union,
+	// intersect or subtract
+	List string `yaml:"list,omitempty" json:"list,omitempty"`
+	// Key is the key lists of maps merge on, name by default
+	Key string `yaml:"key,omitempty" json:"key,omitempty"`
+	// Dedupe drops list entries equal to one before them after merging.
+	// Lists merged on Key instead collapse entries with the same key into
+	// one, with a warning.
+	Dedupe bool `yaml:"dedupe,omitempty" json:"dedupe,omitempty"`
+
+	// Map is merge, the default, or replace to not deep-merge maps
+	Map string `yaml:"map,omitempty" json:"map,omitempty"`
+}
+
+// ParseMergeStrategies parses a merge strategy file
+func ParseMergeStrategies(data []byte) ([]MergeStrategy, error) {
+	var file struct {
+		Merge struct {
+			Strategies []MergeStrategy `yaml:"strategies"`
+		} `yaml:"merge"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, ansi.Errorf("@R{unable to parse merge strategies}: %s", err)
+	}
+	for _, s := range file.Merge.Strategies {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return file.Merge.Strategies, nil
+}
+
+// Validate checks that the strategy can be used
+func (s MergeStrategy) Validate() error {
+	if s.Path == "" {
+		return ansi.Errorf("@R{merge strategy is missing a} @c{path}")
+	}
+	if err := ValidatePathPattern(s.Path); err != nil {
+		return ansi.Errorf("@R{invalid merge strategy path} @c{%s}@R{: %s}", s.Path, err)
+	}
+	switch s.List {
+	case "", "merge", "inline", "append", "prepend", "replace", "union", "intersect", "subtract":
+	default:
+		return ansi.Errorf("@R{merge strategy for} @c{%s} @R{has unknown list mode} @c{%s}@R{; expected merge, inline, append, prepend, replace, union, intersect or subtract}", s.Path, s.List)
+	}
+	if s.Key != "" && s.List != "" && s.List != "merge" {
+		return ansi.Errorf("@R{merge strategy for} @c{%s} @R{sets a key, which only applies to list mode} @c{merge}", s.Path)
+	}
+	switch s.Map {
+	case "", "merge", "replace":
+	default:
+		return ansi.Errorf("@R{merge strategy for} @c{%s} @R{has unknown map mode} @c{%s}@R{; expected merge or replace}", s.Path, s.Map)
+	}
+	return nil
+}
+
+// mergerStrategies converts strategies for use by the merger
+func mergerStrategies(strategies []MergeStrategy) []merger.Strategy {
+	var l []merger.Strategy
+	for _, s := range strategies {
+		l = append(l, merger.Strategy{Path: s.Path, List: s.List, Key: s.Key, Dedupe: s.Dedupe, Map: s.Map})
+	}
+	return l
+}
@@ -0,0 +1,109 @@
+package graft
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMergeStrategies(t *testing.T) {
+	Convey("ParseMergeStrategies", t, func() {
+		Convey("reads the merge section of a strategy file", func() {
+			strategies, err := ParseMergeStrategies([]byte(`
+merge:
+  strategies:
+    - path: jobs
+      key: id
+    - path: meta.tags
+      map: replace
+`))
+			So(err, ShouldBeNil)
+			So(strategies, ShouldResemble, []MergeStrategy{
+				{Path: "jobs", Key: "id"},
+				{Path: "meta.tags", Map: "replace"},
+			})
+		})
+
+		Convey("rejects strategies it cannot use", func() {
+			for _, src := range []string{
+				"merge: {strategies: [{list: append}]}",
+				"merge: {strategies: [{path: 'jobs.[', list: append}]}",
+				"merge: {strategies: [{path: jobs, list: shuffle}]}",
+				"merge: {strategies: [{path: jobs, list: append, key: id}]}",
+				"merge: {strategies: [{path: jobs, map: shallow}]}",
+			} {
+				_, err := ParseMergeStrategies([]byte(src))
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("MergeBuilder.WithMergeStrategies", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+		base, err := engine.ParseYAML([]byte("zones: [z1, z2]\nmeta: {tags: {team: web, tier: frontend}}"))
+		So(err, ShouldBeNil)
+		overlay, err := engine.ParseYAML([]byte("zones: [z2, z3]\nmeta: {tags: {team: platform}}"))
+		So(err, ShouldBeNil)
+
+		Convey("merges the documents as the strategies say", func() {
+			result, err := engine.Merge(context.Background(), base, overlay).
+				WithMergeStrategies(
+					MergeStrategy{Path: "zones", List: "prepend", Dedupe: true},
+					MergeStrategy{Path: "meta.tags", Map: "replace"},
+				).
+				Execute()
+			So(err, ShouldBeNil)
+			So(result.GetData(), ShouldResemble, map[interface{}]interface{}{
+				"zones": []interface{}{"z2", "z3", "z1"},
+				"meta":  map[interface{}]interface{}{"tags": map[interface{}]interface{}{"team": "platform"}},
+			})
+		})
+
+		Convey("merges lists of maps on name when no key is given", func() {
+			base, err := engine.ParseYAML([]byte("jobs: [{name: web, instances: 1}, {name: db, instances: 1}]"))
+			So(err, ShouldBeNil)
+			overlay, err := engine.ParseYAML([]byte("jobs: [{name: db, instances: 3}, {name: worker, instances: 2}]"))
+			So(err, ShouldBeNil)
+
+			result, err := engine.Merge(context.Background(), base, overlay).
+				WithMergeStrategies(MergeStrategy{Path: "jobs", List: "merge"}).
+				Execute()
+			So(err, ShouldBeNil)
+			So(result.GetData(), ShouldResemble, map[interface{}]interface{}{
+				"jobs": []interface{}{
+					map[interface{}]interface{}{"name": "web", "instances": 1},
+					map[interface{}]interface{}{"name": "db", "instances": 3},
+					map[interface{}]interface{}{"name": "worker", "instances": 2},
+				},
+			})
+		})
+
+		Convey("collapses entries with the same key once when merging with dedupe", func() {
+			base, err := engine.ParseYAML([]byte("jobs: [{name: web, instances: 1}, {name: web, size: large}]"))
+			So(err, ShouldBeNil)
+			overlay, err := engine.ParseYAML([]byte("jobs: [{name: db}]"))
+			So(err, ShouldBeNil)
+
+			result, err := engine.Merge(context.Background(), base, overlay).
+				WithMergeStrategies(MergeStrategy{Path: "jobs", List: "merge", Dedupe: true}).
+				Execute()
+			So(err, ShouldBeNil)
+			So(result.GetData(), ShouldResemble, map[interface{}]interface{}{
+				"jobs": []interface{}{
+					map[interface{}]interface{}{"name": "web", "instances": 1, "size": "large"},
+					map[interface{}]interface{}{"name": "db"},
+				},
+			})
+		})
+
+		Convey("fails on strategies it cannot use", func() {
+			_, err := engine.Merge(context.Background(), base, overlay).
+				WithMergeStrategies(MergeStrategy{Path: "zones", List: "shuffle"}).
+				Execute()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unknown list mode")
+		})
+	})
+}
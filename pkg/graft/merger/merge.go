@@ -56,6 +56,9 @@ const (
 	listOpReplace
 	listOpInsert
 	listOpDelete
+	listOpUnion
+	listOpIntersect
+	listOpSubtract
 )
 
 // MultiError represents multiple errors
@@ -79,6 +82,11 @@ func (e MultiError) Error() string {
 	return fmt.Sprintf("%d errors occurred:\n  %s", len(e.Errors), strings.Join(msgs, "\n  "))
 }
 
+// Unwrap returns the collected errors, for errors.Is and errors.As
+func (e MultiError) Unwrap() []error {
+	return e.Errors
+}
+
 func (e *MultiError) Append(err error) {
 	if err != nil {
 		e.Errors = append(e.Errors, err)
@@ -89,16 +97,70 @@ func (e *MultiError) Count() int {
 	return len(e.Errors)
 }
 
+// PathError is a merge failure at a specific path of the document
+type PathError struct {
+	Path    string
+	Message string
+}
+
+func (e PathError) Error() string {
+	return ansi.Sprintf("@m{%s}: ", e.Path) + e.Message
+}
+
+// pathErrorf returns a PathError for path, formatting the message with ansi
+// color codes
+func pathErrorf(path string, format string, args ...interface{}) error {
+	return PathError{Path: path, Message: ansi.Sprintf(format, args...)}
+}
+
 // MergeMetadata contains information about special operators encountered during merge
 type MergeMetadata struct {
-	PrunePaths []string          // Paths that should be pruned
-	SortPaths  map[string]string // Paths that should be sorted -> sort order
+	PrunePaths []string               // Paths that should be pruned
+	SortPaths  map[string]string      // Paths that should be sorted -> sort order
+	Sources    map[string]ValueSource // Paths -> where their value was last written
+}
+
+// ValueSource describes where the value at a path of the merged document came
+// from: the file, line and column that last wrote it, and the operator call
+// that produced it, if any
+type ValueSource struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Operator string `json:"operator,omitempty"`
+}
+
+// String formats the source as file:line:column
+func (s ValueSource) String() string {
+	file := s.File
+	if file == "" {
+		file = "<unknown>"
+	}
+	if s.Line == 0 {
+		return file
+	}
+	return fmt.Sprintf("%s:%d:%d", file, s.Line, s.Column)
 }
 
 // Merger ...
 type Merger struct {
 	AppendByDefault bool
 
+	// SetOpByDefault, when union, intersect or subtract, is how lists that
+	// cannot merge by key merge by default, in place of inline or append
+	SetOpByDefault string
+
+	// DedupeByDefault collapses the entries of lists merged by key by
+	// default that have the same key
+	DedupeByDefault bool
+
+	// Strategies say how the lists and maps at given paths merge
+	Strategies []Strategy
+
+	// Tracker, when set, follows the entries of the lists the merge builds
+	// back to the lists they came from
+	Tracker *SourceTracker
+
 	Errors MultiError
 	depth  int
 
@@ -115,13 +177,15 @@ type Merger struct {
 // (3) an optional list of entries to be added or merged into the array
 type ModificationDefinition struct {
 	listOp listOp
+	dedupe bool
 
 	index    int
 	key      string
 	name     string
 	relative string
 
-	list []interface{}
+	list    []interface{}
+	indices []int // positions of the entries of list in the list they came from
 }
 
 // Merge ...
@@ -222,7 +286,7 @@ func (m *Merger) mergeMap(orig map[interface{}]interface{}, n map[interface{}]in
 	for k, val := range n {
 		path := fmt.Sprintf("%s.%v", node, k)
 		if s, ok := val.(string); ok && mergeRx.MatchString(s) {
-			m.Errors.Append(ansi.Errorf("@m{%s}: @R{inappropriate use of} @c{(( merge ))} @R{operator outside of a list} (this is @G{graft}, after all)", path))
+			m.Errors.Append(pathErrorf(path, "@R{inappropriate use of} @c{(( merge ))} @R{operator outside of a list} (this is @G{graft}, after all)"))
 		}
 
 		// Debug logging
@@ -231,7 +295,10 @@ func (m *Merger) mergeMap(orig map[interface{}]interface{}, n map[interface{}]in
 		// Note: We don't skip nil values here - in YAML, null is a valid value
 		// that should be preserved, not cause key deletion
 
-		if _, exists := orig[k]; exists {
+		if _, exists := orig[k]; exists && m.replacesMap(path, val) {
+			log.DEBUG("%s: found upstream, replacing it as the merge strategy says", path)
+			orig[k] = m.MergeObj(nil, deepCopy(val), path)
+		} else if exists {
 			log.DEBUG("%s: found upstream, merging it", path)
 			result := m.MergeObj(orig[k], val, path)
 			// Always set the result, even if nil (null is a valid YAML value)
@@ -399,12 +466,26 @@ func (m *Merger) MergeObj(orig interface{}, n interface{}, node string) interfac
 
 func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []interface{} {
 	modificationDefinitions := getArrayModifications(n, isSimpleList(orig))
+
+	// Lists without operators of their own merge as their strategy says
+	strategy := m.strategyFor(node)
+	if strategy != nil && len(modificationDefinitions) == 1 {
+		if mods := strategy.modifications(n); mods != nil {
+			log.DEBUG("%s: merging list as the merge strategy for %s says", node, strategy.Path)
+			modificationDefinitions = mods
+		}
+	}
 	log.DEBUG("%s: performing %d modification operations against list", node, len(modificationDefinitions))
 	log.DEBUG("%s: original list has %d items, new list has %d items", node, len(orig), len(n))
 
 	// Create a copy of orig for the (multiple) modifications that are about to happen
 	result := make([]interface{}, len(orig))
 	copy(result, orig)
+	from := m.origins(func() []ListOrigin { return identityOrigins(len(orig)) })
+
+	// Set once a merge on key has collapsed duplicate entries, which leaves
+	// none for the strategy's dedupe to drop
+	collapsed := false
 
 	// Process the modifications definitions that were found in the new list
 	for i, modificationDefinition := range modificationDefinitions {
@@ -420,7 +501,9 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 		if modificationDefinition.listOp == listOpMergeDefault {
 			// Skip default merge if the list is empty (all entries were operators)
 			if len(modificationDefinitions[0].list) > 0 {
-				result = m.mergeArrayDefault(orig, modificationDefinitions[0].list, node)
+				var origins []ListOrigin
+				result, origins = m.mergeArrayDefault(orig, modificationDefinitions[0].list, node)
+				from = m.follow(from, modificationDefinition.indices, func() []ListOrigin { return origins })
 			}
 			continue
 		}
@@ -441,13 +524,35 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 				return nil
 			}
 
-			result = m.mergeArrayByKey(result, modificationDefinition.list, node, key)
+			prev, list := result, modificationDefinition.list
+			if modificationDefinition.dedupe {
+				result = m.collapseByKey(result, node, key)
+				list = m.collapseByKey(list, node, key)
+				collapsed = true
+			}
+			result = m.mergeArrayByKey(result, list, node, key)
+			from = m.follow(from, modificationDefinition.indices, func() []ListOrigin {
+				return keyedOrigins(result, prev, modificationDefinition.list, key)
+			})
+			continue
+		}
+
+		// Perform a union, intersect or subtract list modification
+		if name := setOperationName(modificationDefinition.listOp); name != "" {
+			log.DEBUG("%s: performing %s of %d and %d entries", node, name, len(result), len(modificationDefinition.list))
+			prev := result
+			result = setOperation(modificationDefinition.listOp, result, modificationDefinition.list)
+			from = m.follow(from, modificationDefinition.indices, func() []ListOrigin {
+				return valueOrigins(result, prev, modificationDefinition.list)
+			})
 			continue
 		}
 
 		// Perform a merge inline list modification
 		if modificationDefinition.listOp == listOpMergeInline {
-			result = m.mergeArrayInline(result, modificationDefinition.list, node)
+			var origins []ListOrigin
+			result, origins = m.mergeArrayInline(result, modificationDefinition.list, node)
+			from = m.follow(from, modificationDefinition.indices, func() []ListOrigin { return origins })
 			continue
 		}
 
@@ -455,6 +560,9 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 		if modificationDefinition.listOp == listOpReplace {
 			result = make([]interface{}, len(modificationDefinition.list))
 			copy(result, modificationDefinition.list)
+			from = m.follow(from, modificationDefinition.indices, func() []ListOrigin {
+				return insertOrigins(0, 0, len(result))
+			})
 			continue
 		}
 
@@ -473,14 +581,14 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 			if delete {
 				// Sanity check for delete operation, ensure no orphan entries follow the operator definition
 				if len(modificationDefinition.list) > 0 {
-					m.Errors.Append(ansi.Errorf("@m{%s}: @R{item in array directly after} @c{(( delete \"%s\" ))} @r{must be one of the array operators 'append', 'prepend', 'delete', or 'insert'}", node, name))
+					m.Errors.Append(pathErrorf(node, "@R{item in array directly after} @c{(( delete \"%s\" ))} @r{must be one of the array operators 'append', 'prepend', 'delete', or 'insert'}", name))
 					return nil
 				}
 
 				// Look up the index of the specified insertion point (based on solely on its name)
 				idx = getIndexOfSimpleEntry(result, name)
 				if idx < 0 {
-					m.Errors.Append(ansi.Errorf("@m{%s}: @R{unable to find specified modification point with} @c{'%s'}", node, name))
+					m.Errors.Append(pathErrorf(node, "@R{unable to find specified modification point with} @c{'%s'}", name))
 					return nil
 				}
 			}
@@ -510,14 +618,14 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 					obj := entry.(map[interface{}]interface{})
 					entryName := obj[key].(string)
 					if getIndexOfEntry(result, key, entryName) > 0 {
-						m.Errors.Append(ansi.Errorf("@m{%s}: @R{unable to insert, because new list entry} @c{'%s: %s'} @R{is detected multiple times}", node, key, entryName))
+						m.Errors.Append(pathErrorf(node, "@R{unable to insert, because new list entry} @c{'%s: %s'} @R{is detected multiple times}", key, entryName))
 						return nil
 					}
 				}
 			} else {
 				// Sanity check for delete operation, ensure no orphan entries follow the operator definition
 				if len(modificationDefinition.list) > 0 {
-					m.Errors.Append(ansi.Errorf("@m{%s}: @R{item in array directly after} @c{(( delete %s \"%s\" ))} @r{must be one of the array operators 'append', 'prepend', 'delete', or 'insert'}", node, key, name))
+					m.Errors.Append(pathErrorf(node, "@R{item in array directly after} @c{(( delete %s \"%s\" ))} @r{must be one of the array operators 'append', 'prepend', 'delete', or 'insert'}", key, name))
 					return nil
 				}
 			}
@@ -525,7 +633,7 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 			// Look up the index of the specified insertion point (based on its key/name)
 			idx = getIndexOfEntry(result, key, name)
 			if idx < 0 {
-				m.Errors.Append(ansi.Errorf("@m{%s}: @R{unable to find specified modification point with} @c{'%s: %s'}", node, key, name))
+				m.Errors.Append(pathErrorf(node, "@R{unable to find specified modification point with} @c{'%s: %s'}", key, name))
 				return nil
 			}
 		}
@@ -537,25 +645,54 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 
 		// Back out if idx is smaller than 0, or greater than the length (for inserts), or greater/equal than the length (for deletes)
 		if (idx < 0) || (modificationDefinition.listOp != listOpDelete && idx > len(result)) || (modificationDefinition.listOp == listOpDelete && idx >= len(result)) {
-			m.Errors.Append(ansi.Errorf("@m{%s}: @R{unable to modify the list, because specified index} @c{%d} @R{is out of bounds}", node, idx))
+			m.Errors.Append(pathErrorf(node, "@R{unable to modify the list, because specified index} @c{%d} @R{is out of bounds}", idx))
 			return nil
 		}
 
 		if modificationDefinition.listOp != listOpDelete {
 			log.DEBUG("%s: inserting %d new elements to existing array at index %d", node, len(modificationDefinition.list), idx)
+			from = m.follow(from, modificationDefinition.indices, func() []ListOrigin {
+				return insertOrigins(len(result), idx, len(modificationDefinition.list))
+			})
 			result = insertIntoList(result, idx, modificationDefinition.list)
 		} else {
 			log.DEBUG("%s: deleting element at array index %d", node, idx)
+			from = m.follow(from, nil, func() []ListOrigin { return deleteOrigins(len(result), idx) })
 			result = deleteIndexFromList(result, idx)
 		}
 	}
 
+	if strategy != nil && strategy.Dedupe && !collapsed {
+		prev := result
+		result = dedupe(result, node)
+		from = m.follow(from, nil, func() []ListOrigin { return valueOrigins(result, prev, nil) })
+	}
+
+	m.Tracker.Track(result, orig, n, from)
 	return result
 }
 
+// follow composes the origins of the result of a list modification with
+// from, the origins of the list it modified, when the merger tracks sources.
+// indices are the positions of the entries the modification brought in.
+func (m *Merger) follow(from []ListOrigin, indices []int, origins func() []ListOrigin) []ListOrigin {
+	if m.Tracker == nil {
+		return nil
+	}
+	return composeOrigins(from, origins(), indices)
+}
+
+// origins returns the origins of a merged list, when the merger tracks sources
+func (m *Merger) origins(origins func() []ListOrigin) []ListOrigin {
+	if m.Tracker == nil {
+		return nil
+	}
+	return origins()
+}
+
 // The magic which chooses to merge, append, or inline based on the contents of
 // the array
-func (m *Merger) mergeArrayDefault(orig []interface{}, n []interface{}, node string) []interface{} {
+func (m *Merger) mergeArrayDefault(orig []interface{}, n []interface{}, node string) ([]interface{}, []ListOrigin) {
 	log.DEBUG("%s: performing index-based array merge", node)
 	log.DEBUG("%s: mergeArrayDefault - orig len=%d, new len=%d", node, len(orig), len(n))
 	var err error
@@ -563,27 +700,41 @@ func (m *Merger) mergeArrayDefault(orig []interface{}, n []interface{}, node str
 
 	if err = canKeyMergeArray("original", orig, node, key); err == nil {
 		if err = canKeyMergeArray("new", n, node, key); err == nil {
-			return m.mergeArrayByKey(orig, n, node, key)
+			var result []interface{}
+			if m.DedupeByDefault {
+				result = m.mergeArrayByKey(m.collapseByKey(orig, node, key), m.collapseByKey(n, node, key), node, key)
+			} else {
+				result = m.mergeArrayByKey(orig, n, node, key)
+			}
+			return result, m.origins(func() []ListOrigin { return keyedOrigins(result, orig, n, key) })
 		}
 	}
 
+	setOp, isSetOp := setOperationNamed(m.SetOpByDefault)
+
 	//Warn the user about any unintuitive behavior that may have gotten us here.
 	if warning, isWarning := err.(WarningError); isWarning && warning.HasContext(eContextDefaultMerge) {
 		mergeStratStr := "inline"
-		if m.AppendByDefault {
+		if isSetOp {
+			mergeStratStr = m.SetOpByDefault
+		} else if m.AppendByDefault {
 			mergeStratStr = "append"
 		}
 		warning.Warn()
 		NewWarningError(eContextDefaultMerge, "@Y{Falling back to %s merge strategy}", mergeStratStr).Warn()
 	}
 
+	if isSetOp {
+		result := setOperation(setOp, orig, n)
+		return result, m.origins(func() []ListOrigin { return valueOrigins(result, orig, n) })
+	}
 	if m.AppendByDefault {
-		return append(orig, n...)
+		return append(orig, n...), insertOrigins(len(orig), len(orig), len(n))
 	}
 	return m.mergeArrayInline(orig, n, node)
 }
 
-func (m *Merger) mergeArrayInline(orig []interface{}, n []interface{}, node string) []interface{} {
+func (m *Merger) mergeArrayInline(orig []interface{}, n []interface{}, node string) ([]interface{}, []ListOrigin) {
 	log.DEBUG("%s: mergeArrayInline - orig=%v (len=%d), new=%v (len=%d)", node, orig, len(orig), n, len(n))
 	pruneRx := regexp.MustCompile(`^\s*\Q((\E\s*prune\s*\Q))\E`)
 
@@ -596,73 +747,46 @@ func (m *Merger) mergeArrayInline(orig []interface{}, n []interface{}, node stri
 		}
 	}
 
-	// Merge arrays with prune handling
+	// Merge arrays with prune handling, noting where each merged entry came from
 	merged := make([]interface{}, 0, len(orig)+len(n))
+	origins := make([]ListOrigin, 0, len(orig)+len(n))
 
-	// When we have prune operators, we need to handle the merge differently
-	if len(prunedIndices) > 0 {
-		log.DEBUG("%s: handling array merge with %d prune operators, orig len=%d, new len=%d", node, len(prunedIndices), len(orig), len(n))
-		// Process all elements, but skip those marked for pruning
-		for i := 0; i < len(orig); i++ {
-			log.DEBUG("%s: processing original element at index %d", node, i)
-			// Check if this index is being pruned by the new array
-			if i < len(n) && prunedIndices[i] {
-				log.DEBUG("%s: skipping element at index %d due to prune operator", node, i)
-				// Skip this element entirely - it's being pruned
-				continue
-			}
-
-			// If there's a corresponding element in the new array (and it's not a prune), merge them
-			if i < len(n) && !prunedIndices[i] {
-				path := fmt.Sprintf("%s.%d", node, len(merged))
-				mergedItem := m.MergeObj(orig[i], n[i], path)
-				merged = append(merged, mergedItem)
-			} else {
-				// No corresponding element in new array, keep the original
-				log.DEBUG("%s: keeping original element at index %d (no corresponding new element)", node, i)
-				merged = append(merged, orig[i])
-			}
-		}
-
-		// Add any additional elements from the new array that are beyond the original array's length
-		for i := len(orig); i < len(n); i++ {
-			if !prunedIndices[i] {
-				path := fmt.Sprintf("%s.%d", node, i)
-				mergedItem := m.MergeObj(nil, n[i], path)
-				merged = append(merged, mergedItem)
-			}
-		}
-	} else {
-		// No prune operators, use the standard merge logic
-		// Process elements that exist in both arrays
-		for i := 0; i < len(orig) && i < len(n); i++ {
-			path := fmt.Sprintf("%s.%d", node, i)
-			mergedItem := m.MergeObj(orig[i], n[i], path)
-			merged = append(merged, mergedItem)
+	// Process elements that exist in the original array, skipping those the
+	// new array prunes
+	for i := 0; i < len(orig); i++ {
+		if i < len(n) && prunedIndices[i] {
+			log.DEBUG("%s: skipping element at index %d due to prune operator", node, i)
+			continue
 		}
 
-		// Process remaining elements from original array (if any)
-		for i := len(n); i < len(orig); i++ {
+		// If there's a corresponding element in the new array, merge them
+		if i < len(n) {
+			path := fmt.Sprintf("%s.%d", node, len(merged))
+			merged = append(merged, m.MergeObj(orig[i], n[i], path))
+			origins = append(origins, ListOrigin{Orig: i, New: i})
+		} else {
+			log.DEBUG("%s: keeping original element at index %d (no corresponding new element)", node, i)
 			merged = append(merged, orig[i])
+			origins = append(origins, ListOrigin{Orig: i, New: -1})
 		}
+	}
 
-		// Process remaining elements from new array (if any)
-		for i := len(orig); i < len(n); i++ {
-			path := fmt.Sprintf("%s.%d", node, i)
-
-			// If this index should be pruned, skip it
-			if prunedIndices[i] {
-				log.DEBUG("%s: pruning list entry at index %d", path, i)
-				continue
-			}
+	// Process remaining elements from new array (if any)
+	for i := len(orig); i < len(n); i++ {
+		path := fmt.Sprintf("%s.%d", node, i)
 
-			log.DEBUG("%s: appending new data to existing array", path)
-			mergedItem := m.MergeObj(nil, n[i], path)
-			merged = append(merged, mergedItem)
+		// If this index should be pruned, skip it
+		if prunedIndices[i] {
+			log.DEBUG("%s: pruning list entry at index %d", path, i)
+			continue
 		}
+
+		log.DEBUG("%s: appending new data to existing array", path)
+		merged = append(merged, m.MergeObj(nil, n[i], path))
+		origins = append(origins, ListOrigin{Orig: -1, New: i})
 	}
 
-	return merged
+	return merged, origins
 }
 
 func (m *Merger) mergeArrayByKey(orig []interface{}, n []interface{}, node string, key string) []interface{} {
@@ -722,6 +846,7 @@ func getArrayModifications(obj []interface{}, simpleList bool) []ModificationDef
 	mergeRegEx := regexp.MustCompile("^\\Q((\\E\\s*merge\\s*\\Q))\\E$")
 	mergeOnKeyRegEx := regexp.MustCompile("^\\Q((\\E\\s*merge\\s+(on)\\s+(.+)\\s*\\Q))\\E$")
 	replaceRegEx := regexp.MustCompile("^\\Q((\\E\\s*replace\\s*\\Q))\\E$")
+	setOpRegEx := regexp.MustCompile("^\\Q((\\E\\s*(union|intersect|subtract)\\s*\\Q))\\E$")
 	inlineRegEx := regexp.MustCompile("^\\Q((\\E\\s*inline\\s*\\Q))\\E$")
 	appendRegEx := regexp.MustCompile("^\\Q((\\E\\s*append\\s*\\Q))\\E$")
 	prependRegEx := regexp.MustCompile("^\\Q((\\E\\s*prepend\\s*\\Q))\\E$")
@@ -731,7 +856,7 @@ func getArrayModifications(obj []interface{}, simpleList bool) []ModificationDef
 	deleteByNameRegEx := regexp.MustCompile("^\\Q((\\E\\s*delete\\s+([^ ]+)?\\s*\"(.+)\"\\s*\\Q))\\E$")
 	deleteByNameUnquotedRegEx := regexp.MustCompile("^\\Q((\\E\\s*delete\\s+([^ ]+)?\\s*(.+)\\s*\\Q))\\E$")
 
-	for _, entry := range obj {
+	for i, entry := range obj {
 		e, isString := entry.(string)
 		switch {
 		case !isString:
@@ -748,7 +873,12 @@ func getArrayModifications(obj []interface{}, simpleList bool) []ModificationDef
 			 */
 			if captures := mergeOnKeyRegEx.FindStringSubmatch(e); len(captures) == 3 {
 				key := strings.TrimSpace(captures[2])
-				result = append(result, ModificationDefinition{listOp: listOpMergeOnKey, key: key})
+				// (( merge on "key" dedupe )) collapses entries with the same key
+				dedupe := false
+				if fields := strings.Fields(key); len(fields) == 2 && fields[1] == "dedupe" {
+					key, dedupe = fields[0], true
+				}
+				result = append(result, ModificationDefinition{listOp: listOpMergeOnKey, key: key, dedupe: dedupe})
 				continue
 			}
 
@@ -760,6 +890,11 @@ func getArrayModifications(obj []interface{}, simpleList bool) []ModificationDef
 			result = append(result, ModificationDefinition{listOp: listOpReplace})
 			continue
 
+		case setOpRegEx.MatchString(e): // check for (( union )), (( intersect )) and (( subtract ))
+			op, _ := setOperationNamed(setOpRegEx.FindStringSubmatch(e)[1])
+			result = append(result, ModificationDefinition{listOp: op})
+			continue
+
 		case appendRegEx.MatchString(e): // check for (( append ))
 			result = append(result, ModificationDefinition{listOp: listOpInsert, index: -1})
 			continue
@@ -867,11 +1002,18 @@ func getArrayModifications(obj []interface{}, simpleList bool) []ModificationDef
 
 		// Add the current entry to the 'current' modification definition record (gathering the list)
 		result[lastResultIdx].list = append(result[lastResultIdx].list, entry)
+		result[lastResultIdx].indices = append(result[lastResultIdx].indices, i)
 	}
 
 	return result
 }
 
+// IsArrayOperator reports whether entry, an element of list, is a well-formed
+// array modification operator such as (( append )) or (( insert after "x" ))
+func IsArrayOperator(list []interface{}, entry string) bool {
+	return len(getArrayModifications([]interface{}{entry}, isSimpleList(list))) > 1
+}
+
 func isSimpleList(list []interface{}) bool {
 	log.DEBUG("Going to validate if this is a simple list: %v", list)
 
@@ -915,15 +1057,15 @@ func canKeyMergeArray(disp string, array []interface{}, node string, key string)
 
 	for i, o := range array {
 		if o == nil {
-			return ansi.Errorf("@m{%s.%d}: @R{%s object is nil - cannot merge by key}", node, i, disp)
+			return pathErrorf(fmt.Sprintf("%s.%d", node, i), "@R{%s object is nil - cannot merge by key}", disp)
 		}
 		if reflect.TypeOf(o).Kind() != reflect.Map {
-			return ansi.Errorf("@m{%s.%d}: @R{%s object is a} @c{%s}@R{, not a} @c{map} @R{- cannot merge by key}", node, i, disp, reflect.TypeOf(o).Kind().String())
+			return pathErrorf(fmt.Sprintf("%s.%d", node, i), "@R{%s object is a} @c{%s}@R{, not a} @c{map} @R{- cannot merge by key}", disp, reflect.TypeOf(o).Kind().String())
 		}
 
 		obj := o.(map[interface{}]interface{})
 		if _, ok := obj[key]; !ok {
-			return ansi.Errorf("@m{%s.%d}: @R{%s object does not contain the key} @c{'%s'}@R{ - cannot merge by key}", node, i, disp, key)
+			return pathErrorf(fmt.Sprintf("%s.%d", node, i), "@R{%s object does not contain the key} @c{'%s'}@R{ - cannot merge by key}", disp, key)
 		}
 
 		//Verify that the target key has a hashable value (i.e. a value that is not itself a hash or sequence)
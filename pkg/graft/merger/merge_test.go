@@ -10,6 +10,7 @@ import (
 	"github.com/geofffranks/simpleyaml"
 	"github.com/wayneeseguin/graft/internal/utils/ansi"
 	"github.com/wayneeseguin/graft/internal/utils/tree"
+	"github.com/wayneeseguin/graft/log"
 )
 
 func TestShouldKeyMergeArrayOfHashes(t *testing.T) {
@@ -196,6 +197,34 @@ func TestGetArrayModifications(t *testing.T) {
 			}
 		})
 
+		Convey("(( union )), (( intersect )) and (( subtract ))", func() {
+			for input, op := range map[string]listOp{
+				"(( union ))":       listOpUnion,
+				"((intersect))":     listOpIntersect,
+				"((  subtract  ))":  listOpSubtract,
+				"(( union all ))":   listOpMergeDefault,
+				"(( subtraction ))": listOpMergeDefault,
+			} {
+				Convey(fmt.Sprintf("with case %s", input), func() {
+					results := getArrayModifications([]interface{}{input}, true)
+					So(results[0], shouldBeDefault)
+					So(results[len(results)-1].listOp, ShouldEqual, op)
+				})
+			}
+		})
+
+		Convey("(( merge on <key> dedupe ))", func() {
+			results := getArrayModifications([]interface{}{"(( merge on id dedupe ))"}, false)
+			So(results, ShouldHaveLength, 2)
+			So(results[1], shouldBeMergeOnKey)
+			So(results[1].key, ShouldEqual, "id")
+			So(results[1].dedupe, ShouldBeTrue)
+
+			results = getArrayModifications([]interface{}{"(( merge on id ))"}, false)
+			So(results[1].key, ShouldEqual, "id")
+			So(results[1].dedupe, ShouldBeFalse)
+		})
+
 		Convey("(( append ))", func() {
 			//append test cases go here
 			for input, shouldMatch := range map[string]bool{
@@ -1155,7 +1184,7 @@ func TestMergeArray(t *testing.T) {
 			expect := []interface{}{expectMapSlice}
 
 			m := &Merger{}
-			o := m.mergeArrayInline(orig, array, "node-path")
+			o, _ := m.mergeArrayInline(orig, array, "node-path")
 			err := m.Error()
 			So(o, ShouldResemble, expect)
 			So(err, ShouldBeNil)
@@ -2221,3 +2250,215 @@ top_replace:
 
 	})
 }
+
+func TestSourceTracker(t *testing.T) {
+	Convey("SourceTracker", t, func() {
+		base := map[string]ValueSource{
+			"list":   {File: "base.yml", Line: 1, Column: 1},
+			"list.0": {File: "base.yml", Line: 1, Column: 9},
+			"name":   {File: "base.yml", Line: 2, Column: 1},
+		}
+		src := func(sources map[string]ValueSource, path string) string {
+			s, ok := sources[path]
+			if !ok {
+				return "<none>"
+			}
+			return s.String()
+		}
+		merge := func(list []interface{}, overlay map[string]ValueSource) map[string]ValueSource {
+			tracker := NewSourceTracker()
+			m := &Merger{Tracker: tracker}
+			root := map[interface{}]interface{}{"list": []interface{}{"a"}, "name": "x"}
+			So(m.Merge(root, map[interface{}]interface{}{"list": list}), ShouldBeNil)
+			return tracker.Sources(root, base, overlay)
+		}
+
+		Convey("records appended entries under their merged index", func() {
+			sources := merge([]interface{}{"(( append ))", "b", "c"}, map[string]ValueSource{
+				"list":   {File: "prod.yml", Line: 1, Column: 1},
+				"list.0": {File: "prod.yml", Line: 2, Column: 3},
+				"list.1": {File: "prod.yml", Line: 3, Column: 3},
+				"list.2": {File: "prod.yml", Line: 4, Column: 3},
+			})
+			So(src(sources, "list"), ShouldEqual, "prod.yml:1:1")
+			So(src(sources, "list.0"), ShouldEqual, "base.yml:1:9")
+			So(src(sources, "list.1"), ShouldEqual, "prod.yml:3:3")
+			So(src(sources, "list.2"), ShouldEqual, "prod.yml:4:3")
+			So(src(sources, "name"), ShouldEqual, "base.yml:2:1")
+		})
+
+		Convey("moves the original entries along when entries are prepended", func() {
+			sources := merge([]interface{}{"(( prepend ))", "z"}, map[string]ValueSource{
+				"list":   {File: "prod.yml", Line: 1, Column: 1},
+				"list.0": {File: "prod.yml", Line: 2, Column: 3},
+				"list.1": {File: "prod.yml", Line: 3, Column: 3},
+			})
+			So(src(sources, "list.0"), ShouldEqual, "prod.yml:3:3")
+			So(src(sources, "list.1"), ShouldEqual, "base.yml:1:9")
+		})
+
+		Convey("credits entries merged inline to the overlay", func() {
+			sources := merge([]interface{}{"(( inline ))", "y", "z"}, map[string]ValueSource{
+				"list":   {File: "prod.yml", Line: 1, Column: 1},
+				"list.0": {File: "prod.yml", Line: 2, Column: 3},
+				"list.1": {File: "prod.yml", Line: 3, Column: 3},
+				"list.2": {File: "prod.yml", Line: 4, Column: 3},
+			})
+			So(src(sources, "list.0"), ShouldEqual, "prod.yml:3:3")
+			So(src(sources, "list.1"), ShouldEqual, "prod.yml:4:3")
+			So(src(sources, "list.2"), ShouldEqual, "<none>")
+		})
+
+		Convey("formats sources as file:line:column", func() {
+			So(ValueSource{File: "prod.yml", Line: 4, Column: 3}.String(), ShouldEqual, "prod.yml:4:3")
+			So(ValueSource{File: "STDIN"}.String(), ShouldEqual, "STDIN")
+			So(ValueSource{}.String(), ShouldEqual, "<unknown>")
+		})
+	})
+}
+
+func TestIsArrayOperator(t *testing.T) {
+	Convey("IsArrayOperator", t, func() {
+		named := []interface{}{map[interface{}]interface{}{"name": "web"}}
+		simple := []interface{}{"a", "b"}
+
+		So(IsArrayOperator(named, `(( append ))`), ShouldBeTrue)
+		So(IsArrayOperator(named, `(( insert after "web" ))`), ShouldBeTrue)
+		So(IsArrayOperator(named, `(( delete "web" ))`), ShouldBeTrue)
+		So(IsArrayOperator(simple, `(( insert after 1 ))`), ShouldBeTrue)
+
+		So(IsArrayOperator(named, `(( insert after ))`), ShouldBeFalse)
+		So(IsArrayOperator(named, `(( apend ))`), ShouldBeFalse)
+		So(IsArrayOperator(named, `plain string`), ShouldBeFalse)
+	})
+}
+
+func TestMergeStrategies(t *testing.T) {
+	Convey("Merger.Strategies", t, func() {
+		m := &Merger{Strategies: []Strategy{
+			{Path: "jobs", Key: "id"},
+			{Path: "jobs.*.networks", List: "replace"},
+			{Path: "**.cidrs", List: "append", Dedupe: true},
+			{Path: "meta.tags", Map: "replace"},
+		}}
+		orig := map[interface{}]interface{}{
+			"jobs": []interface{}{
+				map[interface{}]interface{}{"id": "web", "networks": []interface{}{"default", "public"}},
+			},
+			"meta": map[interface{}]interface{}{
+				"cidrs": []interface{}{"10.0.0.0/8", "192.168.0.0/16"},
+				"tags":  map[interface{}]interface{}{"team": "web", "tier": "frontend"},
+			},
+		}
+		n := map[interface{}]interface{}{
+			"jobs": []interface{}{
+				map[interface{}]interface{}{"id": "db"},
+				map[interface{}]interface{}{"id": "web", "networks": []interface{}{"private"}},
+			},
+			"meta": map[interface{}]interface{}{
+				"cidrs": []interface{}{"192.168.0.0/16", "172.16.0.0/12"},
+				"tags":  map[interface{}]interface{}{"team": "platform"},
+			},
+		}
+
+		Convey("merges lists and maps as the strategy for their path says", func() {
+			So(m.Merge(orig, n), ShouldBeNil)
+			So(orig["jobs"], ShouldResemble, []interface{}{
+				map[interface{}]interface{}{"id": "web", "networks": []interface{}{"private"}},
+				map[interface{}]interface{}{"id": "db"},
+			})
+			meta := orig["meta"].(map[interface{}]interface{})
+			So(meta["cidrs"], ShouldResemble, []interface{}{"10.0.0.0/8", "192.168.0.0/16", "172.16.0.0/12"})
+			So(meta["tags"], ShouldResemble, map[interface{}]interface{}{"team": "platform"})
+		})
+
+		Convey("lets array operators in the overlay win", func() {
+			n["meta"].(map[interface{}]interface{})["cidrs"] = []interface{}{"(( replace ))", "0.0.0.0/0"}
+			So(m.Merge(orig, n), ShouldBeNil)
+			So(orig["meta"].(map[interface{}]interface{})["cidrs"], ShouldResemble, []interface{}{"0.0.0.0/0"})
+		})
+
+		Convey("fails to merge on a key the entries do not have", func() {
+			n["jobs"] = []interface{}{map[interface{}]interface{}{"name": "db"}}
+			err := m.Merge(orig, n)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "new object does not contain the key")
+		})
+	})
+}
+
+func TestSetOperations(t *testing.T) {
+	Convey("Set operations on lists", t, func() {
+		orig := map[interface{}]interface{}{
+			"cidrs": []interface{}{"10.0.0.0/8", "192.168.0.0/16", "10.0.0.0/8"},
+		}
+		merge := func(m *Merger, n ...interface{}) []interface{} {
+			o := deepCopy(orig).(map[interface{}]interface{})
+			So(m.Merge(o, map[interface{}]interface{}{"cidrs": n}), ShouldBeNil)
+			return o["cidrs"].([]interface{})
+		}
+
+		Convey("(( union )) keeps every distinct entry once", func() {
+			So(merge(&Merger{}, "(( union ))", "192.168.0.0/16", "172.16.0.0/12", "172.16.0.0/12"),
+				ShouldResemble, []interface{}{"10.0.0.0/8", "192.168.0.0/16", "172.16.0.0/12"})
+		})
+
+		Convey("(( intersect )) keeps the entries found in both lists", func() {
+			So(merge(&Merger{}, "(( intersect ))", "192.168.0.0/16", "172.16.0.0/12"),
+				ShouldResemble, []interface{}{"192.168.0.0/16"})
+		})
+
+		Convey("(( subtract )) removes the entries of the new list", func() {
+			So(merge(&Merger{}, "(( subtract ))", "192.168.0.0/16"),
+				ShouldResemble, []interface{}{"10.0.0.0/8"})
+		})
+
+		Convey("SetOpByDefault applies to lists without operators", func() {
+			So(merge(&Merger{SetOpByDefault: "union"}, "172.16.0.0/12"),
+				ShouldResemble, []interface{}{"10.0.0.0/8", "192.168.0.0/16", "172.16.0.0/12"})
+		})
+
+		Convey("merge strategies can name them", func() {
+			m := &Merger{Strategies: []Strategy{{Path: "cidrs", List: "subtract"}}}
+			So(merge(m, "10.0.0.0/8"), ShouldResemble, []interface{}{"192.168.0.0/16"})
+		})
+	})
+
+	Convey("(( merge on <key> dedupe ))", t, func() {
+		var stderr string
+		printfStdErr := log.PrintfStdErr
+		Reset(func() { log.PrintfStdErr = printfStdErr })
+		log.PrintfStdErr = func(format string, args ...interface{}) {
+			stderr += fmt.Sprintf(format, args...)
+		}
+		ansi.Color(false)
+
+		orig := map[interface{}]interface{}{
+			"jobs": []interface{}{
+				map[interface{}]interface{}{"id": "web", "instances": 2},
+				map[interface{}]interface{}{"id": "db"},
+				map[interface{}]interface{}{"id": "web", "azs": []interface{}{"z1"}},
+			},
+		}
+		n := map[interface{}]interface{}{
+			"jobs": []interface{}{
+				"(( merge on id dedupe ))",
+				map[interface{}]interface{}{"id": "web", "instances": 4},
+				map[interface{}]interface{}{"id": "worker"},
+				map[interface{}]interface{}{"id": "worker", "instances": 1},
+			},
+		}
+
+		Convey("collapses entries with the same key, with a warning", func() {
+			So((&Merger{}).Merge(orig, n), ShouldBeNil)
+			So(orig["jobs"], ShouldResemble, []interface{}{
+				map[interface{}]interface{}{"id": "web", "instances": 4, "azs": []interface{}{"z1"}},
+				map[interface{}]interface{}{"id": "db"},
+				map[interface{}]interface{}{"id": "worker", "instances": 1},
+			})
+			So(stderr, ShouldEqual, ""+
+				"warning: $.jobs: collapsing duplicate list entries with id: web\n"+
+				"warning: $.jobs: collapsing duplicate list entries with id: worker\n")
+		})
+	})
+}
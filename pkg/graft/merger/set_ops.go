@@ -0,0 +1,100 @@
+package merger
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/wayneeseguin/graft/log"
+)
+
+// setOperation returns the union, intersection or difference of the lists
+// orig and n. Entries are compared by value, and each appears only once in
+// the result, in the order it was first seen.
+func setOperation(op listOp, orig []interface{}, n []interface{}) []interface{} {
+	switch op {
+	case listOpUnion:
+		return dedupe(append(append([]interface{}{}, orig...), n...), "")
+	case listOpIntersect:
+		var result []interface{}
+		for _, entry := range orig {
+			if containsEntry(n, entry) {
+				result = append(result, entry)
+			}
+		}
+		return dedupe(result, "")
+	case listOpSubtract:
+		var result []interface{}
+		for _, entry := range orig {
+			if !containsEntry(n, entry) {
+				result = append(result, entry)
+			}
+		}
+		return dedupe(result, "")
+	}
+	return orig
+}
+
+// setOperationName names a set operation for log and error messages
+func setOperationName(op listOp) string {
+	switch op {
+	case listOpUnion:
+		return "union"
+	case listOpIntersect:
+		return "intersect"
+	case listOpSubtract:
+		return "subtract"
+	}
+	return ""
+}
+
+// setOperationNamed returns the set operation called name
+func setOperationNamed(name string) (listOp, bool) {
+	for _, op := range []listOp{listOpUnion, listOpIntersect, listOpSubtract} {
+		if setOperationName(op) == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+func containsEntry(list []interface{}, entry interface{}) bool {
+	for _, other := range list {
+		if reflect.DeepEqual(other, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupe returns list without the entries equal to one before them
+func dedupe(list []interface{}, node string) []interface{} {
+	result := make([]interface{}, 0, len(list))
+	for _, entry := range list {
+		if containsEntry(result, entry) {
+			log.DEBUG("%s: dropping duplicate list entry %v", node, entry)
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// collapseByKey merges the entries of list that have the same value for key
+// into the first of them, warning about each one it collapses. The entries
+// must all be maps holding key.
+func (m *Merger) collapseByKey(list []interface{}, node string, key string) []interface{} {
+	result := make([]interface{}, 0, len(list))
+	seen := map[interface{}]int{}
+	for _, entry := range list {
+		obj := entry.(map[interface{}]interface{})
+		i, duplicate := seen[obj[key]]
+		if !duplicate {
+			seen[obj[key]] = len(result)
+			result = append(result, entry)
+			continue
+		}
+		NewWarningError(eContextAll, "@m{%s}: @Y{collapsing duplicate list entries with} @c{%s: %v}", node, key, obj[key]).Warn()
+		result[i] = m.MergeObj(deepCopy(result[i]), obj, fmt.Sprintf("%s.%v", node, obj[key]))
+	}
+	return result
+}
@@ -0,0 +1,216 @@
+package merger
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/wayneeseguin/graft/internal/utils/tree"
+)
+
+// SourceTracker follows the entries of the lists a merge builds back to the
+// lists they came from, so that once the merge is done the source of every
+// value can be recorded under the path it ended up at
+type SourceTracker struct {
+	lists map[*interface{}][]entrySource
+}
+
+// entrySource names the entries a merged list entry came from, in the list
+// merged into and in the list merged in
+type entrySource struct {
+	orig, new       string
+	fromOrig, fromN bool
+}
+
+// ListOrigin says where an entry of a merged list came from: its index in
+// the list merged into and in the list merged in, or -1 for neither
+type ListOrigin struct {
+	Orig, New int
+}
+
+// NewSourceTracker returns a tracker with no lists recorded
+func NewSourceTracker() *SourceTracker {
+	return &SourceTracker{lists: make(map[*interface{}][]entrySource)}
+}
+
+// Track notes that list, the result of merging n into orig, has entries that
+// came from the ones origins points at
+func (t *SourceTracker) Track(list, orig, n []interface{}, origins []ListOrigin) {
+	if t == nil || len(list) == 0 || len(list) != len(origins) {
+		return
+	}
+	entries := make([]entrySource, len(origins))
+	for i, o := range origins {
+		if o.Orig >= 0 {
+			entries[i].orig, entries[i].fromOrig = entryName(orig[o.Orig], o.Orig), true
+		}
+		if o.New >= 0 {
+			entries[i].new, entries[i].fromN = entryName(n[o.New], o.New), true
+		}
+	}
+	t.lists[&list[0]] = entries
+}
+
+// Sources returns where each value of root, the result of merging a document
+// with the sources overlay into one with the sources base, was last written
+func (t *SourceTracker) Sources(root map[interface{}]interface{}, base, overlay map[string]ValueSource) map[string]ValueSource {
+	sources := make(map[string]ValueSource)
+
+	record := func(path, orig, n string, fromOrig, fromN bool) (bool, bool) {
+		_, inOrig := base[orig]
+		_, inN := overlay[n]
+		inOrig, inN = inOrig && fromOrig, inN && fromN
+		if inN {
+			sources[path] = overlay[n]
+		} else if inOrig {
+			sources[path] = base[orig]
+		}
+		return inOrig, inN
+	}
+
+	var walk func(value interface{}, path, orig, n string, fromOrig, fromN bool)
+	walk = func(value interface{}, path, orig, n string, fromOrig, fromN bool) {
+		switch v := value.(type) {
+		case map[interface{}]interface{}:
+			for k, val := range v {
+				key := fmt.Sprintf("%v", k)
+				sub, subOrig, subN := joinPath(path, key), joinPath(orig, key), joinPath(n, key)
+				inOrig, inN := record(sub, subOrig, subN, fromOrig, fromN)
+				walk(val, sub, subOrig, subN, inOrig, inN)
+			}
+
+		case []interface{}:
+			var entries []entrySource
+			if t != nil && len(v) > 0 && len(t.lists[&v[0]]) == len(v) {
+				entries = t.lists[&v[0]]
+			}
+			for i, entry := range v {
+				name := entryName(entry, i)
+				// Lists the merge did not build are as the document that last
+				// wrote them had them
+				e := entrySource{orig: name, new: name, fromOrig: !fromN, fromN: fromN}
+				if entries != nil {
+					e = entries[i]
+				}
+				sub, subOrig, subN := joinPath(path, name), joinPath(orig, e.orig), joinPath(n, e.new)
+				inOrig, inN := record(sub, subOrig, subN, fromOrig && e.fromOrig, fromN && e.fromN)
+				walk(entry, sub, subOrig, subN, inOrig, inN)
+			}
+		}
+	}
+	walk(root, "", "", "", true, true)
+	return sources
+}
+
+// entryName is how sources address a list entry: by its name, if it has one,
+// and by its index otherwise
+func entryName(entry interface{}, i int) string {
+	if obj, ok := entry.(map[interface{}]interface{}); ok {
+		for _, field := range tree.NameFields {
+			if name, ok := obj[field].(string); ok {
+				return name
+			}
+		}
+	}
+	return strconv.Itoa(i)
+}
+
+// joinPath appends a component to a dotted path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	if key == "" {
+		return path
+	}
+	return path + "." + key
+}
+
+// composeOrigins maps the origins of a list modification's result, which
+// point into the list it modified and the entries it brought in, back to
+// the lists the merge started from. from holds the origins of the modified
+// list, and indices the positions of the entries brought in.
+func composeOrigins(from []ListOrigin, origins []ListOrigin, indices []int) []ListOrigin {
+	composed := make([]ListOrigin, len(origins))
+	for i, o := range origins {
+		composed[i] = ListOrigin{Orig: -1, New: -1}
+		if o.Orig >= 0 {
+			composed[i] = from[o.Orig]
+		}
+		if o.New >= 0 {
+			composed[i].New = indices[o.New]
+		}
+	}
+	return composed
+}
+
+// identityOrigins returns the origins of a list left as it was
+func identityOrigins(n int) []ListOrigin {
+	return insertOrigins(n, n, 0)
+}
+
+// insertOrigins returns the origins of a list of size entries with count
+// entries inserted at idx
+func insertOrigins(size, idx, count int) []ListOrigin {
+	origins := make([]ListOrigin, 0, size+count)
+	for i := 0; i < idx; i++ {
+		origins = append(origins, ListOrigin{Orig: i, New: -1})
+	}
+	for i := 0; i < count; i++ {
+		origins = append(origins, ListOrigin{Orig: -1, New: i})
+	}
+	for i := idx; i < size; i++ {
+		origins = append(origins, ListOrigin{Orig: i, New: -1})
+	}
+	return origins
+}
+
+// deleteOrigins returns the origins of a list of size entries with the one
+// at idx deleted
+func deleteOrigins(size, idx int) []ListOrigin {
+	origins := identityOrigins(size)
+	return append(origins[:idx], origins[idx+1:]...)
+}
+
+// keyedOrigins returns the origins of result, a merge on key of n into orig
+func keyedOrigins(result, orig, n []interface{}, key string) []ListOrigin {
+	indexOf := func(list []interface{}, name interface{}) int {
+		for i, entry := range list {
+			if obj, ok := entry.(map[interface{}]interface{}); ok && obj[key] == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	origins := make([]ListOrigin, len(result))
+	for i, entry := range result {
+		origins[i] = ListOrigin{Orig: -1, New: -1}
+		if obj, ok := entry.(map[interface{}]interface{}); ok {
+			origins[i] = ListOrigin{Orig: indexOf(orig, obj[key]), New: indexOf(n, obj[key])}
+		}
+	}
+	return origins
+}
+
+// valueOrigins returns the origins of result, whose entries are each the
+// first equal one of orig or, failing that, of n
+func valueOrigins(result, orig, n []interface{}) []ListOrigin {
+	indexOf := func(list []interface{}, entry interface{}) int {
+		for i, other := range list {
+			if reflect.DeepEqual(other, entry) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	origins := make([]ListOrigin, len(result))
+	for i, entry := range result {
+		origins[i] = ListOrigin{Orig: indexOf(orig, entry), New: -1}
+		if origins[i].Orig < 0 {
+			origins[i].New = indexOf(n, entry)
+		}
+	}
+	return origins
+}
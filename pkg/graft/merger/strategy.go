@@ -0,0 +1,72 @@
+package merger
+
+import (
+	"github.com/wayneeseguin/graft/internal/utils/pathglob"
+)
+
+// Strategy says how the lists and maps at the paths matching Path merge,
+// so that the overlays do not need array operators to say it themselves.
+// Operators found in an overlay list still take precedence.
+type Strategy struct {
+	Path string // a pattern, as matched by pathglob.MatchExact
+
+	List   string // merge, inline, append, prepend, replace, union, intersect or subtract
+	Key    string // the key lists of maps merge on
+	Dedupe bool   // drop list entries equal to one before them, or collapse those with the same key when merging on it
+
+	Map string // merge, or replace to not deep-merge maps
+}
+
+// strategyFor returns the first strategy whose path matches node
+func (m *Merger) strategyFor(node string) *Strategy {
+	for i := range m.Strategies {
+		if pathglob.MatchExact(m.Strategies[i].Path, node) {
+			return &m.Strategies[i]
+		}
+	}
+	return nil
+}
+
+// replacesMap reports whether a strategy replaces the map at node, rather
+// than merging val into it
+func (m *Merger) replacesMap(node string, val interface{}) bool {
+	switch val.(type) {
+	case map[interface{}]interface{}, map[string]interface{}:
+		s := m.strategyFor(node)
+		return s != nil && s.Map == "replace"
+	}
+	return false
+}
+
+// modifications returns the list modification the strategy makes in place
+// of the default merge of list n, or nil if it leaves that to the default
+func (s *Strategy) modifications(n []interface{}) []ModificationDefinition {
+	var mod ModificationDefinition
+	switch {
+	case s.List == "merge" || (s.List == "" && s.Key != ""):
+		key := s.Key
+		if key == "" {
+			key = getDefaultIdentifierKey()
+		}
+		mod = ModificationDefinition{listOp: listOpMergeOnKey, key: key, dedupe: s.Dedupe}
+	case s.List == "inline":
+		mod = ModificationDefinition{listOp: listOpMergeInline}
+	case s.List == "append":
+		mod = ModificationDefinition{listOp: listOpInsert, index: -1}
+	case s.List == "prepend":
+		mod = ModificationDefinition{listOp: listOpInsert, index: 0}
+	case s.List == "replace":
+		mod = ModificationDefinition{listOp: listOpReplace}
+	default:
+		op, ok := setOperationNamed(s.List)
+		if !ok {
+			return nil
+		}
+		mod = ModificationDefinition{listOp: op}
+	}
+	mod.list = n
+	for i := range n {
+		mod.indices = append(mod.indices, i)
+	}
+	return []ModificationDefinition{{listOp: listOpMergeDefault}, mod}
+}
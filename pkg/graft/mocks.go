@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
 	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 	vaultkv "github.com/cloudfoundry-community/vaultkv"
+	"github.com/cppforlife/go-patch/patch"
 )
 
 // Mock implementations for testing
@@ -23,6 +24,8 @@ type MockEngine struct {
 	MergeFilesFunc         func(ctx context.Context, paths ...string) MergeBuilder
 	MergeReadersFunc       func(ctx context.Context, readers ...io.Reader) MergeBuilder
 	EvaluateFunc           func(ctx context.Context, doc Document) (Document, error)
+	DiffFunc               func(from, to Document, options DiffOptions) ([]DiffChange, error)
+	GoPatchFunc            func(from, to Document) (patch.Ops, error)
 	ToYAMLFunc             func(doc Document) ([]byte, error)
 	ToJSONFunc             func(doc Document) ([]byte, error)
 	ToJSONIndentFunc       func(doc Document, indent string) ([]byte, error)
@@ -44,6 +47,13 @@ type MockEngine struct {
 	MergeFilesCalls   [][]string
 	MergeReadersCalls [][]io.Reader
 	EvaluateCalls     []Document
+	DiffCalls         []struct {
+		From, To Document
+		Options  DiffOptions
+	}
+	GoPatchCalls []struct {
+		From, To Document
+	}
 	ToYAMLCalls       []Document
 	ToJSONCalls       []Document
 	ToJSONIndentCalls []struct {
@@ -75,6 +85,8 @@ func NewMockEngine() *MockEngine {
 		MergeFilesFunc:         func(ctx context.Context, paths ...string) MergeBuilder { return &MockMergeBuilder{} },
 		MergeReadersFunc:       func(ctx context.Context, readers ...io.Reader) MergeBuilder { return &MockMergeBuilder{} },
 		EvaluateFunc:           func(ctx context.Context, doc Document) (Document, error) { return doc, nil },
+		DiffFunc:               func(from, to Document, options DiffOptions) ([]DiffChange, error) { return nil, nil },
+		GoPatchFunc:            func(from, to Document) (patch.Ops, error) { return patch.Ops{}, nil },
 		ToYAMLFunc:             func(doc Document) ([]byte, error) { return []byte{}, nil },
 		ToJSONFunc:             func(doc Document) ([]byte, error) { return []byte{}, nil },
 		ToJSONIndentFunc:       func(doc Document, indent string) ([]byte, error) { return []byte{}, nil },
@@ -128,6 +140,21 @@ func (m *MockEngine) Evaluate(ctx context.Context, doc Document) (Document, erro
 	return m.EvaluateFunc(ctx, doc)
 }
 
+func (m *MockEngine) Diff(from, to Document, options DiffOptions) ([]DiffChange, error) {
+	m.DiffCalls = append(m.DiffCalls, struct {
+		From, To Document
+		Options  DiffOptions
+	}{from, to, options})
+	return m.DiffFunc(from, to, options)
+}
+
+func (m *MockEngine) GoPatch(from, to Document) (patch.Ops, error) {
+	m.GoPatchCalls = append(m.GoPatchCalls, struct {
+		From, To Document
+	}{from, to})
+	return m.GoPatchFunc(from, to)
+}
+
 func (m *MockEngine) ToYAML(doc Document) ([]byte, error) {
 	m.ToYAMLCalls = append(m.ToYAMLCalls, doc)
 	return m.ToYAMLFunc(doc)
@@ -213,6 +240,8 @@ type MockDocument struct {
 	PruneFunc              func(key string) Document
 	CherryPickFunc         func(keys ...string) Document
 	GetDataFunc            func() interface{}
+	ProvenanceFunc         func(path string) (ValueSource, bool)
+	TaintedFunc            func() map[string]TaintSource
 
 	// Call tracking
 	GetCalls                []string
@@ -239,6 +268,8 @@ type MockDocument struct {
 	PruneCalls      []string
 	CherryPickCalls [][]string
 	GetDataCalls    int
+	ProvenanceCalls []string
+	TaintedCalls    int
 
 	// Test data
 	TestData map[string]interface{}
@@ -266,6 +297,8 @@ func NewMockDocument() *MockDocument {
 		ToJSONFunc:             func() ([]byte, error) { return []byte{}, nil },
 		RawDataFunc:            func() interface{} { return make(map[interface{}]interface{}) },
 		GetDataFunc:            func() interface{} { return make(map[interface{}]interface{}) },
+		ProvenanceFunc:         func(path string) (ValueSource, bool) { return ValueSource{}, false },
+		TaintedFunc:            func() map[string]TaintSource { return map[string]TaintSource{} },
 	}
 	// Self-referential functions need to be set after creation
 	m.DeepCopyFunc = func() Document { return NewMockDocument() }
@@ -384,25 +417,52 @@ func (m *MockDocument) GetData() interface{} {
 	return m.GetDataFunc()
 }
 
+func (m *MockDocument) Provenance(path string) (ValueSource, bool) {
+	m.ProvenanceCalls = append(m.ProvenanceCalls, path)
+	return m.ProvenanceFunc(path)
+}
+
+func (m *MockDocument) Tainted() map[string]TaintSource {
+	m.TaintedCalls++
+	return m.TaintedFunc()
+}
+
 // MockMergeBuilder provides a mock implementation of MergeBuilder for testing
 type MockMergeBuilder struct {
 	// Control behavior
 	WithPruneFunc              func(keys ...string) MergeBuilder
 	WithCherryPickFunc         func(keys ...string) MergeBuilder
 	WithArrayMergeStrategyFunc func(strategy ArrayMergeStrategy) MergeBuilder
+	WithMergeStrategiesFunc    func(strategies ...MergeStrategy) MergeBuilder
 	SkipEvaluationFunc         func() MergeBuilder
 	EnableGoPatchFunc          func() MergeBuilder
+	WithPatchFunc              func(data []byte, format PatchFormat) MergeBuilder
 	FallbackAppendFunc         func() MergeBuilder
+	PreserveOrderFunc          func() MergeBuilder
+	PreserveCommentsFunc       func() MergeBuilder
+	WithTraceFunc              func(trace *EvalTrace) MergeBuilder
+	RedactFunc                 func() MergeBuilder
+	WithRedactorFunc           func(redactor Redactor) MergeBuilder
 	ExecuteFunc                func() (Document, error)
 
 	// Call tracking
 	WithPruneCalls              [][]string
 	WithArrayMergeStrategyCalls []ArrayMergeStrategy
+	WithMergeStrategiesCalls    [][]MergeStrategy
 	WithCherryPickCalls         [][]string
 	SkipEvaluationCalls         int
 	EnableGoPatchCalls          int
-	FallbackAppendCalls         int
-	ExecuteCalls                int
+	WithPatchCalls              []struct {
+		Data   []byte
+		Format PatchFormat
+	}
+	FallbackAppendCalls   int
+	PreserveOrderCalls    int
+	PreserveCommentsCalls int
+	WithTraceCalls        []*EvalTrace
+	RedactCalls           int
+	WithRedactorCalls     int
+	ExecuteCalls          int
 }
 
 // NewMockMergeBuilder creates a new mock merge builder with sensible defaults
@@ -415,9 +475,16 @@ func NewMockMergeBuilder() *MockMergeBuilder {
 	mock.WithPruneFunc = func(keys ...string) MergeBuilder { return mock }
 	mock.WithCherryPickFunc = func(keys ...string) MergeBuilder { return mock }
 	mock.WithArrayMergeStrategyFunc = func(strategy ArrayMergeStrategy) MergeBuilder { return mock }
+	mock.WithMergeStrategiesFunc = func(strategies ...MergeStrategy) MergeBuilder { return mock }
 	mock.SkipEvaluationFunc = func() MergeBuilder { return mock }
 	mock.EnableGoPatchFunc = func() MergeBuilder { return mock }
+	mock.WithPatchFunc = func(data []byte, format PatchFormat) MergeBuilder { return mock }
 	mock.FallbackAppendFunc = func() MergeBuilder { return mock }
+	mock.PreserveOrderFunc = func() MergeBuilder { return mock }
+	mock.PreserveCommentsFunc = func() MergeBuilder { return mock }
+	mock.WithTraceFunc = func(trace *EvalTrace) MergeBuilder { return mock }
+	mock.RedactFunc = func() MergeBuilder { return mock }
+	mock.WithRedactorFunc = func(redactor Redactor) MergeBuilder { return mock }
 
 	return mock
 }
@@ -438,6 +505,11 @@ func (m *MockMergeBuilder) WithArrayMergeStrategy(strategy ArrayMergeStrategy) M
 	return m.WithArrayMergeStrategyFunc(strategy)
 }
 
+func (m *MockMergeBuilder) WithMergeStrategies(strategies ...MergeStrategy) MergeBuilder {
+	m.WithMergeStrategiesCalls = append(m.WithMergeStrategiesCalls, strategies)
+	return m.WithMergeStrategiesFunc(strategies...)
+}
+
 func (m *MockMergeBuilder) SkipEvaluation() MergeBuilder {
 	m.SkipEvaluationCalls++
 	return m.SkipEvaluationFunc()
@@ -448,11 +520,44 @@ func (m *MockMergeBuilder) EnableGoPatch() MergeBuilder {
 	return m.EnableGoPatchFunc()
 }
 
+func (m *MockMergeBuilder) WithPatch(data []byte, format PatchFormat) MergeBuilder {
+	m.WithPatchCalls = append(m.WithPatchCalls, struct {
+		Data   []byte
+		Format PatchFormat
+	}{data, format})
+	return m.WithPatchFunc(data, format)
+}
+
 func (m *MockMergeBuilder) FallbackAppend() MergeBuilder {
 	m.FallbackAppendCalls++
 	return m.FallbackAppendFunc()
 }
 
+func (m *MockMergeBuilder) PreserveOrder() MergeBuilder {
+	m.PreserveOrderCalls++
+	return m.PreserveOrderFunc()
+}
+
+func (m *MockMergeBuilder) PreserveComments() MergeBuilder {
+	m.PreserveCommentsCalls++
+	return m.PreserveCommentsFunc()
+}
+
+func (m *MockMergeBuilder) WithTrace(trace *EvalTrace) MergeBuilder {
+	m.WithTraceCalls = append(m.WithTraceCalls, trace)
+	return m.WithTraceFunc(trace)
+}
+
+func (m *MockMergeBuilder) Redact() MergeBuilder {
+	m.RedactCalls++
+	return m.RedactFunc()
+}
+
+func (m *MockMergeBuilder) WithRedactor(redactor Redactor) MergeBuilder {
+	m.WithRedactorCalls++
+	return m.WithRedactorFunc(redactor)
+}
+
 func (m *MockMergeBuilder) Execute() (Document, error) {
 	m.ExecuteCalls++
 	return m.ExecuteFunc()
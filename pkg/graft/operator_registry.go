@@ -96,13 +96,13 @@ var OperatorInfoRegistry = map[string]OperatorInfo{
 		Name:       "grab",
 		Precedence: PrecedenceCall,
 		MinArgs:    1,
-		MaxArgs:    1,
+		MaxArgs:    -1,
 		Phase:      EvalPhase,
 	},
 	"concat": {
 		Name:       "concat",
 		Precedence: PrecedenceCall,
-		MinArgs:    1,
+		MinArgs:    2,
 		MaxArgs:    -1,
 		Phase:      EvalPhase,
 	},
@@ -145,7 +145,7 @@ var OperatorInfoRegistry = map[string]OperatorInfo{
 		Name:       "keys",
 		Precedence: PrecedenceCall,
 		MinArgs:    1,
-		MaxArgs:    1,
+		MaxArgs:    -1,
 		Phase:      EvalPhase,
 	},
 	"stringify": {
@@ -180,7 +180,7 @@ var OperatorInfoRegistry = map[string]OperatorInfo{
 		Name:       "defer",
 		Precedence: PrecedenceCall,
 		MinArgs:    1,
-		MaxArgs:    1,
+		MaxArgs:    -1,
 		Phase:      MergePhase,
 	},
 	"param": {
@@ -197,6 +197,13 @@ var OperatorInfoRegistry = map[string]OperatorInfo{
 		MaxArgs:    -1, // unlimited args for paths with defaults
 		Phase:      EvalPhase,
 	},
+	"vault-generate": {
+		Name:       "vault-generate",
+		Precedence: PrecedenceCall,
+		MinArgs:    1, // a path, then a policy and its arguments
+		MaxArgs:    -1,
+		Phase:      EvalPhase,
+	},
 	"calc": {
 		Name:       "calc",
 		Precedence: PrecedenceCall,
@@ -207,7 +214,7 @@ var OperatorInfoRegistry = map[string]OperatorInfo{
 	"sort": {
 		Name:       "sort",
 		Precedence: PrecedenceCall,
-		MinArgs:    1,
+		MinArgs:    0,
 		MaxArgs:    2,
 		Phase:      EvalPhase,
 	},
@@ -215,13 +222,13 @@ var OperatorInfoRegistry = map[string]OperatorInfo{
 		Name:       "shuffle",
 		Precedence: PrecedenceCall,
 		MinArgs:    1,
-		MaxArgs:    2,
+		MaxArgs:    -1,
 		Phase:      EvalPhase,
 	},
 	"ips": {
 		Name:       "ips",
 		Precedence: PrecedenceCall,
-		MinArgs:    1,
+		MinArgs:    2,
 		MaxArgs:    -1,
 		Phase:      EvalPhase,
 	},
@@ -229,7 +236,7 @@ var OperatorInfoRegistry = map[string]OperatorInfo{
 		Name:       "inject",
 		Precedence: PrecedenceCall,
 		MinArgs:    1,
-		MaxArgs:    1,
+		MaxArgs:    -1,
 		Phase:      EvalPhase,
 	},
 	"load": {
@@ -242,7 +249,7 @@ var OperatorInfoRegistry = map[string]OperatorInfo{
 	"prune": {
 		Name:       "prune",
 		Precedence: PrecedenceCall,
-		MinArgs:    1,
+		MinArgs:    0,
 		MaxArgs:    -1,
 		Phase:      EvalPhase,
 	},
@@ -0,0 +1,90 @@
+package operators
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+// ExternalRef is a reference an operator makes to data kept outside of the
+// documents being merged
+type ExternalRef struct {
+	Operator   string   // the operator making the reference, e.g. awsparam
+	Target     string   // the @target of the operator call, "" for the default
+	Path       string   // what is read: a parameter, secret, nats path, file or location
+	References []string // the places in the document that call for Path
+}
+
+// externalRefs holds the references made while graft.TrackExternalRefs is
+// set, by operator, target and path
+var externalRefs = struct {
+	sync.Mutex
+	byKey map[[3]string][]string
+}{byKey: map[[3]string][]string{}}
+
+// recordExternalRef notes that the operator call being run by ev reads path,
+// when graft.TrackExternalRefs asks for it
+func recordExternalRef(ev *Evaluator, operator, path string) {
+	if !graft.TrackExternalRefs || ev == nil {
+		return
+	}
+	here := ""
+	if ev.Here != nil {
+		here = ev.Here.String()
+	}
+
+	externalRefs.Lock()
+	defer externalRefs.Unlock()
+	key := [3]string{operator, ev.Target, path}
+	for _, seen := range externalRefs.byKey[key] {
+		if seen == here {
+			return
+		}
+	}
+	externalRefs.byKey[key] = append(externalRefs.byKey[key], here)
+}
+
+// ExternalRefs returns the references tracked so far, sorted by operator,
+// target and path
+func ExternalRefs() []ExternalRef {
+	externalRefs.Lock()
+	defer externalRefs.Unlock()
+	refs := make([]ExternalRef, 0, len(externalRefs.byKey))
+	for key, heres := range externalRefs.byKey {
+		references := append([]string{}, heres...)
+		sort.Strings(references)
+		refs = append(refs, ExternalRef{Operator: key[0], Target: key[1], Path: key[2], References: references})
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Operator != refs[j].Operator {
+			return refs[i].Operator < refs[j].Operator
+		}
+		if refs[i].Target != refs[j].Target {
+			return refs[i].Target < refs[j].Target
+		}
+		return refs[i].Path < refs[j].Path
+	})
+	return refs
+}
+
+// ResetExternalRefs forgets the references tracked so far
+func ResetExternalRefs() {
+	externalRefs.Lock()
+	defer externalRefs.Unlock()
+	externalRefs.byKey = map[[3]string][]string{}
+}
+
+// AwsTargetRegion returns the region the awsparam and awssecret calls to
+// targetName read from, as far as it can be told without AWS, or "" when the
+// region is left to the AWS SDK
+func AwsTargetRegion(targetName string) string {
+	if targetName == "" {
+		return defaultAwsTarget().Region
+	}
+	config, err := awsTargetPool.getTargetConfig(targetName)
+	if err != nil {
+		return ""
+	}
+	return config.Region
+}
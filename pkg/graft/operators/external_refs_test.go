@@ -0,0 +1,80 @@
+package operators
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/geofffranks/simpleyaml"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+func TestExternalRefs(t *testing.T) {
+	YAML := func(s string) map[interface{}]interface{} {
+		y, err := simpleyaml.NewYaml([]byte(s))
+		So(err, ShouldBeNil)
+
+		data, err := y.Map()
+		So(err, ShouldBeNil)
+
+		return data
+	}
+	merge := func(doc string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: YAML(doc)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	Convey("external references are recorded without contacting the services", t, func() {
+		dir, err := os.MkdirTemp("", "graft-refs")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		motd := filepath.Join(dir, "motd.txt")
+		So(os.WriteFile(motd, []byte("hello"), 0600), ShouldBeNil)
+
+		SkipAws, SkipNats, SkipRemoteLoads, SkipFileReads = true, true, true, true
+		graft.TrackExternalRefs = true
+		defer func() {
+			SkipAws, SkipNats, SkipRemoteLoads, SkipFileReads = false, false, false, false
+			graft.TrackExternalRefs = false
+		}()
+		ResetExternalRefs()
+
+		tree, err := merge(`
+meta:
+  env: prod
+  motd: ` + motd + `
+param:  (( awsparam "/app/" meta.env "/db/password" ))
+secret: (( awssecret "app/db-admin?key=password" ))
+again:  (( awssecret "app/db-admin?key=username" ))
+token:  (( awssecret@prod "app/token" ))
+flags:  (( nats "kv:flags/app" ))
+motd:   (( file meta.motd ))
+gone:   (( file "/nonexistent/banner.txt" ))
+remote: (( load "https://example.com/defaults.yml" ))
+`)
+		So(err, ShouldBeNil)
+		So(tree["motd"], ShouldEqual, "REDACTED")
+		So(tree["gone"], ShouldEqual, "REDACTED")
+		So(tree["remote"], ShouldEqual, "REDACTED")
+		So(tree["flags"], ShouldEqual, "REDACTED")
+		So(ExternalRefs(), ShouldResemble, []ExternalRef{
+			{Operator: "awsparam", Target: "", Path: "/app/prod/db/password", References: []string{"param"}},
+			{Operator: "awssecret", Target: "", Path: "app/db-admin", References: []string{"again", "secret"}},
+			{Operator: "awssecret", Target: "prod", Path: "app/token", References: []string{"token"}},
+			{Operator: "file", Target: "", Path: "/nonexistent/banner.txt", References: []string{"gone"}},
+			{Operator: "file", Target: "", Path: motd, References: []string{"motd"}},
+			{Operator: "load", Target: "", Path: "https://example.com/defaults.yml", References: []string{"remote"}},
+			{Operator: "nats", Target: "", Path: "kv:flags/app", References: []string{"flags"}},
+		})
+
+		Convey("and only while tracking is asked for", func() {
+			graft.TrackExternalRefs = false
+			ResetExternalRefs()
+			_, err := merge(`param: (( awsparam "/app/db/password" ))`)
+			So(err, ShouldBeNil)
+			So(ExternalRefs(), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,288 @@
+package operators
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/geofffranks/yaml"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+)
+
+// RecordedLookup is a value an operator looked up outside of the documents
+// being merged, as recorded by --record and served back by --replay
+type RecordedLookup struct {
+	Operator string      `yaml:"operator"`
+	Target   string      `yaml:"target,omitempty"`
+	Key      string      `yaml:"key"`
+	Value    interface{} `yaml:"value,omitempty"`
+	Sealed   string      `yaml:"sealed,omitempty"`  // the value, encrypted
+	Missing  bool        `yaml:"missing,omitempty"` // the lookup found nothing
+}
+
+// lookupRecording is a file of recorded lookups. When values are sealed, the
+// file says how to derive the key that opens them from a passphrase.
+type lookupRecording struct {
+	Format     int               `yaml:"graft_lookups"`
+	Encryption *lookupEncryption `yaml:"encryption,omitempty"`
+	Lookups    []RecordedLookup  `yaml:"lookups"`
+}
+
+type lookupEncryption struct {
+	Cipher     string `yaml:"cipher"`
+	KDF        string `yaml:"kdf"`
+	Iterations int    `yaml:"iterations"`
+	Salt       string `yaml:"salt"`
+}
+
+const lookupRecordingFormat = 1
+
+// secretLookupOperators are the operators whose values are sealed when a
+// recording is encrypted
+var secretLookupOperators = []string{"vault", "awsparam", "awssecret"}
+
+// lookupRecorder holds the lookups made while recording, by operator,
+// target and key
+var lookupRecorder = struct {
+	sync.Mutex
+	on      bool
+	lookups map[[3]string]RecordedLookup
+}{lookups: map[[3]string]RecordedLookup{}}
+
+// lookupReplay holds the lookups being served back, by operator, target and
+// key. It is nil unless replaying.
+var lookupReplay map[[3]string]RecordedLookup
+
+// StartRecordingLookups records the lookups made from now on, forgetting
+// those recorded before
+func StartRecordingLookups() {
+	lookupRecorder.Lock()
+	defer lookupRecorder.Unlock()
+	lookupRecorder.on = true
+	lookupRecorder.lookups = map[[3]string]RecordedLookup{}
+}
+
+// StopRecordingLookups stops recording lookups
+func StopRecordingLookups() {
+	lookupRecorder.Lock()
+	defer lookupRecorder.Unlock()
+	lookupRecorder.on = false
+}
+
+// RecordedLookups returns the lookups recorded so far, sorted by operator,
+// target and key
+func RecordedLookups() []RecordedLookup {
+	lookupRecorder.Lock()
+	defer lookupRecorder.Unlock()
+	lookups := make([]RecordedLookup, 0, len(lookupRecorder.lookups))
+	for _, lookup := range lookupRecorder.lookups {
+		lookups = append(lookups, lookup)
+	}
+	sort.Slice(lookups, func(i, j int) bool {
+		if lookups[i].Operator != lookups[j].Operator {
+			return lookups[i].Operator < lookups[j].Operator
+		}
+		if lookups[i].Target != lookups[j].Target {
+			return lookups[i].Target < lookups[j].Target
+		}
+		return lookups[i].Key < lookups[j].Key
+	})
+	return lookups
+}
+
+// recordLookup notes that operator found value, or nothing if missing, for
+// key on targetName, when recording
+func recordLookup(operator, targetName, key string, value interface{}, missing bool) {
+	lookupRecorder.Lock()
+	defer lookupRecorder.Unlock()
+	if !lookupRecorder.on {
+		return
+	}
+	lookup := RecordedLookup{Operator: operator, Target: targetName, Key: key, Missing: missing}
+	if !missing {
+		lookup.Value = value
+	}
+	lookupRecorder.lookups[[3]string{operator, targetName, key}] = lookup
+}
+
+// ReplayLookups serves lookups back in place of Vault, AWS, NATS and remote
+// load locations, or stops doing so when lookups is nil
+func ReplayLookups(lookups []RecordedLookup) {
+	if lookups == nil {
+		lookupReplay = nil
+		return
+	}
+	lookupReplay = make(map[[3]string]RecordedLookup, len(lookups))
+	for _, lookup := range lookups {
+		lookupReplay[[3]string{lookup.Operator, lookup.Target, lookup.Key}] = lookup
+	}
+}
+
+// replaying tells whether lookups are being served back
+func replaying() bool {
+	return lookupReplay != nil
+}
+
+// lookupNotRecordedError is returned when replaying a lookup that was not
+// recorded. It is never taken for a missing secret.
+type lookupNotRecordedError struct {
+	operator, target, key string
+}
+
+func (e lookupNotRecordedError) Error() string {
+	operator := e.operator
+	if e.target != "" {
+		operator += "@" + e.target
+	}
+	return ansi.Sprintf("@R{no} @c{%s} @R{lookup of} @c{%s} @R{was recorded; record the merge again with} @m{--record}", operator, e.key)
+}
+
+// isLookupNotRecorded tells whether err is a replayed lookup that was not
+// recorded
+func isLookupNotRecorded(err error) bool {
+	_, ok := err.(lookupNotRecordedError)
+	return ok
+}
+
+// replayLookup serves back what operator found for key on targetName. A
+// lookup that found nothing returns missing. Lookups that are served back
+// are recorded again, so a replay can be recorded anew.
+func replayLookup(operator, targetName, key string) (value interface{}, missing bool, err error) {
+	lookup, ok := lookupReplay[[3]string{operator, targetName, key}]
+	if !ok {
+		return nil, false, lookupNotRecordedError{operator: operator, target: targetName, key: key}
+	}
+	recordLookup(operator, targetName, key, lookup.Value, lookup.Missing)
+	return lookup.Value, lookup.Missing, nil
+}
+
+// replayLookupString serves back a lookup whose value is a string
+func replayLookupString(operator, targetName, key string) (string, error) {
+	value, missing, err := replayLookup(operator, targetName, key)
+	if err != nil {
+		return "", err
+	}
+	if missing {
+		return "", fmt.Errorf("%s not found", key)
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// MarshalLookups writes lookups as a recording. With a passphrase, the
+// values of vault, awsparam and awssecret lookups are sealed with
+// AES-256-GCM; the operators, targets and keys stay readable.
+func MarshalLookups(lookups []RecordedLookup, passphrase string) ([]byte, error) {
+	recording := lookupRecording{Format: lookupRecordingFormat, Lookups: lookups}
+	if passphrase == "" {
+		return yaml.Marshal(recording)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := passphraseCipher(passphrase, salt, secretBundleIterations)
+	if err != nil {
+		return nil, err
+	}
+	recording.Encryption = &lookupEncryption{
+		Cipher:     secretBundleCipher,
+		KDF:        secretBundleKDF,
+		Iterations: secretBundleIterations,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+	}
+
+	recording.Lookups = make([]RecordedLookup, len(lookups))
+	for i, lookup := range lookups {
+		if !lookup.Missing && containsString(secretLookupOperators, lookup.Operator) {
+			plain, err := yaml.Marshal(lookup.Value)
+			if err != nil {
+				return nil, err
+			}
+			nonce := make([]byte, gcm.NonceSize())
+			if _, err := rand.Read(nonce); err != nil {
+				return nil, err
+			}
+			lookup.Sealed = base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil))
+			lookup.Value = nil
+		}
+		recording.Lookups[i] = lookup
+	}
+	return yaml.Marshal(recording)
+}
+
+// UnmarshalLookups reads a recording, opening sealed values with passphrase
+func UnmarshalLookups(data []byte, passphrase string) ([]RecordedLookup, error) {
+	var recording lookupRecording
+	if err := yaml.Unmarshal(data, &recording); err != nil || recording.Format == 0 {
+		return nil, fmt.Errorf("not a recording of lookups")
+	}
+	if recording.Format != lookupRecordingFormat {
+		return nil, fmt.Errorf("unsupported recording of lookups (format %d)", recording.Format)
+	}
+	if recording.Lookups == nil {
+		recording.Lookups = []RecordedLookup{}
+	}
+	if recording.Encryption == nil {
+		return recording.Lookups, nil
+	}
+
+	enc := recording.Encryption
+	if enc.Cipher != secretBundleCipher || enc.KDF != secretBundleKDF {
+		return nil, fmt.Errorf("unsupported encryption of recorded lookups (%s, %s)", enc.Cipher, enc.KDF)
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("the recorded lookups are encrypted; set GRAFT_SECRETS_KEY or GRAFT_SECRETS_KEY_FILE to their passphrase")
+	}
+	salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("the recorded lookups are corrupt")
+	}
+	gcm, err := passphraseCipher(passphrase, salt, enc.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, lookup := range recording.Lookups {
+		if lookup.Sealed == "" {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(lookup.Sealed)
+		if err != nil || len(sealed) < gcm.NonceSize() {
+			return nil, fmt.Errorf("the recorded %s lookup of %s is corrupt", lookup.Operator, lookup.Key)
+		}
+		plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt the recorded lookups; wrong passphrase?")
+		}
+		var value interface{}
+		if err := yaml.Unmarshal(plain, &value); err != nil {
+			return nil, err
+		}
+		recording.Lookups[i].Value, recording.Lookups[i].Sealed = value, ""
+	}
+	return recording.Lookups, nil
+}
+
+// LoadLookups reads the recording at path, opening sealed values with
+// passphrase
+func LoadLookups(path, passphrase string) ([]RecordedLookup, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - the recording is named by the user
+	if err != nil {
+		return nil, ansi.Errorf("@R{unable to read recorded lookups} @c{%s}: %s", path, err)
+	}
+	lookups, err := UnmarshalLookups(data, passphrase)
+	if err != nil {
+		return nil, ansi.Errorf("@R{unable to load recorded lookups} @c{%s}: %s", path, err)
+	}
+	return lookups, nil
+}
@@ -0,0 +1,117 @@
+package operators
+
+import (
+	"testing"
+
+	"github.com/geofffranks/simpleyaml"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLookupRecording(t *testing.T) {
+	YAML := func(s string) map[interface{}]interface{} {
+		y, err := simpleyaml.NewYaml([]byte(s))
+		So(err, ShouldBeNil)
+
+		data, err := y.Map()
+		So(err, ShouldBeNil)
+
+		return data
+	}
+	merge := func(doc string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: YAML(doc)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	doc := `
+password: (( vault "secret/db:password" ))
+fallback: (( vault "secret/missing:password" || "default" ))
+param:    (( awsparam "/app/db/host" ))
+token:    (( awssecret@production "app/token?stage=AWSCURRENT" ))
+`
+	recorded := []RecordedLookup{
+		{Operator: "awsparam", Key: "/app/db/host", Value: "db.example.com"},
+		{Operator: "awssecret", Target: "production", Key: "app/token?stage=AWSCURRENT", Value: "prod-token"},
+		{Operator: "vault", Key: "secret/db:password", Value: "hunter2"},
+		{Operator: "vault", Key: "secret/missing:password", Missing: true},
+	}
+
+	Convey("lookups", t, func() {
+		defer StopRecordingLookups()
+		defer ReplayLookups(nil)
+
+		Convey("are recorded with their operator, target and key", func() {
+			bundle, err := ParseSecretBundle([]byte(`
+vault:
+  secret/db: {password: hunter2}
+awsparam:
+  /app/db/host: db.example.com
+targets:
+  production:
+    awssecret:
+      app/token: prod-token
+`), "")
+			So(err, ShouldBeNil)
+			UseSecretBundle(bundle)
+			defer UseSecretBundle(nil)
+
+			StartRecordingLookups()
+			_, err = merge(doc)
+			So(err, ShouldBeNil)
+			So(RecordedLookups(), ShouldResemble, recorded)
+		})
+
+		Convey("are served back without vault or AWS", func() {
+			ReplayLookups(recorded)
+			tree, err := merge(doc)
+			So(err, ShouldBeNil)
+			So(tree["password"], ShouldEqual, "hunter2")
+			So(tree["fallback"], ShouldEqual, "default")
+			So(tree["param"], ShouldEqual, "db.example.com")
+			So(tree["token"], ShouldEqual, "prod-token")
+		})
+
+		Convey("that were not recorded fail a replay, defaults or not", func() {
+			ReplayLookups(recorded)
+			_, err := merge(`x: (( vault "secret/other:password" || "default" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no vault lookup of secret/other:password was recorded")
+
+			_, err = merge(`x: (( awssecret "app/token" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no awssecret lookup of app/token was recorded")
+
+			_, err = merge(`x: (( nats "kv:flags/app" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no nats lookup of kv:flags/app was recorded")
+		})
+
+		Convey("can be saved with their secret values encrypted", func() {
+			withNats := append([]RecordedLookup{{Operator: "nats", Key: "kv:flags/app", Value: "on"}}, recorded...)
+			data, err := MarshalLookups(withNats, "correct horse")
+			So(err, ShouldBeNil)
+			So(string(data), ShouldNotContainSubstring, "hunter2")
+			So(string(data), ShouldNotContainSubstring, "prod-token")
+			So(string(data), ShouldContainSubstring, "key: secret/db:password")
+			So(string(data), ShouldContainSubstring, "value: \"on\"")
+
+			lookups, err := UnmarshalLookups(data, "correct horse")
+			So(err, ShouldBeNil)
+			So(lookups, ShouldResemble, withNats)
+
+			_, err = UnmarshalLookups(data, "battery staple")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "wrong passphrase")
+
+			_, err = UnmarshalLookups(data, "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "set GRAFT_SECRETS_KEY")
+
+			plain, err := MarshalLookups(recorded, "")
+			So(err, ShouldBeNil)
+			lookups, err = UnmarshalLookups(plain, "")
+			So(err, ShouldBeNil)
+			So(lookups, ShouldResemble, recorded)
+		})
+	})
+}
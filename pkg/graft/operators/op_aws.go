@@ -2,6 +2,7 @@ package operators
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"strconv"
@@ -168,7 +169,9 @@ func (acp *AwsClientPool) GetParameterStoreClient(targetName string) (ssmiface.S
 	return client, nil
 }
 
-// getTargetConfig retrieves target configuration from environment variables
+// getTargetConfig resolves a target from its declaration in the graft
+// configuration, if there is one, overridden by AWS_<TARGET>_* environment
+// variables
 func (acp *AwsClientPool) getTargetConfig(targetName string) (*AwsTarget, error) {
 	// Check if we have cached config
 	acp.mu.RLock()
@@ -178,41 +181,43 @@ func (acp *AwsClientPool) getTargetConfig(targetName string) (*AwsTarget, error)
 	}
 	acp.mu.RUnlock()
 
+	config := &AwsTarget{
+		MaxRetries:         3,
+		HTTPTimeout:        30 * time.Second,
+		CacheTTL:           5 * time.Minute,
+		AssumeRoleDuration: 1 * time.Hour,
+		SessionName:        "graft-" + targetName,
+	}
+	if def, ok := definedAwsTarget(targetName); ok {
+		overlayTarget(config, def)
+	}
+
 	// Use environment variables with target suffix
 	envPrefix := fmt.Sprintf("AWS_%s_", strings.ToUpper(targetName))
-
-	// Check if any AWS target-specific environment variables are set
-	region := os.Getenv(envPrefix + "REGION")
-	profile := os.Getenv(envPrefix + "PROFILE")
-	role := os.Getenv(envPrefix + "ROLE")
-	accessKeyID := os.Getenv(envPrefix + "ACCESS_KEY_ID")
-
-	// Require at least one target-specific configuration
-	if region == "" && profile == "" && role == "" && accessKeyID == "" {
-		return nil, fmt.Errorf("AWS target '%s' configuration incomplete (expected %sREGION, %sPROFILE, %sROLE, or %sACCESS_KEY_ID environment variable)",
+	config.Region = getEnvOrDefault(envPrefix+"REGION", config.Region)
+	config.Profile = getEnvOrDefault(envPrefix+"PROFILE", config.Profile)
+	config.Role = getEnvOrDefault(envPrefix+"ROLE", config.Role)
+	config.AccessKeyID = getEnvOrDefault(envPrefix+"ACCESS_KEY_ID", config.AccessKeyID)
+	config.SecretAccessKey = getEnvOrDefault(envPrefix+"SECRET_ACCESS_KEY", config.SecretAccessKey)
+	config.SessionToken = getEnvOrDefault(envPrefix+"SESSION_TOKEN", config.SessionToken)
+	config.Endpoint = getEnvOrDefault(envPrefix+"ENDPOINT", config.Endpoint)
+	config.S3ForcePathStyle = parseBoolOrDefault(os.Getenv(envPrefix+"S3_FORCE_PATH_STYLE"), config.S3ForcePathStyle)
+	config.DisableSSL = parseBoolOrDefault(os.Getenv(envPrefix+"DISABLE_SSL"), config.DisableSSL)
+	config.MaxRetries = parseIntOrDefault(os.Getenv(envPrefix+"MAX_RETRIES"), config.MaxRetries)
+	config.HTTPTimeout = parseDurationOrDefault(os.Getenv(envPrefix+"HTTP_TIMEOUT"), config.HTTPTimeout)
+	config.CacheTTL = parseDurationOrDefault(os.Getenv(envPrefix+"CACHE_TTL"), config.CacheTTL)
+	config.AssumeRoleDuration = parseDurationOrDefault(os.Getenv(envPrefix+"ASSUME_ROLE_DURATION"), config.AssumeRoleDuration)
+	config.ExternalID = getEnvOrDefault(envPrefix+"EXTERNAL_ID", config.ExternalID)
+	config.SessionName = getEnvOrDefault(envPrefix+"SESSION_NAME", config.SessionName)
+	config.MfaSerial = getEnvOrDefault(envPrefix+"MFA_SERIAL", config.MfaSerial)
+	config.AuditLogging = parseBoolOrDefault(os.Getenv(envPrefix+"AUDIT_LOGGING"), config.AuditLogging)
+
+	// Require at least one way of choosing the account to talk to
+	if config.Region == "" && config.Profile == "" && config.Role == "" && config.AccessKeyID == "" {
+		return nil, fmt.Errorf("AWS target '%s' configuration incomplete (declare it under targets.aws, or set %sREGION, %sPROFILE, %sROLE, or %sACCESS_KEY_ID)",
 			targetName, envPrefix, envPrefix, envPrefix, envPrefix)
 	}
 
-	config := &AwsTarget{
-		Region:             getEnvOrDefault(envPrefix+"REGION", ""),
-		Profile:            getEnvOrDefault(envPrefix+"PROFILE", ""),
-		Role:               getEnvOrDefault(envPrefix+"ROLE", ""),
-		AccessKeyID:        getEnvOrDefault(envPrefix+"ACCESS_KEY_ID", ""),
-		SecretAccessKey:    getEnvOrDefault(envPrefix+"SECRET_ACCESS_KEY", ""),
-		SessionToken:       getEnvOrDefault(envPrefix+"SESSION_TOKEN", ""),
-		Endpoint:           getEnvOrDefault(envPrefix+"ENDPOINT", ""),
-		S3ForcePathStyle:   parseBoolOrDefault(getEnvOrDefault(envPrefix+"S3_FORCE_PATH_STYLE", "false"), false),
-		DisableSSL:         parseBoolOrDefault(getEnvOrDefault(envPrefix+"DISABLE_SSL", "false"), false),
-		MaxRetries:         parseIntOrDefault(getEnvOrDefault(envPrefix+"MAX_RETRIES", "3"), 3),
-		HTTPTimeout:        parseDurationOrDefault(getEnvOrDefault(envPrefix+"HTTP_TIMEOUT", "30s"), 30*time.Second),
-		CacheTTL:           parseDurationOrDefault(getEnvOrDefault(envPrefix+"CACHE_TTL", "5m"), 5*time.Minute),
-		AssumeRoleDuration: parseDurationOrDefault(getEnvOrDefault(envPrefix+"ASSUME_ROLE_DURATION", "1h"), 1*time.Hour),
-		ExternalID:         getEnvOrDefault(envPrefix+"EXTERNAL_ID", ""),
-		SessionName:        getEnvOrDefault(envPrefix+"SESSION_NAME", "graft-"+targetName),
-		MfaSerial:          getEnvOrDefault(envPrefix+"MFA_SERIAL", ""),
-		AuditLogging:       parseBoolOrDefault(getEnvOrDefault(envPrefix+"AUDIT_LOGGING", "false"), false),
-	}
-
 	return config, nil
 }
 
@@ -253,8 +258,10 @@ func (acp *AwsClientPool) createSessionFromConfig(config *AwsTarget) (*session.S
 		options.Config.MaxRetries = aws.Int(config.MaxRetries)
 	}
 
-	// Configure HTTP timeout (this would require additional configuration in practice)
-	// HTTPTimeout is not directly available in aws.Config but would be handled by custom transport
+	// Configure HTTP timeout
+	if config.HTTPTimeout > 0 {
+		options.Config.HTTPClient = &http.Client{Timeout: config.HTTPTimeout}
+	}
 
 	// Configure credentials if provided
 	if config.AccessKeyID != "" && config.SecretAccessKey != "" {
@@ -352,6 +359,14 @@ func (acp *AwsClientPool) SetSecretCache(targetName, secret, value string) {
 	acp.secretsCache[targetName][secret] = value
 }
 
+// ClearCaches forgets the cached secrets and parameters of every target
+func (acp *AwsClientPool) ClearCaches() {
+	acp.mu.Lock()
+	defer acp.mu.Unlock()
+	acp.secretsCache = make(map[string]map[string]string)
+	acp.paramsCache = make(map[string]map[string]string)
+}
+
 // SetParamCache sets a parameter value in the cache for a target
 func (acp *AwsClientPool) SetParamCache(targetName, param, value string) {
 	acp.mu.Lock()
@@ -369,11 +384,13 @@ type AwsOperator struct {
 	variant string
 }
 
-// extractTarget extracts target name from operator call (placeholder)
+// extractTarget returns the @target named by the operator call being run,
+// or "" to use the default configuration
 func (o AwsOperator) extractTarget(ev *Evaluator, args []*Expr) string {
-	// TODO: Extract target from parsed expression when parser supports it
-	// For now, return empty string to use default configuration
-	return ""
+	if ev == nil {
+		return ""
+	}
+	return ev.Target
 }
 
 // getCacheKey generates a cache key that includes target information
@@ -384,32 +401,22 @@ func (o AwsOperator) getCacheKey(target, variant, key string) string {
 	return fmt.Sprintf("%s@%s:%s", target, variant, key)
 }
 
-// initializeAwsSession will configure an AWS session with profile, region and role assume including loading shared config (e.g. ~/.aws/credentials)
-func initializeAwsSession(profile string, region string, role string) (s *session.Session, err error) {
-	options := session.Options{
-		Config:            aws.Config{},
-		SharedConfigState: session.SharedConfigEnable,
-	}
-
-	if region != "" {
-		options.Config.Region = aws.String(region)
-	}
-
-	if profile != "" {
-		options.Profile = profile
-	}
-
-	s, err = session.NewSessionWithOptions(options)
-	if err != nil {
-		return nil, err
-	}
+// defaultAwsTarget is the configuration of awsparam and awssecret calls that
+// name no target: AWS_* environment variables over the default given to
+// DefineTargets
+func defaultAwsTarget() AwsTarget {
+	definedTargets.RLock()
+	config := definedTargets.DefaultAWS
+	definedTargets.RUnlock()
 
-	if role != "" {
-		options.Config.Credentials = stscreds.NewCredentials(s, role, func(p *stscreds.AssumeRoleProvider) {})
-		s, err = session.NewSession(&options.Config)
-	}
-
-	return s, err
+	config.Region = getEnvOrDefault("AWS_REGION", config.Region)
+	config.Profile = getEnvOrDefault("AWS_PROFILE", config.Profile)
+	config.Role = getEnvOrDefault("AWS_ROLE", config.Role)
+	config.AccessKeyID = getEnvOrDefault("AWS_ACCESS_KEY_ID", config.AccessKeyID)
+	config.SecretAccessKey = getEnvOrDefault("AWS_SECRET_ACCESS_KEY", config.SecretAccessKey)
+	config.SessionToken = getEnvOrDefault("AWS_SESSION_TOKEN", config.SessionToken)
+	config.Endpoint = getEnvOrDefault("AWS_ENDPOINT", config.Endpoint)
+	return config
 }
 
 // getAwsSecret will fetch the specified secret from AWS Secretsmanager at the specified (if provided) stage / version
@@ -479,6 +486,11 @@ func (AwsOperator) Phase() OperatorPhase {
 	return EvalPhase
 }
 
+// Sensitive marks parameters and secrets read from AWS as tainted
+func (AwsOperator) Sensitive() bool {
+	return true
+}
+
 // Dependencies is not used by AwsOperator
 func (AwsOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
 	return auto
@@ -542,10 +554,16 @@ func (o AwsOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 
 	// Extract target information (placeholder for now)
 	targetName := o.extractTarget(ev, args)
+	recordExternalRef(ev, o.variant, key)
 
 	var value string
 	if !SkipAws {
-		if targetName != "" {
+		if replaying() {
+			value, err = replayLookupString(o.variant, targetName, awsLookupKey(key, params))
+		} else if secretBundle != nil {
+			// a secret bundle answers in place of AWS
+			value, err = o.getValueFromBundle(ev, targetName, key)
+		} else if targetName != "" {
 			// Use target-aware client pool
 			value, err = o.getValueFromTarget(targetName, key, params)
 		} else {
@@ -553,7 +571,8 @@ func (o AwsOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 			engine := graft.GetEngine(ev)
 			session := engine.GetOperatorState().GetAWSSession()
 			if session == nil {
-				session, err = initializeAwsSession(os.Getenv("AWS_PROFILE"), os.Getenv("AWS_REGION"), os.Getenv("AWS_ROLE"))
+				config := defaultAwsTarget()
+				session, err = awsTargetPool.createSessionFromConfig(&config)
 				if err != nil {
 					return nil, fmt.Errorf("error during AWS session initialization: %s", err)
 				}
@@ -567,8 +586,12 @@ func (o AwsOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 		}
 
 		if err != nil {
+			if isLookupNotRecorded(err) {
+				return nil, err
+			}
 			return nil, fmt.Errorf("$.%s error fetching %s: %s", key, o.variant, err)
 		}
+		recordLookup(o.variant, targetName, awsLookupKey(key, params), value, false)
 
 		subkey := params.Get("key")
 		if subkey != "" {
@@ -600,6 +623,49 @@ func (o AwsOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 	}, nil
 }
 
+// awsLookupKey is how lookups of key are recorded: the name of the parameter
+// or secret, and the stage or version of the secret that was read
+func awsLookupKey(key string, params url.Values) string {
+	if stage := params.Get("stage"); stage != "" {
+		return key + "?stage=" + stage
+	}
+	if version := params.Get("version"); version != "" {
+		return key + "?version=" + version
+	}
+	return key
+}
+
+// getValueFromBundle retrieves a value from the secret bundle, through the
+// same caches as values from AWS
+func (o AwsOperator) getValueFromBundle(ev *Evaluator, targetName, key string) (string, error) {
+	var cache map[string]string
+	var set func(key, value string)
+	switch {
+	case targetName != "" && o.variant == "awsparam":
+		cache = awsTargetPool.GetParamCache(targetName)
+		set = func(key, value string) { awsTargetPool.SetParamCache(targetName, key, value) }
+	case targetName != "":
+		cache = awsTargetPool.GetSecretCache(targetName)
+		set = func(key, value string) { awsTargetPool.SetSecretCache(targetName, key, value) }
+	case o.variant == "awsparam":
+		state := graft.GetEngine(ev).GetOperatorState()
+		cache, set = state.GetAWSParamsCache(), state.SetAWSParamCache
+	default:
+		state := graft.GetEngine(ev).GetOperatorState()
+		cache, set = state.GetAWSSecretsCache(), state.SetAWSSecretCache
+	}
+	if val, cached := cache[key]; cached {
+		return val, nil
+	}
+
+	value, err := getBundleAwsValue(o.variant, targetName, key)
+	if err != nil {
+		return "", err
+	}
+	set(key, value)
+	return value, nil
+}
+
 // getValueFromTarget retrieves a value from AWS using target-specific clients
 func (o AwsOperator) getValueFromTarget(targetName, key string, params url.Values) (string, error) {
 	config, err := awsTargetPool.getTargetConfig(targetName)
@@ -234,11 +234,15 @@ func TestAwsTargetConfiguration(t *testing.T) {
 func TestAwsOperatorTargetExtraction(t *testing.T) {
 	op := AwsOperator{variant: "awsparam"}
 
-	// For now, the extractTarget method returns empty string (placeholder)
-	// In the full implementation, this would extract target from the operator call
+	// Without an evaluator there is no operator call to take a target from
 	target := op.extractTarget(nil, nil)
 	if target != "" {
-		t.Errorf("Expected empty target (placeholder implementation), got '%s'", target)
+		t.Errorf("Expected empty target without an evaluator, got '%s'", target)
+	}
+
+	target = op.extractTarget(&Evaluator{Target: "production"}, nil)
+	if target != "production" {
+		t.Errorf("Expected the target of the call being run, got '%s'", target)
 	}
 }
 
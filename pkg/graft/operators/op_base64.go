@@ -59,6 +59,7 @@ func (Base64Operator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 	}
 
 	encoded := base64.StdEncoding.EncodeToString([]byte(contents))
+	ev.ConcealDerived(encoded)
 	DEBUG("  resolved (( base64 ... )) operation to the string:\n    \"%s\"", encoded)
 
 	return &Response{
@@ -62,6 +62,7 @@ func (Base64DecodeOperator) Run(ev *Evaluator, args []*Expr) (*Response, error)
 	if err != nil {
 		return nil, ansi.Errorf("@R{base64 decoding failed:} @c{%s}", err)
 	}
+	ev.ConcealDerived(string(decoded))
 
 	DEBUG("  resolved (( base64-decode ... )) operation to the string:\n    \"%s\"", string(decoded))
 
@@ -158,6 +158,7 @@ func replaceReferences(ev *Evaluator, input string) (string, error) {
 		if resolveError != nil {
 			return "", resolveError
 		}
+		ev.TaintFrom(cursor)
 
 		path := cursor.String()
 		DEBUG("    path/value: %s=%v", path, value)
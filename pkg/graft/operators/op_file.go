@@ -99,6 +99,14 @@ func (FileOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 		DEBUG("using GRAFT_FILE_BASE_PATH, final path: %s", filename)
 	}
 
+	recordExternalRef(ev, "file", filename)
+	if SkipFileReads {
+		return &Response{
+			Type:  Replace,
+			Value: "REDACTED",
+		}, nil
+	}
+
 	// Read the file
 	file, err := os.ReadFile(filename) // #nosec G304 - file operator needs to read user-specified files
 	if err != nil {
@@ -116,6 +124,10 @@ func (FileOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 	}, nil
 }
 
+// SkipFileReads toggles whether FileOperator reads the files it is given.
+// When true those file calls return "REDACTED"
+var SkipFileReads bool
+
 func init() {
 	RegisterOp("file", FileOperator{})
 }
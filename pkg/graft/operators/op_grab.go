@@ -81,6 +81,7 @@ func (GrabOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 					DEBUG("     [%d]: resolution of path failed\n    error: %s", i, err)
 					return nil, fmt.Errorf("Unable to resolve `%s`: %s", pathStr, err)
 				}
+				ev.TaintFrom(cursor)
 				vals = append(vals, resolved)
 			} else {
 				// Not a valid path, use the string value as-is
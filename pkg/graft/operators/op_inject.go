@@ -69,6 +69,7 @@ func (InjectOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 				DEBUG("     [%d]: resolution failed\n    error: %s", i, err)
 				return nil, err
 			}
+			ev.TaintFrom(arg.Reference)
 
 			m, ok := s.(map[interface{}]interface{})
 			if !ok {
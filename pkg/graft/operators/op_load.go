@@ -13,6 +13,10 @@ import (
 	"github.com/wayneeseguin/graft/internal/utils/tree"
 )
 
+// SkipRemoteLoads toggles whether LoadOperator fetches locations that are
+// URIs. When true those load calls return "REDACTED"
+var SkipRemoteLoads bool
+
 // LoadOperator is invoked with (( load <location> ))
 type LoadOperator struct{}
 
@@ -76,9 +80,29 @@ func (LoadOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 		location = fmt.Sprintf("%v", val)
 	}
 
-	bytes, err := getBytesFromLocation(location)
-	if err != nil {
-		return nil, err
+	recordExternalRef(ev, "load", location)
+	if SkipRemoteLoads && isRemoteLocation(location) {
+		return &Response{
+			Type:  Replace,
+			Value: "REDACTED",
+		}, nil
+	}
+
+	var bytes []byte
+	if replaying() && isRemoteLocation(location) {
+		// only remote locations are recorded; local files are read as usual
+		contents, err := replayLookupString("load", "", location)
+		if err != nil {
+			return nil, err
+		}
+		bytes = []byte(contents)
+	} else {
+		if bytes, err = getBytesFromLocation(location); err != nil {
+			return nil, err
+		}
+		if isRemoteLocation(location) {
+			recordLookup("load", "", location, string(bytes), false)
+		}
 	}
 
 	data, err := simpleyaml.NewYaml(bytes)
@@ -103,9 +127,16 @@ func (LoadOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 	return nil, fmt.Errorf("unsupported root type in loaded content, only map or list roots are supported")
 }
 
+// isRemoteLocation tells whether a load location is a URI to fetch, rather
+// than a local file
+func isRemoteLocation(location string) bool {
+	locURL, err := url.ParseRequestURI(location)
+	return err == nil && locURL.Scheme != ""
+}
+
 func getBytesFromLocation(location string) ([]byte, error) {
 	// Handle location as a URI if it looks like one and has a scheme
-	if locURL, err := url.ParseRequestURI(location); err == nil && locURL.Scheme != "" {
+	if isRemoteLocation(location) {
 		response, err := http.Get(location) // #nosec G107 - load operator needs to fetch from user-specified URLs
 		if err != nil {
 			return nil, err
@@ -186,7 +186,9 @@ func (ncp *NatsClientPool) GetConnection(targetName string) (*pooledConnection,
 	return pooledConn, nil
 }
 
-// getTargetConfig retrieves target configuration from environment variables
+// getTargetConfig resolves a target from its declaration in the graft
+// configuration, if there is one, overridden by NATS_<TARGET>_* environment
+// variables
 func (ncp *NatsClientPool) getTargetConfig(targetName string) (*NatsTarget, error) {
 	// Check if we have cached config
 	ncp.mu.RLock()
@@ -196,32 +198,40 @@ func (ncp *NatsClientPool) getTargetConfig(targetName string) (*NatsTarget, erro
 	}
 	ncp.mu.RUnlock()
 
-	// Use environment variables with target suffix
-	envPrefix := fmt.Sprintf("NATS_%s_", strings.ToUpper(targetName))
-
-	// Check if the URL environment variable is set (required for target configurations)
-	urlEnvVar := envPrefix + "URL"
-	url := os.Getenv(urlEnvVar)
-	if url == "" {
-		return nil, fmt.Errorf("NATS target '%s' configuration incomplete (expected %s environment variable)",
-			targetName, urlEnvVar)
+	config := &NatsTarget{
+		Timeout:            5 * time.Second,
+		Retries:            3,
+		RetryInterval:      1 * time.Second,
+		RetryBackoff:       2.0,
+		MaxRetryInterval:   30 * time.Second,
+		CacheTTL:           5 * time.Minute,
+		StreamingThreshold: 10 * 1024 * 1024,
+	}
+	if def, ok := definedNatsTarget(targetName); ok {
+		overlayTarget(config, def)
 	}
 
-	config := &NatsTarget{
-		URL:                url,
-		Timeout:            parseDurationOrDefault(getEnvOrDefault(envPrefix+"TIMEOUT", "5s"), 5*time.Second),
-		Retries:            parseIntOrDefault(getEnvOrDefault(envPrefix+"RETRIES", "3"), 3),
-		RetryInterval:      parseDurationOrDefault(getEnvOrDefault(envPrefix+"RETRY_INTERVAL", "1s"), 1*time.Second),
-		RetryBackoff:       parseFloatOrDefault(getEnvOrDefault(envPrefix+"RETRY_BACKOFF", "2.0"), 2.0),
-		MaxRetryInterval:   parseDurationOrDefault(getEnvOrDefault(envPrefix+"MAX_RETRY_INTERVAL", "30s"), 30*time.Second),
-		TLS:                parseBoolOrDefault(getEnvOrDefault(envPrefix+"TLS", "false"), false),
-		CertFile:           getEnvOrDefault(envPrefix+"CERT_FILE", ""),
-		KeyFile:            getEnvOrDefault(envPrefix+"KEY_FILE", ""),
-		CAFile:             getEnvOrDefault(envPrefix+"CA_FILE", ""),
-		InsecureSkipVerify: parseBoolOrDefault(getEnvOrDefault(envPrefix+"INSECURE_SKIP_VERIFY", "false"), false),
-		CacheTTL:           parseDurationOrDefault(getEnvOrDefault(envPrefix+"CACHE_TTL", "5m"), 5*time.Minute),
-		StreamingThreshold: parseInt64OrDefault(getEnvOrDefault(envPrefix+"STREAMING_THRESHOLD", "10485760"), 10*1024*1024),
-		AuditLogging:       parseBoolOrDefault(getEnvOrDefault(envPrefix+"AUDIT_LOGGING", "false"), false),
+	// Use environment variables with target suffix
+	envPrefix := fmt.Sprintf("NATS_%s_", strings.ToUpper(targetName))
+	config.URL = getEnvOrDefault(envPrefix+"URL", config.URL)
+	config.Timeout = parseDurationOrDefault(os.Getenv(envPrefix+"TIMEOUT"), config.Timeout)
+	config.Retries = parseIntOrDefault(os.Getenv(envPrefix+"RETRIES"), config.Retries)
+	config.RetryInterval = parseDurationOrDefault(os.Getenv(envPrefix+"RETRY_INTERVAL"), config.RetryInterval)
+	config.RetryBackoff = parseFloatOrDefault(os.Getenv(envPrefix+"RETRY_BACKOFF"), config.RetryBackoff)
+	config.MaxRetryInterval = parseDurationOrDefault(os.Getenv(envPrefix+"MAX_RETRY_INTERVAL"), config.MaxRetryInterval)
+	config.TLS = parseBoolOrDefault(os.Getenv(envPrefix+"TLS"), config.TLS)
+	config.CertFile = getEnvOrDefault(envPrefix+"CERT_FILE", config.CertFile)
+	config.KeyFile = getEnvOrDefault(envPrefix+"KEY_FILE", config.KeyFile)
+	config.CAFile = getEnvOrDefault(envPrefix+"CA_FILE", config.CAFile)
+	config.InsecureSkipVerify = parseBoolOrDefault(os.Getenv(envPrefix+"INSECURE_SKIP_VERIFY"), config.InsecureSkipVerify)
+	config.CacheTTL = parseDurationOrDefault(os.Getenv(envPrefix+"CACHE_TTL"), config.CacheTTL)
+	config.StreamingThreshold = parseInt64OrDefault(os.Getenv(envPrefix+"STREAMING_THRESHOLD"), config.StreamingThreshold)
+	config.AuditLogging = parseBoolOrDefault(os.Getenv(envPrefix+"AUDIT_LOGGING"), config.AuditLogging)
+
+	// The URL is required for target configurations
+	if config.URL == "" {
+		return nil, fmt.Errorf("NATS target '%s' configuration incomplete (declare it under targets.nats, or set %sURL)",
+			targetName, envPrefix)
 	}
 
 	return config, nil
@@ -245,11 +255,13 @@ func (ncp *NatsClientPool) ReleaseConnection(targetName string) {
 // It will fetch values from NATS JetStream KV or Object stores
 type NatsOperator struct{}
 
-// extractTarget extracts target name from operator call (placeholder)
+// extractTarget returns the @target named by the operator call being run,
+// or "" to use the default configuration
 func (n NatsOperator) extractTarget(ev *graft.Evaluator, args []*graft.Expr) string {
-	// TODO: Extract target from parsed expression when parser supports it
-	// For now, return empty string to use default configuration
-	return ""
+	if ev == nil {
+		return ""
+	}
+	return ev.Target
 }
 
 // getCacheKey generates a cache key that includes target information
@@ -957,13 +969,6 @@ func (n NatsOperator) Run(ev *graft.Evaluator, args []*graft.Expr) (*graft.Respo
 	DEBUG("running (( nats ... )) operation at $.%s", ev.Here)
 	defer DEBUG("done with (( nats ... )) operation at $%s\n", ev.Here)
 
-	if SkipNats {
-		return &graft.Response{
-			Type:  graft.Replace,
-			Value: "REDACTED",
-		}, nil
-	}
-
 	// Validate arguments
 	if len(args) < 1 {
 		return nil, fmt.Errorf("nats operator requires at least one argument")
@@ -985,6 +990,27 @@ func (n NatsOperator) Run(ev *graft.Evaluator, args []*graft.Expr) (*graft.Respo
 	if err != nil {
 		return nil, err
 	}
+	recordExternalRef(ev, "nats", path)
+
+	if SkipNats {
+		return &graft.Response{
+			Type:  graft.Replace,
+			Value: "REDACTED",
+		}, nil
+	}
+	if replaying() {
+		value, missing, err := replayLookup("nats", n.extractTarget(ev, args), path)
+		if err != nil {
+			return nil, err
+		}
+		if missing {
+			return nil, fmt.Errorf("%s not found", path)
+		}
+		return &graft.Response{
+			Type:  graft.Replace,
+			Value: value,
+		}, nil
+	}
 
 	// Parse configuration
 	config, err := parseNatsConfig(ev, args)
@@ -1024,6 +1050,7 @@ func (n NatsOperator) Run(ev *graft.Evaluator, args []*graft.Expr) (*graft.Respo
 	if err != nil {
 		return nil, err
 	}
+	recordLookup("nats", targetName, path, value, false)
 
 	return &graft.Response{
 		Type:  graft.Replace,
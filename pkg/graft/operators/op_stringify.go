@@ -21,8 +21,20 @@ func (StringifyOperator) Phase() OperatorPhase {
 }
 
 // Dependencies ...
-func (StringifyOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
-	return auto
+func (StringifyOperator) Dependencies(_ *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	l := append([]*tree.Cursor{}, auto...)
+
+	// a map or list has to be fully evaluated before it is stringified
+	for _, arg := range args {
+		if arg.Type == Reference {
+			for _, other := range locs {
+				if other.Under(arg.Reference) {
+					l = append(l, other)
+				}
+			}
+		}
+	}
+	return l
 }
 
 // Run ...
@@ -8,6 +8,8 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cloudfoundry-community/vaultkv"
 	"github.com/geofffranks/yaml"
@@ -26,16 +28,31 @@ var VaultRefs = map[string][]string{}
 
 // VaultTarget represents a vault target configuration
 type VaultTarget struct {
-	URL        string `yaml:"url"`
-	Token      string `yaml:"token"`
-	Namespace  string `yaml:"namespace"`
-	SkipVerify bool   `yaml:"skip_verify"`
+	URL        string        `yaml:"url"`
+	Token      string        `yaml:"token"`
+	Namespace  string        `yaml:"namespace"`
+	SkipVerify bool          `yaml:"skip_verify"`
+	CACert     string        `yaml:"ca_cert"`
+	ClientCert string        `yaml:"client_cert"`
+	ClientKey  string        `yaml:"client_key"`
+	AuthMethod string        `yaml:"auth_method"`
+	AuthMount  string        `yaml:"auth_mount"`
+	AuthRole   string        `yaml:"auth_role"` // kubernetes and cert
+	RoleID     string        `yaml:"role_id"`   // approle
+	SecretID   string        `yaml:"secret_id"` // approle
+	JWTFile    string        `yaml:"jwt_file"`  // kubernetes
+	Username   string        `yaml:"username"`  // userpass
+	Password   string        `yaml:"password"`  // userpass
+	Timeout    time.Duration `yaml:"timeout"`
+	CacheTTL   time.Duration `yaml:"cache_ttl"`
 }
 
 // VaultClientPool manages vault clients for different targets
 type VaultClientPool struct {
+	mu      sync.RWMutex
 	clients map[string]*vaultkv.KV
 	configs map[string]*VaultTarget
+	fetched map[string]time.Time // cache key -> when the secret was read
 }
 
 // Global client pool for target-aware vault clients
@@ -47,9 +64,12 @@ var vaultClientPool = &VaultClientPool{
 // GetClient returns a vault client for the specified target
 func (vcp *VaultClientPool) GetClient(targetName string, engine graft.Engine) (*vaultkv.KV, error) {
 	// Return existing client if available
+	vcp.mu.RLock()
 	if client, exists := vcp.clients[targetName]; exists {
+		vcp.mu.RUnlock()
 		return client, nil
 	}
+	vcp.mu.RUnlock()
 
 	// Get target configuration
 	config, err := vcp.getTargetConfig(targetName, engine)
@@ -64,48 +84,84 @@ func (vcp *VaultClientPool) GetClient(targetName string, engine graft.Engine) (*
 	}
 
 	// Store client for reuse
+	vcp.mu.Lock()
 	vcp.clients[targetName] = client
 	vcp.configs[targetName] = config
+	vcp.mu.Unlock()
 
 	return client, nil
 }
 
-// getTargetConfig retrieves target configuration from the engine or environment
+// getTargetConfig resolves a target from its declaration in the graft
+// configuration, if there is one, overridden by VAULT_<TARGET>_* environment
+// variables
 func (vcp *VaultClientPool) getTargetConfig(targetName string, engine graft.Engine) (*VaultTarget, error) {
 	// Check if we have cached config
+	vcp.mu.RLock()
 	if config, exists := vcp.configs[targetName]; exists {
+		vcp.mu.RUnlock()
 		return config, nil
 	}
+	vcp.mu.RUnlock()
 
-	// For now, try environment variables with target suffix
-	// In a full implementation, this would query the engine's configuration
-	envPrefix := fmt.Sprintf("VAULT_%s_", strings.ToUpper(targetName))
-
-	config := &VaultTarget{
-		URL:       os.Getenv(envPrefix + "ADDR"),
-		Token:     os.Getenv(envPrefix + "TOKEN"),
-		Namespace: os.Getenv(envPrefix + "NAMESPACE"),
+	config := &VaultTarget{}
+	if def, ok := definedVaultTarget(targetName); ok {
+		overlayTarget(config, def)
 	}
 
-	// Check for skip verify
-	if skipStr := os.Getenv(envPrefix + "SKIP_VERIFY"); skipStr == "true" || skipStr == "1" {
-		config.SkipVerify = true
-	}
-
-	// If no environment variables found, return error
-	if config.URL == "" || config.Token == "" {
-		return nil, fmt.Errorf("vault target '%s' configuration not found (expected %sADDR and %sTOKEN environment variables)",
+	envPrefix := fmt.Sprintf("VAULT_%s_", strings.ToUpper(targetName))
+	config.URL = getEnvOrDefault(envPrefix+"ADDR", config.URL)
+	config.Token = getEnvOrDefault(envPrefix+"TOKEN", config.Token)
+	config.Namespace = getEnvOrDefault(envPrefix+"NAMESPACE", config.Namespace)
+	if skipStr := os.Getenv(envPrefix + "SKIP_VERIFY"); skipStr != "" {
+		config.SkipVerify = skipVaultVerify(skipStr)
+	}
+	config.CACert = getEnvOrDefault(envPrefix+"CACERT", config.CACert)
+	config.ClientCert = getEnvOrDefault(envPrefix+"CLIENT_CERT", config.ClientCert)
+	config.ClientKey = getEnvOrDefault(envPrefix+"CLIENT_KEY", config.ClientKey)
+	vaultAuthFromEnv(config, envPrefix)
+	config.Timeout = parseDurationOrDefault(os.Getenv(envPrefix+"TIMEOUT"), config.Timeout)
+	config.CacheTTL = parseDurationOrDefault(os.Getenv(envPrefix+"CACHE_TTL"), config.CacheTTL)
+
+	if config.URL == "" || (config.Token == "" && config.usesToken()) {
+		return nil, fmt.Errorf("vault target '%s' configuration not found (declare it under targets.vault, or set %sADDR and %sTOKEN)",
 			targetName, envPrefix, envPrefix)
 	}
+	if _, err := newVaultAuthMethod(config); err != nil {
+		return nil, fmt.Errorf("vault target '%s' cannot log in: %s", targetName, err)
+	}
 
 	return config, nil
 }
 
-// createVaultClientFromConfig creates a vault client from target configuration
+// expired reports whether the copy of a secret cached under cacheKey for a
+// target is older than the cache TTL of that target
+func (vcp *VaultClientPool) expired(targetName, cacheKey string) bool {
+	vcp.mu.RLock()
+	defer vcp.mu.RUnlock()
+	config, ok := vcp.configs[targetName]
+	if !ok || config.CacheTTL <= 0 {
+		return false
+	}
+	at, ok := vcp.fetched[cacheKey]
+	return ok && time.Since(at) > config.CacheTTL
+}
+
+// cached records that the secret under cacheKey was just read from vault
+func (vcp *VaultClientPool) cached(cacheKey string) {
+	vcp.mu.Lock()
+	defer vcp.mu.Unlock()
+	if vcp.fetched == nil {
+		vcp.fetched = make(map[string]time.Time)
+	}
+	vcp.fetched[cacheKey] = time.Now()
+}
+
+// createVaultClientFromConfig creates a vault client from target
+// configuration, and logs it in with the auth method of the target
 func createVaultClientFromConfig(config *VaultTarget) (*vaultkv.KV, error) {
 	// Expand environment variables in configuration
 	addr := os.ExpandEnv(config.URL)
-	token := os.ExpandEnv(config.Token)
 	namespace := os.ExpandEnv(config.Namespace)
 
 	parsedURL, err := url.Parse(addr)
@@ -122,53 +178,103 @@ func createVaultClientFromConfig(config *VaultTarget) (*vaultkv.KV, error) {
 		}
 	}
 
-	// TLS configuration
-	roots, err := x509.SystemCertPool()
+	tlsConfig, err := vaultTLSConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve system root certificate authorities: %s", err)
+		return nil, err
+	}
+
+	method, err := newVaultAuthMethod(config)
+	if err != nil {
+		return nil, err
 	}
 
 	client := &vaultkv.Client{
-		AuthToken: token,
 		VaultURL:  parsedURL,
 		Namespace: namespace,
 		Client: &http.Client{
+			Timeout: config.Timeout,
 			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				TLSClientConfig: &tls.Config{
-					RootCAs:            roots,
-					InsecureSkipVerify: config.SkipVerify, // #nosec G402 - controlled by user configuration
-				},
-			},
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				if len(via) > 10 {
-					return fmt.Errorf("stopped after 10 redirects")
-				}
-				req.Header.Add("X-Vault-Token", token)
-				req.Header.Add("X-Vault-Namespace", namespace)
-				return nil
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
 			},
 		},
 	}
+	client.Client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		// carry over the token the request was first sent with, which the
+		// client read under its token lock: reading client.AuthToken here
+		// would race with a refresh logging in again
+		req.Header.Set("X-Vault-Token", via[0].Header.Get("X-Vault-Token"))
+		req.Header.Set("X-Vault-Namespace", namespace)
+		return nil
+	}
 
 	// Enable tracing if debug is on
 	if DebugOn() {
 		client.Trace = os.Stderr
 	}
 
+	if err := vaultLogin(client, method); err != nil {
+		return nil, fmt.Errorf("unable to log in with the %s auth method: %s", methodName(config), err)
+	}
+
 	return client.NewKV(), nil
 }
 
-// extractTarget attempts to extract target information from the operator context
+// methodName is the auth method config uses, by name
+func methodName(config *VaultTarget) string {
+	if config.AuthMethod == "" {
+		return "token"
+	}
+	return config.AuthMethod
+}
+
+// vaultTLSConfig builds the TLS settings for a target: its CA certificate if
+// it has one, the system roots otherwise, and its client certificate
+func vaultTLSConfig(config *VaultTarget) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.SkipVerify, // #nosec G402 - controlled by user configuration
+	}
+
+	if caCert := os.ExpandEnv(config.CACert); caCert != "" {
+		// #nosec G304 - the CA certificate is named by the user's configuration
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA certificate: %s", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA certificate %s", caCert)
+		}
+		tlsConfig.RootCAs = roots
+	} else {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve system root certificate authorities: %s", err)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if config.ClientCert != "" || config.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(os.ExpandEnv(config.ClientCert), os.ExpandEnv(config.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// extractTarget returns the @target named by the operator call being run,
+// or "" to use the default configuration
 func (o VaultOperator) extractTarget(ev *Evaluator, args []*Expr) string {
-	// For now, we'll implement a simple approach where target information
-	// could be stored in the engine state or extracted from the evaluator context.
-	// In a full implementation, this would access the parsed operator call's target field.
-
-	// TODO: This is a placeholder implementation. In the complete implementation,
-	// the target would be available from the operator call context.
-	// For now, we'll return empty string (no target) to maintain backward compatibility.
-	return ""
+	if ev == nil {
+		return ""
+	}
+	return ev.Target
 }
 
 // getCacheKey generates a cache key that includes target information
@@ -218,6 +324,14 @@ func newVaultArgProcessor(args []*Expr) *vaultArgProcessor {
 			processor.defaultIndex = i
 			// Use the left side of LogicalOr for vault path
 			processor.args[i] = arg.Left
+
+			// `|| vault "other/path:key"` leaves the arguments of the operator
+			// after the ||, so they make up the default, not the path
+			if call := operatorCallAfterOr(arg.Right, parsedArgs[i+1:]); call != nil {
+				processor.defaultExpr = call
+				processor.args = processor.args[:i+1]
+				break
+			}
 		} else {
 			processor.args[i] = arg
 		}
@@ -226,6 +340,24 @@ func newVaultArgProcessor(args []*Expr) *vaultArgProcessor {
 	return processor
 }
 
+// operatorCallAfterOr rebuilds the operator call that the parser splits
+// into a reference to its name, the right side of a ||, and the arguments
+// that follow it. It returns nil unless name names an operator.
+func operatorCallAfterOr(name *Expr, args []*Expr) *Expr {
+	if name == nil || name.Type != Reference || name.Reference == nil || len(args) == 0 {
+		return nil
+	}
+	op := name.Reference.String()
+	if _, ok := graft.OpRegistry[op]; !ok {
+		return nil
+	}
+	return &Expr{
+		Type:     OperatorCall,
+		Operator: op,
+		Call:     graft.NewNamedOpcall(op, "", graft.OperatorFor(op), args, op),
+	}
+}
+
 // isVaultPathString checks if an expression looks like a vault path (contains colon)
 func isVaultPathString(ev *Evaluator, expr *Expr) bool {
 	// Try to resolve to string without error propagation
@@ -505,6 +637,12 @@ func (VaultOperator) Phase() OperatorPhase {
 	return EvalPhase
 }
 
+// Sensitive marks the secrets vault returns, and everything derived from
+// them, as tainted
+func (VaultOperator) Sensitive() bool {
+	return true
+}
+
 // Dependencies collects implicit dependencies that a given `(( vault ... ))`
 // call has. There are no dependencies other that those given as args to the
 // command.
@@ -512,13 +650,23 @@ func (VaultOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, aut
 	return auto
 }
 
+// initializeVaultClient sets up the default vault client from VAULT_*
+// environment variables over the default given to DefineTargets, falling back
+// to ~/.svtoken or ~/.vault-token, and logs it in
 func initializeVaultClient() error {
-	addr := os.Getenv("VAULT_ADDR")
-	token := os.Getenv("VAULT_TOKEN")
-	namespace := os.Getenv("VAULT_NAMESPACE")
-	skip := false
-
-	if addr == "" || token == "" {
+	definedTargets.RLock()
+	config := definedTargets.DefaultVault
+	definedTargets.RUnlock()
+
+	config.URL = getEnvOrDefault("VAULT_ADDR", config.URL)
+	config.Token = getEnvOrDefault("VAULT_TOKEN", config.Token)
+	config.Namespace = getEnvOrDefault("VAULT_NAMESPACE", config.Namespace)
+	config.CACert = getEnvOrDefault("VAULT_CACERT", config.CACert)
+	config.ClientCert = getEnvOrDefault("VAULT_CLIENT_CERT", config.ClientCert)
+	config.ClientKey = getEnvOrDefault("VAULT_CLIENT_KEY", config.ClientKey)
+	vaultAuthFromEnv(&config, "VAULT_")
+
+	if config.URL == "" || (config.Token == "" && config.usesToken()) {
 		svtoken := struct {
 			Vault      string `yaml:"vault"`
 			Token      string `yaml:"token"`
@@ -529,78 +677,34 @@ func initializeVaultClient() error {
 		if err == nil {
 			err = yaml.Unmarshal(b, &svtoken)
 			if err == nil {
-				addr = svtoken.Vault
-				token = svtoken.Token
-				namespace = svtoken.Namespace
-				skip = svtoken.SkipVerify
+				config.URL = svtoken.Vault
+				config.Token = svtoken.Token
+				config.Namespace = svtoken.Namespace
+				config.SkipVerify = svtoken.SkipVerify
 			}
 		}
 	}
 
 	if skipVaultVerify(os.Getenv("VAULT_SKIP_VERIFY")) {
-		skip = true
+		config.SkipVerify = true
 	}
 
-	if token == "" {
+	if config.Token == "" && config.usesToken() {
 		b, err := os.ReadFile(fmt.Sprintf("%s/.vault-token", os.Getenv("HOME")))
 		if err == nil {
-			token = strings.TrimSuffix(string(b), "\n")
+			config.Token = strings.TrimSuffix(string(b), "\n")
 		}
 	}
 
-	if addr == "" || token == "" {
+	if config.URL == "" || (config.Token == "" && config.usesToken()) {
 		return fmt.Errorf("Failed to determine Vault URL / token, and the $REDACT environment variable is not set.")
 	}
 
-	roots, err := x509.SystemCertPool()
-	if err != nil {
-		return fmt.Errorf("unable to retrieve system root certificate authorities: %s", err)
-	}
-
-	parsedURL, err := url.Parse(addr)
-	if err != nil {
-		return fmt.Errorf("Could not parse Vault URL `%s': %s", addr, err)
-	}
-
-	if parsedURL.Port() == "" {
-		if parsedURL.Scheme == "http" {
-			parsedURL.Host = parsedURL.Host + ":80"
-		} else {
-			parsedURL.Host = parsedURL.Host + ":443"
-		}
-	}
-
-	client := &vaultkv.Client{
-		AuthToken: token,
-		VaultURL:  parsedURL,
-		Namespace: namespace,
-		Client: &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				TLSClientConfig: &tls.Config{
-					RootCAs:            roots,
-					InsecureSkipVerify: skip, // #nosec G402 - skip is controlled by user configuration
-				},
-			},
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				if len(via) > 10 {
-					return fmt.Errorf("stopped after 10 redirects")
-				}
-				req.Header.Add("X-Vault-Token", token)
-				req.Header.Add("X-Vault-Namespace", token)
-				return nil
-			},
-		},
-	}
-	if DebugOn() {
-		client.Trace = os.Stderr
-	}
-
+	kv, err := createVaultClientFromConfig(&config)
 	if err != nil {
 		return fmt.Errorf("Error setting up Vault client: %s", err)
 	}
-
-	globalKV = client.NewKV()
+	globalKV = kv
 
 	return nil
 }
@@ -678,8 +782,9 @@ func (o VaultOperator) runClassic(ev *Evaluator, args []*Expr, engine graft.Engi
 				return nil, fmt.Errorf("unable to evaluate default value: %s", evalErr)
 			}
 			return &Response{
-				Type:  Replace,
-				Value: defaultValue,
+				Type:     Replace,
+				Value:    defaultValue,
+				Fallback: true,
 			}, nil
 		}
 		return nil, err
@@ -704,8 +809,9 @@ func (o VaultOperator) runWithSubOperators(ev *Evaluator, args []*Expr, engine g
 				return nil, fmt.Errorf("unable to evaluate default value: %s", evalErr)
 			}
 			return &Response{
-				Type:  Replace,
-				Value: defaultValue,
+				Type:     Replace,
+				Value:    defaultValue,
+				Fallback: true,
 			}, nil
 		}
 		return nil, err
@@ -716,13 +822,25 @@ func (o VaultOperator) runWithSubOperators(ev *Evaluator, args []*Expr, engine g
 
 // tryVaultPaths attempts to retrieve secrets from a list of vault paths
 func (o VaultOperator) tryVaultPaths(ev *Evaluator, engine graft.Engine, paths []string, processor *vaultArgProcessor, targetName string) (*Response, error) {
+	// Without vault, every path and default could be the one used
+	if engine.GetOperatorState().IsVaultSkipped() {
+		for _, key := range paths {
+			recordVaultRef(engine, targetName, key, ev.Here.String())
+		}
+		skipVaultDefault(ev, processor.hasDefault, processor.evaluateDefault)
+		return &Response{
+			Type:  Replace,
+			Value: "REDACTED",
+		}, nil
+	}
+
 	// Try each path in order
 	var lastErr error
 	for i, key := range paths {
 		DEBUG("vault: trying path %d of %d: %s", i+1, len(paths), key)
 
 		// Track vault references using engine context
-		engine.GetOperatorState().AddVaultRef(key, []string{ev.Here.String()})
+		recordVaultRef(engine, targetName, key, ev.Here.String())
 
 		// Perform the vault lookup
 		secret, err := o.performVaultLookup(engine, key, targetName)
@@ -735,6 +853,11 @@ func (o VaultOperator) tryVaultPaths(ev *Evaluator, engine graft.Engine, paths [
 			}, nil
 		}
 
+		// Replays fail on lookups that were not recorded, whatever the default
+		if isLookupNotRecorded(err) {
+			return nil, err
+		}
+
 		// Remember the last error
 		lastErr = err
 		DEBUG("vault: path %d failed: %s", i+1, err)
@@ -752,9 +875,23 @@ func (o VaultOperator) tryVaultPaths(ev *Evaluator, engine graft.Engine, paths [
 		if evalErr != nil {
 			return nil, fmt.Errorf("unable to evaluate default value: %s", evalErr)
 		}
+		return &Response{
+			Type:     Replace,
+			Value:    defaultValue,
+			Fallback: true,
+		}, nil
+	}
+
+	// With --vault-generate-missing, create what none of the paths have
+	if VaultGenerateMissing && isVaultNotFound(lastErr) {
+		DEBUG("vault: all paths failed, generating a random secret at %s", paths[0])
+		secret, err := generateVaultSecret(engine, paths[0], targetName, "random", nil)
+		if err != nil {
+			return nil, err
+		}
 		return &Response{
 			Type:  Replace,
-			Value: defaultValue,
+			Value: secret,
 		}, nil
 	}
 
@@ -767,6 +904,18 @@ func (o VaultOperator) tryVaultPaths(ev *Evaluator, engine graft.Engine, paths [
 	return nil, fmt.Errorf("vault operator failed to retrieve secret")
 }
 
+// skipVaultDefault evaluates the default of a vault call while vault is
+// skipped, only so that the vault calls nested in it record their paths too.
+// Whatever it evaluates to, the call itself is redacted.
+func skipVaultDefault(ev *Evaluator, hasDefault bool, evaluate func(*Evaluator) (interface{}, error)) {
+	if !hasDefault {
+		return
+	}
+	if _, err := evaluate(ev); err != nil {
+		DEBUG("vault: unable to evaluate the default while skipping vault: %s", err)
+	}
+}
+
 // resolveVaultArgs handles the resolution of vault arguments
 func (VaultOperator) resolveVaultArgs(ev *Evaluator, args []*Expr) (string, error) {
 	var l []string
@@ -815,60 +964,70 @@ func (VaultOperator) resolveVaultArgs(ev *Evaluator, args []*Expr) (string, erro
 	return key, nil
 }
 
-// performVaultLookup performs the actual vault lookup
+// performVaultLookup performs the actual vault lookup, or serves back the
+// recorded one when replaying
 func (o VaultOperator) performVaultLookup(engine graft.Engine, key string, targetName string) (string, error) {
 	if engine.GetOperatorState().IsVaultSkipped() {
 		return "REDACTED", nil
 	}
+	if replaying() {
+		secret, err := replayLookupString("vault", targetName, key)
+		if err != nil && !isLookupNotRecorded(err) {
+			err = fmt.Errorf("secret %s not found", key)
+		}
+		return secret, err
+	}
 
-	var kv *vaultkv.KV
-	var err error
+	secret, err := o.lookupVaultSecret(engine, key, targetName)
+	if err == nil || isVaultNotFound(err) {
+		recordLookup("vault", targetName, key, secret, err != nil)
+	}
+	return secret, err
+}
 
-	if targetName != "" {
-		// Use target-specific client
-		kv, err = vaultClientPool.GetClient(targetName, engine)
-		if err != nil {
-			return "", fmt.Errorf("failed to get vault client for target '%s': %v", targetName, err)
+// lookupVaultSecret reads key from vault, or from the secret bundle in use
+func (o VaultOperator) lookupVaultSecret(engine graft.Engine, key string, targetName string) (string, error) {
+	// a secret bundle answers in place of vault
+	var kv *vaultkv.KV
+	if secretBundle == nil {
+		var err error
+		if kv, err = vaultKV(engine, targetName); err != nil {
+			return "", err
 		}
-		DEBUG("vault: using target-specific client for '%s'", targetName)
-	} else {
-		// Fall back to default behavior (environment-based or global client)
-		kv = engine.GetOperatorState().GetVaultClient()
 		if kv == nil {
-			// For backward compatibility, try to initialize from environment
-			if SkipVault {
-				return "REDACTED", nil
-			}
-
-			// Fall back to global initialization
-			if globalKV == nil {
-				err := initializeVaultClient()
-				if err != nil {
-					return "", fmt.Errorf("Error during Vault client initialization: %s", err)
-				}
-			}
-			kv = globalKV
+			return "REDACTED", nil
 		}
-		DEBUG("vault: using default client")
 	}
 
-	leftPart, rightPart := parsePath(key)
-	if leftPart == "" || rightPart == "" {
-		return "", ansi.Errorf("@R{invalid argument} @c{%s}@R{; must be in the form} @m{path/to/secret:key}", key)
+	ref, err := ParseVaultReference(key)
+	if err != nil {
+		return "", err
 	}
 
-	// Check cache first (include target in cache key)
-	cacheKey := o.getCacheKey(targetName, leftPart)
+	// Check cache first (include target in cache key). Pinned versions and
+	// metadata are cached apart from the latest version of the secret.
+	cacheKey := o.getCacheKey(targetName, ref.Secret+ref.cacheSuffix())
 	vaultCache := engine.GetOperatorState().GetVaultCache()
 	var fullSecret map[string]interface{}
 	var found bool
-	if fullSecret, found = vaultCache[cacheKey]; found {
-		DEBUG("vault: Cache hit for `%s` (target: %s)", leftPart, targetName)
+	if fullSecret, found = vaultCache[cacheKey]; found && targetName != "" && vaultClientPool.expired(targetName, cacheKey) {
+		DEBUG("vault: cached copy of `%s` has expired (target: %s)", ref.Secret, targetName)
+		found = false
+	}
+	if found {
+		DEBUG("vault: Cache hit for `%s` (target: %s)", ref.Secret, targetName)
 	} else {
-		DEBUG("vault: Cache MISS for `%s` (target: %s)", leftPart, targetName)
+		DEBUG("vault: Cache MISS for `%s` (target: %s)", ref.Secret, targetName)
 		// Secret isn't cached. Grab it from the vault.
 		var err error
-		fullSecret, err = getVaultSecretWithClient(kv, leftPart)
+		var version uint
+		if secretBundle != nil {
+			fullSecret, err = getBundleVaultSecret(targetName, ref)
+		} else if ref.Metadata {
+			fullSecret, err = getVaultMetadata(kv, ref.Secret)
+		} else {
+			fullSecret, version, err = getVaultSecretVersion(kv, ref.Secret, ref.Version)
+		}
 		if err != nil {
 			//Normalize the error messages
 			switch err.(type) {
@@ -877,16 +1036,62 @@ func (o VaultOperator) performVaultLookup(engine graft.Engine, key string, targe
 			}
 			return "", err
 		}
+		if ref.Version == 0 {
+			recordVaultVersion(targetName, ref.Secret, version)
+		}
 		engine.GetOperatorState().SetVaultCache(cacheKey, fullSecret)
+		if targetName != "" {
+			vaultClientPool.cached(cacheKey)
+		}
 	}
 
-	secret, err := extractSubkey(fullSecret, leftPart, rightPart)
+	secret, err := extractSubkey(fullSecret, ref.Secret, ref.Key)
 	if err != nil {
 		return "", err
 	}
 	return secret, nil
 }
 
+// vaultKV returns the client of targetName, or the default client when no
+// target is named, logged in and ready to use. It returns nil when vault
+// lookups are being skipped.
+func vaultKV(engine graft.Engine, targetName string) (*vaultkv.KV, error) {
+	var kv *vaultkv.KV
+	var err error
+
+	if targetName != "" {
+		// Use target-specific client
+		kv, err = vaultClientPool.GetClient(targetName, engine)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get vault client for target '%s': %v", targetName, err)
+		}
+		DEBUG("vault: using target-specific client for '%s'", targetName)
+	} else {
+		// Fall back to default behavior (environment-based or global client)
+		kv = engine.GetOperatorState().GetVaultClient()
+		if kv == nil {
+			// For backward compatibility, try to initialize from environment
+			if SkipVault {
+				return nil, nil
+			}
+
+			// Fall back to global initialization
+			if globalKV == nil {
+				err := initializeVaultClient()
+				if err != nil {
+					return nil, fmt.Errorf("Error during Vault client initialization: %s", err)
+				}
+			}
+			kv = globalKV
+		}
+		DEBUG("vault: using default client")
+	}
+	if err := refreshVaultLogin(kv); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
 // VaultTryOperator is a deprecated alias for VaultOperator
 // It maintains backward compatibility but logs a deprecation warning
 type VaultTryOperator struct{}
@@ -901,6 +1106,11 @@ func (VaultTryOperator) Phase() OperatorPhase {
 	return EvalPhase
 }
 
+// Sensitive marks the secrets vault-try returns as tainted
+func (VaultTryOperator) Sensitive() bool {
+	return true
+}
+
 // Dependencies returns the dependencies for this operator
 func (VaultTryOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
 	return auto
@@ -925,6 +1135,7 @@ func (o VaultTryOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 	engine := graft.GetEngine(ev)
 
 	// Try each vault path in order
+	skipped := false
 	for i, pathExpr := range vaultPaths {
 		DEBUG("vault-try: attempting path %d of %d", i+1, len(vaultPaths))
 
@@ -964,8 +1175,13 @@ func (o VaultTryOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 			continue // Skip to next path
 		}
 
-		// Track this vault reference
-		engine.GetOperatorState().AddVaultRef(path, []string{ev.Here.String()})
+		// Track this vault reference. Without vault, every path could be the
+		// one used.
+		recordVaultRef(engine, "", path, ev.Here.String())
+		if engine.GetOperatorState().IsVaultSkipped() {
+			skipped = true
+			continue
+		}
 
 		// Use the shared vault infrastructure
 		vaultOp := VaultOperator{}
@@ -979,10 +1195,24 @@ func (o VaultTryOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 			}, nil
 		}
 
+		if isLookupNotRecorded(err) {
+			return nil, err
+		}
+
 		// Log the error but continue to next path
 		DEBUG("vault-try: path %d failed: %s", i+1, err)
 	}
 
+	if skipped {
+		skipVaultDefault(ev, true, func(ev *Evaluator) (interface{}, error) {
+			return ResolveOperatorArgument(ev, defaultExpr)
+		})
+		return &Response{
+			Type:  Replace,
+			Value: "REDACTED",
+		}, nil
+	}
+
 	// All vault paths failed, use the default value
 	DEBUG("vault-try: all paths failed, evaluating default value")
 	defaultValue, err := ResolveOperatorArgument(ev, defaultExpr)
@@ -991,8 +1221,9 @@ func (o VaultTryOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 	}
 
 	return &Response{
-		Type:  Replace,
-		Value: defaultValue,
+		Type:     Replace,
+		Value:    defaultValue,
+		Fallback: true,
 	}, nil
 }
 
@@ -1019,17 +1250,33 @@ func getVaultSecret(secret string) (map[string]interface{}, error) {
 
 // getVaultSecretWithClient retrieves a secret using the provided client
 func getVaultSecretWithClient(kvClient *vaultkv.KV, secret string) (map[string]interface{}, error) {
-	ret := map[string]interface{}{}
+	ret, _, err := getVaultSecretVersion(kvClient, secret, 0)
+	return ret, err
+}
 
-	DEBUG("Fetching Vault secret at `%s'", secret)
-	_, err := kvClient.Get(secret, &ret, nil)
-	if err != nil {
-		DEBUG(" failure.")
-		return nil, err
-	}
+// vaultKVClient is a graft.VaultClient that reads and writes through a
+// vaultkv client
+type vaultKVClient struct {
+	kv *vaultkv.KV
+}
 
-	DEBUG("  success.")
-	return ret, nil
+var _ graft.VaultClient = vaultKVClient{}
+
+// Get reads the secret at path
+func (c vaultKVClient) Get(path string) (map[string]interface{}, error) {
+	return getVaultSecretWithClient(c.kv, path)
+}
+
+// List lists the secrets beneath path
+func (c vaultKVClient) List(path string) ([]string, error) {
+	return c.kv.List(path)
+}
+
+// Put replaces the secret at path with data
+func (c vaultKVClient) Put(path string, data map[string]interface{}) error {
+	DEBUG("Writing Vault secret at `%s'", path)
+	_, err := c.kv.Set(path, data, nil)
+	return err
 }
 
 func extractSubkey(secretMap map[string]interface{}, secret, subkey string) (string, error) {
@@ -0,0 +1,419 @@
+package operators
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/internal/utils/tree"
+	"github.com/wayneeseguin/graft/log"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+// VaultGenerateMissing makes (( vault ... )) calls that find nothing generate
+// a random secret, as if they were (( vault-generate ... )) calls
+var VaultGenerateMissing bool
+
+// VaultGenerateDryRun makes vault-generate record what it would generate,
+// without writing anything to vault
+var VaultGenerateDryRun bool
+
+// GeneratedSecret is a secret that vault-generate wrote, or would have
+// written in a dry run
+type GeneratedSecret struct {
+	Target  string   `json:"target,omitempty"`
+	Path    string   `json:"path"`
+	Keys    []string `json:"keys"`
+	Policy  string   `json:"policy"`
+	Args    []string `json:"args,omitempty"`
+	Written bool     `json:"written"`
+}
+
+// vaultGenerated lists the secrets generated by this run, in order
+var vaultGenerated = struct {
+	sync.Mutex
+	secrets []GeneratedSecret
+}{}
+
+// VaultGenerated lists the secrets generated, or that would have been
+// generated in a dry run, since ResetVaultGenerated
+func VaultGenerated() []GeneratedSecret {
+	vaultGenerated.Lock()
+	defer vaultGenerated.Unlock()
+	return append([]GeneratedSecret{}, vaultGenerated.secrets...)
+}
+
+// ResetVaultGenerated forgets the secrets generated so far
+func ResetVaultGenerated() {
+	vaultGenerated.Lock()
+	vaultGenerated.secrets = nil
+	vaultGenerated.Unlock()
+}
+
+// vaultGeneratePolicy generates the keys of a secret. A policy with no keys
+// generates the one key it is asked for.
+type vaultGeneratePolicy struct {
+	keys     []string
+	generate func(key string, args []string) (map[string]interface{}, error)
+}
+
+// vaultGeneratePolicies are the policies vault-generate knows, by name
+var vaultGeneratePolicies = map[string]vaultGeneratePolicy{
+	"random": {generate: generateRandom},
+	"ssh":    {keys: []string{"private", "public", "fingerprint"}, generate: generateSSH},
+	"rsa":    {keys: []string{"private", "public"}, generate: generateRSA},
+	"cert":   {keys: []string{"certificate", "key"}, generate: generateCert},
+}
+
+// DefaultGeneratedLength is the length of random secrets, unless the
+// random policy is given another
+const DefaultGeneratedLength = 32
+
+// VaultGenerateOperator reads a secret like (( vault ... )) does, and creates
+// it in vault when it is not there
+type VaultGenerateOperator struct{}
+
+// Setup ...
+func (VaultGenerateOperator) Setup() error {
+	return nil
+}
+
+// Phase identifies when this operator runs
+func (VaultGenerateOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Sensitive marks the secrets vault-generate reads or writes as tainted
+func (VaultGenerateOperator) Sensitive() bool {
+	return true
+}
+
+// Dependencies returns the dependencies for this operator
+func (VaultGenerateOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run executes `(( vault-generate "path/to/secret:key" policy args... ))`
+func (VaultGenerateOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( vault-generate ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( vault-generate ... )) operation at $.%s\n", ev.Here)
+
+	if len(args) < 1 {
+		return nil, fmt.Errorf("vault-generate operator requires a secret path, optionally followed by a policy and its arguments")
+	}
+
+	var values []string
+	for i, arg := range args {
+		val, err := ResolveOperatorArgument(ev, arg)
+		if err != nil {
+			DEBUG("  arg[%d]: failed to resolve expression to a concrete value", i)
+			return nil, err
+		}
+		switch v := val.(type) {
+		case string:
+			values = append(values, v)
+		case int, int64, float64:
+			values = append(values, fmt.Sprintf("%v", v))
+		default:
+			return nil, ansi.Errorf("@R{vault-generate operator argument is not a string or a number}")
+		}
+	}
+
+	key, policy := values[0], "random"
+	if len(values) > 1 {
+		policy = values[1]
+	}
+	var policyArgs []string
+	if len(values) > 2 {
+		policyArgs = values[2:]
+	}
+
+	engine := graft.GetEngine(ev)
+	recordVaultRef(engine, ev.Target, key, ev.Here.String())
+
+	secret, err := generateVaultSecret(engine, key, ev.Target, policy, policyArgs)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		Type:  Replace,
+		Value: secret,
+	}, nil
+}
+
+func init() {
+	RegisterOp("vault-generate", VaultGenerateOperator{})
+}
+
+// generateVaultSecret returns the secret at key, in the form
+// path/to/secret:key, generating it with policy first if it is not in vault.
+// The other keys of the secret are left as they are.
+func generateVaultSecret(engine graft.Engine, key, targetName, policyName string, args []string) (string, error) {
+	ref, err := ParseVaultReference(key)
+	if err != nil {
+		return "", err
+	}
+	if ref.Version != 0 || ref.Metadata {
+		return "", ansi.Errorf("@R{invalid argument} @c{%s}@R{; vault-generate writes the latest version of a key, and cannot pin a version or read metadata}", key)
+	}
+	path, subkey := ref.Secret, ref.Key
+	policy, ok := vaultGeneratePolicies[policyName]
+	if !ok {
+		return "", ansi.Errorf("@R{unknown vault-generate policy} @c{%s}@R{; must be one of} @m{cert, random, rsa, ssh}", policyName)
+	}
+	keys := policy.keys
+	if keys == nil {
+		keys = []string{subkey}
+	} else if !containsString(keys, subkey) {
+		return "", ansi.Errorf("@R{the} @c{%s} @R{policy generates the keys} @m{%s}@R{, not} @c{%s}", policyName, strings.Join(keys, ", "), subkey)
+	}
+
+	// replays never write to vault; what was generated was recorded
+	secret, err := VaultOperator{}.performVaultLookup(engine, key, targetName)
+	if err == nil || !isVaultNotFound(err) || replaying() {
+		return secret, err
+	}
+
+	if VaultGenerateDryRun {
+		recordGenerated(GeneratedSecret{Target: targetName, Path: path, Keys: keys, Policy: policyName, Args: args})
+		return "REDACTED", nil
+	}
+
+	client, err := vaultClientFor(engine, targetName)
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := client.Get(path)
+	if err != nil {
+		if !isVaultNotFound(err) {
+			return "", err
+		}
+		existing = map[string]interface{}{}
+	}
+	for _, k := range keys {
+		if _, found := existing[k]; found {
+			return "", ansi.Errorf("@R{secret} @c{%s} @R{already has the key} @c{%s}@R{; refusing to generate the rest of a} @m{%s} @R{secret over it}", path, k, policyName)
+		}
+	}
+
+	generated, err := policy.generate(subkey, args)
+	if err != nil {
+		return "", ansi.Errorf("@R{unable to generate} @c{%s} @R{with the} @m{%s} @R{policy}: %s", key, policyName, err)
+	}
+	for k, v := range generated {
+		existing[k] = v
+	}
+	if err := client.Put(path, existing); err != nil {
+		return "", ansi.Errorf("@R{unable to write} @c{%s} @R{to vault}: %s", path, err)
+	}
+
+	target := targetName
+	if target == "" {
+		target = "default"
+	}
+	log.PrintfStdErr("AUDIT: vault-generate wrote %s (%s) with the %s policy (target: %s)\n", path, strings.Join(keys, ", "), policyName, target)
+	recordGenerated(GeneratedSecret{Target: targetName, Path: path, Keys: keys, Policy: policyName, Args: args, Written: true})
+
+	cacheKey := VaultOperator{}.getCacheKey(targetName, path)
+	engine.GetOperatorState().SetVaultCache(cacheKey, existing)
+	if targetName != "" {
+		vaultClientPool.cached(cacheKey)
+	}
+
+	recordLookup("vault", targetName, key, generated[subkey], false)
+	return generated[subkey].(string), nil
+}
+
+// recordGenerated adds secret to the secrets generated by this run. In a dry
+// run, a secret that is already listed is only listed once.
+func recordGenerated(secret GeneratedSecret) {
+	vaultGenerated.Lock()
+	defer vaultGenerated.Unlock()
+	for _, s := range vaultGenerated.secrets {
+		if s.Target == secret.Target && s.Path == secret.Path && containsString(s.Keys, secret.Keys[0]) {
+			return
+		}
+	}
+	vaultGenerated.secrets = append(vaultGenerated.secrets, secret)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+/****** POLICIES ********************************************/
+
+// alphanumeric characters make up random secrets, unless the random policy
+// is given others
+const alphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// generateRandom generates `random [length] [characters]`
+func generateRandom(key string, args []string) (map[string]interface{}, error) {
+	length, err := policyInt(args, 0, DefaultGeneratedLength)
+	if err != nil {
+		return nil, err
+	}
+	if length < 1 {
+		return nil, fmt.Errorf("length must be positive, not %d", length)
+	}
+	chars := alphanumeric
+	if len(args) > 1 && args[1] != "" {
+		chars = args[1]
+	}
+
+	var out strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return nil, err
+		}
+		out.WriteByte(chars[n.Int64()])
+	}
+	return map[string]interface{}{key: out.String()}, nil
+}
+
+// generateRSA generates `rsa [bits]`: a private key and its public key
+func generateRSA(_ string, args []string) (map[string]interface{}, error) {
+	key, err := generateRSAKey(args)
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"private": encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+		"public":  encodePEM("PUBLIC KEY", public),
+	}, nil
+}
+
+// generateSSH generates `ssh [bits]`: a private key, its public key in
+// authorized_keys form, and the SHA256 fingerprint of that
+func generateSSH(_ string, args []string) (map[string]interface{}, error) {
+	key, err := generateRSAKey(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ssh-rsa wire format: the key type, the exponent and the modulus
+	var wire bytes.Buffer
+	writeSSHField(&wire, []byte("ssh-rsa"))
+	writeSSHField(&wire, sshMPInt(big.NewInt(int64(key.E))))
+	writeSSHField(&wire, sshMPInt(key.N))
+	sum := sha256.Sum256(wire.Bytes())
+
+	return map[string]interface{}{
+		"private":     encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+		"public":      "ssh-rsa " + base64.StdEncoding.EncodeToString(wire.Bytes()),
+		"fingerprint": "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]),
+	}, nil
+}
+
+// generateCert generates `cert common-name [alternative names...]`: a
+// self-signed certificate, valid for a year, and its key
+func generateCert(_ string, args []string) (map[string]interface{}, error) {
+	if len(args) < 1 || args[0] == "" {
+		return nil, fmt.Errorf("a common name is required")
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: args[0]},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, name := range args {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"certificate": encodePEM("CERTIFICATE", der),
+		"key":         encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+	}, nil
+}
+
+// generateRSAKey generates an RSA key of the size given as the first policy
+// argument, 2048 bits by default
+func generateRSAKey(args []string) (*rsa.PrivateKey, error) {
+	bits, err := policyInt(args, 0, 2048)
+	if err != nil {
+		return nil, err
+	}
+	if bits < 1024 {
+		return nil, fmt.Errorf("keys must be at least 1024 bits, not %d", bits)
+	}
+	return rsa.GenerateKey(rand.Reader, bits)
+}
+
+// policyInt is the numeric policy argument at i, or def when there is none
+func policyInt(args []string, i, def int) (int, error) {
+	if len(args) <= i || args[i] == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(args[i])
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a number", args[i])
+	}
+	return n, nil
+}
+
+// writeSSHField writes a length-prefixed field of the SSH wire format
+func writeSSHField(wire *bytes.Buffer, field []byte) {
+	_ = binary.Write(wire, binary.BigEndian, uint32(len(field)))
+	wire.Write(field)
+}
+
+// sshMPInt is n in the mpint form of the SSH wire format, which needs a
+// leading zero byte to keep a positive number with its top bit set positive
+func sshMPInt(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+func encodePEM(kind string, der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}))
+}
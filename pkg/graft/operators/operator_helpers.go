@@ -15,6 +15,19 @@ func ResolveOperatorArgument(ev *Evaluator, arg *Expr) (interface{}, error) {
 		return nil, nil
 	}
 
+	done := ev.TraceArgument(arg)
+	val, err := resolveOperatorArgument(ev, arg)
+	done(val, err)
+	return val, err
+}
+
+// resolveOperatorArgument does the work of ResolveOperatorArgument, which
+// records each argument in the evaluation trace
+func resolveOperatorArgument(ev *Evaluator, arg *Expr) (interface{}, error) {
+	if arg == nil {
+		return nil, nil
+	}
+
 	switch arg.Type {
 	case Literal:
 		return arg.Literal, nil
@@ -31,6 +44,7 @@ func ResolveOperatorArgument(ev *Evaluator, arg *Expr) (interface{}, error) {
 			// Format the error message to match the expected format
 			return nil, fmt.Errorf("Unable to resolve `%s`: %s", arg.Reference.String(), err)
 		}
+		ev.TaintFrom(arg.Reference)
 		return val, nil
 
 	case EnvVar:
@@ -91,8 +105,9 @@ func evaluateNestedOperator(ev *Evaluator, expr *Expr) (interface{}, error) {
 		return nil, fmt.Errorf("unknown operator: %s", opName)
 	}
 
-	// Create a temporary opcall for the nested operator
-	opcall := graft.NewOpcall(op, args, "")
+	// Create a temporary opcall for the nested operator, keeping the @target
+	// the parser found for it
+	opcall := graft.NewNamedOpcall(opName, expr.Target, op, args, "")
 
 	// Set the where field to the current evaluator's position
 	// This is important for operators like vault that use ev.Here
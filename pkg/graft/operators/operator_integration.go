@@ -354,7 +354,7 @@ func parseOpcallWithOriginalParser(phase OperatorPhase, src string) (*Opcall, er
 		for i, arg := range args {
 			DEBUG("    arg[%d]: %s", i, arg)
 		}
-		return graft.NewOpcall(op, args, src), nil
+		return graft.NewNamedOpcall(opname, "", op, args, src), nil
 	}
 	DEBUG("parsing `%s': not an operator (no match)", src)
 	return nil, nil
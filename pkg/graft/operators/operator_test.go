@@ -19,6 +19,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 	vaultkv "github.com/cloudfoundry-community/vaultkv"
+	"github.com/cppforlife/go-patch/patch"
 	"github.com/geofffranks/simpleyaml"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/wayneeseguin/graft/internal/utils/ansi"
@@ -81,6 +82,10 @@ func (e *TestEngine) MergeReaders(ctx context.Context, readers ...io.Reader) gra
 func (e *TestEngine) Evaluate(ctx context.Context, doc graft.Document) (graft.Document, error) {
 	return nil, nil
 }
+func (e *TestEngine) Diff(from, to graft.Document, options graft.DiffOptions) ([]graft.DiffChange, error) {
+	return nil, nil
+}
+func (e *TestEngine) GoPatch(from, to graft.Document) (patch.Ops, error)             { return nil, nil }
 func (e *TestEngine) ToYAML(doc graft.Document) ([]byte, error)                      { return nil, nil }
 func (e *TestEngine) ToJSON(doc graft.Document) ([]byte, error)                      { return nil, nil }
 func (e *TestEngine) ToJSONIndent(doc graft.Document, indent string) ([]byte, error) { return nil, nil }
@@ -0,0 +1,320 @@
+package operators
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-community/vaultkv"
+	"github.com/geofffranks/yaml"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+// SecretBundle holds secrets that answer vault, awsparam and awssecret calls
+// in place of Vault and AWS, for merges that cannot reach them
+type SecretBundle struct {
+	Vault     map[string]map[string]interface{} `yaml:"vault"`
+	AwsParam  map[string]string                 `yaml:"awsparam"`
+	AwsSecret map[string]string                 `yaml:"awssecret"`
+	Targets   map[string]*SecretBundle          `yaml:"targets"`
+}
+
+// secretBundleEnvelope is an encrypted secret bundle, as kept on disk. The
+// bundle is sealed with AES-256-GCM, under a key derived from a passphrase.
+type secretBundleEnvelope struct {
+	Format     int    `yaml:"graft_secret_bundle"`
+	Cipher     string `yaml:"cipher"`
+	KDF        string `yaml:"kdf"`
+	Iterations int    `yaml:"iterations"`
+	Salt       string `yaml:"salt"`
+	Nonce      string `yaml:"nonce"`
+	Data       string `yaml:"data"`
+}
+
+const (
+	secretBundleFormat     = 1
+	secretBundleCipher     = "aes-256-gcm"
+	secretBundleKDF        = "pbkdf2-sha256"
+	secretBundleIterations = 600000
+)
+
+// secretBundle is the bundle in use, if any. While it is set, vault,
+// awsparam and awssecret calls never reach Vault or AWS.
+var secretBundle *SecretBundle
+
+// UseSecretBundle answers vault, awsparam and awssecret calls from bundle,
+// or from Vault and AWS again when bundle is nil
+func UseSecretBundle(bundle *SecretBundle) {
+	if bundle != secretBundle {
+		// values cached for targets must not outlive the source they came from
+		awsTargetPool.ClearCaches()
+	}
+	secretBundle = bundle
+}
+
+// LoadSecretBundle reads the secret bundle at path, decrypting it with
+// passphrase
+func LoadSecretBundle(path, passphrase string) (*SecretBundle, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - the bundle is named by the user
+	if err != nil {
+		return nil, ansi.Errorf("@R{unable to read secret bundle} @c{%s}: %s", path, err)
+	}
+	bundle, err := ParseSecretBundle(data, passphrase)
+	if err != nil {
+		return nil, ansi.Errorf("@R{unable to load secret bundle} @c{%s}: %s", path, err)
+	}
+	return bundle, nil
+}
+
+// ParseSecretBundle decrypts data with passphrase and parses the bundle in
+// it. Bundles that were never encrypted, like test fixtures, are parsed as
+// they are.
+func ParseSecretBundle(data []byte, passphrase string) (*SecretBundle, error) {
+	if isEncryptedSecretBundle(data) {
+		var err error
+		if data, err = DecryptSecretBundle(data, passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("not a secret bundle: %s", err)
+	}
+	for key := range raw {
+		switch key {
+		case "vault", "awsparam", "awssecret", "targets":
+		default:
+			return nil, fmt.Errorf("unknown key %q; a secret bundle holds vault, awsparam, awssecret and targets", key)
+		}
+	}
+
+	bundle := &SecretBundle{}
+	if err := yaml.Unmarshal(data, bundle); err != nil {
+		return nil, fmt.Errorf("not a secret bundle: %s", err)
+	}
+	bundle.stringify()
+	return bundle, nil
+}
+
+// stringify turns the scalar values of vault secrets into the strings vault
+// would hold, so that `port: 5432` reads the same as `port: "5432"`
+func (b *SecretBundle) stringify() {
+	for _, secret := range b.Vault {
+		for key, value := range secret {
+			switch value.(type) {
+			case string, map[interface{}]interface{}, []interface{}, nil:
+			default:
+				secret[key] = fmt.Sprintf("%v", value)
+			}
+		}
+	}
+	for _, target := range b.Targets {
+		if target != nil {
+			target.stringify()
+		}
+	}
+}
+
+// target returns the secrets of targetName, "" being the default. A target
+// missing from the bundle holds no secrets.
+func (b *SecretBundle) target(targetName string) *SecretBundle {
+	if targetName == "" {
+		return b
+	}
+	if t, ok := b.Targets[targetName]; ok && t != nil {
+		return t
+	}
+	return &SecretBundle{}
+}
+
+// isEncryptedSecretBundle tells an encrypted bundle from a plain one
+func isEncryptedSecretBundle(data []byte) bool {
+	var envelope secretBundleEnvelope
+	return yaml.Unmarshal(data, &envelope) == nil && envelope.Format != 0
+}
+
+// EncryptSecretBundle seals plain, a secret bundle, with passphrase
+func EncryptSecretBundle(plain []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("a passphrase is required to encrypt a secret bundle")
+	}
+	if isEncryptedSecretBundle(plain) {
+		return nil, fmt.Errorf("the secret bundle is already encrypted")
+	}
+	if _, err := ParseSecretBundle(plain, ""); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := passphraseCipher(passphrase, salt, secretBundleIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(secretBundleEnvelope{
+		Format:     secretBundleFormat,
+		Cipher:     secretBundleCipher,
+		KDF:        secretBundleKDF,
+		Iterations: secretBundleIterations,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Data:       base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plain, nil)),
+	})
+}
+
+// DecryptSecretBundle opens data, an encrypted secret bundle, with passphrase
+func DecryptSecretBundle(data []byte, passphrase string) ([]byte, error) {
+	var envelope secretBundleEnvelope
+	if err := yaml.Unmarshal(data, &envelope); err != nil || envelope.Format == 0 {
+		return nil, fmt.Errorf("not an encrypted secret bundle")
+	}
+	if envelope.Format != secretBundleFormat || envelope.Cipher != secretBundleCipher || envelope.KDF != secretBundleKDF {
+		return nil, fmt.Errorf("unsupported secret bundle (format %d, %s, %s)", envelope.Format, envelope.Cipher, envelope.KDF)
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("the secret bundle is encrypted; set GRAFT_SECRETS_KEY or GRAFT_SECRETS_KEY_FILE to its passphrase")
+	}
+
+	salt, err1 := base64.StdEncoding.DecodeString(envelope.Salt)
+	nonce, err2 := base64.StdEncoding.DecodeString(envelope.Nonce)
+	sealed, err3 := base64.StdEncoding.DecodeString(envelope.Data)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, fmt.Errorf("the secret bundle is corrupt")
+	}
+	gcm, err := passphraseCipher(passphrase, salt, envelope.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("the secret bundle is corrupt")
+	}
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt the secret bundle; wrong passphrase?")
+	}
+	return plain, nil
+}
+
+// passphraseCipher derives the AES-256-GCM cipher of passphrase, for secret
+// bundles and recorded lookups
+func passphraseCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations < 1 {
+		return nil, fmt.Errorf("the secret bundle is corrupt")
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// bundleVaultClient is a graft.VaultClient that reads the vault secrets of a
+// secret bundle. Bundles are read-only.
+type bundleVaultClient struct {
+	bundle *SecretBundle
+}
+
+var _ graft.VaultClient = bundleVaultClient{}
+
+// Get reads the secret at path
+func (c bundleVaultClient) Get(path string) (map[string]interface{}, error) {
+	secret, ok := c.bundle.Vault[strings.Trim(path, "/")]
+	if !ok {
+		return nil, &vaultkv.ErrNotFound{}
+	}
+	ret := make(map[string]interface{}, len(secret))
+	for k, v := range secret {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+// List lists the secrets beneath path
+func (c bundleVaultClient) List(path string) ([]string, error) {
+	prefix := strings.Trim(path, "/") + "/"
+	seen := map[string]bool{}
+	for secret := range c.bundle.Vault {
+		// pinned versions and metadata are not secrets of their own
+		if !strings.HasPrefix(secret, prefix) || strings.HasSuffix(secret, "@metadata") || vaultVersionPin.MatchString(secret) {
+			continue
+		}
+		name := strings.TrimPrefix(secret, prefix)
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i+1]
+		}
+		seen[name] = true
+	}
+	if len(seen) == 0 {
+		return nil, &vaultkv.ErrNotFound{}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Put refuses to write, since bundles are read-only
+func (c bundleVaultClient) Put(path string, data map[string]interface{}) error {
+	return ansi.Errorf("@R{cannot write} @c{%s}@R{; the secret bundle is read-only}", path)
+}
+
+// vaultClientFor returns the client that vault calls to targetName go
+// through: the secret bundle when one is in use, else vault itself
+func vaultClientFor(engine graft.Engine, targetName string) (graft.VaultClient, error) {
+	if secretBundle != nil {
+		return bundleVaultClient{bundle: secretBundle.target(targetName)}, nil
+	}
+	kv, err := vaultKV(engine, targetName)
+	if err != nil {
+		return nil, err
+	}
+	return vaultKVClient{kv: kv}, nil
+}
+
+// getBundleVaultSecret reads the secret ref names from the secret bundle.
+// Pinned versions and metadata are kept in the bundle as path@vN and
+// path@metadata; a pinned version the bundle does not hold is an error.
+func getBundleVaultSecret(targetName string, ref VaultReference) (map[string]interface{}, error) {
+	client := bundleVaultClient{bundle: secretBundle.target(targetName)}
+	secret, err := client.Get(ref.Secret + ref.cacheSuffix())
+	if err != nil && ref.Version != 0 {
+		return nil, fmt.Errorf("version %d of %s not found in the secret bundle", ref.Version, ref.Secret)
+	}
+	return secret, err
+}
+
+// getBundleAwsValue reads the awsparam or awssecret key of targetName from
+// the secret bundle
+func getBundleAwsValue(variant, targetName, key string) (string, error) {
+	values := secretBundle.target(targetName).AwsParam
+	if variant == "awssecret" {
+		values = secretBundle.target(targetName).AwsSecret
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("%s not found in the secret bundle", key)
+	}
+	return value, nil
+}
@@ -0,0 +1,142 @@
+package operators
+
+import (
+	"testing"
+
+	"github.com/geofffranks/simpleyaml"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSecretBundle(t *testing.T) {
+	YAML := func(s string) map[interface{}]interface{} {
+		y, err := simpleyaml.NewYaml([]byte(s))
+		So(err, ShouldBeNil)
+
+		data, err := y.Map()
+		So(err, ShouldBeNil)
+
+		return data
+	}
+	merge := func(doc string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: YAML(doc)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	plain := []byte(`
+vault:
+  secret/db:
+    password: hunter2
+    port: 5432
+  secret/db@v2:
+    password: old-hunter
+  secret/db@metadata:
+    created_time: "2024-01-01T00:00:00Z"
+  secret/apps/api:
+    key: api-key
+awsparam:
+  /app/db/password: from-ssm
+awssecret:
+  app/db-admin: '{"password":"admin-pw"}'
+targets:
+  production:
+    vault:
+      secret/db:
+        password: prod-hunter
+    awssecret:
+      app/token: prod-token
+`)
+
+	Convey("secret bundles", t, func() {
+		Convey("can be encrypted and decrypted with a passphrase", func() {
+			sealed, err := EncryptSecretBundle(plain, "correct horse")
+			So(err, ShouldBeNil)
+			So(string(sealed), ShouldNotContainSubstring, "hunter2")
+
+			opened, err := DecryptSecretBundle(sealed, "correct horse")
+			So(err, ShouldBeNil)
+			So(string(opened), ShouldEqual, string(plain))
+
+			_, err = DecryptSecretBundle(sealed, "battery staple")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "wrong passphrase")
+
+			_, err = ParseSecretBundle(sealed, "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "set GRAFT_SECRETS_KEY")
+
+			bundle, err := ParseSecretBundle(sealed, "correct horse")
+			So(err, ShouldBeNil)
+			So(bundle.AwsParam["/app/db/password"], ShouldEqual, "from-ssm")
+		})
+
+		Convey("refuse what they do not know", func() {
+			_, err := ParseSecretBundle([]byte("vault: {}\nnats: {}\n"), "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `unknown key "nats"`)
+
+			_, err = EncryptSecretBundle(plain, "")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("answer vault, awsparam and awssecret calls in place of Vault and AWS", func() {
+			bundle, err := ParseSecretBundle(plain, "")
+			So(err, ShouldBeNil)
+			UseSecretBundle(bundle)
+			defer UseSecretBundle(nil)
+
+			tree, err := merge(`
+password: (( vault "secret/db:password" ))
+port:     (( vault "secret/db:port" ))
+pinned:   (( vault "secret/db:password@v2" ))
+unpinned: (( vault "secret/db:password@v9" || "no-v9" ))
+created:  (( vault "secret/db:@created_time" ))
+fallback: (( vault "secret/missing:password" || "default" ))
+prod:     (( vault@production "secret/db:password" ))
+param:    (( awsparam "/app/db/password" ))
+secret:   (( awssecret "app/db-admin?key=password" ))
+token:    (( awssecret@production "app/token" ))
+`)
+			So(err, ShouldBeNil)
+			So(tree["password"], ShouldEqual, "hunter2")
+			So(tree["port"], ShouldEqual, "5432")
+			So(tree["pinned"], ShouldEqual, "old-hunter")
+			So(tree["unpinned"], ShouldEqual, "no-v9")
+			So(tree["created"], ShouldEqual, "2024-01-01T00:00:00Z")
+			So(tree["fallback"], ShouldEqual, "default")
+			So(tree["prod"], ShouldEqual, "prod-hunter")
+			So(tree["param"], ShouldEqual, "from-ssm")
+			So(tree["secret"], ShouldEqual, "admin-pw")
+			So(tree["token"], ShouldEqual, "prod-token")
+
+			_, err = merge(`x: (( vault "secret/missing:password" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "secret secret/missing:password not found")
+
+			_, err = merge(`x: (( vault "secret/db:password@v9" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "version 9 of secret/db not found in the secret bundle")
+
+			_, err = merge(`x: (( awsparam "/app/missing" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "/app/missing not found in the secret bundle")
+		})
+
+		Convey("are read-only", func() {
+			bundle, err := ParseSecretBundle(plain, "")
+			So(err, ShouldBeNil)
+			UseSecretBundle(bundle)
+			defer UseSecretBundle(nil)
+			VaultGenerateMissing = true
+			defer func() { VaultGenerateMissing = false }()
+
+			_, err = merge(`x: (( vault-generate "secret/new:password" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "the secret bundle is read-only")
+
+			names, err := bundleVaultClient{bundle: bundle}.List("secret")
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"apps/", "db"})
+		})
+	})
+}
@@ -0,0 +1,138 @@
+package operators
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/geofffranks/simpleyaml"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/wayneeseguin/graft/log"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+func TestTaintTracking(t *testing.T) {
+	YAML := func(s string) map[interface{}]interface{} {
+		y, err := simpleyaml.NewYaml([]byte(s))
+		So(err, ShouldBeNil)
+
+		data, err := y.Map()
+		So(err, ShouldBeNil)
+
+		return data
+	}
+
+	Convey("values from sensitive operators", t, func() {
+		bundle, err := ParseSecretBundle([]byte(`
+vault:
+  secret/db: {password: hunter2}
+awsparam:
+  /app/token: s3cr3t-token
+`), "")
+		So(err, ShouldBeNil)
+		UseSecretBundle(bundle)
+		defer UseSecretBundle(nil)
+
+		So(graft.IsSensitive(VaultOperator{}), ShouldBeTrue)
+		So(graft.IsSensitive(AwsOperator{variant: "awsparam"}), ShouldBeTrue)
+		So(graft.IsSensitive(GrabOperator{}), ShouldBeFalse)
+
+		ev := &Evaluator{Tree: YAML(`
+meta:
+  user: admin
+  password: (( vault "secret/db:password" ))
+creds:   (( grab meta ))
+url:     (( concat "postgres://" meta.user ":" meta.password "@db" ))
+encoded: (( base64 meta.password ))
+inline:  (( concat "token-" (awsparam "/app/token") ))
+user:    (( grab meta.user ))
+joined:  (( join ":" meta.user meta.password ))
+dumped:  (( stringify meta ))
+key:     password
+picked:  (( grab (concat "meta." key) ))
+jobs:
+- name: web
+  password: (( grab meta.password ))
+`)}
+		ev.Trace = graft.NewEvalTrace()
+		So(ev.RunPhase(EvalPhase), ShouldBeNil)
+
+		Convey("taint what they produce and everything derived from it", func() {
+			vault := graft.TaintSource{Path: "meta.password", Operator: "vault", Source: `(( vault "secret/db:password" ))`}
+			So(ev.Taints(), ShouldResemble, map[string]graft.TaintSource{
+				"meta.password":     vault,
+				"creds.password":    vault,
+				"url":               vault,
+				"encoded":           vault,
+				"jobs.web.password": vault,
+				"joined":            vault,
+				"dumped":            vault,
+				"picked":            vault,
+				"inline":            {Path: "inline", Operator: "awsparam", Source: `(( awsparam "/app/token" ))`},
+			})
+		})
+
+		Convey("are never written to debug logging", func() {
+			var stderr string
+			was, wasOn := log.PrintfStdErr, log.DebugOn
+			defer func() { log.PrintfStdErr, log.DebugOn = was, wasOn }()
+			log.PrintfStdErr = func(format string, args ...interface{}) {
+				stderr += fmt.Sprintf(format, args...)
+			}
+			log.DebugOn = true
+
+			DEBUG("resolved to %s, %s and %s", "hunter2", "aHVudGVyMg==", "token-s3cr3t-token")
+			So(stderr, ShouldEqual, "DEBUG> resolved to REDACTED, REDACTED and REDACTED\n")
+		})
+
+		Convey("are masked in the evaluation trace", func() {
+			for _, e := range ev.Trace.Entries("") {
+				if e.Path != "user" {
+					So(fmt.Sprintf("%v", e.Value), ShouldNotContainSubstring, "hunter2")
+					So(fmt.Sprintf("%v", e.Value), ShouldNotContainSubstring, "s3cr3t")
+				}
+				for _, input := range e.Inputs {
+					So(fmt.Sprintf("%v", input.Value), ShouldNotContainSubstring, "hunter2")
+				}
+			}
+			So(ev.Trace.Entries("user")[0].Value, ShouldEqual, "admin")
+		})
+	})
+
+	Convey("defaults of sensitive operators", t, func() {
+		bundle, err := ParseSecretBundle([]byte(`
+vault:
+  secret/db: {password: hunter2}
+`), "")
+		So(err, ShouldBeNil)
+		UseSecretBundle(bundle)
+		defer UseSecretBundle(nil)
+
+		ev := &Evaluator{Tree: YAML(`
+meta:
+  plain:    not-a-secret
+  password: (( vault "secret/db:password" ))
+literal: (( vault "secret/missing:password" || "fallback" ))
+plain:   (( vault "secret/missing:password" || meta.plain ))
+secret:  (( vault "secret/missing:password" || meta.password ))
+`)}
+		ev.Trace = graft.NewEvalTrace()
+		So(ev.RunPhase(EvalPhase), ShouldBeNil)
+		So(ev.Tree["literal"], ShouldEqual, "fallback")
+		So(ev.Tree["plain"], ShouldEqual, "not-a-secret")
+		So(ev.Tree["secret"], ShouldEqual, "hunter2")
+
+		Convey("carry only the taint of their own expression", func() {
+			vault := graft.TaintSource{Path: "meta.password", Operator: "vault", Source: `(( vault "secret/db:password" ))`}
+			So(ev.Taints(), ShouldResemble, map[string]graft.TaintSource{
+				"meta.password": vault,
+				"secret":        vault,
+			})
+		})
+
+		Convey("are recorded as they are in the evaluation trace", func() {
+			So(ev.Trace.Entries("literal")[0].Value, ShouldEqual, "fallback")
+			So(ev.Trace.Entries("plain")[0].Value, ShouldEqual, "not-a-secret")
+			So(ev.Trace.Entries("secret")[0].Value, ShouldEqual, "REDACTED")
+		})
+	})
+}
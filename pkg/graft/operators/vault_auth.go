@@ -0,0 +1,345 @@
+package operators
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-community/vaultkv"
+)
+
+// DefaultKubernetesJWTFile is where Kubernetes mounts the service account
+// token that the kubernetes auth method logs in with
+const DefaultKubernetesJWTFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultAuthMethod logs a vault client in. Login sets the token of the client
+// and returns the lease it was issued with.
+type VaultAuthMethod interface {
+	Login(client *vaultkv.Client) (*VaultLease, error)
+}
+
+// VaultLease is a token issued by an auth method. A Duration of zero means
+// the token does not expire.
+type VaultLease struct {
+	Token     string
+	Duration  time.Duration
+	Renewable bool
+}
+
+// vaultAuthMethods builds each auth method from the settings of a target
+var vaultAuthMethods = map[string]func(config *VaultTarget) (VaultAuthMethod, error){}
+
+// RegisterVaultAuthMethod makes an auth method available to the default
+// vault client and to vault targets, under name
+func RegisterVaultAuthMethod(name string, build func(config *VaultTarget) (VaultAuthMethod, error)) {
+	vaultAuthMethods[name] = build
+}
+
+func init() {
+	RegisterVaultAuthMethod("token", newTokenAuth)
+	RegisterVaultAuthMethod("approle", newAppRoleAuth)
+	RegisterVaultAuthMethod("kubernetes", newKubernetesAuth)
+	RegisterVaultAuthMethod("userpass", newUserpassAuth)
+	RegisterVaultAuthMethod("cert", newCertAuth)
+}
+
+// vaultAuthMethodNames lists the registered auth methods, in order
+func vaultAuthMethodNames() []string {
+	names := make([]string, 0, len(vaultAuthMethods))
+	for name := range vaultAuthMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newVaultAuthMethod builds the auth method config asks for, token if it
+// names none
+func newVaultAuthMethod(config *VaultTarget) (VaultAuthMethod, error) {
+	name := config.AuthMethod
+	if name == "" {
+		name = "token"
+	}
+	build, ok := vaultAuthMethods[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported auth method '%s' (must be one of %s)", name, strings.Join(vaultAuthMethodNames(), ", "))
+	}
+	return build(config)
+}
+
+// usesToken reports whether config authenticates with a token it is given,
+// rather than one it logs in for
+func (config *VaultTarget) usesToken() bool {
+	return config.AuthMethod == "" || config.AuthMethod == "token"
+}
+
+// authMount is where the auth method of config is mounted, under auth/
+func (config *VaultTarget) authMount(method string) string {
+	if mount := strings.Trim(os.ExpandEnv(config.AuthMount), "/"); mount != "" {
+		return mount
+	}
+	return method
+}
+
+// vaultAuthFromEnv reads the auth settings given by the environment
+// variables starting with prefix (VAULT_ or VAULT_<TARGET>_) on top of those
+// in config
+func vaultAuthFromEnv(config *VaultTarget, prefix string) {
+	config.AuthMethod = getEnvOrDefault(prefix+"AUTH_METHOD", config.AuthMethod)
+	config.AuthMount = getEnvOrDefault(prefix+"AUTH_MOUNT", config.AuthMount)
+	config.AuthRole = getEnvOrDefault(prefix+"AUTH_ROLE", config.AuthRole)
+	config.RoleID = getEnvOrDefault(prefix+"ROLE_ID", config.RoleID)
+	config.SecretID = getEnvOrDefault(prefix+"SECRET_ID", config.SecretID)
+	config.JWTFile = getEnvOrDefault(prefix+"AUTH_JWT_FILE", config.JWTFile)
+	config.Username = getEnvOrDefault(prefix+"AUTH_USERNAME", config.Username)
+	config.Password = getEnvOrDefault(prefix+"AUTH_PASSWORD", config.Password)
+}
+
+/****** AUTH METHODS ****************************************/
+
+// tokenAuth uses a token it is given, as is
+type tokenAuth struct {
+	token string
+}
+
+func newTokenAuth(config *VaultTarget) (VaultAuthMethod, error) {
+	return tokenAuth{token: os.ExpandEnv(config.Token)}, nil
+}
+
+func (a tokenAuth) Login(client *vaultkv.Client) (*VaultLease, error) {
+	client.SetAuthToken(a.token)
+	return &VaultLease{Token: a.token}, nil
+}
+
+// appRoleAuth logs in with a role ID and, unless the role does not need one,
+// a secret ID
+type appRoleAuth struct {
+	mount, roleID, secretID string
+}
+
+func newAppRoleAuth(config *VaultTarget) (VaultAuthMethod, error) {
+	a := appRoleAuth{
+		mount:    config.authMount("approle"),
+		roleID:   os.ExpandEnv(config.RoleID),
+		secretID: os.ExpandEnv(config.SecretID),
+	}
+	if a.roleID == "" {
+		return nil, fmt.Errorf("the approle auth method needs a role_id")
+	}
+	return a, nil
+}
+
+func (a appRoleAuth) Login(client *vaultkv.Client) (*VaultLease, error) {
+	out, err := client.AuthApproleMount(a.mount, a.roleID, a.secretID)
+	if err != nil {
+		return nil, err
+	}
+	return leaseFromAuthOutput(client, out), nil
+}
+
+// userpassAuth logs in with a username and password
+type userpassAuth struct {
+	mount, username, password string
+}
+
+func newUserpassAuth(config *VaultTarget) (VaultAuthMethod, error) {
+	a := userpassAuth{
+		mount:    config.authMount("userpass"),
+		username: os.ExpandEnv(config.Username),
+		password: os.ExpandEnv(config.Password),
+	}
+	if a.username == "" || a.password == "" {
+		return nil, fmt.Errorf("the userpass auth method needs a username and a password")
+	}
+	return a, nil
+}
+
+func (a userpassAuth) Login(client *vaultkv.Client) (*VaultLease, error) {
+	out, err := client.AuthUserpassMount(a.mount, a.username, a.password)
+	if err != nil {
+		return nil, err
+	}
+	return leaseFromAuthOutput(client, out), nil
+}
+
+// kubernetesAuth logs in with the service account token of the pod graft
+// runs in, as a role
+type kubernetesAuth struct {
+	mount, role, jwtFile string
+}
+
+func newKubernetesAuth(config *VaultTarget) (VaultAuthMethod, error) {
+	a := kubernetesAuth{
+		mount:   config.authMount("kubernetes"),
+		role:    os.ExpandEnv(config.AuthRole),
+		jwtFile: os.ExpandEnv(config.JWTFile),
+	}
+	if a.role == "" {
+		return nil, fmt.Errorf("the kubernetes auth method needs a role")
+	}
+	if a.jwtFile == "" {
+		a.jwtFile = DefaultKubernetesJWTFile
+	}
+	return a, nil
+}
+
+func (a kubernetesAuth) Login(client *vaultkv.Client) (*VaultLease, error) {
+	// the token is read at every login, since kubernetes rotates it
+	// #nosec G304 - the token file is named by the user's configuration
+	jwt, err := os.ReadFile(a.jwtFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account token: %s", err)
+	}
+	return vaultLoginRequest(client, "auth/"+a.mount+"/login", map[string]string{
+		"role": a.role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+}
+
+// certAuth logs in with the TLS client certificate of the target, optionally
+// as one of the certificate roles
+type certAuth struct {
+	mount, role string
+}
+
+func newCertAuth(config *VaultTarget) (VaultAuthMethod, error) {
+	if config.ClientCert == "" || config.ClientKey == "" {
+		return nil, fmt.Errorf("the cert auth method needs a client certificate and key")
+	}
+	return certAuth{mount: config.authMount("cert"), role: os.ExpandEnv(config.AuthRole)}, nil
+}
+
+func (a certAuth) Login(client *vaultkv.Client) (*VaultLease, error) {
+	body := map[string]string{}
+	if a.role != "" {
+		body["name"] = a.role
+	}
+	return vaultLoginRequest(client, "auth/"+a.mount+"/login", body)
+}
+
+// leaseFromAuthOutput is the lease of a login done by the vaultkv client
+func leaseFromAuthOutput(client *vaultkv.Client, out *vaultkv.AuthOutput) *VaultLease {
+	client.SetAuthToken(out.ClientToken)
+	return &VaultLease{Token: out.ClientToken, Duration: out.LeaseDuration, Renewable: out.Renewable}
+}
+
+// vaultLoginRequest posts body to an auth endpoint at path, and logs client
+// in with the token that comes back. Renewing a token answers the same way.
+func vaultLoginRequest(client *vaultkv.Client, path string, body interface{}) (*VaultLease, error) {
+	var in bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&in).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := client.Curl("POST", path, nil, &in)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Errors []string `json:"errors"`
+		Auth   struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+			Renewable     bool   `json:"renewable"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("unable to parse the response of vault to %s: %s", path, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		if len(out.Errors) == 0 {
+			return nil, fmt.Errorf("vault answered %s to %s", resp.Status, path)
+		}
+		return nil, fmt.Errorf("%s", strings.Join(out.Errors, "; "))
+	}
+	if out.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("vault did not return a token from %s", path)
+	}
+
+	client.SetAuthToken(out.Auth.ClientToken)
+	return &VaultLease{
+		Token:     out.Auth.ClientToken,
+		Duration:  time.Duration(out.Auth.LeaseDuration) * time.Second,
+		Renewable: out.Auth.Renewable,
+	}, nil
+}
+
+/****** LEASES **********************************************/
+
+// vaultSession is the login of one vault client, kept so that its token can
+// be renewed before the lease runs out
+type vaultSession struct {
+	sync.Mutex
+	method VaultAuthMethod
+	lease  VaultLease
+	issued time.Time
+}
+
+// vaultSessions holds the session of every client that logged in
+var vaultSessions = struct {
+	sync.Mutex
+	byClient map[*vaultkv.Client]*vaultSession
+}{byClient: map[*vaultkv.Client]*vaultSession{}}
+
+// vaultLogin logs client in with method, and remembers the lease so that
+// refreshVaultLogin can keep it going
+func vaultLogin(client *vaultkv.Client, method VaultAuthMethod) error {
+	lease, err := method.Login(client)
+	if err != nil {
+		return err
+	}
+	DEBUG("vault: logged in, lease of %s (renewable: %t)", lease.Duration, lease.Renewable)
+
+	vaultSessions.Lock()
+	vaultSessions.byClient[client] = &vaultSession{method: method, lease: *lease, issued: time.Now()}
+	vaultSessions.Unlock()
+	return nil
+}
+
+// refreshVaultLogin renews the token of kv once less than a third of its
+// lease is left, or logs in again if it cannot be renewed. Without it, a
+// long merge could outlive the token it started with.
+func refreshVaultLogin(kv *vaultkv.KV) error {
+	if kv == nil || kv.Client == nil {
+		return nil
+	}
+	vaultSessions.Lock()
+	session, ok := vaultSessions.byClient[kv.Client]
+	vaultSessions.Unlock()
+	if !ok {
+		return nil
+	}
+
+	session.Lock()
+	defer session.Unlock()
+	if session.lease.Duration <= 0 || time.Since(session.issued) < session.lease.Duration*2/3 {
+		return nil
+	}
+
+	if session.lease.Renewable {
+		lease, err := vaultLoginRequest(kv.Client, "auth/token/renew-self", nil)
+		if err == nil && lease.Duration > 0 {
+			DEBUG("vault: renewed token, lease of %s", lease.Duration)
+			session.lease, session.issued = *lease, time.Now()
+			return nil
+		}
+		DEBUG("vault: unable to renew token (%v), logging in again", err)
+	}
+
+	lease, err := session.method.Login(kv.Client)
+	if err != nil {
+		return fmt.Errorf("unable to log in to vault again: %s", err)
+	}
+	DEBUG("vault: logged in again, lease of %s", lease.Duration)
+	session.lease, session.issued = *lease, time.Now()
+	return nil
+}
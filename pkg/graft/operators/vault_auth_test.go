@@ -0,0 +1,284 @@
+package operators
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-community/vaultkv"
+	"github.com/geofffranks/simpleyaml"
+)
+
+// vaultAuthStandIn answers the auth endpoints of vault, handing out a token
+// per login, and serves secret/db to whoever holds a current one
+type vaultAuthStandIn struct {
+	*httptest.Server
+	sync.Mutex
+	logins, renewals int
+	renewable        bool
+	tokens           map[string]bool
+}
+
+func newVaultAuthStandIn(t *testing.T) *vaultAuthStandIn {
+	v := &vaultAuthStandIn{renewable: true, tokens: map[string]bool{}}
+	v.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v.Lock()
+		defer v.Unlock()
+
+		body := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		login := func(ok bool) {
+			if !ok {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, `{"errors":["invalid credentials"]}`)
+				return
+			}
+			v.logins++
+			token := fmt.Sprintf("s.login-%d", v.logins)
+			v.tokens[token] = true
+			fmt.Fprintf(w, `{"auth":{"client_token":%q,"lease_duration":3600,"renewable":%t}}`, token, v.renewable)
+		}
+
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			login(body["role_id"] == "graft-ci" && body["secret_id"] == "s3cr3t")
+		case "/v1/auth/k8s/login":
+			login(body["role"] == "graft" && body["jwt"] == "service-account-jwt")
+		case "/v1/auth/userpass/login/alice":
+			login(body["password"] == "hunter2")
+		case "/v1/auth/cert/login":
+			login(body["name"] == "web")
+		case "/v1/auth/token/renew-self":
+			if !v.tokens[r.Header.Get("X-Vault-Token")] || !v.renewable {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, `{"errors":["lease is not renewable"]}`)
+				return
+			}
+			v.renewals++
+			fmt.Fprintf(w, `{"auth":{"client_token":%q,"lease_duration":3600,"renewable":true}}`, r.Header.Get("X-Vault-Token"))
+		case "/v1/sys/internal/ui/mounts":
+			fmt.Fprintf(w, `{"data":{"secret":{"secret/":{"type":"kv","options":{"version":"1"}}}}}`)
+		case "/v1/secret/moved":
+			http.Redirect(w, r, "/v1/secret/db", http.StatusTemporaryRedirect)
+		case "/v1/secret/db":
+			if tokens := r.Header.Values("X-Vault-Token"); len(tokens) != 1 || !v.tokens[tokens[0]] {
+				w.WriteHeader(403)
+				fmt.Fprintf(w, `{"errors":["permission denied"]}`)
+				return
+			}
+			fmt.Fprintf(w, `{"data":{"password":"from-vault"}}`)
+		default:
+			w.WriteHeader(404)
+			fmt.Fprintf(w, `{"errors":[]}`)
+		}
+	}))
+	t.Cleanup(v.Close)
+	return v
+}
+
+func TestVaultAuthMethods(t *testing.T) {
+	mock := newVaultAuthStandIn(t)
+	jwt := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(jwt, []byte("service-account-jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, config := range []*VaultTarget{
+		{URL: mock.URL, AuthMethod: "approle", RoleID: "graft-ci", SecretID: "s3cr3t"},
+		{URL: mock.URL, AuthMethod: "kubernetes", AuthMount: "k8s", AuthRole: "graft", JWTFile: jwt},
+		{URL: mock.URL, AuthMethod: "userpass", Username: "alice", Password: "hunter2"},
+	} {
+		kv, err := createVaultClientFromConfig(config)
+		if err != nil {
+			t.Errorf("Expected the %s auth method to log in, got %v", config.AuthMethod, err)
+			continue
+		}
+		secret, err := getVaultSecretWithClient(kv, "secret/db")
+		if err != nil || secret["password"] != "from-vault" {
+			t.Errorf("Expected the %s login to read secret/db, got %v (%v)", config.AuthMethod, secret, err)
+		}
+	}
+
+	u, _ := url.Parse(mock.URL)
+	client := &vaultkv.Client{VaultURL: u}
+	lease, err := certAuth{mount: "cert", role: "web"}.Login(client)
+	if err != nil {
+		t.Fatalf("Expected the cert auth method to log in, got %v", err)
+	}
+	if client.AuthToken != lease.Token || lease.Duration != time.Hour || !lease.Renewable {
+		t.Errorf("Expected the client to hold a renewable hour-long token, got %+v", lease)
+	}
+
+	_, err = createVaultClientFromConfig(&VaultTarget{URL: mock.URL, AuthMethod: "userpass", Username: "alice", Password: "wrong"})
+	if err == nil || !strings.Contains(err.Error(), "unable to log in with the userpass auth method") || !strings.Contains(err.Error(), "invalid credentials") {
+		t.Errorf("Expected a failed userpass login, got %v", err)
+	}
+}
+
+func TestVaultRedirectsKeepTheToken(t *testing.T) {
+	mock := newVaultAuthStandIn(t)
+	kv, err := createVaultClientFromConfig(&VaultTarget{URL: mock.URL, AuthMethod: "userpass", Username: "alice", Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("Expected the userpass auth method to log in, got %v", err)
+	}
+
+	read := func() {
+		t.Helper()
+		secret, err := getVaultSecretWithClient(kv, "secret/moved")
+		if err != nil || secret["password"] != "from-vault" {
+			t.Errorf("Expected the redirect to secret/db to carry the token, got %v (%v)", secret, err)
+		}
+	}
+	read()
+
+	// the token from logging in again is the one that follows redirects
+	mock.Lock()
+	mock.tokens, mock.renewable = map[string]bool{}, false
+	mock.Unlock()
+	vaultSessions.Lock()
+	vaultSessions.byClient[kv.Client].issued = time.Now().Add(-time.Hour)
+	vaultSessions.Unlock()
+	if err := refreshVaultLogin(kv); err != nil {
+		t.Fatal(err)
+	}
+	read()
+}
+
+func TestVaultAuthMethodSettings(t *testing.T) {
+	defer DefineTargets(TargetDefinitions{})
+	DefineTargets(TargetDefinitions{
+		Vault: map[string]VaultTarget{
+			"ci":   {URL: "https://vault.example.com", AuthMethod: "approle"},
+			"pods": {URL: "https://vault.example.com", AuthMethod: "kubernetes", AuthRole: "graft", JWTFile: "/does/not/exist"},
+		},
+	})
+
+	pool := &VaultClientPool{configs: map[string]*VaultTarget{}}
+	if _, err := pool.getTargetConfig("ci", nil); err == nil || !strings.Contains(err.Error(), "needs a role_id") {
+		t.Errorf("Expected vault@ci to need a role ID, got %v", err)
+	}
+	t.Setenv("VAULT_CI_ROLE_ID", "graft-ci")
+	config, err := pool.getTargetConfig("ci", nil)
+	if err != nil || config.RoleID != "graft-ci" || config.Token != "" {
+		t.Errorf("Expected vault@ci to take its role ID from the environment, and need no token, got %+v (%v)", config, err)
+	}
+
+	if got := strings.Join(CheckTarget("vault", "pods").Problems, "\n"); !strings.Contains(got, "unable to read service account token") {
+		t.Errorf("Expected vault@pods to be missing its service account token, got %s", got)
+	}
+}
+
+func TestVaultLoginIsRenewed(t *testing.T) {
+	mock := newVaultAuthStandIn(t)
+
+	defer DefineTargets(TargetDefinitions{})
+	DefineTargets(TargetDefinitions{
+		Vault: map[string]VaultTarget{
+			"ci": {URL: mock.URL, AuthMethod: "approle", RoleID: "graft-ci", SecretID: "s3cr3t", CacheTTL: time.Nanosecond},
+		},
+	})
+	SkipVault = false
+
+	lookup := func() {
+		t.Helper()
+		y, err := simpleyaml.NewYaml([]byte(`password: (( vault@ci "secret/db:password" ))`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := y.Map()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev := &Evaluator{Tree: tree}
+		if err := ev.RunPhase(EvalPhase); err != nil {
+			t.Fatalf("Expected the vault call to succeed, got %v", err)
+		}
+		if ev.Tree["password"] != "from-vault" {
+			t.Errorf("Expected the secret from vault@ci, got %v", ev.Tree["password"])
+		}
+	}
+	// ageSession makes the lease of vault@ci look like it was issued long ago
+	ageSession := func(by time.Duration) {
+		kv, err := vaultClientPool.GetClient("ci", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vaultSessions.Lock()
+		vaultSessions.byClient[kv.Client].issued = time.Now().Add(-by)
+		vaultSessions.Unlock()
+	}
+
+	lookup()
+	lookup()
+	if mock.logins != 1 || mock.renewals != 0 {
+		t.Errorf("Expected one login and no renewals while the lease is fresh, got %d and %d", mock.logins, mock.renewals)
+	}
+
+	ageSession(50 * time.Minute)
+	lookup()
+	if mock.logins != 1 || mock.renewals != 1 {
+		t.Errorf("Expected the token to be renewed near the end of its lease, got %d logins and %d renewals", mock.logins, mock.renewals)
+	}
+
+	mock.Lock()
+	mock.renewable = false
+	mock.Unlock()
+	ageSession(50 * time.Minute)
+	lookup()
+	if mock.logins != 2 {
+		t.Errorf("Expected to log in again when the token cannot be renewed, got %d logins", mock.logins)
+	}
+}
+
+func TestDefaultVaultClientLogsIn(t *testing.T) {
+	mock := newVaultAuthStandIn(t)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("VAULT_ADDR", mock.URL)
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_AUTH_METHOD", "approle")
+	t.Setenv("VAULT_ROLE_ID", "graft-ci")
+	t.Setenv("VAULT_SECRET_ID", "s3cr3t")
+
+	defer func() { globalKV = nil }()
+	if err := initializeVaultClient(); err != nil {
+		t.Fatalf("Expected the default client to log in with approle, got %v", err)
+	}
+	secret, err := getVaultSecret("secret/db")
+	if err != nil || secret["password"] != "from-vault" {
+		t.Errorf("Expected the default client to read secret/db, got %v (%v)", secret, err)
+	}
+}
+
+func TestDefaultVaultClientUsesDefinedDefault(t *testing.T) {
+	mock := newVaultAuthStandIn(t)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_AUTH_METHOD", "")
+	t.Setenv("VAULT_ROLE_ID", "graft-ci")
+	t.Setenv("VAULT_SECRET_ID", "")
+
+	DefineTargets(TargetDefinitions{DefaultVault: VaultTarget{
+		URL:        mock.URL,
+		AuthMethod: "approle",
+		RoleID:     "from-config",
+		SecretID:   "s3cr3t",
+	}})
+	defer DefineTargets(TargetDefinitions{})
+
+	if err := initializeVaultClient(); err != nil {
+		t.Fatalf("Expected the default client to log in with the defined default, got %v", err)
+	}
+	secret, err := getVaultSecret("secret/db")
+	if err != nil || secret["password"] != "from-vault" {
+		t.Errorf("Expected the default client to read secret/db, got %v (%v)", secret, err)
+	}
+}
@@ -0,0 +1,61 @@
+package operators
+
+import (
+	"sync"
+
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+// vaultTargetRefs holds the vault references made while they are being
+// tracked, by target ("" for the default vault) and then by vault path
+var vaultTargetRefs = struct {
+	sync.Mutex
+	byTarget map[string]map[string][]string
+}{byTarget: map[string]map[string][]string{}}
+
+// recordVaultRef notes that the document calls for ref, a vault path in the
+// form path/to/secret:key, from targetName at here. References are kept for
+// vaultinfo when vault is skipped, or when graft.TrackVaultRefs asks for it.
+func recordVaultRef(engine graft.Engine, targetName, ref, here string) {
+	engine.GetOperatorState().AddVaultRef(ref, []string{here})
+	if !engine.GetOperatorState().IsVaultSkipped() && !graft.TrackVaultRefs {
+		return
+	}
+
+	vaultTargetRefs.Lock()
+	defer vaultTargetRefs.Unlock()
+	refs, ok := vaultTargetRefs.byTarget[targetName]
+	if !ok {
+		refs = map[string][]string{}
+		vaultTargetRefs.byTarget[targetName] = refs
+	}
+	for _, seen := range refs[ref] {
+		if seen == here {
+			return
+		}
+	}
+	refs[ref] = append(refs[ref], here)
+}
+
+// VaultTargetRefs returns the vault references tracked so far: for each
+// target, "" being the default vault, the places in the document that call
+// for each vault path
+func VaultTargetRefs() map[string]map[string][]string {
+	vaultTargetRefs.Lock()
+	defer vaultTargetRefs.Unlock()
+	targets := make(map[string]map[string][]string, len(vaultTargetRefs.byTarget))
+	for target, refs := range vaultTargetRefs.byTarget {
+		targets[target] = make(map[string][]string, len(refs))
+		for ref, heres := range refs {
+			targets[target][ref] = append([]string{}, heres...)
+		}
+	}
+	return targets
+}
+
+// ResetVaultTargetRefs forgets the vault references tracked so far
+func ResetVaultTargetRefs() {
+	vaultTargetRefs.Lock()
+	defer vaultTargetRefs.Unlock()
+	vaultTargetRefs.byTarget = map[string]map[string][]string{}
+}
@@ -0,0 +1,99 @@
+package operators
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/geofffranks/simpleyaml"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/wayneeseguin/graft/pkg/graft"
+)
+
+func TestVaultTargetRefs(t *testing.T) {
+	YAML := func(s string) map[interface{}]interface{} {
+		y, err := simpleyaml.NewYaml([]byte(s))
+		So(err, ShouldBeNil)
+
+		data, err := y.Map()
+		So(err, ShouldBeNil)
+
+		return data
+	}
+	merge := func(doc string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: YAML(doc)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	Convey("without vault, every path a vault call could read is recorded", t, func() {
+		graft.SkipVault = true
+		defer func() { graft.SkipVault = false }()
+		ResetVaultTargetRefs()
+
+		tree, err := merge(`
+meta:
+  env: prod
+primary:  (( vault "secret/db:password" || vault "secret/shared/db:password" || "changeme" ))
+paths:    (( vault "secret/db:user; secret/legacy/db:user" ))
+try:      (( vault-try "secret/v2/db:password" "secret/db:password" "changeme" ))
+target:   (( vault@production "secret/app:token" ))
+computed: (( vault (concat "secret/" meta.env "/db:password") ))
+`)
+		So(err, ShouldBeNil)
+		So(tree["primary"], ShouldEqual, "REDACTED")
+		So(tree["try"], ShouldEqual, "REDACTED")
+		So(VaultTargetRefs(), ShouldResemble, map[string]map[string][]string{
+			"": {
+				"secret/db:password":        {"primary", "try"},
+				"secret/shared/db:password": {"primary"},
+				"secret/db:user":            {"paths"},
+				"secret/legacy/db:user":     {"paths"},
+				"secret/v2/db:password":     {"try"},
+				"secret/prod/db:password":   {"computed"},
+			},
+			"production": {
+				"secret/app:token": {"target"},
+			},
+		})
+	})
+
+	Convey("operators after || in a vault call make up its default", t, func() {
+		globalKV = nil
+		SkipVault = false
+		ResetVaultTargetRefs()
+		mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/sys/internal/ui/mounts":
+				fmt.Fprintf(w, `{"data":{"secret":{"secret/":{"type":"kv","options":{"version":"1"}}}}}`)
+			case "/v1/secret/shared/db":
+				fmt.Fprintf(w, `{"data":{"password":"shared"}}`)
+			default:
+				w.WriteHeader(404)
+				fmt.Fprintf(w, `{"errors":[]}`)
+			}
+		}))
+		defer mock.Close()
+		os.Setenv("VAULT_ADDR", mock.URL)
+		os.Setenv("VAULT_TOKEN", "test-token")
+		defer os.Unsetenv("VAULT_ADDR")
+		defer os.Unsetenv("VAULT_TOKEN")
+
+		tree, err := merge(`
+defaults:
+  password: from-defaults
+chained: (( vault "secret/db:password" || vault "secret/shared/db:password" ))
+grabbed: (( vault "secret/db:password" || grab defaults.password ))
+last:    (( vault "secret/db:password" || vault "secret/missing:password" || "changeme" ))
+`)
+		So(err, ShouldBeNil)
+		So(tree["chained"], ShouldEqual, "shared")
+		So(tree["grabbed"], ShouldEqual, "from-defaults")
+		So(tree["last"], ShouldEqual, "changeme")
+
+		// references are only recorded for vaultinfo
+		So(VaultTargetRefs(), ShouldBeEmpty)
+	})
+}
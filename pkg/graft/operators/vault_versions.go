@@ -0,0 +1,192 @@
+package operators
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-community/vaultkv"
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+)
+
+// VaultReference is a vault path given to the vault operators, split into
+// the secret, the key within it and the version it is pinned to, if any
+type VaultReference struct {
+	Secret   string
+	Key      string
+	Version  uint // 0 for the latest version
+	Metadata bool // Key names a field of the metadata of the secret
+}
+
+// vaultVersionPin matches the @vN that pins a key to version N
+var vaultVersionPin = regexp.MustCompile(`@v([0-9]+)$`)
+
+// vaultMetadataFields are the metadata of a kv v2 secret that can be read
+// with path/to/secret:@field
+var vaultMetadataFields = []string{"created_time", "current_version", "max_versions", "oldest_version", "updated_time"}
+
+// ParseVaultReference splits ref, a vault path in the form
+// path/to/secret:key, path/to/secret:key@vN or path/to/secret:@field
+func ParseVaultReference(ref string) (VaultReference, error) {
+	secret, key := parsePath(ref)
+	r := VaultReference{Secret: secret, Key: key}
+
+	if m := vaultVersionPin.FindStringSubmatch(key); m != nil {
+		version, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil || version == 0 {
+			return r, ansi.Errorf("@R{invalid version in} @c{%s}@R{; versions start at} @m{@v1}", ref)
+		}
+		r.Key, r.Version = strings.TrimSuffix(key, m[0]), uint(version)
+	}
+	if strings.HasPrefix(r.Key, "@") {
+		r.Key, r.Metadata = r.Key[1:], true
+		if r.Version != 0 {
+			return r, ansi.Errorf("@R{invalid argument} @c{%s}@R{; metadata describes every version of a secret, and cannot be pinned}", ref)
+		}
+		if !containsString(vaultMetadataFields, r.Key) {
+			return r, ansi.Errorf("@R{unknown vault metadata} @c{%s}@R{; must be one of} @m{%s}", r.Key, strings.Join(vaultMetadataFields, ", "))
+		}
+	}
+
+	if r.Secret == "" || r.Key == "" {
+		return r, ansi.Errorf("@R{invalid argument} @c{%s}@R{; must be in the form} @m{path/to/secret:key}", ref)
+	}
+	return r, nil
+}
+
+// cacheSuffix tells the cached copies of the versions and the metadata of
+// a secret apart
+func (r VaultReference) cacheSuffix() string {
+	switch {
+	case r.Metadata:
+		return "@metadata"
+	case r.Version != 0:
+		return fmt.Sprintf("@v%d", r.Version)
+	}
+	return ""
+}
+
+// getVaultSecretVersion reads a version of secret, the latest if version is
+// 0, and returns it with the number of the version that was read. That
+// number is 0 on kv v1 mounts, which do not keep versions.
+func getVaultSecretVersion(kvClient *vaultkv.KV, secret string, version uint) (map[string]interface{}, uint, error) {
+	ret := map[string]interface{}{}
+
+	var opts *vaultkv.KVGetOpts
+	if version != 0 {
+		DEBUG("Fetching version %d of Vault secret at `%s'", version, secret)
+		opts = &vaultkv.KVGetOpts{Version: version}
+	} else {
+		DEBUG("Fetching Vault secret at `%s'", secret)
+	}
+	meta, err := kvClient.Get(secret, &ret, opts)
+	if err != nil {
+		DEBUG(" failure.")
+		return nil, 0, err
+	}
+
+	DEBUG("  success.")
+	// vaultkv only knows when a version was created on kv v2 mounts
+	if meta.CreatedAt.IsZero() {
+		return ret, 0, nil
+	}
+	return ret, meta.Version, nil
+}
+
+// getVaultMetadata reads the metadata of a secret on a kv v2 mount, as the
+// strings a vault call puts in the document
+func getVaultMetadata(kvClient *vaultkv.KV, secret string) (map[string]interface{}, error) {
+	mountVersion, err := kvClient.MountVersion(secret)
+	if err != nil {
+		return nil, err
+	}
+	if mountVersion != 2 {
+		return nil, ansi.Errorf("@R{secret} @c{%s} @R{is not on a kv v2 mount, and has no metadata}", secret)
+	}
+	mount, err := kvClient.MountPath(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	DEBUG("Fetching metadata of Vault secret at `%s'", secret)
+	mount = strings.Trim(mount, "/")
+	subpath := strings.Trim(strings.TrimPrefix(strings.Trim(secret, "/"), mount), "/")
+	meta, err := kvClient.Client.V2GetMetadata(mount, subpath)
+	if err != nil {
+		DEBUG(" failure.")
+		return nil, err
+	}
+
+	DEBUG("  success.")
+	return map[string]interface{}{
+		"created_time":    meta.CreatedAt.UTC().Format(time.RFC3339Nano),
+		"updated_time":    meta.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		"current_version": strconv.FormatUint(uint64(meta.CurrentVersion), 10),
+		"oldest_version":  strconv.FormatUint(uint64(meta.OldestVersion), 10),
+		"max_versions":    strconv.FormatUint(uint64(meta.MaxVersions), 10),
+	}, nil
+}
+
+// vaultVersions holds the version each unpinned secret resolved to, by
+// target and path, for vaultinfo to report
+var vaultVersions = struct {
+	sync.Mutex
+	byTarget map[string]map[string]uint
+}{byTarget: map[string]map[string]uint{}}
+
+// recordVaultVersion notes that the latest version of secret on target, ""
+// being the default vault, was version
+func recordVaultVersion(target, secret string, version uint) {
+	if version == 0 {
+		return
+	}
+	vaultVersions.Lock()
+	defer vaultVersions.Unlock()
+	if vaultVersions.byTarget[target] == nil {
+		vaultVersions.byTarget[target] = map[string]uint{}
+	}
+	vaultVersions.byTarget[target][secret] = version
+}
+
+// ResolvedVaultVersions returns the version that the latest version of each
+// secret on a kv v2 mount resolved to: for each target, "" being the default
+// vault, by path
+func ResolvedVaultVersions() map[string]map[string]uint {
+	vaultVersions.Lock()
+	defer vaultVersions.Unlock()
+	targets := make(map[string]map[string]uint, len(vaultVersions.byTarget))
+	for target, secrets := range vaultVersions.byTarget {
+		targets[target] = make(map[string]uint, len(secrets))
+		for secret, version := range secrets {
+			targets[target][secret] = version
+		}
+	}
+	return targets
+}
+
+// ResetResolvedVaultVersions forgets the versions that earlier runs resolved
+func ResetResolvedVaultVersions() {
+	vaultVersions.Lock()
+	defer vaultVersions.Unlock()
+	vaultVersions.byTarget = map[string]map[string]uint{}
+}
+
+// VaultReferenceVersion returns the version ref, a path given to a vault
+// operator, is pinned to, or else the version its secret on target resolved
+// to. It returns 0 for references to metadata, and for secrets that were not
+// read.
+func VaultReferenceVersion(target, ref string) uint {
+	r, err := ParseVaultReference(ref)
+	if err != nil || r.Metadata {
+		return 0
+	}
+	if r.Version != 0 {
+		return r.Version
+	}
+	vaultVersions.Lock()
+	defer vaultVersions.Unlock()
+	return vaultVersions.byTarget[target][r.Secret]
+}
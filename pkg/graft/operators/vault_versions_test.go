@@ -0,0 +1,145 @@
+package operators
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/geofffranks/simpleyaml"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVaultVersions(t *testing.T) {
+	YAML := func(s string) map[interface{}]interface{} {
+		y, err := simpleyaml.NewYaml([]byte(s))
+		So(err, ShouldBeNil)
+
+		data, err := y.Map()
+		So(err, ShouldBeNil)
+
+		return data
+	}
+
+	Convey("vault versions and metadata", t, func() {
+		globalKV = nil
+		SkipVault = false
+		ResetResolvedVaultVersions()
+
+		// secret/ is a kv v2 mount holding three versions of secret/db,
+		// legacy/ a kv v1 mount
+		mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/sys/internal/ui/mounts":
+				fmt.Fprintf(w, `{"data":{"secret":{"secret/":{"type":"kv","options":{"version":"2"}},"legacy/":{"type":"kv","options":{"version":"1"}}}}}`)
+			case "/v1/secret/data/db":
+				version := r.URL.Query().Get("version")
+				if version == "" {
+					version = "3"
+				}
+				if version != "1" && version != "2" && version != "3" {
+					w.WriteHeader(404)
+					fmt.Fprintf(w, `{"errors":[]}`)
+					return
+				}
+				fmt.Fprintf(w, `{"data":{"data":{"password":"password-v%s"},"metadata":{"created_time":"2024-0%s-01T00:00:00Z","version":%s}}}`, version, version, version)
+			case "/v1/secret/metadata/db":
+				fmt.Fprintf(w, `{"data":{"created_time":"2024-01-01T00:00:00Z","updated_time":"2024-03-01T00:00:00Z","current_version":3,"oldest_version":1,"max_versions":10,"versions":{}}}`)
+			case "/v1/legacy/db":
+				fmt.Fprintf(w, `{"data":{"password":"legacy"}}`)
+			default:
+				w.WriteHeader(404)
+				fmt.Fprintf(w, `{"errors":[]}`)
+			}
+		}))
+		defer mock.Close()
+
+		os.Setenv("VAULT_ADDR", mock.URL)
+		os.Setenv("VAULT_TOKEN", "test-token")
+		defer os.Unsetenv("VAULT_ADDR")
+		defer os.Unsetenv("VAULT_TOKEN")
+
+		merge := func(doc string) (map[interface{}]interface{}, error) {
+			ev := &Evaluator{Tree: YAML(doc)}
+			err := ev.RunPhase(EvalPhase)
+			return ev.Tree, err
+		}
+
+		Convey("reads the latest version unless one is pinned", func() {
+			tree, err := merge(`
+latest: (( vault "secret/db:password" ))
+pinned: (( vault "secret/db:password@v1" ))
+`)
+			So(err, ShouldBeNil)
+			So(tree["latest"], ShouldEqual, "password-v3")
+			So(tree["pinned"], ShouldEqual, "password-v1")
+		})
+
+		Convey("reports the versions references resolved to", func() {
+			_, err := merge(`
+latest: (( vault "secret/db:password" ))
+legacy: (( vault "legacy/db:password" ))
+`)
+			So(err, ShouldBeNil)
+			So(ResolvedVaultVersions(), ShouldResemble, map[string]map[string]uint{"": {"secret/db": 3}})
+			So(VaultReferenceVersion("", "secret/db:password"), ShouldEqual, 3)
+			So(VaultReferenceVersion("", "secret/db:password@v2"), ShouldEqual, 2)
+			So(VaultReferenceVersion("", "legacy/db:password"), ShouldEqual, 0)
+			So(VaultReferenceVersion("", "secret/db:@current_version"), ShouldEqual, 0)
+		})
+
+		Convey("keeps the versions of the same path on different targets apart", func() {
+			recordVaultVersion("", "secret/db", 3)
+			recordVaultVersion("production", "secret/db", 7)
+			So(ResolvedVaultVersions(), ShouldResemble, map[string]map[string]uint{
+				"":           {"secret/db": 3},
+				"production": {"secret/db": 7},
+			})
+			So(VaultReferenceVersion("", "secret/db:password"), ShouldEqual, 3)
+			So(VaultReferenceVersion("production", "secret/db:password"), ShouldEqual, 7)
+		})
+
+		Convey("reads the metadata of kv v2 secrets", func() {
+			tree, err := merge(`
+created: (( vault "secret/db:@created_time" ))
+current: (( vault "secret/db:@current_version" ))
+`)
+			So(err, ShouldBeNil)
+			So(tree["created"], ShouldEqual, "2024-01-01T00:00:00Z")
+			So(tree["current"], ShouldEqual, "3")
+		})
+
+		Convey("falls back to the default when a pinned version does not exist", func() {
+			tree, err := merge(`password: (( vault "secret/db:password@v9" || "fallback" ))`)
+			So(err, ShouldBeNil)
+			So(tree["password"], ShouldEqual, "fallback")
+
+			_, err = merge(`password: (( vault "secret/db:password@v9" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "secret secret/db:password@v9 not found")
+		})
+
+		Convey("refuses what it cannot read", func() {
+			_, err := merge(`x: (( vault "secret/db:password@v0" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "versions start at")
+
+			_, err = merge(`x: (( vault "secret/db:@created_time@v2" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot be pinned")
+
+			_, err = merge(`x: (( vault "secret/db:@owner" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unknown vault metadata")
+
+			_, err = merge(`x: (( vault "legacy/db:@created_time" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "is not on a kv v2 mount")
+
+			_, err = merge(`x: (( vault-generate "secret/db:token@v2" ))`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot pin a version")
+		})
+	})
+}
@@ -139,6 +139,7 @@ func tryParseInfixOperator(phase OperatorPhase, content, opName string) *Opcall
 		src:  content,
 		op:   op,
 		args: []*Expr{leftExpr, rightExpr},
+		name: opName,
 	}
 }
 
@@ -200,6 +201,7 @@ func tryParseTernary(phase OperatorPhase, content string) *Opcall {
 		src:  content,
 		op:   op,
 		args: []*Expr{condExpr, trueExpr, falseExpr},
+		name: "?:",
 	}
 }
 
@@ -269,13 +271,14 @@ func parseExpression(expr string) (*Expr, error) {
 			src = strings.TrimSpace(src)
 			parts := strings.Fields(src)
 			if len(parts) > 0 {
-				opName = parts[0]
+				opName = strings.SplitN(parts[0], "@", 2)[0]
 			}
 		}
 
 		return &Expr{
 			Type:     OperatorCall,
 			Operator: opName,
+			Target:   nestedOpcall.Target(),
 			Call:     nestedOpcall,
 		}, nil
 	}
@@ -601,9 +604,11 @@ func ParseOpcall(phase OperatorPhase, src string) (*Opcall, error) {
 		log.DEBUG("ParseOpcall: parseArgs returned %d arguments", len(args))
 
 		return &Opcall{
-			src:  src,
-			op:   op,
-			args: args,
+			src:    src,
+			op:     op,
+			args:   args,
+			name:   operatorName,
+			target: targetName,
 		}, nil
 	}
 
@@ -1440,7 +1445,7 @@ func exprToOpcall(phase OperatorPhase, node *ExprNode) *Opcall {
 			}
 		}
 
-		return NewOpcall(op, args, fmt.Sprintf("(( %s ))", node.Value))
+		return NewNamedOpcall(node.Value, "", op, args, fmt.Sprintf("(( %s ))", node.Value))
 	}
 
 	return nil
@@ -69,10 +69,10 @@ func ParseOpcall(phase OperatorPhase, src string) (*Opcall, error) {
 
 				// Check if it's a valid operator
 				// For operators with targets (e.g., vault@production), extract base operator name
-				baseOpName := opname
+				baseOpName, targetName := opname, ""
 				if strings.Contains(opname, "@") {
 					parts := strings.SplitN(opname, "@", 2)
-					baseOpName = parts[0]
+					baseOpName, targetName = parts[0], parts[1]
 				}
 
 				op := OperatorFor(baseOpName)
@@ -95,7 +95,7 @@ func ParseOpcall(phase OperatorPhase, src string) (*Opcall, error) {
 				if opname == "defer" && argStr != "" {
 					// For defer, we want to use the legacy argument parsing to preserve the original behavior
 					// This means we parse it like the old argify function would
-					return parseOpcallLegacyArgs(op, argStr, src, phase)
+					return parseOpcallLegacyArgs(baseOpName, targetName, op, argStr, src, phase)
 				}
 
 				// Parse arguments with the parser
@@ -104,7 +104,7 @@ func ParseOpcall(phase OperatorPhase, src string) (*Opcall, error) {
 					return nil, err
 				}
 
-				return graft.NewOpcall(op, args, src), nil
+				return graft.NewNamedOpcall(baseOpName, targetName, op, args, src), nil
 			}
 		}
 	}
@@ -145,10 +145,10 @@ func ParseOpcall(phase OperatorPhase, src string) (*Opcall, error) {
 		}
 
 		// For operators with targets (e.g., vault@production), extract base operator name
-		baseOpName := opname
+		baseOpName, targetName := opname, expr.Target
 		if strings.Contains(opname, "@") {
 			parts := strings.SplitN(opname, "@", 2)
-			baseOpName = parts[0]
+			baseOpName, targetName = parts[0], parts[1]
 		}
 
 		op := OperatorFor(baseOpName)
@@ -170,7 +170,7 @@ func ParseOpcall(phase OperatorPhase, src string) (*Opcall, error) {
 		}
 
 		DEBUG("ParseOpcall: returning operator '%s' with %d args", opname, len(args))
-		return graft.NewOpcall(op, args, src), nil
+		return graft.NewNamedOpcall(baseOpName, targetName, op, args, src), nil
 	}
 
 	// If it's just a simple reference and looks like a BOSH varname, ignore it
@@ -360,7 +360,7 @@ func (op *ExpressionWrapperOperator) Run(ev *Evaluator, args []*Expr) (*Response
 }
 
 // parseOpcallLegacyArgs parses arguments using legacy-style parsing for specific operators
-func parseOpcallLegacyArgs(op Operator, argStr string, src string, phase OperatorPhase) (*Opcall, error) {
+func parseOpcallLegacyArgs(name, target string, op Operator, argStr string, src string, phase OperatorPhase) (*Opcall, error) {
 	// Use a simplified version of the legacy argify function
 	// The legacy argify builds a LogicalOr expression when it sees ||
 
@@ -452,7 +452,7 @@ func parseOpcallLegacyArgs(op Operator, argStr string, src string, phase Operato
 		return nil, fmt.Errorf("syntax error near: %s", argStr)
 	}
 
-	return graft.NewOpcall(op, final, src), nil
+	return graft.NewNamedOpcall(name, target, op, final, src), nil
 }
 
 // splitLegacyArgs splits arguments respecting quoted strings
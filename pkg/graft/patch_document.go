@@ -0,0 +1,185 @@
+package graft
+
+import (
+	"fmt"
+
+	"github.com/geofffranks/yaml"
+)
+
+// patchDocument is a special document type that holds a JSON Patch or a JSON
+// Merge Patch. Unlike go-patch documents, which apply once everything else
+// is merged, patch documents apply in sequence: each one patches the result
+// of merging the documents before it.
+type patchDocument struct {
+	format     PatchFormat
+	name       string
+	jsonPatch  JSONPatch
+	mergePatch map[interface{}]interface{}
+}
+
+// NewJSONPatchDocument creates a new document applying an RFC 6902 JSON Patch
+func NewJSONPatchDocument(p JSONPatch) Document {
+	return &patchDocument{format: JSONPatchFormat, jsonPatch: p}
+}
+
+// NewMergePatchDocument creates a new document applying an RFC 7386 JSON
+// Merge Patch
+func NewMergePatchDocument(p map[interface{}]interface{}) Document {
+	return &patchDocument{format: MergePatchFormat, mergePatch: p}
+}
+
+// ParsePatch parses data as a patch document in the given format. Patches
+// whose format is to be detected are read as JSON Patches when their root is
+// a list, and as JSON Merge Patches otherwise.
+func ParsePatch(data []byte, format PatchFormat) (Document, error) {
+	if format == DetectPatchFormat {
+		format = MergePatchFormat
+		var root interface{}
+		if err := yaml.Unmarshal(data, &root); err == nil {
+			if _, ok := root.([]interface{}); ok {
+				format = JSONPatchFormat
+			}
+		}
+	}
+
+	switch format {
+	case JSONPatchFormat:
+		p, err := ParseJSONPatch(data)
+		if err != nil {
+			return nil, err
+		}
+		return NewJSONPatchDocument(p), nil
+	case MergePatchFormat:
+		p, err := ParseMergePatch(data)
+		if err != nil {
+			return nil, err
+		}
+		return NewMergePatchDocument(p), nil
+	}
+	return nil, fmt.Errorf("unknown patch format '%s'", format)
+}
+
+// IsPatchDocument checks if a document is a JSON Patch or JSON Merge Patch
+// document
+func IsPatchDocument(doc Document) bool {
+	_, ok := doc.(*patchDocument)
+	return ok
+}
+
+// apply patches data, naming the file the patch came from in any error
+func (p *patchDocument) apply(data map[interface{}]interface{}) (map[interface{}]interface{}, error) {
+	var patched interface{}
+	if p.format == JSONPatchFormat {
+		var err error
+		if patched, err = p.jsonPatch.Apply(data); err != nil {
+			if p.name != "" {
+				return nil, fmt.Errorf("%s: %s", p.name, err)
+			}
+			return nil, err
+		}
+	} else {
+		patched = ApplyMergePatch(data, p.mergePatch)
+	}
+
+	m, ok := patched.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s operations resulted in non-map data", p.format.String())
+	}
+	return m, nil
+}
+
+func (p *patchDocument) data() interface{} {
+	if p.format == JSONPatchFormat {
+		return p.jsonPatch
+	}
+	return p.mergePatch
+}
+
+func (p *patchDocument) Get(path string) (interface{}, error) {
+	return nil, fmt.Errorf("%s documents do not support Get operations", p.format.String())
+}
+
+func (p *patchDocument) GetString(path string) (string, error) {
+	return "", fmt.Errorf("%s documents do not support GetString operations", p.format.String())
+}
+
+func (p *patchDocument) GetInt(path string) (int, error) {
+	return 0, fmt.Errorf("%s documents do not support GetInt operations", p.format.String())
+}
+
+func (p *patchDocument) GetBool(path string) (bool, error) {
+	return false, fmt.Errorf("%s documents do not support GetBool operations", p.format.String())
+}
+
+func (p *patchDocument) GetSlice(path string) ([]interface{}, error) {
+	return nil, fmt.Errorf("%s documents do not support GetSlice operations", p.format.String())
+}
+
+func (p *patchDocument) GetMap(path string) (map[string]interface{}, error) {
+	return nil, fmt.Errorf("%s documents do not support GetMap operations", p.format.String())
+}
+
+func (p *patchDocument) Set(path string, value interface{}) error {
+	return fmt.Errorf("%s documents do not support Set operations", p.format.String())
+}
+
+func (p *patchDocument) Delete(path string) error {
+	return fmt.Errorf("%s documents do not support Delete operations", p.format.String())
+}
+
+func (p *patchDocument) Keys() []string {
+	return []string{}
+}
+
+func (p *patchDocument) ToYAML() ([]byte, error) {
+	return nil, fmt.Errorf("%s documents do not support ToYAML operations", p.format.String())
+}
+
+func (p *patchDocument) ToJSON() ([]byte, error) {
+	return nil, fmt.Errorf("%s documents do not support ToJSON operations", p.format.String())
+}
+
+func (p *patchDocument) RawData() interface{} {
+	return p.data()
+}
+
+func (p *patchDocument) Prune(key string) Document {
+	return p // No-op for patch documents
+}
+
+func (p *patchDocument) Clone() Document {
+	clone := *p
+	return &clone
+}
+
+func (p *patchDocument) CherryPick(keys ...string) Document {
+	return p // No-op for patch documents
+}
+
+func (p *patchDocument) GetData() interface{} {
+	return p.data()
+}
+
+func (p *patchDocument) Provenance(path string) (ValueSource, bool) {
+	return ValueSource{}, false
+}
+
+func (p *patchDocument) Tainted() map[string]TaintSource {
+	return map[string]TaintSource{}
+}
+
+func (p *patchDocument) GetInt64(path string) (int64, error) {
+	return 0, fmt.Errorf("%s documents do not support GetInt64 operations", p.format.String())
+}
+
+func (p *patchDocument) GetFloat64(path string) (float64, error) {
+	return 0, fmt.Errorf("%s documents do not support GetFloat64 operations", p.format.String())
+}
+
+func (p *patchDocument) GetStringSlice(path string) ([]string, error) {
+	return nil, fmt.Errorf("%s documents do not support GetStringSlice operations", p.format.String())
+}
+
+func (p *patchDocument) GetMapStringString(path string) (map[string]string, error) {
+	return nil, fmt.Errorf("%s documents do not support GetMapStringString operations", p.format.String())
+}
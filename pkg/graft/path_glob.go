@@ -0,0 +1,19 @@
+package graft
+
+import (
+	"github.com/wayneeseguin/graft/internal/utils/pathglob"
+)
+
+// MatchPath reports whether the dotted path p is at or beneath a path that
+// pattern matches. Patterns are matched one segment at a time: `*` matches
+// any single segment (or part of one, as in `*_key`) and `**` matches any
+// number of segments. List entries are named by their name, key or id, like
+// `jobs.web`, or by index when they have none. A leading `$.` is ignored.
+func MatchPath(pattern, p string) bool {
+	return pathglob.Match(pattern, p)
+}
+
+// ValidatePathPattern checks that pattern can be used with MatchPath
+func ValidatePathPattern(pattern string) error {
+	return pathglob.Validate(pattern)
+}
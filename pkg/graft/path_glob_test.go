@@ -0,0 +1,37 @@
+package graft
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMatchPath(t *testing.T) {
+	Convey("MatchPath", t, func() {
+		Convey("matches paths at and beneath the pattern", func() {
+			So(MatchPath("meta", "meta"), ShouldBeTrue)
+			So(MatchPath("meta", "meta.env"), ShouldBeTrue)
+			So(MatchPath("meta", "$.meta.env"), ShouldBeTrue)
+			So(MatchPath("meta.env", "meta"), ShouldBeFalse)
+			So(MatchPath("meta", "metadata"), ShouldBeFalse)
+		})
+
+		Convey("matches a single segment with *", func() {
+			So(MatchPath("jobs.*.instances", "jobs.web.instances"), ShouldBeTrue)
+			So(MatchPath("jobs.*.instances", "jobs.web.properties.instances"), ShouldBeFalse)
+			So(MatchPath("*_key", "ssh_key"), ShouldBeTrue)
+		})
+
+		Convey("matches any number of segments with **", func() {
+			So(MatchPath("**.password", "password"), ShouldBeTrue)
+			So(MatchPath("**.password", "jobs.web.properties.password"), ShouldBeTrue)
+			So(MatchPath("jobs.**.password", "jobs.web.password"), ShouldBeTrue)
+			So(MatchPath("jobs.**.password", "meta.password"), ShouldBeFalse)
+		})
+
+		Convey("rejects malformed patterns", func() {
+			So(ValidatePathPattern("jobs.[.name"), ShouldNotBeNil)
+			So(ValidatePathPattern("jobs.*.name"), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,231 @@
+package graft
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wayneeseguin/graft/internal/utils/tree"
+	"github.com/wayneeseguin/graft/pkg/graft/merger"
+	"gopkg.in/yaml.v3"
+)
+
+// ValueSource describes where a value of a merged document was last written
+type ValueSource = merger.ValueSource
+
+// sourcesFromNode records the line and column of every key and list entry in
+// a parsed yaml.v3 node tree, indexed by dotted path. The file is filled in
+// later by WithSourceName, since the parser only ever sees bytes.
+func sourcesFromNode(node *yaml.Node) map[string]ValueSource {
+	sources := make(map[string]ValueSource)
+
+	var record func(node *yaml.Node, path string)
+	record = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				record(child, path)
+			}
+
+		case yaml.AliasNode:
+			if node.Alias != nil {
+				record(node.Alias, path)
+			}
+
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				sub := joinKeyPath(path, key.Value)
+				sources[sub] = ValueSource{Line: key.Line, Column: key.Column}
+				record(value, sub)
+			}
+
+		case yaml.SequenceNode:
+			for i, child := range node.Content {
+				sub := joinKeyPath(path, yamlNodeName(child, strconv.Itoa(i)))
+				sources[sub] = ValueSource{Line: child.Line, Column: child.Column}
+				record(child, sub)
+			}
+		}
+	}
+	record(node, "")
+	return sources
+}
+
+// WithSourceName names the file (or stream) doc was parsed from, so that its
+// provenance reports it. Multi-document files are named `file.yml[2]`. JSON
+// Patch documents name the file in the errors of their operations.
+func WithSourceName(doc Document, name string) Document {
+	if p, ok := doc.(*patchDocument); ok {
+		named := *p
+		named.name = name
+		return &named
+	}
+	d, ok := doc.(*document)
+	if !ok {
+		return doc
+	}
+
+	named := d.withData(d.data)
+	named.sources = make(map[string]ValueSource, len(d.sources))
+	for path, src := range d.sources {
+		src.File = name
+		named.sources[path] = src
+	}
+	return named
+}
+
+// documentSources returns the value sources carried by doc, if any
+func documentSources(doc Document) map[string]ValueSource {
+	if d, ok := doc.(*document); ok {
+		return d.sources
+	}
+	return nil
+}
+
+// copySources returns an independent copy of sources
+func copySources(sources map[string]ValueSource) map[string]ValueSource {
+	if sources == nil {
+		return nil
+	}
+	copied := make(map[string]ValueSource, len(sources))
+	for path, src := range sources {
+		copied[path] = src
+	}
+	return copied
+}
+
+// withSources attaches sources to doc
+func withSources(doc Document, sources map[string]ValueSource) Document {
+	d, ok := doc.(*document)
+	if !ok {
+		return doc
+	}
+	withSrc := d.withData(d.data)
+	withSrc.sources = sources
+	return withSrc
+}
+
+// Provenance reports where the value at path was last written. Values that
+// came out of an operator report the operator call and the position of the
+// key that held it; values nested inside such a result (a grabbed map, for
+// instance) report the operator that produced their parent.
+func (d *document) Provenance(path string) (ValueSource, bool) {
+	if d.sources == nil {
+		return ValueSource{}, false
+	}
+
+	canonical, err := canonicalSourcePath(d.data, path)
+	if err != nil {
+		return ValueSource{}, false
+	}
+
+	for {
+		if src, ok := d.sources[canonical]; ok {
+			return src, true
+		}
+		if canonical == "" {
+			return ValueSource{}, false
+		}
+		if i := strings.LastIndex(canonical, "."); i >= 0 {
+			canonical = canonical[:i]
+		} else {
+			canonical = ""
+		}
+	}
+}
+
+// canonicalSourcePath resolves path against data and returns it in the form
+// provenance is recorded under, where list entries are addressed by name when
+// they have one and by index otherwise
+func canonicalSourcePath(data interface{}, path string) (string, error) {
+	cursor, err := tree.ParseCursor(path)
+	if err != nil {
+		return "", err
+	}
+
+	canonical := ""
+	here := data
+	for _, node := range cursor.Nodes {
+		switch v := here.(type) {
+		case map[interface{}]interface{}:
+			found := false
+			for k, val := range v {
+				if fmt.Sprintf("%v", k) == node {
+					here, found = val, true
+					break
+				}
+			}
+			if !found {
+				return "", fmt.Errorf("`%s` could not be found in the datastructure", path)
+			}
+			canonical = joinKeyPath(canonical, node)
+
+		case []interface{}:
+			found := false
+			if i, err := strconv.Atoi(node); err == nil && i >= 0 && i < len(v) {
+				here, found = v[i], true
+				node = nameOfObj(here, node)
+			} else {
+				for _, item := range v {
+					if nameOfObj(item, "") == node {
+						here, found = item, true
+						break
+					}
+				}
+			}
+			if !found {
+				return "", fmt.Errorf("`%s` could not be found in the datastructure", path)
+			}
+			canonical = joinKeyPath(canonical, node)
+
+		default:
+			return "", fmt.Errorf("`%s` could not be found in the datastructure", path)
+		}
+	}
+	return canonical, nil
+}
+
+// recordSource marks the value an operator wrote as coming from that
+// operator, at the position of the key that held the (( ... )) expression
+func (ev *Evaluator) recordSource(op *Opcall, resp *Response) {
+	if op.where == nil {
+		return
+	}
+	where := op.where.String()
+	src := ev.Sources[where]
+	src.Operator = op.Src()
+
+	switch resp.Type {
+	case Replace:
+		for path := range ev.Sources {
+			if strings.HasPrefix(path, where+".") {
+				delete(ev.Sources, path)
+			}
+		}
+		ev.Sources[where] = src
+
+	case Inject:
+		parent := op.where.Copy()
+		parent.Pop()
+		delete(ev.Sources, where)
+		if m, ok := resp.Value.(map[interface{}]interface{}); ok {
+			for k := range m {
+				// keys already defined next to the inject override it
+				path := joinKeyPath(parent.String(), fmt.Sprintf("%v", k))
+				if _, exists := ev.Sources[path]; !exists {
+					ev.Sources[path] = src
+				}
+			}
+		}
+	}
+}
+
+// sourcePosition returns where the key at path was written, if known
+func (ev *Evaluator) sourcePosition(path string) Position {
+	src, ok := ev.Sources[path]
+	if !ok {
+		return Position{}
+	}
+	return Position{Line: src.Line, Column: src.Column, File: src.File}
+}
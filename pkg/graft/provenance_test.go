@@ -0,0 +1,113 @@
+package graft
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProvenance(t *testing.T) {
+	Convey("Document.Provenance", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+
+		parse := func(name, src string) Document {
+			doc, err := engine.ParseYAML([]byte(src))
+			So(err, ShouldBeNil)
+			return WithSourceName(doc, name)
+		}
+
+		base := parse("base.yml", `meta:
+  size: small
+  zone: z1
+jobs:
+- name: web
+  instances: 1
+size: (( grab meta.size ))
+copy: (( grab meta ))
+`)
+		prod := parse("prod.yml", `meta:
+  size: large
+jobs:
+- name: web
+  instances: 3
+`)
+
+		result, err := engine.Merge(context.Background(), base, prod).Execute()
+		So(err, ShouldBeNil)
+
+		Convey("reports the last file to write a value", func() {
+			src, ok := result.Provenance("meta.size")
+			So(ok, ShouldBeTrue)
+			So(src, ShouldResemble, ValueSource{File: "prod.yml", Line: 2, Column: 3})
+
+			src, ok = result.Provenance("meta.zone")
+			So(ok, ShouldBeTrue)
+			So(src, ShouldResemble, ValueSource{File: "base.yml", Line: 3, Column: 3})
+		})
+
+		Convey("addresses list entries by name or index", func() {
+			src, ok := result.Provenance("jobs.web.instances")
+			So(ok, ShouldBeTrue)
+			So(src.String(), ShouldEqual, "prod.yml:5:3")
+
+			src, ok = result.Provenance("jobs.0.instances")
+			So(ok, ShouldBeTrue)
+			So(src.String(), ShouldEqual, "prod.yml:5:3")
+		})
+
+		Convey("reports the operator that produced a value", func() {
+			src, ok := result.Provenance("$.size")
+			So(ok, ShouldBeTrue)
+			So(src, ShouldResemble, ValueSource{File: "base.yml", Line: 7, Column: 1, Operator: "(( grab meta.size ))"})
+
+			src, ok = result.Provenance("copy.zone")
+			So(ok, ShouldBeTrue)
+			So(src.Operator, ShouldEqual, "(( grab meta ))")
+			So(src.Line, ShouldEqual, 8)
+		})
+
+		Convey("follows list entries that array operators move", func() {
+			list := parse("list.yml", `list:
+- a
+`)
+			explain := func(overlay string, path string) string {
+				result, err := engine.Merge(context.Background(), list, parse("overlay.yml", overlay)).Execute()
+				So(err, ShouldBeNil)
+				src, ok := result.Provenance(path)
+				So(ok, ShouldBeTrue)
+				return src.String()
+			}
+
+			appended := `list:
+- (( append ))
+- b
+- c
+`
+			So(explain(appended, "list.0"), ShouldEqual, "list.yml:2:3")
+			So(explain(appended, "list.1"), ShouldEqual, "overlay.yml:3:3")
+			So(explain(appended, "list.2"), ShouldEqual, "overlay.yml:4:3")
+
+			prepended := `list:
+- (( prepend ))
+- z
+`
+			So(explain(prepended, "list.0"), ShouldEqual, "overlay.yml:3:3")
+			So(explain(prepended, "list.1"), ShouldEqual, "list.yml:2:3")
+
+			inline := `list:
+- (( inline ))
+- y
+- z
+`
+			So(explain(inline, "list.0"), ShouldEqual, "overlay.yml:3:3")
+			So(explain(inline, "list.1"), ShouldEqual, "overlay.yml:4:3")
+		})
+
+		Convey("has nothing to say about paths that do not exist", func() {
+			_, ok := result.Provenance("meta.missing")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,103 @@
+package graft
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/wayneeseguin/graft/internal/utils/ansi"
+	"gopkg.in/yaml.v3"
+)
+
+// SecretPolicy says where in a merged document secrets may appear. Secrets
+// are the values produced by sensitive operators like (( vault )), and
+// everything derived from them through (( grab )), (( concat )),
+// (( join )), (( stringify )), (( base64 )) and the like.
+//
+// A policy file looks like:
+//
+//	secrets:
+//	  allow:
+//	    - credentials.*
+//	    - jobs.*.properties.**.password
+//
+// A pattern allows the path it matches and everything beneath it; see
+// MatchPath for how patterns are matched.
+type SecretPolicy struct {
+	Secrets struct {
+		Allow []string `yaml:"allow" json:"allow"`
+	} `yaml:"secrets" json:"secrets"`
+}
+
+// ParseSecretPolicy parses a secret policy file. Keys it does not know, like
+// an allow: list outside of secrets:, are errors rather than ignored.
+func ParseSecretPolicy(data []byte) (*SecretPolicy, error) {
+	p := &SecretPolicy{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, ansi.Errorf("@R{unable to parse secret policy}: %s", err)
+	}
+	for _, pattern := range p.Secrets.Allow {
+		if err := ValidatePathPattern(pattern); err != nil {
+			return nil, ansi.Errorf("@R{invalid secret policy pattern} @c{%s}@R{: %s}", pattern, err)
+		}
+	}
+	return p, nil
+}
+
+// Allows reports whether a secret may appear at the path where
+func (p *SecretPolicy) Allows(where string) bool {
+	for _, pattern := range p.Secrets.Allow {
+		if MatchPath(pattern, where) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns a SecretLeak for each path of doc holding a secret that the
+// policy does not allow there, in path order. Paths pruned from doc, or
+// masked by MergeBuilder.Redact, are not checked: they leak nothing.
+func (p *SecretPolicy) Check(doc Document) []SecretLeak {
+	tainted := doc.Tainted()
+	var leaks []SecretLeak
+	for _, where := range sortedTaintPaths(tainted) {
+		if !p.Allows(where) {
+			leaks = append(leaks, SecretLeak{Path: where, Source: tainted[where], Allow: p.Secrets.Allow})
+		}
+	}
+	return leaks
+}
+
+// Enforce checks doc against the policy, returning a MultiError of every
+// SecretLeak found
+func (p *SecretPolicy) Enforce(doc Document) error {
+	errs := MultiError{Errors: []error{}}
+	for _, leak := range p.Check(doc) {
+		leak := leak
+		errs.Append(&leak)
+	}
+	if errs.Count() > 0 {
+		return errs
+	}
+	return nil
+}
+
+// SecretLeak is a secret found where a SecretPolicy does not allow one
+type SecretLeak struct {
+	Path   string      `json:"path"`
+	Source TaintSource `json:"source"`
+	Allow  []string    `json:"allow"`
+}
+
+// Error ...
+func (l *SecretLeak) Error() string {
+	allowed := "nowhere"
+	if len(l.Allow) > 0 {
+		allowed = "only under " + strings.Join(l.Allow, ", ")
+	}
+	return ansi.Sprintf("@c{$.%s} @R{holds a secret from} @c{%s} @R{at} @c{$.%s}@R{; the secret policy allows secrets %s}",
+		l.Path, l.Source.Source, l.Source.Path, allowed)
+}
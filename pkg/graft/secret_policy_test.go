@@ -0,0 +1,90 @@
+package graft
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSecretPolicy(t *testing.T) {
+	Convey("SecretPolicy", t, func() {
+		policy, err := ParseSecretPolicy([]byte(`
+secrets:
+  allow:
+    - credentials.*
+    - jobs.*.properties.**.password
+    - "*_key"
+`))
+		So(err, ShouldBeNil)
+
+		Convey("allows secrets at and beneath the paths its patterns match", func() {
+			So(policy.Allows("credentials.db"), ShouldBeTrue)
+			So(policy.Allows("credentials.db.password"), ShouldBeTrue)
+			So(policy.Allows("$.credentials.db"), ShouldBeTrue)
+			So(policy.Allows("jobs.web.properties.password"), ShouldBeTrue)
+			So(policy.Allows("jobs.web.properties.db.admin.password"), ShouldBeTrue)
+			So(policy.Allows("ssh_key"), ShouldBeTrue)
+
+			So(policy.Allows("credentials"), ShouldBeFalse)
+			So(policy.Allows("jobs.web.properties.url"), ShouldBeFalse)
+			So(policy.Allows("meta.ssh_key"), ShouldBeFalse)
+		})
+
+		Convey("finds secrets outside of the allowed paths", func() {
+			vault := TaintSource{Path: "meta.password", Operator: "vault", Source: `(( vault "secret/db:password" ))`}
+			doc := withTaints(NewDocument(map[interface{}]interface{}{
+				"credentials": map[interface{}]interface{}{"db": "hunter2"},
+				"meta":        map[interface{}]interface{}{"password": "hunter2"},
+				"url":         "postgres://admin:hunter2@db",
+			}), map[string]TaintSource{
+				"credentials.db": vault,
+				"meta.password":  vault,
+				"url":            vault,
+				"pruned":         vault,
+			})
+
+			leaks := policy.Check(doc)
+			So(len(leaks), ShouldEqual, 2)
+			So(leaks[0].Path, ShouldEqual, "meta.password")
+			So(leaks[1].Path, ShouldEqual, "url")
+			So(leaks[1].Source, ShouldResemble, vault)
+
+			err := policy.Enforce(doc)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `$.url holds a secret from (( vault "secret/db:password" )) at $.meta.password; the secret policy allows secrets only under credentials.*`)
+
+			var leak *SecretLeak
+			So(errors.As(err, &leak), ShouldBeTrue)
+			So(leak.Path, ShouldEqual, "meta.password")
+
+			records := ErrorRecords(err)
+			So(len(records), ShouldEqual, 2)
+			So(records[1].Type, ShouldEqual, "secret_leak")
+			So(records[1].Path, ShouldEqual, "$.url")
+			So(records[1].Operator, ShouldEqual, "vault")
+		})
+
+		Convey("passes documents that hold secrets only where allowed", func() {
+			doc := withTaints(NewDocument(map[interface{}]interface{}{
+				"credentials": map[interface{}]interface{}{"db": "hunter2"},
+			}), map[string]TaintSource{"credentials.db": {Path: "credentials.db", Operator: "vault"}})
+			So(policy.Enforce(doc), ShouldBeNil)
+		})
+
+		Convey("rejects malformed patterns", func() {
+			_, err := ParseSecretPolicy([]byte("secrets: {allow: ['creds.[']}"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects keys it does not know", func() {
+			_, err := ParseSecretPolicy([]byte("allow: [credentials.*]"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "field allow not found")
+
+			_, err = ParseSecretPolicy([]byte("secrets: {allowed: [credentials.*]}"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "field allowed not found")
+		})
+	})
+}
@@ -0,0 +1,426 @@
+package graft
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wayneeseguin/graft/internal/utils/tree"
+	"github.com/wayneeseguin/graft/log"
+)
+
+// SensitiveOperator is implemented by operators whose results are secret,
+// like (( vault )). The values they produce, and every value derived from
+// them, are tainted: they never show up in debug or trace logging, and
+// MergeBuilder.Redact masks them in the output.
+type SensitiveOperator interface {
+	// Sensitive reports whether the results of the operator are secret
+	Sensitive() bool
+}
+
+// IsSensitive reports whether op declares its results secret
+func IsSensitive(op Operator) bool {
+	s, ok := op.(SensitiveOperator)
+	return ok && s.Sensitive()
+}
+
+// TaintSource is the sensitive operator call that a tainted value came from
+type TaintSource struct {
+	Path     string `json:"path" yaml:"path"`
+	Operator string `json:"operator" yaml:"operator"`
+	Source   string `json:"source" yaml:"source"`
+}
+
+// taintRead is a tainted value that the operator call being run has read or
+// produced. Under is where the tainted value lies beneath what was read.
+type taintRead struct {
+	under  []string
+	source TaintSource
+}
+
+// Redactor returns what to output in place of value, a scalar at path that
+// holds or derives from a secret
+type Redactor func(path string, value interface{}) interface{}
+
+// RedactSecrets is the Redactor used by MergeBuilder.Redact; it replaces
+// every secret with REDACTED
+func RedactSecrets(path string, value interface{}) interface{} {
+	return "REDACTED"
+}
+
+// TaintFrom is called by operators as they read the value at path out of
+// the tree. Whatever the operator call being run produces is tainted if the
+// value at path is, or holds anything that is.
+func (ev *Evaluator) TaintFrom(path *tree.Cursor) {
+	if ev == nil || path == nil || len(ev.taints) == 0 {
+		return
+	}
+	read := ev.taintPath(path)
+	for _, tainted := range sortedTaintPaths(ev.taints) {
+		if _, ok := beneathPath(read, tainted); ok {
+			ev.tainting = append(ev.tainting, taintRead{source: ev.taints[tainted]})
+		} else if under, ok := beneathPath(tainted, read); ok {
+			ev.tainting = append(ev.tainting, taintRead{under: under, source: ev.taints[tainted]})
+		}
+	}
+}
+
+// ConcealDerived keeps value out of debug and trace logging if the operator
+// call being run has read a tainted value. Operators that transform their
+// arguments beyond recognition, like base64, call it before logging what
+// they produced.
+func (ev *Evaluator) ConcealDerived(value interface{}) {
+	if ev != nil && len(ev.tainting) > 0 {
+		concealValue(value)
+	}
+}
+
+// Taints returns the paths holding tainted values, each with the sensitive
+// operator call its value came from
+func (ev *Evaluator) Taints() map[string]TaintSource {
+	return copyTaints(ev.taints)
+}
+
+// taintCall notes that op, a sensitive operator call, produced value
+func (ev *Evaluator) taintCall(op *Opcall, value interface{}) {
+	source := TaintSource{Operator: op.Name(), Source: op.src}
+	if op.where != nil {
+		source.Path = op.where.String()
+	}
+	if source.Source == "" {
+		args := []string{source.Operator}
+		for _, arg := range op.args {
+			args = append(args, traceExpr(arg))
+		}
+		source.Source = "(( " + strings.Join(args, " ") + " ))"
+	}
+	ev.tainting = append(ev.tainting, taintRead{source: source})
+	concealValue(value)
+}
+
+// recordTaint taints the values op wrote with whatever tainted values it
+// read or produced while it ran. Values that op replaced are untainted.
+func (ev *Evaluator) recordTaint(op *Opcall, resp *Response) {
+	reads := ev.tainting
+	ev.tainting = nil
+	if op.where == nil || (len(reads) == 0 && len(ev.taints) == 0) {
+		return
+	}
+
+	switch resp.Type {
+	case Replace:
+		where := ev.taintPath(op.where)
+		for path := range ev.taints {
+			if _, ok := beneathPath(path, where); ok {
+				delete(ev.taints, path)
+			}
+		}
+		for _, read := range reads {
+			ev.taint(where, resp.Value, read)
+		}
+
+	case Inject:
+		parent := op.where.Copy()
+		parent.Pop()
+		at := ev.taintPath(parent)
+		injected, ok := resp.Value.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		for k, v := range injected {
+			key := fmt.Sprintf("%v", k)
+			for _, read := range reads {
+				if len(read.under) == 0 {
+					ev.taint(joinKeyPath(at, key), v, read)
+				} else if read.under[0] == key {
+					ev.taint(joinKeyPath(at, key), v, taintRead{under: read.under[1:], source: read.source})
+				}
+			}
+		}
+	}
+}
+
+// taint marks value, written at where, as tainted by read: the part of it
+// beneath read.under if value still holds it, or else all of it
+func (ev *Evaluator) taint(where string, value interface{}, read taintRead) {
+	path, tainted := where, value
+	if len(read.under) > 0 {
+		if v, ok := valueBeneath(value, read.under); ok {
+			path, tainted = joinKeyPath(where, strings.Join(read.under, ".")), v
+		}
+	}
+	if ev.taints == nil {
+		ev.taints = map[string]TaintSource{}
+	}
+	if _, exists := ev.taints[path]; !exists {
+		ev.taints[path] = read.source
+	}
+	concealValue(tainted)
+
+	// a map or list grabbed before the secret was written into it is shared
+	// with the place it was grabbed to, which holds the secret as well
+	keys := strings.Split(path, ".")
+	if len(keys) < 2 {
+		return
+	}
+	parent, ok := valueBeneath(ev.Tree, keys[:len(keys)-1])
+	if !ok {
+		return
+	}
+	for _, alias := range sharedPaths(ev.Tree, parent) {
+		aliased := joinKeyPath(alias, keys[len(keys)-1])
+		if _, exists := ev.taints[aliased]; !exists {
+			ev.taints[aliased] = read.source
+		}
+	}
+}
+
+// sharedPaths lists the paths in data that hold container, a map or list,
+// itself rather than a copy of it
+func sharedPaths(data map[interface{}]interface{}, container interface{}) []string {
+	var ptr uintptr
+	switch c := container.(type) {
+	case map[interface{}]interface{}:
+		ptr = reflect.ValueOf(c).Pointer()
+	case []interface{}:
+		if len(c) == 0 {
+			return nil
+		}
+		ptr = reflect.ValueOf(c).Pointer()
+	default:
+		return nil
+	}
+
+	var paths []string
+	var walk func(value interface{}, path string)
+	walk = func(value interface{}, path string) {
+		switch v := value.(type) {
+		case map[interface{}]interface{}:
+			if path != "" && reflect.ValueOf(v).Pointer() == ptr {
+				paths = append(paths, path)
+				return
+			}
+			for k, sub := range v {
+				walk(sub, joinKeyPath(path, fmt.Sprintf("%v", k)))
+			}
+		case []interface{}:
+			if len(v) > 0 && reflect.ValueOf(v).Pointer() == ptr {
+				paths = append(paths, path)
+				return
+			}
+			for i, sub := range v {
+				walk(sub, joinKeyPath(path, nameOfObj(sub, strconv.Itoa(i))))
+			}
+		}
+	}
+	walk(data, "")
+	return paths
+}
+
+// taintPath is the form of path that taints are recorded under, the same as
+// provenance: list entries are named when they have a name, so that taints
+// survive the lists being sorted or pruned after evaluation
+func (ev *Evaluator) taintPath(path *tree.Cursor) string {
+	if canonical, err := canonicalSourcePath(ev.Tree, path.String()); err == nil {
+		return canonical
+	}
+	return path.String()
+}
+
+// traceable is resp as the evaluation trace may record it, with the value
+// masked if it is tainted
+func (ev *Evaluator) traceable(resp *Response) *Response {
+	if resp == nil || len(ev.tainting) == 0 {
+		return resp
+	}
+	return &Response{Type: resp.Type, Value: redactValue("", resp.Value, RedactSecrets)}
+}
+
+// beneathPath reports whether path is root or lies beneath it, and if so
+// the keys that lead from root to path
+func beneathPath(path, root string) ([]string, bool) {
+	switch {
+	case root == "":
+		if path == "" {
+			return nil, true
+		}
+		return strings.Split(path, "."), true
+	case path == root:
+		return nil, true
+	case strings.HasPrefix(path, root+"."):
+		return strings.Split(strings.TrimPrefix(path, root+"."), "."), true
+	}
+	return nil, false
+}
+
+// valueBeneath returns what value holds at keys, list entries being found
+// by name or index
+func valueBeneath(value interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		switch v := value.(type) {
+		case map[interface{}]interface{}:
+			found := false
+			for k, sub := range v {
+				if fmt.Sprintf("%v", k) == key {
+					value, found = sub, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		case []interface{}:
+			i := listEntry(v, key)
+			if i < 0 {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// listEntry returns the index of the entry of list named key, or at index
+// key, or -1 if there is none
+func listEntry(list []interface{}, key string) int {
+	for i, item := range list {
+		if nameOfObj(item, "") == key {
+			return i
+		}
+	}
+	if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(list) {
+		return i
+	}
+	return -1
+}
+
+// concealValue keeps the strings in value out of debug and trace logging
+func concealValue(value interface{}) {
+	switch v := value.(type) {
+	case string:
+		log.Conceal(v)
+	case map[interface{}]interface{}:
+		for _, sub := range v {
+			concealValue(sub)
+		}
+	case map[string]interface{}:
+		for _, sub := range v {
+			concealValue(sub)
+		}
+	case []interface{}:
+		for _, sub := range v {
+			concealValue(sub)
+		}
+	}
+}
+
+// redactValue returns a copy of value, found at path, with each scalar in it
+// replaced by what redactor returns
+func redactValue(path string, value interface{}, redactor Redactor) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		redacted := make(map[interface{}]interface{}, len(v))
+		for k, sub := range v {
+			redacted[k] = redactValue(joinKeyPath(path, fmt.Sprintf("%v", k)), sub, redactor)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, sub := range v {
+			redacted[i] = redactValue(joinKeyPath(path, strconv.Itoa(i)), sub, redactor)
+		}
+		return redacted
+	}
+	return redactor(path, value)
+}
+
+// redactTree masks each tainted value in data, in place
+func redactTree(data map[interface{}]interface{}, taints map[string]TaintSource, redactor Redactor) {
+	for _, path := range sortedTaintPaths(taints) {
+		keys := strings.Split(path, ".")
+		parent, ok := valueBeneath(data, keys[:len(keys)-1])
+		if !ok {
+			continue // pruned, or left out by a cherry-pick
+		}
+		key := keys[len(keys)-1]
+		switch p := parent.(type) {
+		case map[interface{}]interface{}:
+			for k, v := range p {
+				if fmt.Sprintf("%v", k) == key {
+					p[k] = redactValue(path, v, redactor)
+					break
+				}
+			}
+		case []interface{}:
+			if i := listEntry(p, key); i >= 0 {
+				p[i] = redactValue(path, p[i], redactor)
+			}
+		}
+	}
+}
+
+// sortedTaintPaths lists the paths of taints in order
+func sortedTaintPaths(taints map[string]TaintSource) []string {
+	paths := make([]string, 0, len(taints))
+	for path := range taints {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// copyTaints returns an independent copy of taints
+func copyTaints(taints map[string]TaintSource) map[string]TaintSource {
+	copied := make(map[string]TaintSource, len(taints))
+	for path, source := range taints {
+		copied[path] = source
+	}
+	return copied
+}
+
+// documentTaints returns the taints recorded when doc was evaluated
+func documentTaints(doc Document) map[string]TaintSource {
+	if d, ok := doc.(*document); ok {
+		return d.taints
+	}
+	return nil
+}
+
+// withTaints attaches taints to doc
+func withTaints(doc Document, taints map[string]TaintSource) Document {
+	d, ok := doc.(*document)
+	if !ok {
+		return doc
+	}
+	withTaint := d.withData(d.data)
+	withTaint.taints = taints
+	return withTaint
+}
+
+// Tainted returns the paths whose values came from a sensitive operator
+// call, or were derived from one, each with the call it came from
+func (d *document) Tainted() map[string]TaintSource {
+	tainted := map[string]TaintSource{}
+	for path, source := range d.taints {
+		// values pruned from the document no longer count
+		if _, ok := valueBeneath(d.data, strings.Split(path, ".")); ok {
+			tainted[path] = source
+		}
+	}
+	return tainted
+}
+
+// redacted returns a copy of doc with its tainted values masked by redactor
+func redacted(doc Document, redactor Redactor) Document {
+	d, ok := doc.(*document)
+	if !ok || len(d.taints) == 0 {
+		return doc
+	}
+	data, _ := deepCopy(d.data).(map[interface{}]interface{})
+	redactTree(data, d.taints, redactor)
+	return d.withData(data)
+}
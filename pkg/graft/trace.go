@@ -0,0 +1,234 @@
+package graft
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EvalTrace records every operator call an Evaluator runs: the arguments it
+// resolved, which side of each `||` won, and the value it produced. It is
+// filled in as a document is evaluated, see MergeBuilder.WithTrace.
+type EvalTrace struct {
+	mu      sync.Mutex
+	entries []*TraceEntry
+
+	// current is the operator call being run, and stack the arguments it is
+	// resolving, innermost last
+	current *TraceEntry
+	stack   []*TraceInput
+}
+
+// TraceEntry is a single operator call made during evaluation
+type TraceEntry struct {
+	Path     string        `json:"path"`
+	Operator string        `json:"operator"`
+	Source   string        `json:"source"`
+	Inputs   []*TraceInput `json:"inputs,omitempty"`
+	Value    interface{}   `json:"value,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// TraceInput is an argument an operator resolved. For `a || b`, Inputs holds
+// each alternative that was tried, and Chosen the one whose value was used.
+// For a nested operator call, Inputs holds the arguments that call resolved.
+type TraceInput struct {
+	Expr   string        `json:"expr"`
+	Value  interface{}   `json:"value,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	Chosen string        `json:"chosen,omitempty"`
+	Inputs []*TraceInput `json:"inputs,omitempty"`
+
+	or bool
+}
+
+// NewEvalTrace creates an empty trace
+func NewEvalTrace() *EvalTrace {
+	return &EvalTrace{}
+}
+
+// Entries returns the recorded operator calls, in the order they ran, whose
+// path is prefix or lies beneath it. An empty prefix returns every call.
+func (t *EvalTrace) Entries(prefix string) []*TraceEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prefix = strings.TrimPrefix(prefix, "$.")
+	var entries []*TraceEntry
+	for _, e := range t.entries {
+		if prefix == "" || e.Path == prefix || strings.HasPrefix(e.Path, prefix+".") {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// begin starts recording the call op
+func (t *EvalTrace) begin(op *Opcall) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	path := "<generated>"
+	if op.where != nil {
+		path = op.where.String()
+	}
+	t.current = &TraceEntry{Path: path, Operator: op.Name(), Source: op.src}
+	t.stack = nil
+}
+
+// end finishes recording the current call with its outcome
+func (t *EvalTrace) end(resp *Response, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current == nil {
+		return
+	}
+	if err != nil {
+		t.current.Error = err.Error()
+	} else if resp != nil {
+		t.current.Value = traceValue(resp.Value)
+	}
+	t.entries = append(t.entries, t.current)
+	t.current = nil
+	t.stack = nil
+}
+
+// push starts recording the resolution of arg, returning the function that
+// records its result
+func (t *EvalTrace) push(arg *Expr) func(interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current == nil {
+		return func(interface{}, error) {}
+	}
+
+	input := &TraceInput{Expr: traceExpr(arg), or: arg != nil && arg.Type == LogicalOr}
+	if n := len(t.stack); n > 0 {
+		t.stack[n-1].Inputs = append(t.stack[n-1].Inputs, input)
+	} else {
+		t.current.Inputs = append(t.current.Inputs, input)
+	}
+	t.stack = append(t.stack, input)
+
+	return func(value interface{}, err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.pop(input, value, err)
+	}
+}
+
+func (t *EvalTrace) pop(input *TraceInput, value interface{}, err error) {
+	if n := len(t.stack); n > 0 && t.stack[n-1] == input {
+		t.stack = t.stack[:n-1]
+	}
+
+	if err != nil {
+		input.Error = err.Error()
+	} else {
+		input.Value = traceValue(value)
+	}
+
+	if !input.or {
+		return
+	}
+
+	// a || b || c nests as a || (b || c); list the alternatives side by side
+	var alternatives []*TraceInput
+	for _, alt := range input.Inputs {
+		if alt.or {
+			alternatives = append(alternatives, alt.Inputs...)
+		} else {
+			alternatives = append(alternatives, alt)
+		}
+	}
+	input.Inputs = alternatives
+	if err == nil {
+		for _, alt := range alternatives {
+			if alt.Error == "" {
+				input.Chosen = alt.Expr
+				break
+			}
+		}
+	}
+}
+
+// IsAlternatives reports whether input is a `||`, whose Inputs are the
+// alternatives that were tried
+func (input *TraceInput) IsAlternatives() bool {
+	return input.or
+}
+
+// TraceArgument is called by operators as they resolve one of their
+// arguments. The returned function must be called with the result. Both do
+// nothing unless the evaluator is recording a trace.
+func (ev *Evaluator) TraceArgument(arg *Expr) func(interface{}, error) {
+	if ev == nil || ev.Trace == nil {
+		return func(interface{}, error) {}
+	}
+	tainted := len(ev.tainting)
+	done := ev.Trace.push(arg)
+	return func(value interface{}, err error) {
+		// arguments that read or produced a secret are never recorded
+		if len(ev.tainting) > tainted {
+			value = redactValue("", value, RedactSecrets)
+		}
+		done(value, err)
+	}
+}
+
+// traceExpr renders an argument the way it would be written in a template
+func traceExpr(e *Expr) string {
+	if e == nil {
+		return "nil"
+	}
+	switch e.Type {
+	case Literal:
+		if s, ok := e.Literal.(string); ok {
+			return strconv.Quote(s)
+		}
+		if e.Literal == nil {
+			return "nil"
+		}
+		return fmt.Sprintf("%v", e.Literal)
+	case LogicalOr:
+		return traceExpr(e.Left) + " || " + traceExpr(e.Right)
+	case OperatorCall:
+		args := []string{e.Operator}
+		for _, arg := range e.Args() {
+			args = append(args, traceExpr(arg))
+		}
+		return "(( " + strings.Join(args, " ") + " ))"
+	default:
+		return e.String()
+	}
+}
+
+// traceValue copies value into a form that can be written as JSON, so that
+// later changes to the tree do not change what was recorded
+func traceValue(value interface{}) interface{} {
+	copied, err := deinterface(value, false)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return copied
+}
+
+type evalTraceKey struct{}
+
+// WithEvalTrace returns a context that makes the engine record its
+// evaluation into trace
+func WithEvalTrace(ctx context.Context, trace *EvalTrace) context.Context {
+	return context.WithValue(ctx, evalTraceKey{}, trace)
+}
+
+// GetEvalTrace returns the trace set by WithEvalTrace, if any
+func GetEvalTrace(ctx context.Context) *EvalTrace {
+	if trace, ok := ctx.Value(evalTraceKey{}).(*EvalTrace); ok {
+		return trace
+	}
+	return nil
+}
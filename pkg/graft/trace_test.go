@@ -0,0 +1,63 @@
+package graft
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvalTrace(t *testing.T) {
+	Convey("EvalTrace", t, func() {
+		engine, err := NewEngine()
+		So(err, ShouldBeNil)
+
+		doc, err := engine.ParseYAML([]byte(`meta:
+  name: web
+  size: (( grab meta.sizes.large || meta.sizes.small || "tiny" ))
+jobs:
+- name: web
+  name_copy: (( grab meta.name ))
+`))
+		So(err, ShouldBeNil)
+
+		trace := NewEvalTrace()
+		_, err = engine.Merge(context.Background(), doc).WithTrace(trace).Execute()
+		So(err, ShouldBeNil)
+
+		Convey("records each operator call with the value it produced", func() {
+			entries := trace.Entries("")
+			So(entries, ShouldHaveLength, 2)
+
+			paths := []string{entries[0].Path, entries[1].Path}
+			So(paths, ShouldContain, "meta.size")
+			So(paths, ShouldContain, "jobs.web.name_copy")
+		})
+
+		Convey("records which alternative of a || was used", func() {
+			entries := trace.Entries("$.meta")
+			So(entries, ShouldHaveLength, 1)
+
+			e := entries[0]
+			So(e.Operator, ShouldEqual, "grab")
+			So(e.Source, ShouldEqual, `(( grab meta.sizes.large || meta.sizes.small || "tiny" ))`)
+			So(e.Value, ShouldEqual, "tiny")
+			So(e.Inputs, ShouldHaveLength, 1)
+
+			or := e.Inputs[0]
+			So(or.IsAlternatives(), ShouldBeTrue)
+			So(or.Chosen, ShouldEqual, `"tiny"`)
+			So(or.Inputs, ShouldHaveLength, 3)
+			So(or.Inputs[0].Expr, ShouldEqual, "meta.sizes.large")
+			So(or.Inputs[0].Error, ShouldNotBeEmpty)
+			So(or.Inputs[1].Expr, ShouldEqual, "meta.sizes.small")
+			So(or.Inputs[2].Value, ShouldEqual, "tiny")
+		})
+
+		Convey("filters by path prefix", func() {
+			So(trace.Entries("jobs"), ShouldHaveLength, 1)
+			So(trace.Entries("jobs.web.name_copy"), ShouldHaveLength, 1)
+			So(trace.Entries("job"), ShouldBeEmpty)
+		})
+	})
+}